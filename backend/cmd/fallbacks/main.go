@@ -0,0 +1,55 @@
+// fallbacks 通过 Google 街景元数据查找兜底全景列表中没有 pano_id 的条目，把全景 ID、坐标、拍摄日期和版权信息写回文件
+//
+// 写入 pano_id 的条目在 Google 不可用或配额用完时也能直接使用，不再请求上游。
+// 需要 GOOGLE_API_KEY（以及可选的 GOOGLE_MAPS_SIGNING_SECRET），每个条目消耗一次街景元数据请求。
+//
+// 用法：
+//
+//	go run ./cmd/fallbacks [-file internal/services/fallback_panoramas.json]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/config"
+	"github.com/my-streetview-project/backend/internal/services"
+)
+
+func main() {
+	cfg := config.New()
+
+	path := flag.String("file", "internal/services/fallback_panoramas.json", "兜底全景列表文件")
+	flag.Parse()
+
+	fallbacks, err := services.LoadFallbackSet(*path)
+	if err != nil {
+		log.Fatalf("加载兜底全景列表失败: %v", err)
+	}
+
+	provider, err := services.NewGoogleStreetViewProvider(cfg.GoogleMapsAPIKey(), cfg.GoogleMapsSigningSecret(), cfg.GoogleMapsBaseURL(), nil)
+	if err != nil {
+		log.Fatalf("创建街景数据源失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	pinned, err := fallbacks.Pin(ctx, provider)
+	if err != nil {
+		// 部分条目查找失败时仍然写回已查找到的条目
+		log.Printf("部分条目查找失败: %v", err)
+	}
+
+	data, err := fallbacks.Encode()
+	if err != nil {
+		log.Fatalf("编码兜底全景列表失败: %v", err)
+	}
+	if err := os.WriteFile(*path, data, 0o644); err != nil {
+		log.Fatalf("写入兜底全景列表失败: %v", err)
+	}
+	log.Printf("已写入 %d 个条目的全景 ID: %s", pinned, *path)
+}
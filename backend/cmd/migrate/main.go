@@ -0,0 +1,154 @@
+// migrate 将 Redis 中已有的位置信息、探索偏好、AI 描述、追问对话、逆地理编码缓存和街景图片缓存复制到 bbolt 嵌入式数据库
+//
+// 已过期的缓存和追问对话不迁移，追问计数按对话中记录的用量重建。限流计数、Google API 用量计数和预生成位置池只在当前统计窗口或运行期间有意义，也不迁移。
+//
+// 用法：
+//
+//	go run ./cmd/migrate [-redis localhost:6379] [-redis-db 0] [-bolt data/streetview.db]
+//
+// Redis 密码从 REDIS_PASSWORD 读取，也可以用 -redis-password 指定。迁移只读取 Redis，不写入源数据库。
+// 迁移期间请停止使用同一数据库文件的服务进程，bbolt 同一时间只允许一个进程打开。
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/config"
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/repositories"
+)
+
+// redisSource 源 Redis 的连接参数
+type redisSource struct {
+	address  string
+	password string
+	db       int
+}
+
+func (s redisSource) RedisAddress() string  { return s.address }
+func (s redisSource) RedisPassword() string { return s.password }
+func (s redisSource) RedisDB() int          { return s.db }
+
+type boltPath string
+
+func (p boltPath) BoltPath() string { return string(p) }
+
+func main() {
+	cfg := config.New()
+
+	redisAddr := flag.String("redis", cfg.RedisAddress(), "源 Redis 地址")
+	redisPassword := flag.String("redis-password", cfg.RedisPassword(), "源 Redis 密码")
+	redisDB := flag.Int("redis-db", cfg.RedisDB(), "源 Redis 数据库编号")
+	dbPath := flag.String("bolt", cfg.BoltPath(), "目标 bbolt 数据库文件")
+	flag.Parse()
+
+	// 不使用 NewRedisRepository，它会在源数据库中补建位置索引
+	redisRepo, err := repositories.OpenRedisRepository(redisSource{address: *redisAddr, password: *redisPassword, db: *redisDB})
+	if err != nil {
+		log.Fatalf("连接 Redis 失败: %v", err)
+	}
+
+	target, err := repositories.NewBoltRepository(boltPath(*dbPath))
+	if err != nil {
+		log.Fatalf("打开 bbolt 数据库失败: %v", err)
+	}
+	defer target.Close()
+
+	log.Printf("开始迁移: %s -> %s", *redisAddr, *dbPath)
+	ctx := context.Background()
+
+	// step 执行一类数据的迁移并输出迁移数量，失败时退出
+	step := func(name string, scan func(count *int) error) {
+		count := 0
+		if err := scan(&count); err != nil {
+			log.Fatalf("迁移%s失败（已迁移 %d 条）: %v", name, count, err)
+		}
+		log.Printf("已迁移%s: %d 条", name, count)
+	}
+	now := time.Now()
+
+	step("位置信息", func(count *int) error {
+		return redisRepo.ScanLocations(ctx, func(location models.Location) error {
+			if location.PanoID == "" {
+				return nil
+			}
+			if err := target.SaveLocation(ctx, location); err != nil {
+				return err
+			}
+			*count++
+			return nil
+		})
+	})
+
+	step("探索偏好", func(count *int) error {
+		return redisRepo.ScanExplorationPreferences(ctx, func(sessionID string, pref models.ExplorationPreference) error {
+			if err := target.SaveExplorationPreference(ctx, sessionID, pref); err != nil {
+				return err
+			}
+			*count++
+			return nil
+		})
+	})
+
+	step("AI 描述", func(count *int) error {
+		return redisRepo.ScanDescriptions(ctx, func(desc models.LocationDescription) error {
+			if err := target.SaveDescription(ctx, desc); err != nil {
+				return err
+			}
+			*count++
+			return nil
+		})
+	})
+
+	step("追问对话", func(count *int) error {
+		return redisRepo.ScanChatThreads(ctx, func(thread models.ChatThread) error {
+			if thread.Expired(now) {
+				return nil
+			}
+			if err := target.SaveChatThread(ctx, thread); err != nil {
+				return err
+			}
+			// 追问次数和 token 用量以单独的计数为准，按对话中记录的用量重建
+			var ttl time.Duration
+			if !thread.ExpiresAt.IsZero() {
+				ttl = thread.ExpiresAt.Sub(now)
+			}
+			if _, err := target.AddChatUsage(ctx, thread.SessionID, thread.PanoID, thread.Turns, thread.TokensUsed, ttl); err != nil {
+				return err
+			}
+			*count++
+			return nil
+		})
+	})
+
+	step("逆地理编码缓存", func(count *int) error {
+		return redisRepo.ScanGeocodes(ctx, func(entry models.GeocodeCacheEntry) error {
+			if !now.Before(entry.ExpiresAt) {
+				return nil
+			}
+			if err := target.SaveGeocode(ctx, entry); err != nil {
+				return err
+			}
+			*count++
+			return nil
+		})
+	})
+
+	step("街景图片缓存", func(count *int) error {
+		return redisRepo.ScanStreetViewImages(ctx, func(entry models.StreetViewImageCacheEntry) error {
+			if !now.Before(entry.ExpiresAt) {
+				return nil
+			}
+			if err := target.SaveStreetViewImage(ctx, entry); err != nil {
+				return err
+			}
+			*count++
+			return nil
+		})
+	})
+
+	log.Printf("迁移完成")
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -93,24 +98,71 @@ func main() {
 		}
 	}
 
-	// 初始化 Redis 仓库 (this also initializes a redis client)
-	repo, err := repositories.NewRedisRepository(cfg)
+	// 初始化仓库（根据 STORAGE_BACKEND 选择 Redis、bbolt 或内存存储）
+	repo, err := repositories.NewRepository(cfg)
 	if err != nil {
 		log.Fatalf("初始化仓库失败: %v", err)
 	}
+	log.Printf("使用存储后端: %s", cfg.StorageBackend())
+
+	// 收到 SIGINT / SIGTERM 时停止后台任务并关闭服务
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// 初始化服务
-	aiService, err := services.NewAIService(cfg, repo)
-	if err != nil {
-		log.Fatalf("初始化 AI 服务失败: %v", err)
+	// 禁用 Google API 时使用合成街景和离线地理编码，无需 API Key 和网络
+	var mapsService *services.MapsService
+	var geocodeCache *services.GeocodeCache
+	var quota *services.QuotaTracker
+	var images *services.StreetViewImageService
+	if cfg.EnableGoogleAPI() {
+		var err error
+		mapsService, err = services.NewMapsService(cfg.GoogleMapsAPIKey(), cfg.GoogleMapsSigningSecret(), cfg.GoogleMapsBaseURL())
+		if err != nil {
+			log.Fatalf("初始化 Maps 服务失败: %v", err)
+		}
+		if path := cfg.StreetViewFallbackFile(); path != "" {
+			fallbacks, err := services.LoadFallbackSet(path)
+			if err != nil {
+				log.Fatalf("加载兜底全景列表失败: %v", err)
+			}
+			mapsService.SetFallbacks(fallbacks)
+		}
+		// 位置生成和描述生成共用 Google API 预算
+		metadataDaily, metadataMonthly := cfg.StreetViewMetadataBudget()
+		geocodeDaily, geocodeMonthly := cfg.GeocodeBudget()
+		imageDaily, imageMonthly := cfg.StreetViewImageBudget()
+		quota = services.NewQuotaTracker(repo, map[string]services.QuotaBudget{
+			services.APIStreetViewMetadata: {Daily: int64(metadataDaily), Monthly: int64(metadataMonthly)},
+			services.APIGeocode:            {Daily: int64(geocodeDaily), Monthly: int64(geocodeMonthly)},
+			services.APIStreetViewImage:    {Daily: int64(imageDaily), Monthly: int64(imageMonthly)},
+		})
+		mapsService.SetQuota(quota)
+		// 位置生成和描述生成共用逆地理编码缓存
+		if cfg.GeocodeCacheTTL() > 0 {
+			geocodeCache = services.NewGeocodeCache(repo, cfg.GeocodeCachePrecision(), cfg.GeocodeCacheTTL())
+			mapsService.SetGeocodeCache(geocodeCache)
+		}
+		// 街景图片由服务端请求并缓存，客户端无需持有 API Key
+		images = services.NewStreetViewImageService(mapsService, repo, cfg.StreetViewImageCacheTTL(), int64(cfg.StreetViewImageMaxBytes()))
 	}
 
-	mapsService, err := services.NewMapsService(cfg.GoogleMapsAPIKey())
-	if err != nil {
-		log.Fatalf("初始化 Maps 服务失败: %v", err)
+	// 描述生成与位置生成共用同一个 MapsService
+	aiService := services.NewAIService(cfg, repo, mapsService)
+	var locationService *services.LocationService
+	if mapsService != nil {
+		locationService = services.NewLocationService(repo, aiService, mapsService)
+	} else {
+		locationService = services.NewOfflineLocationService(repo, aiService)
+		log.Printf("Google API 已禁用，使用合成街景和离线地理编码")
 	}
 
-	locationService := services.NewLocationService(repo, aiService, mapsService)
+	// 后台预生成随机位置，请求时直接从池中取出
+	locationService.StartLocationPool(ctx, services.PoolConfig{
+		Size:           cfg.LocationPoolSize(),
+		LowWater:       cfg.LocationPoolLowWater(),
+		RefillInterval: cfg.LocationPoolRefillInterval(),
+	})
 
 	// 设置 Gin 路由
 	if cfg.SecurityConfig().RateLimit.Enabled {
@@ -127,12 +179,7 @@ func main() {
 
 	// 根据配置启用限流
 	if cfg.SecurityConfig().RateLimit.Enabled {
-		// Get Redis client from repository
-		redisClientForRateLimit := repo.GetRedisClient()
-		if redisClientForRateLimit == nil { // Should not happen if repo initialized correctly
-			log.Fatalf("无法从仓库获取Redis客户端用于限流")
-		}
-		r.Use(api.RateLimitMiddleware(redisClientForRateLimit))
+		r.Use(api.RateLimitMiddleware(repo))
 	}
 
 	r.Use(api.InputValidationMiddleware())
@@ -155,10 +202,24 @@ func main() {
 			}
 		}
 
+		// 兜底全景使用次数，离线模式不使用兜底全景
+		metrics := map[string]interface{}{}
+		if mapsService != nil {
+			metrics["streetview_fallback"] = mapsService.FallbackStats()
+		}
+		if geocodeCache != nil {
+			metrics["geocode_cache"] = geocodeCache.Stats()
+		}
+
 		c.JSON(200, gin.H{
-			"status": "ok",
+			"status":  "ok",
+			"metrics": metrics,
 			"config": map[string]interface{}{
 				"rate_limit_enabled": cfg.SecurityConfig().RateLimit.Enabled,
+				"storage_backend":    cfg.StorageBackend(),
+				"offline_mode":       cfg.OfflineMode(),
+				"ai_enabled":         cfg.EnableOpenAI(),
+				"google_api_enabled": cfg.EnableGoogleAPI(),
 				"cors_origins":       cfg.SecurityConfig().CORS.AllowedOrigins,
 				"proxy_enabled":      cfg.ProxyURL() != "",
 				"proxy_type":         os.Getenv("PROXY_TYPE"),
@@ -173,8 +234,9 @@ func main() {
 	r.GET("/test/sentry", mysentry.TestSentry())
 
 	// 设置路由
-	handlers := api.NewHandlers(locationService, aiService)
+	handlers := api.NewHandlers(locationService, aiService, images)
 	api.SetupRoutes(r, handlers)
+	api.SetupAdminRoutes(r, api.NewAdminHandlers(quota), cfg.AdminToken())
 
 	addr := cfg.ServerAddress()
 	logger := utils.SystemLogger()
@@ -186,10 +248,28 @@ func main() {
 	})
 
 	fmt.Printf("服务器运行在 %s\n", addr)
-	if err := r.Run(addr); err != nil {
-		logger.Error("server_failed", "Server failed to start", err, map[string]interface{}{
-			"address": addr,
-		})
-		log.Fatalf("服务器运行失败: %v", err)
+	srv := &http.Server{Addr: addr, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("server_failed", "Server failed to start", err, map[string]interface{}{
+				"address": addr,
+			})
+			log.Fatalf("服务器运行失败: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Info("server_stopping", "Shutting down HTTP server", nil)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("server_shutdown_failed", "Failed to shut down HTTP server gracefully", err, nil)
+	}
+
+	// 关闭 bbolt 数据库文件，释放文件锁，其他进程（例如迁移工具）才能打开
+	if closer, ok := repo.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Error("repository_close_failed", "Failed to close repository", err, nil)
+		}
 	}
 }
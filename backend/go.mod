@@ -9,6 +9,9 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/paulmach/orb v0.11.1
 	github.com/redis/go-redis/v9 v9.7.0
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/sync v0.10.0
+	golang.org/x/text v0.21.0
 	googlemaps.github.io/maps v1.7.0
 )
 
@@ -41,7 +44,6 @@ require (
 	golang.org/x/crypto v0.31.0 // indirect
 	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
-	golang.org/x/text v0.21.0 // indirect
 	golang.org/x/time v0.0.0-20200416051211-89c76fbcd5d1 // indirect
 	google.golang.org/protobuf v1.34.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
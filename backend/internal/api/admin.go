@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/my-streetview-project/backend/internal/services"
+)
+
+// AdminHandlers 管理接口
+type AdminHandlers struct {
+	quota *services.QuotaTracker
+}
+
+// NewAdminHandlers 创建管理接口，quota 为 nil（未启用 Google API）时用量列表为空
+func NewAdminHandlers(quota *services.QuotaTracker) *AdminHandlers {
+	return &AdminHandlers{quota: quota}
+}
+
+// GetUsage 返回各 Google API 在当前统计日和统计月的请求次数、预算以及是否处于降级模式
+func (h *AdminHandlers) GetUsage(c *gin.Context) {
+	usage := h.quota.Usage(c.Request.Context())
+	if usage == nil {
+		usage = []services.APIUsage{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"usage": usage,
+		},
+	})
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		status int
+	}{
+		{"未配置令牌时不注册", "", "Bearer secret", http.StatusNotFound},
+		{"缺少令牌", "secret", "", http.StatusUnauthorized},
+		{"令牌错误", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"令牌正确", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			SetupAdminRoutes(r, NewAdminHandlers(nil), tt.token)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/usage", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("状态码为 %d，期望 %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
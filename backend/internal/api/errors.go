@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,16 +9,26 @@ import (
 	"github.com/getsentry/sentry-go"
 	sentrygin "github.com/getsentry/sentry-go/gin"
 	"github.com/gin-gonic/gin"
+	"github.com/my-streetview-project/backend/internal/i18n"
+	"github.com/my-streetview-project/backend/internal/models"
 )
 
 // ErrorResponse 定义统一的错误响应结构
+// Message 为空时按 key（没有时按 Code）从消息目录中取出请求语言对应的说明
 type ErrorResponse struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	Status  int    `json:"-"` // HTTP 状态码，为 0 时按 400 处理
+
+	key  string        // 消息目录中更具体的消息码
+	args []interface{} // 消息的格式化参数
 }
 
 // Error 实现 error 接口
 func (e *ErrorResponse) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: %s", e.Code, i18n.T(i18n.DefaultLanguage, e.messageKey(), e.args...))
+	}
 	return fmt.Sprintf("%s: %s", e.Code, e.Message)
 }
 
@@ -29,30 +40,153 @@ func NewErrorResponse(code, message string) *ErrorResponse {
 	}
 }
 
-// 预定义错误类型
+// WithKey 返回使用更具体的消息码的副本，预定义错误本身不会被修改
+func (e *ErrorResponse) WithKey(key string, args ...interface{}) *ErrorResponse {
+	copied := *e
+	copied.Message = ""
+	copied.key = key
+	copied.args = args
+	return &copied
+}
+
+// WithMessage 返回使用固定说明（例如模型给出的解释）的副本，该说明不经过消息目录
+func (e *ErrorResponse) WithMessage(message string) *ErrorResponse {
+	copied := *e
+	copied.Message = message
+	return &copied
+}
+
+// Localize 返回说明已翻译为 lang 的副本
+func (e *ErrorResponse) Localize(lang string) *ErrorResponse {
+	if e.Message != "" {
+		return e
+	}
+	copied := *e
+	copied.Message = i18n.T(lang, e.messageKey(), e.args...)
+	return &copied
+}
+
+// messageKey 目录中有具体消息码时使用它，否则使用错误码
+func (e *ErrorResponse) messageKey() string {
+	if e.key != "" && i18n.Has(e.key) {
+		return e.key
+	}
+	return e.Code
+}
+
+// 预定义错误类型，说明见消息目录
 var (
 	ErrInvalidInput = &ErrorResponse{
-		Code:    "INVALID_INPUT",
-		Message: "输入参数无效",
+		Code:   "INVALID_INPUT",
+		Status: http.StatusBadRequest,
 	}
 	ErrInternalServer = &ErrorResponse{
-		Code:    "INTERNAL_ERROR",
-		Message: "服务器内部错误",
+		Code:   "INTERNAL_ERROR",
+		Status: http.StatusInternalServerError,
 	}
 	ErrRateLimitExceeded = &ErrorResponse{
-		Code:    "RATE_LIMIT_EXCEEDED",
-		Message: "请求过于频繁，请稍后再试",
+		Code:   "RATE_LIMIT_EXCEEDED",
+		Status: http.StatusTooManyRequests,
 	}
 	ErrUnauthorized = &ErrorResponse{
-		Code:    "UNAUTHORIZED",
-		Message: "未授权的访问",
+		Code:   "UNAUTHORIZED",
+		Status: http.StatusUnauthorized,
 	}
 	ErrResourceNotFound = &ErrorResponse{
-		Code:    "NOT_FOUND",
-		Message: "请求的资源不存在",
+		Code:   "NOT_FOUND",
+		Status: http.StatusNotFound,
+	}
+	ErrTimeout = &ErrorResponse{
+		Code:   "TIMEOUT",
+		Status: http.StatusGatewayTimeout,
+	}
+	ErrUpstreamUnavailable = &ErrorResponse{
+		Code:   "UPSTREAM_UNAVAILABLE",
+		Status: http.StatusBadGateway,
+	}
+	ErrQuotaExhausted = &ErrorResponse{
+		Code:   "QUOTA_EXHAUSTED",
+		Status: http.StatusTooManyRequests,
+	}
+	ErrInvalidInterest = &ErrorResponse{
+		Code:   "INVALID_INTEREST",
+		Status: http.StatusUnprocessableEntity,
+	}
+	ErrNoStreetView = &ErrorResponse{
+		Code:   "NO_STREET_VIEW",
+		Status: http.StatusServiceUnavailable,
+	}
+	ErrPayloadTooLarge = &ErrorResponse{
+		Code:   "PAYLOAD_TOO_LARGE",
+		Status: http.StatusRequestEntityTooLarge,
 	}
 )
 
+// errorMappings 错误分类到错误响应的映射，按顺序匹配：
+// 超时、上游不可用和配额错误排在业务分类之前，例如 AI 超时导致的探索兴趣解析失败按超时响应
+var errorMappings = []struct {
+	kind     error
+	response *ErrorResponse
+}{
+	{models.ErrTimeout, ErrTimeout},
+	{models.ErrUpstreamUnavailable, ErrUpstreamUnavailable},
+	{models.ErrQuotaExhausted, ErrQuotaExhausted},
+	{models.ErrRateLimited, ErrRateLimitExceeded},
+	{models.ErrInvalidInput, ErrInvalidInput},
+	{models.ErrNotFound, ErrResourceNotFound},
+	{models.ErrInvalidInterest, ErrInvalidInterest},
+	{models.ErrNoStreetView, ErrNoStreetView},
+}
+
+// MapError 将错误映射为 HTTP 状态码和错误响应，说明在写出时才按请求语言翻译
+// 带分类的错误使用分类对应的错误码，错误携带消息码或用户可见说明时替换默认说明；未分类的错误按内部错误处理，不暴露细节
+func MapError(err error) (int, *ErrorResponse) {
+	var resp *ErrorResponse
+	if errors.As(err, &resp) {
+		if resp.Status == 0 {
+			return http.StatusBadRequest, resp
+		}
+		return resp.Status, resp
+	}
+
+	for _, m := range errorMappings {
+		if !errors.Is(err, m.kind) {
+			continue
+		}
+		switch code, message := models.Detail(err); {
+		case code != "":
+			return m.response.Status, m.response.WithKey(code)
+		case message != "":
+			return m.response.Status, m.response.WithMessage(message)
+		}
+		return m.response.Status, m.response
+	}
+
+	return ErrInternalServer.Status, ErrInternalServer
+}
+
+// respondError 按 MapError 的映射写出错误响应；客户端已断开时只记录 499
+func respondError(c *gin.Context, err error) {
+	if requestCanceled(c, err) {
+		c.AbortWithStatus(statusClientClosedRequest)
+		return
+	}
+	status, resp := MapError(err)
+	c.AbortWithStatusJSON(status, errorBody(c, resp, nil))
+}
+
+// errorBody 构造统一的错误响应体，说明翻译为请求语言，extra 中的字段与 success、error 并列返回
+func errorBody(c *gin.Context, resp *ErrorResponse, extra gin.H) gin.H {
+	body := gin.H{
+		"success": false,
+		"error":   resp.Localize(messageLanguage(c)),
+	}
+	for k, v := range extra {
+		body[k] = v
+	}
+	return body
+}
+
 // ErrorHandler 统一错误处理中间件
 func ErrorHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -86,27 +220,13 @@ func ErrorHandler() gin.HandlerFunc {
 				})
 			}
 
-			// 根据错误类型返回适当的响应
-			switch e := err.Err.(type) {
-			case *ErrorResponse:
-				c.JSON(http.StatusBadRequest, gin.H{
-					"success": false,
-					"error": gin.H{
-						"code":    e.Code,
-						"message": e.Message,
-					},
-				})
-			default:
+			// 根据错误分类返回适当的响应
+			status, resp := MapError(err.Err)
+			if resp == ErrInternalServer {
 				// 记录详细错误日志
 				log.Printf("未处理的错误: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"success": false,
-					"error": gin.H{
-						"code":    ErrInternalServer.Code,
-						"message": ErrInternalServer.Message,
-					},
-				})
 			}
+			c.JSON(status, errorBody(c, resp, nil))
 		}
 	}
 }
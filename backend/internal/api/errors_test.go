@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/my-streetview-project/backend/internal/models"
+)
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    string
+		message string
+	}{
+		{
+			name:   "包装后的超时",
+			err:    fmt.Errorf("AI 描述生成失败: %w", models.Classify(models.ErrTimeout, errors.New("AI 请求超时 (模型: m)"))),
+			status: http.StatusGatewayTimeout,
+			code:   ErrTimeout.Code,
+		},
+		{
+			name:    "带用户说明的配额错误",
+			err:     fmt.Errorf("追问失败: %w", models.NewError(models.ErrQuotaExhausted, "CHAT_TURN_LIMIT", "追问次数已达上限")),
+			status:  http.StatusTooManyRequests,
+			code:    ErrQuotaExhausted.Code,
+			message: "追问次数已达上限",
+		},
+		{
+			name:   "超时优先于探索兴趣无效",
+			err:    models.Classify(models.ErrInvalidInterest, fmt.Errorf("生成探索区域失败: %w", models.Classify(models.ErrTimeout, context.DeadlineExceeded))),
+			status: http.StatusGatewayTimeout,
+			code:   ErrTimeout.Code,
+		},
+		{
+			name:   "位置不存在",
+			err:    fmt.Errorf("获取位置信息失败: %w", models.NewError(models.ErrNotFound, "LOCATION_NOT_FOUND", "位置不存在")),
+			status: http.StatusNotFound,
+			code:   ErrResourceNotFound.Code,
+		},
+		{
+			name:    "预定义错误响应",
+			err:     ErrInvalidInput.WithKey("MISSING_COUNTRY"),
+			status:  http.StatusBadRequest,
+			code:    ErrInvalidInput.Code,
+			message: "缺少 country 参数",
+		},
+		{
+			name:    "模型给出的解释不经过消息目录",
+			err:     models.Classify(models.ErrInvalidInterest, fmt.Errorf("生成探索区域失败: %w", models.NewError(models.ErrInvalidInterest, "", "这不是一个地理主题"))),
+			status:  http.StatusUnprocessableEntity,
+			code:    ErrInvalidInterest.Code,
+			message: "这不是一个地理主题",
+		},
+		{
+			name:    "未分类错误不暴露细节",
+			err:     errors.New("dial tcp 10.0.0.1:6379: connection refused"),
+			status:  http.StatusInternalServerError,
+			code:    ErrInternalServer.Code,
+			message: "服务器内部错误",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := MapError(tt.err)
+			resp = resp.Localize("zh-CN")
+			if status != tt.status || resp.Code != tt.code {
+				t.Errorf("映射结果为 %d %s，期望 %d %s", status, resp.Code, tt.status, tt.code)
+			}
+			if tt.message != "" && resp.Message != tt.message {
+				t.Errorf("错误说明为 %q，期望 %q", resp.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestErrorResponseLocalize(t *testing.T) {
+	resp := ErrInvalidInput.WithKey("INVALID_QUESTION", 500)
+	if msg := resp.Localize("en").Message; msg != "The question must not be empty or longer than 500 characters" {
+		t.Errorf("英文说明不正确: %q", msg)
+	}
+	if msg := resp.Localize("zh").Message; msg != "问题不能为空且不能超过 500 个字符" {
+		t.Errorf("中文说明不正确: %q", msg)
+	}
+	// 目录中没有的消息码回退到错误码的说明
+	if msg := ErrTimeout.WithKey("NO_SUCH_KEY").Localize("en").Message; msg != "The request timed out, please try again later" {
+		t.Errorf("未知消息码应该回退到错误码的说明: %q", msg)
+	}
+	if ErrInvalidInput.Message != "" {
+		t.Error("翻译不应该修改预定义错误")
+	}
+}
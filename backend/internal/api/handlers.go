@@ -1,25 +1,103 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/my-streetview-project/backend/internal/i18n"
+	"github.com/my-streetview-project/backend/internal/models"
 	"github.com/my-streetview-project/backend/internal/services"
 	"github.com/my-streetview-project/backend/internal/utils"
 )
 
+// statusClientClosedRequest 客户端在响应返回前断开连接（沿用 nginx 的 499 约定）
+const statusClientClosedRequest = 499
+
 type Handlers struct {
 	locationService *services.LocationService
 	aiService       *services.AIService
+	images          *services.StreetViewImageService
 }
 
-func NewHandlers(locationService *services.LocationService, aiService *services.AIService) *Handlers {
+// NewHandlers 创建接口处理器，images 为 nil（未启用 Google API）时图片接口返回 NO_STREET_VIEW
+func NewHandlers(locationService *services.LocationService, aiService *services.AIService, images *services.StreetViewImageService) *Handlers {
 	return &Handlers{
 		locationService: locationService,
 		aiService:       aiService,
+		images:          images,
+	}
+}
+
+// requestCanceled 判断错误是否由客户端断开连接导致，此时下游调用已被取消，无需再写响应
+func requestCanceled(c *gin.Context, err error) bool {
+	return errors.Is(err, context.Canceled) && c.Request.Context().Err() != nil
+}
+
+// requestLanguage 返回请求语言的代码：?lang= 优先，其次协商 Accept-Language，都没有时使用默认语言
+// ?lang= 不是合法的 BCP-47 标签或不受支持时写出 400 并返回 false
+func requestLanguage(c *gin.Context) (string, bool) {
+	if tag := strings.TrimSpace(c.Query("lang")); tag != "" {
+		lang, err := i18n.ParseLanguage(tag)
+		switch {
+		case errors.Is(err, i18n.ErrInvalidLanguage):
+			respondError(c, ErrInvalidInput.WithKey("INVALID_LANGUAGE", tag))
+			return "", false
+		case err != nil:
+			respondError(c, ErrInvalidInput.WithKey("UNSUPPORTED_LANGUAGE", tag, strings.Join(supportedLanguageCodes(), ", ")))
+			return "", false
+		}
+		return lang.Code, true
+	}
+	if code := i18n.Negotiate(c.GetHeader("Accept-Language")); code != "" {
+		return code, true
+	}
+	return i18n.DefaultSupportedLanguage().Code, true
+}
+
+// messageLanguage 返回响应消息使用的语言，?lang= 无效时忽略
+func messageLanguage(c *gin.Context) string {
+	if lang, err := i18n.ParseLanguage(c.Query("lang")); err == nil {
+		return lang.Code
+	}
+	if code := i18n.Negotiate(c.GetHeader("Accept-Language")); code != "" {
+		return code
+	}
+	return i18n.DefaultLanguage
+}
+
+func supportedLanguageCodes() []string {
+	langs := i18n.SupportedLanguages()
+	codes := make([]string, len(langs))
+	for i, lang := range langs {
+		codes[i] = lang.Code
+	}
+	return codes
+}
+
+// ListLanguages 返回支持的界面和描述语言，第一个为默认语言
+func (h *Handlers) ListLanguages(c *gin.Context) {
+	langs := i18n.SupportedLanguages()
+	result := make([]gin.H, len(langs))
+	for i, lang := range langs {
+		result[i] = gin.H{
+			"code": lang.Code,
+			"name": lang.Name,
+		}
 	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"languages": result,
+		},
+	})
 }
 
 // 获取随机位置
@@ -27,25 +105,128 @@ func (h *Handlers) GetRandomLocation(c *gin.Context) {
 	// 从 gin.Context 获取会话 ID (由 SessionMiddleware 设置)
 	sessionIDInterface, exists := c.Get("sessionID")
 	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "无法获取会话ID"})
+		respondError(c, ErrInternalServer.WithKey("SESSION_MISSING"))
 		return
 	}
 	sessionID, ok := sessionIDInterface.(string)
 	if !ok || sessionID == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "无效的会话ID格式"})
+		respondError(c, ErrInternalServer.WithKey("SESSION_INVALID"))
+		return
+	}
+
+	language, ok := requestLanguage(c)
+	if !ok {
 		return
 	}
 
-	// Get language from query parameter, default to "en" (align with frontend default)
-	language := c.DefaultQuery("lang", "en")
+	// 可选的拍摄日期范围，例如 captured_from=2019 只返回 2019 年及以后拍摄的街景
+	dates, err := models.ParseCaptureDateRange(c.Query("captured_from"), c.Query("captured_to"))
+	if err != nil {
+		respondError(c, ErrInvalidInput.WithKey("INVALID_CAPTURE_DATE"))
+		return
+	}
 
 	// 获取随机位置（自动处理用户偏好）
-	loc, err := h.locationService.GetRandomLocation(sessionID, language)
+	loc, err := h.locationService.GetRandomLocation(c.Request.Context(), sessionID, language, dates)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"location": loc,
+		},
+	})
+}
+
+// 位置列表分页参数
+const (
+	defaultLocationPageSize = 20
+	maxLocationPageSize     = 100
+)
+
+// locationFilter 读取 country / city 查询参数，二者必须且只能提供一个
+func locationFilter(c *gin.Context) (country, city string, ok bool) {
+	country = strings.TrimSpace(c.Query("country"))
+	city = strings.TrimSpace(c.Query("city"))
+	if (country == "") == (city == "") {
+		respondError(c, ErrInvalidInput.WithKey("LOCATION_FILTER_REQUIRED"))
+		return "", "", false
+	}
+	return country, city, true
+}
+
+// ListLocations 按国家或城市分页列出已发现的位置
+func (h *Handlers) ListLocations(c *gin.Context) {
+	country, city, ok := locationFilter(c)
+	if !ok {
+		return
+	}
+
+	// page 的范围已由 InputValidationMiddleware 校验
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultLocationPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxLocationPageSize {
+		respondError(c, ErrInvalidInput.WithKey("INVALID_PAGE_SIZE"))
+		return
+	}
+
+	locations, total, err := h.locationService.ListLocations(c.Request.Context(), services.LocationQuery{
+		Country:  country,
+		City:     city,
+		Page:     page,
+		PageSize: pageSize,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"locations": locations,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// CountLocations 统计国家或城市下已发现的位置数量
+func (h *Handlers) CountLocations(c *gin.Context) {
+	country, city, ok := locationFilter(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.locationService.CountLocations(c.Request.Context(), country, city)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"count": count,
+		},
+	})
+}
+
+// GetRandomDiscoveredLocation 随机返回指定国家下一个已发现的位置
+func (h *Handlers) GetRandomDiscoveredLocation(c *gin.Context) {
+	country := strings.TrimSpace(c.Query("country"))
+	if country == "" {
+		respondError(c, ErrInvalidInput.WithKey("MISSING_COUNTRY"))
+		return
+	}
+
+	loc, err := h.locationService.GetRandomDiscoveredLocation(c.Request.Context(), country)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -61,36 +242,39 @@ func (h *Handlers) GetRandomLocation(c *gin.Context) {
 func (h *Handlers) GetLocationDescription(c *gin.Context) {
 	panoID := c.Param("panoId")
 	if panoID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Missing location ID",
-		})
+		respondError(c, ErrInvalidInput.WithKey("MISSING_PANO_ID"))
 		return
 	}
 
-	// Get language from query parameter, default to "zh"
-	language := c.DefaultQuery("lang", "zh")
+	language, ok := requestLanguage(c)
+	if !ok {
+		return
+	}
 
-	loc, err := h.locationService.GetLocation(panoID)
+	loc, err := h.locationService.GetLocation(c.Request.Context(), panoID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
 
 	startTime := time.Now()
 	logger := utils.APILogger()
 
-	desc, err := h.aiService.GetDescriptionForLocation(loc, language)
+	// refresh=true 时忽略缓存强制重新生成
+	refresh := c.Query("refresh") == "true"
+
+	desc, cached, err := h.aiService.GetDescriptionForLocation(c.Request.Context(), loc, language, refresh)
 	if err != nil {
 		duration := time.Since(startTime)
-		statusCode := http.StatusInternalServerError
-
-		if strings.Contains(err.Error(), "超时") || strings.Contains(err.Error(), "timeout") {
-			statusCode = http.StatusRequestTimeout
+		if requestCanceled(c, err) {
+			logger.Info("get_description_canceled", "Client canceled description request", map[string]interface{}{
+				"pano_id":  panoID,
+				"duration": duration.String(),
+			})
+			c.AbortWithStatus(statusClientClosedRequest)
+			return
 		}
+		statusCode, resp := MapError(err)
 
 		logger.Error("get_description_failed", "Failed to get AI description", err, map[string]interface{}{
 			"pano_id":  panoID,
@@ -99,38 +283,32 @@ func (h *Handlers) GetLocationDescription(c *gin.Context) {
 			"status":   statusCode,
 		})
 
-		c.JSON(statusCode, gin.H{
-			"success":  false,
-			"error":    err.Error(),
-			"duration": duration.String(),
-		})
+		c.JSON(statusCode, errorBody(c, resp, gin.H{"duration": duration.String()}))
 		return
 	}
 
 	// 验证描述内容是否有效
-	if desc == "" || strings.TrimSpace(desc) == "" {
+	if strings.TrimSpace(desc.Content) == "" {
 		duration := time.Since(startTime)
 		logger.Error("empty_description", "AI generated empty description", nil, map[string]interface{}{
 			"pano_id":     panoID,
 			"language":    language,
 			"duration":    duration.String(),
-			"desc_length": len(desc),
+			"desc_length": len(desc.Content),
 		})
 
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success":  false,
-			"error":    "AI生成的描述为空，请重试",
-			"duration": duration.String(),
-		})
+		c.JSON(http.StatusInternalServerError, errorBody(c, ErrInternalServer.WithKey("EMPTY_DESCRIPTION"), gin.H{"duration": duration.String()}))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
-			"description": desc,
-			"language":    language,
-			"duration":    time.Since(startTime).String(),
+			"description":  desc.Content,
+			"language":     language,
+			"duration":     time.Since(startTime).String(),
+			"cached":       cached,
+			"generated_at": desc.GeneratedAt,
 		},
 	})
 }
@@ -139,65 +317,330 @@ func (h *Handlers) GetLocationDescription(c *gin.Context) {
 func (h *Handlers) GetLocationDetailedDescription(c *gin.Context) {
 	panoID := c.Param("panoId")
 	if panoID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Missing location ID",
-		})
+		respondError(c, ErrInvalidInput.WithKey("MISSING_PANO_ID"))
 		return
 	}
 
-	// Get language from query parameter, default to "zh"
-	language := c.DefaultQuery("lang", "zh")
+	language, ok := requestLanguage(c)
+	if !ok {
+		return
+	}
 
-	loc, err := h.locationService.GetLocation(panoID)
+	loc, err := h.locationService.GetLocation(c.Request.Context(), panoID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
 
 	startTime := time.Now()
 	logger := utils.APILogger()
 
-	desc, err := h.aiService.GetDetailedDescriptionForLocation(loc, language)
+	// refresh=true 时忽略缓存强制重新生成
+	refresh := c.Query("refresh") == "true"
+
+	desc, cached, err := h.aiService.GetDetailedDescriptionForLocation(c.Request.Context(), loc, language, refresh)
 	if err != nil {
 		duration := time.Since(startTime)
-		statusCode := http.StatusInternalServerError
-		errorMsg := err.Error()
-
-		if strings.Contains(errorMsg, "超时") || strings.Contains(errorMsg, "timeout") {
-			statusCode = http.StatusRequestTimeout
-		} else if strings.Contains(errorMsg, "没有找到基础对话历史") {
-			statusCode = http.StatusBadRequest
+		if requestCanceled(c, err) {
+			logger.Info("get_detailed_description_canceled", "Client canceled detailed description request", map[string]interface{}{
+				"pano_id":  panoID,
+				"duration": duration.String(),
+			})
+			c.AbortWithStatus(statusClientClosedRequest)
+			return
 		}
+		statusCode, resp := MapError(err)
 
 		logger.Error("get_detailed_description_failed", "Failed to get detailed AI description", err, map[string]interface{}{
 			"pano_id":  panoID,
 			"language": language,
-			"duration": time.Since(startTime).String(),
+			"duration": duration.String(),
 			"status":   statusCode,
 		})
 
-		c.JSON(statusCode, gin.H{
-			"success":  false,
-			"error":    errorMsg,
-			"duration": duration.String(),
+		c.JSON(statusCode, errorBody(c, resp, gin.H{"duration": duration.String()}))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"description":  desc.Content,
+			"language":     language,
+			"duration":     time.Since(startTime).String(),
+			"cached":       cached,
+			"generated_at": desc.GeneratedAt,
+		},
+	})
+}
+
+// 追问问题的最大长度（字符数）
+const maxChatQuestionLength = 500
+
+// ChatAboutLocation 针对当前全景图追问
+func (h *Handlers) ChatAboutLocation(c *gin.Context) {
+	panoID := c.Param("panoId")
+
+	var req struct {
+		Question string `json:"question" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || panoID == "" {
+		respondError(c, ErrInvalidInput.WithKey("INVALID_REQUEST"))
+		return
+	}
+
+	question := strings.TrimSpace(req.Question)
+	if question == "" || utf8.RuneCountInString(question) > maxChatQuestionLength {
+		respondError(c, ErrInvalidInput.WithKey("INVALID_QUESTION", maxChatQuestionLength))
+		return
+	}
+
+	// 从 gin.Context 获取会话 ID (由 SessionMiddleware 设置)
+	sessionIDInterface, exists := c.Get("sessionID")
+	if !exists {
+		respondError(c, ErrInternalServer.WithKey("SESSION_MISSING"))
+		return
+	}
+	sessionID, ok := sessionIDInterface.(string)
+	if !ok || sessionID == "" {
+		respondError(c, ErrInternalServer.WithKey("SESSION_INVALID"))
+		return
+	}
+
+	language, ok := requestLanguage(c)
+	if !ok {
+		return
+	}
+
+	loc, err := h.locationService.GetLocation(c.Request.Context(), panoID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	startTime := time.Now()
+	logger := utils.APILogger()
+
+	reply, thread, err := h.aiService.ChatAboutLocation(c.Request.Context(), sessionID, loc, language, question)
+	if err != nil {
+		if requestCanceled(c, err) {
+			logger.Info("chat_canceled", "Client canceled chat request", map[string]interface{}{
+				"pano_id":  panoID,
+				"duration": time.Since(startTime).String(),
+			})
+			c.AbortWithStatus(statusClientClosedRequest)
+			return
+		}
+
+		statusCode, resp := MapError(err)
+
+		logger.Error("chat_failed", "Failed to answer chat question", err, map[string]interface{}{
+			"pano_id":  panoID,
+			"turns":    thread.Turns,
+			"tokens":   thread.TokensUsed,
+			"duration": time.Since(startTime).String(),
+			"status":   statusCode,
 		})
+
+		c.JSON(statusCode, errorBody(c, resp, nil))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
-			"description": desc,
-			"language":    language,
-			"duration":    time.Since(startTime).String(),
+			"reply":        reply,
+			"turns":        thread.Turns,
+			"max_turns":    h.aiService.ChatMaxTurns(),
+			"tokens_used":  thread.TokensUsed,
+			"token_budget": h.aiService.ChatTokenBudget(),
+			"duration":     time.Since(startTime).String(),
 		},
 	})
 }
 
+// StreamLocationDescription 以 SSE 流式返回位置描述
+func (h *Handlers) StreamLocationDescription(c *gin.Context) {
+	h.streamDescription(c, models.DescriptionShort)
+}
+
+// StreamLocationDetailedDescription 以 SSE 流式返回位置详细描述
+func (h *Handlers) StreamLocationDetailedDescription(c *gin.Context) {
+	h.streamDescription(c, models.DescriptionDetailed)
+}
+
+// streamDescription 生成过程中通过 delta 事件转发文本片段，结束时发送 done 事件携带完整描述；
+// 输出语言不符重新生成时先发送 reset 事件，客户端应清空已收到的片段，之后的 delta 为重新生成的内容；
+// 命中缓存时直接发送 done 事件。流开始之后的错误通过 error 事件返回
+func (h *Handlers) streamDescription(c *gin.Context, kind string) {
+	panoID := c.Param("panoId")
+	if panoID == "" {
+		respondError(c, ErrInvalidInput.WithKey("MISSING_PANO_ID"))
+		return
+	}
+
+	language, ok := requestLanguage(c)
+	if !ok {
+		return
+	}
+
+	loc, err := h.locationService.GetLocation(c.Request.Context(), panoID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	startTime := time.Now()
+	logger := utils.APILogger()
+	refresh := c.Query("refresh") == "true"
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 关闭 nginx 的响应缓冲
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	onDelta := func(delta string) error {
+		if err := c.Request.Context().Err(); err != nil {
+			return err
+		}
+		c.SSEvent("delta", gin.H{"content": delta})
+		c.Writer.Flush()
+		return nil
+	}
+	onReset := func() error {
+		if err := c.Request.Context().Err(); err != nil {
+			return err
+		}
+		c.SSEvent("reset", gin.H{})
+		c.Writer.Flush()
+		return nil
+	}
+
+	var desc models.LocationDescription
+	var cached bool
+	if kind == models.DescriptionDetailed {
+		desc, cached, err = h.aiService.StreamDetailedDescriptionForLocation(c.Request.Context(), loc, language, refresh, onDelta, onReset)
+	} else {
+		desc, cached, err = h.aiService.StreamDescriptionForLocation(c.Request.Context(), loc, language, refresh, onDelta, onReset)
+	}
+
+	duration := time.Since(startTime)
+	if err != nil {
+		if requestCanceled(c, err) {
+			logger.Info("stream_description_canceled", "Client canceled description stream", map[string]interface{}{
+				"pano_id":  panoID,
+				"kind":     kind,
+				"duration": duration.String(),
+			})
+			return
+		}
+
+		logger.Error("stream_description_failed", "Failed to stream AI description", err, map[string]interface{}{
+			"pano_id":  panoID,
+			"kind":     kind,
+			"language": language,
+			"duration": duration.String(),
+		})
+		_, resp := MapError(err)
+		c.SSEvent("error", gin.H{
+			"error":    resp.Localize(messageLanguage(c)),
+			"duration": duration.String(),
+		})
+		c.Writer.Flush()
+		return
+	}
+
+	c.SSEvent("done", gin.H{
+		"description":  desc.Content,
+		"language":     language,
+		"duration":     duration.String(),
+		"cached":       cached,
+		"generated_at": desc.GeneratedAt,
+	})
+	c.Writer.Flush()
+}
+
+// GetLocationImage 代理 Street View Static API 的全景图片，邮件、分享卡片和命令行等客户端无需持有 Google Maps API Key
+// 查询参数 heading、pitch、fov 和 size（例如 640x400）均可省略；请求头 If-None-Match 与图片的 ETag 一致时返回 304
+func (h *Handlers) GetLocationImage(c *gin.Context) {
+	panoID := c.Param("panoId")
+	if panoID == "" {
+		respondError(c, ErrInvalidInput.WithKey("MISSING_PANO_ID"))
+		return
+	}
+	if h.images == nil {
+		respondError(c, ErrNoStreetView.WithKey("STREETVIEW_IMAGE_DISABLED"))
+		return
+	}
+
+	req, err := services.ParseStreetViewImageRequest(panoID, c.Query("heading"), c.Query("pitch"), c.Query("fov"), c.Query("size"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// 只代理已发现的位置，避免接口被用来批量下载任意全景；只读查询，不计入访问次数
+	exists, err := h.locationService.LocationExists(c.Request.Context(), panoID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !exists {
+		respondError(c, ErrResourceNotFound.WithKey("LOCATION_NOT_FOUND"))
+		return
+	}
+
+	// 先用缓存的 ETag 验证客户端的副本，一致时直接返回 304，图片缓存过期后也不必再请求上游
+	if etag, expiresAt := h.images.CachedETag(c.Request.Context(), req); etag != "" && etagMatches(c.GetHeader("If-None-Match"), etag) {
+		setImageCacheHeaders(c, etag, expiresAt)
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	image, err := h.images.Get(c.Request.Context(), req)
+	if err != nil {
+		if !requestCanceled(c, err) {
+			utils.APILogger().Error("get_image_failed", "Failed to get Street View image", err, map[string]interface{}{
+				"pano_id": panoID,
+				"size":    fmt.Sprintf("%dx%d", req.Width, req.Height),
+			})
+		}
+		respondError(c, err)
+		return
+	}
+
+	setImageCacheHeaders(c, image.ETag, image.ExpiresAt)
+	if etagMatches(c.GetHeader("If-None-Match"), image.ETag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, image.ContentType, image.Data)
+}
+
+// setImageCacheHeaders 设置图片的 ETag，并让客户端缓存到服务端缓存过期为止
+func setImageCacheHeaders(c *gin.Context, etag string, expiresAt time.Time) {
+	c.Header("ETag", etag)
+	maxAge := int(time.Until(expiresAt).Seconds())
+	if maxAge > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+}
+
+// etagMatches 判断 If-None-Match 请求头是否包含该 ETag，支持逗号分隔的多个值、弱 ETag 和 *
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
 // SetExplorationPreference 设置探索偏好
 func (h *Handlers) SetExplorationPreference(c *gin.Context) {
 	var req struct {
@@ -205,61 +648,41 @@ func (h *Handlers) SetExplorationPreference(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "无效的请求参数",
-		})
+		respondError(c, ErrInvalidInput.WithKey("INVALID_REQUEST"))
 		return
 	}
 
 	// 从 gin.Context 获取会话 ID (由 SessionMiddleware 设置)
 	sessionIDInterface, exists := c.Get("sessionID")
 	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "无法获取会话ID"})
+		respondError(c, ErrInternalServer.WithKey("SESSION_MISSING"))
 		return
 	}
 	sessionID, ok := sessionIDInterface.(string)
 	if !ok || sessionID == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "无效的会话ID格式"})
+		respondError(c, ErrInternalServer.WithKey("SESSION_INVALID"))
 		return
 	}
 
-	// 获取语言参数，默认为英文
-	language := c.DefaultQuery("lang", "en")
+	language, ok := requestLanguage(c)
+	if !ok {
+		return
+	}
 
 	// 设置探索偏好
-	if err := h.locationService.SetExplorationPreference(sessionID, req.Interest); err != nil {
-		// 所有错误都返回 200 状态码，由前端处理
-		if err.Error() == "无法理解该探索兴趣" {
-			errorMsg := "抱歉，我们无法理解您输入的探索兴趣。建议您尝试更具体的主题，例如：日本传统建筑、欧洲古堡、热带海滩、美国国家公园等。"
-
-			// 根据语言提供对应的错误消息
-			if language == "en" {
-				errorMsg = "Sorry, we couldn't understand your exploration interest. Please try more specific topics, such as: traditional Japanese architecture, European castles, tropical beaches, US national parks, etc."
-			}
-
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"error":   errorMsg,
-			})
+	if err := h.locationService.SetExplorationPreference(c.Request.Context(), sessionID, req.Interest, language); err != nil {
+		if requestCanceled(c, err) {
+			c.AbortWithStatus(statusClientClosedRequest)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+		status, resp := MapError(err)
+		c.JSON(status, errorBody(c, resp, nil))
 		return
 	}
 
-	// 根据语言设置成功消息
-	successMsg := "探索偏好设置成功"
-	if language == "en" {
-		successMsg = "Exploration preference set successfully"
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": successMsg,
+		"message": i18n.T(messageLanguage(c), "PREFERENCE_SAVED"),
 	})
 }
 
@@ -268,41 +691,33 @@ func (h *Handlers) DeleteExplorationPreference(c *gin.Context) {
 	// 从 gin.Context 获取会话 ID (由 SessionMiddleware 设置)
 	sessionIDInterface, exists := c.Get("sessionID")
 	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "无法获取会话ID"})
+		respondError(c, ErrInternalServer.WithKey("SESSION_MISSING"))
 		return
 	}
 	sessionID, ok := sessionIDInterface.(string)
 	if !ok || sessionID == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "无效的会话ID格式"})
+		respondError(c, ErrInternalServer.WithKey("SESSION_INVALID"))
 		return
 	}
 
-	// 获取语言参数，默认为英文
-	language := c.DefaultQuery("lang", "en")
-
 	// 删除探索偏好
-	if err := h.locationService.DeleteExplorationPreference(sessionID); err != nil {
-		errorMsg := "删除探索偏好失败"
-		if language == "en" {
-			errorMsg = "Failed to delete exploration preference"
+	if err := h.locationService.DeleteExplorationPreference(c.Request.Context(), sessionID); err != nil {
+		if requestCanceled(c, err) {
+			c.AbortWithStatus(statusClientClosedRequest)
+			return
 		}
-
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   errorMsg,
-			"detail":  err.Error(),
-		})
+		// 原始错误只记录在服务端日志中，不返回给客户端
+		utils.APILogger().Error("delete_preference_failed", "Failed to delete exploration preference", err, nil)
+		status, resp := MapError(err)
+		if resp == ErrInternalServer {
+			resp = ErrInternalServer.WithKey("PREFERENCE_DELETE_FAILED")
+		}
+		c.JSON(status, errorBody(c, resp, nil))
 		return
 	}
 
-	// 根据语言设置成功消息
-	successMsg := "探索偏好已成功删除"
-	if language == "en" {
-		successMsg = "Exploration preference successfully deleted"
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": successMsg,
+		"message": i18n.T(messageLanguage(c), "PREFERENCE_DELETED"),
 	})
 }
@@ -0,0 +1,500 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/my-streetview-project/backend/internal/config"
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/openai"
+	"github.com/my-streetview-project/backend/internal/repositories"
+	"github.com/my-streetview-project/backend/internal/services"
+)
+
+// stubImageSource 返回固定内容的图片并记录请求次数
+type stubImageSource struct {
+	calls int
+}
+
+func (s *stubImageSource) StreetViewImage(ctx context.Context, req services.StreetViewImageRequest, maxBytes int64) (*services.StreetViewImage, error) {
+	s.calls++
+	return &services.StreetViewImage{ContentType: "image/jpeg", Data: []byte("jpeg")}, nil
+}
+
+func TestGetLocationImage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := repositories.NewMemoryRepository()
+	if err := repo.SaveLocation(context.Background(), models.Location{PanoID: "known_pano", Country: "Japan"}); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	source := &stubImageSource{}
+	images := services.NewStreetViewImageService(source, repo, time.Hour, 1024)
+
+	r := gin.New()
+	r.Use(InputValidationMiddleware())
+	SetupRoutes(r, NewHandlers(services.NewOfflineLocationService(repo, nil), nil, images))
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/api/v1/locations/known_pano/image?heading=90&size=320x200", "")
+	if w.Code != http.StatusOK || w.Body.String() != "jpeg" || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("状态码为 %d，内容为 %q", w.Code, w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Cache-Control") == "" {
+		t.Errorf("响应应该带 ETag 和 Cache-Control: %v", w.Header())
+	}
+
+	if w := get("/api/v1/locations/known_pano/image?heading=90&size=320x200", `"other", `+etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("ETag 一致时应返回 304，实际为 %d", w.Code)
+	}
+	if source.calls != 1 {
+		t.Errorf("应该只请求 1 次上游，实际为 %d 次", source.calls)
+	}
+	if locations, _ := repo.ListLocationsByCountry(context.Background(), "Japan", 0, 10); len(locations) != 1 || locations[0].AccessCount != 0 {
+		t.Errorf("图片请求不应更新位置的访问次数: %+v", locations)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"尺寸超过上限", "/api/v1/locations/known_pano/image?size=1024x1024", http.StatusBadRequest},
+		{"未发现的位置", "/api/v1/locations/unknown_pano/image", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := get(tt.path, ""); w.Code != tt.status {
+			t.Errorf("%s: 状态码为 %d，期望 %d: %s", tt.name, w.Code, tt.status, w.Body.String())
+		}
+	}
+}
+
+func TestGetLocationImageRevalidatesAfterCacheExpiry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := repositories.NewMemoryRepository()
+	if err := repo.SaveLocation(context.Background(), models.Location{PanoID: "known_pano"}); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	source := &stubImageSource{}
+	ttl := 50 * time.Millisecond
+	images := services.NewStreetViewImageService(source, repo, ttl, 1024)
+
+	r := gin.New()
+	SetupRoutes(r, NewHandlers(services.NewOfflineLocationService(repo, nil), nil, images))
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/locations/known_pano/image", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("状态码为 %d，ETag 为 %q", w.Code, etag)
+	}
+
+	// 图片缓存过期后，ETag 一致的重新验证直接返回 304，不请求上游
+	time.Sleep(2 * ttl)
+	if w := get(etag); w.Code != http.StatusNotModified || w.Header().Get("ETag") != etag || w.Header().Get("Cache-Control") == "" {
+		t.Errorf("ETag 一致时应返回 304，实际为 %d: %v", w.Code, w.Header())
+	}
+	if source.calls != 1 {
+		t.Errorf("重新验证不应请求上游，实际请求了 %d 次", source.calls)
+	}
+
+	// ETag 不一致时重新请求上游
+	if w := get(`"other"`); w.Code != http.StatusOK || w.Body.String() != "jpeg" {
+		t.Errorf("ETag 不一致时应返回图片，实际为 %d", w.Code)
+	}
+	if source.calls != 2 {
+		t.Errorf("缓存过期且 ETag 不一致时应请求上游，实际请求了 %d 次", source.calls)
+	}
+}
+
+func TestGetRandomLocationHidesConversationHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// 位置池中的位置带有包含系统提示词的对话历史
+	repo := repositories.NewMemoryRepository()
+	pooled := models.Location{PanoID: "pooled_pano", ConversationHistory: `[{"role":"system","content":"secret prompt"}]`}
+	if err := repo.PushPoolLocation(context.Background(), "global:en", pooled); err != nil {
+		t.Fatalf("放入位置池失败: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	locations := services.NewOfflineLocationService(repo, nil)
+	locations.StartLocationPool(ctx, services.PoolConfig{Size: 1, LowWater: 1, RefillInterval: time.Hour})
+
+	r := gin.New()
+	r.Use(SessionMiddleware())
+	SetupRoutes(r, NewHandlers(locations, nil, nil))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/locations/random?lang=en", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码为 %d: %s", w.Code, w.Body.String())
+	}
+
+	var body struct {
+		Data struct {
+			Location map[string]interface{} `json:"location"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if body.Data.Location["pano_id"] != "pooled_pano" {
+		t.Fatalf("应该返回位置池中的位置: %v", body.Data.Location)
+	}
+	if _, found := body.Data.Location["conversation_history"]; found {
+		t.Errorf("响应不应包含对话历史: %s", w.Body.String())
+	}
+}
+
+// countingProvider 记录请求次数的街景数据源，所有请求都失败
+type countingProvider struct {
+	calls int
+}
+
+func (p *countingProvider) NearestPanorama(ctx context.Context, latitude, longitude float64, radius int) (*services.Panorama, error) {
+	p.calls++
+	return nil, models.Classify(models.ErrUpstreamUnavailable, errors.New("google unavailable"))
+}
+
+func (p *countingProvider) ReverseGeocode(ctx context.Context, latitude, longitude float64, language string) (*models.GeocodeResult, error) {
+	p.calls++
+	return nil, models.Classify(models.ErrUpstreamUnavailable, errors.New("google unavailable"))
+}
+
+func TestGetRandomLocationQuotaExhausted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	// 街景元数据预算已用完，仓库中有一个已发现的位置
+	repo := repositories.NewMemoryRepository()
+	discovered := models.Location{
+		PanoID:  "discovered_pano",
+		Country: "Japan",
+		Geocode: &models.GeocodeResult{Source: models.GeocodeSourceGoogle, Language: "en"},
+	}
+	if err := repo.SaveLocation(ctx, discovered); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	quota := services.NewQuotaTracker(repositories.NewMemoryRepository(), map[string]services.QuotaBudget{
+		services.APIStreetViewMetadata: {Daily: 1},
+	})
+	if err := quota.Acquire(ctx, services.APIStreetViewMetadata); err != nil {
+		t.Fatalf("预算内的请求不应被拒绝: %v", err)
+	}
+	provider := &countingProvider{}
+	maps := services.NewMapsServiceWithProvider(provider)
+	maps.SetQuota(quota)
+
+	r := gin.New()
+	r.Use(SessionMiddleware())
+	SetupRoutes(r, NewHandlers(services.NewLocationService(repo, nil, maps), nil, nil))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/locations/random?lang=en", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("预算用完时应该返回已发现的位置，状态码为 %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"pano_id":"discovered_pano"`) {
+		t.Errorf("应该返回已发现的位置: %s", w.Body.String())
+	}
+	if provider.calls != 0 {
+		t.Errorf("预算用完后不应请求 Google，实际请求 %d 次", provider.calls)
+	}
+}
+
+// streamTestConfig 启用 AI、描述缓存 1 小时，其余配置项调用时会 panic
+type streamTestConfig struct {
+	config.Config
+}
+
+func (streamTestConfig) EnableOpenAI() bool                 { return true }
+func (streamTestConfig) EnableGoogleAPI() bool              { return false }
+func (streamTestConfig) DescriptionCacheTTL() time.Duration { return time.Hour }
+
+// stubLLM 流式生成时依次发送 deltas，然后返回 err；每发送一段调用一次 onSent
+// retry 非空时模拟语言不符：发送完 deltas 后调用 onReset 并发送 retry 作为重新生成的内容
+type stubLLM struct {
+	openai.Client
+	deltas []string
+	retry  []string
+	err    error
+	onSent func()
+	calls  int
+}
+
+func (s *stubLLM) StreamLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string, onDelta func(string) error, onReset func() error) (string, []openai.ChatMessage, error) {
+	s.calls++
+	send := func(deltas []string) error {
+		for _, delta := range deltas {
+			if err := onDelta(delta); err != nil {
+				return err
+			}
+			if s.onSent != nil {
+				s.onSent()
+			}
+		}
+		return nil
+	}
+
+	if err := send(s.deltas); err != nil {
+		return "", nil, err
+	}
+	if s.err != nil {
+		return "", nil, s.err
+	}
+	if s.retry == nil {
+		return strings.Join(s.deltas, ""), nil, nil
+	}
+	if err := onReset(); err != nil {
+		return "", nil, err
+	}
+	if err := send(s.retry); err != nil {
+		return "", nil, err
+	}
+	return strings.Join(s.retry, ""), nil, nil
+}
+
+// sseEvent 一个 SSE 事件的名称和 JSON 数据
+type sseEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// parseSSE 按 gin SSEvent 的输出格式（event:... / data:...）解析响应中的事件
+func parseSSE(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		if block == "" {
+			continue
+		}
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event:"); ok {
+				event.name = name
+			} else if data, ok := strings.CutPrefix(line, "data:"); ok {
+				if err := json.Unmarshal([]byte(data), &event.data); err != nil {
+					t.Fatalf("解析事件数据失败: %v: %q", err, data)
+				}
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// newStreamTestRouter 创建使用内存仓库和 stubLLM 的路由，仓库中已有一个带逆地理编码结果的位置
+func newStreamTestRouter(t *testing.T, llm *stubLLM) (*gin.Engine, repositories.Repository) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	repo := repositories.NewMemoryRepository()
+	loc := models.Location{
+		PanoID:    "stream_pano",
+		Latitude:  35.6595,
+		Longitude: 139.7006,
+		Geocode: &models.GeocodeResult{
+			Source:   models.GeocodeSourceGoogle,
+			Language: "en",
+			Results:  []models.GeocodePlace{{FormattedAddress: "Shibuya, Tokyo, Japan"}},
+		},
+	}
+	if err := repo.SaveLocation(context.Background(), loc); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	ai := services.NewAIServiceWithClient(streamTestConfig{}, repo, llm, nil)
+
+	r := gin.New()
+	SetupRoutes(r, NewHandlers(services.NewOfflineLocationService(repo, ai), ai, nil))
+	return r, repo
+}
+
+func eventNames(events []sseEvent) []string {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = event.name
+	}
+	return names
+}
+
+func TestStreamLocationDescription(t *testing.T) {
+	llm := &stubLLM{deltas: []string{"Hello ", "Tokyo"}}
+	r, _ := newStreamTestRouter(t, llm)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/locations/stream_pano/description/stream?lang=en", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("状态码为 %d，Content-Type 为 %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	events := parseSSE(t, w.Body.String())
+	if names := strings.Join(eventNames(events), ","); names != "delta,delta,done" {
+		t.Fatalf("事件顺序为 %s，期望 delta,delta,done", names)
+	}
+	if events[0].data["content"] != "Hello " || events[1].data["content"] != "Tokyo" {
+		t.Errorf("delta 事件内容不正确: %+v", events[:2])
+	}
+	done := events[2].data
+	if done["description"] != "Hello Tokyo" || done["cached"] != false || done["language"] != "en" || done["generated_at"] == "" {
+		t.Errorf("done 事件内容不正确: %v", done)
+	}
+}
+
+func TestStreamLocationDescriptionReset(t *testing.T) {
+	llm := &stubLLM{deltas: []string{"你好", "东京"}, retry: []string{"Hello ", "Tokyo"}}
+	r, _ := newStreamTestRouter(t, llm)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/locations/stream_pano/description/stream?lang=en", nil))
+
+	// 重新生成前发送 reset 事件，之后流式发送重新生成的内容
+	events := parseSSE(t, w.Body.String())
+	if names := strings.Join(eventNames(events), ","); names != "delta,delta,reset,delta,delta,done" {
+		t.Fatalf("事件顺序为 %s，期望 delta,delta,reset,delta,delta,done", names)
+	}
+	if events[3].data["content"] != "Hello " || events[5].data["description"] != "Hello Tokyo" {
+		t.Errorf("reset 之后应该是重新生成的内容: %+v", events[3:])
+	}
+}
+
+func TestStreamLocationDescriptionCached(t *testing.T) {
+	llm := &stubLLM{}
+	r, repo := newStreamTestRouter(t, llm)
+
+	generatedAt := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	err := repo.SaveDescription(context.Background(), models.LocationDescription{
+		PanoID:      "stream_pano",
+		Language:    "en",
+		Kind:        models.DescriptionShort,
+		Content:     "cached description",
+		GeneratedAt: generatedAt,
+	})
+	if err != nil {
+		t.Fatalf("保存描述失败: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/locations/stream_pano/description/stream?lang=en", nil))
+
+	// 命中缓存时只发送 done 事件，不调用 LLM
+	events := parseSSE(t, w.Body.String())
+	if len(events) != 1 || events[0].name != "done" {
+		t.Fatalf("命中缓存时应该只有 done 事件，实际为 %v", eventNames(events))
+	}
+	done := events[0].data
+	if done["description"] != "cached description" || done["cached"] != true || done["generated_at"] != generatedAt.Format(time.RFC3339) {
+		t.Errorf("done 事件内容不正确: %v", done)
+	}
+	if llm.calls != 0 {
+		t.Errorf("命中缓存时不应调用 LLM，实际调用 %d 次", llm.calls)
+	}
+}
+
+func TestStreamLocationDescriptionError(t *testing.T) {
+	llm := &stubLLM{
+		deltas: []string{"Hello "},
+		err:    models.Classify(models.ErrUpstreamUnavailable, errors.New("upstream failed")),
+	}
+	r, repo := newStreamTestRouter(t, llm)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/locations/stream_pano/description/stream?lang=en", nil))
+
+	// 流开始后出错时仍为 200，通过 error 事件返回错误，不缓存描述
+	events := parseSSE(t, w.Body.String())
+	if names := strings.Join(eventNames(events), ","); w.Code != http.StatusOK || names != "delta,error" {
+		t.Fatalf("状态码为 %d，事件顺序为 %s，期望 200 和 delta,error", w.Code, names)
+	}
+	if errBody, ok := events[1].data["error"].(map[string]interface{}); !ok || errBody["code"] == "" {
+		t.Errorf("error 事件应该带有错误码: %v", events[1].data)
+	}
+	if desc, _ := repo.GetDescription(context.Background(), "stream_pano", "en", models.DescriptionShort); desc != nil {
+		t.Errorf("失败的描述不应被缓存: %+v", desc)
+	}
+}
+
+func TestStreamLocationDescriptionClientCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 发送第一段后客户端断开，之后的片段不再发送
+	llm := &stubLLM{deltas: []string{"Hello ", "Tokyo"}, onSent: cancel}
+	r, repo := newStreamTestRouter(t, llm)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/locations/stream_pano/description/stream?lang=en", nil).WithContext(ctx)
+	r.ServeHTTP(w, req)
+
+	events := parseSSE(t, w.Body.String())
+	if names := strings.Join(eventNames(events), ","); names != "delta" {
+		t.Errorf("客户端断开后不应再发送事件，实际为 %s", names)
+	}
+	if desc, _ := repo.GetDescription(context.Background(), "stream_pano", "en", models.DescriptionShort); desc != nil {
+		t.Errorf("中断的描述不应被缓存: %+v", desc)
+	}
+}
+
+// failingPreferenceRepo 删除探索偏好时返回带有内部信息的错误
+type failingPreferenceRepo struct {
+	repositories.Repository
+}
+
+func (failingPreferenceRepo) DeleteExplorationPreference(ctx context.Context, sessionID string) error {
+	return errors.New("dial tcp 10.0.0.5:6379: connection refused")
+}
+
+func TestDeleteExplorationPreferenceError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := failingPreferenceRepo{repositories.NewMemoryRepository()}
+	r := gin.New()
+	r.Use(SessionMiddleware())
+	SetupRoutes(r, NewHandlers(services.NewOfflineLocationService(repo, nil), nil, nil))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/preferences/exploration/remove", nil))
+
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if w.Code != http.StatusInternalServerError || body.Error.Code != ErrInternalServer.Code ||
+		body.Error.Message != "Failed to delete exploration preference" {
+		t.Errorf("状态码为 %d，错误为 %+v，期望 500 和删除偏好失败的说明", w.Code, body.Error)
+	}
+	if strings.Contains(w.Body.String(), "10.0.0.5") || strings.Contains(w.Body.String(), "detail") {
+		t.Errorf("响应不应包含原始错误: %s", w.Body.String())
+	}
+}
@@ -2,19 +2,21 @@ package api
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/my-streetview-project/backend/internal/repositories"
 	"github.com/my-streetview-project/backend/internal/utils"
-	"github.com/redis/go-redis/v9"
 )
 
-// RateLimitMiddleware 实现基于 Redis 的请求限流
-func RateLimitMiddleware(redisClient *redis.Client) gin.HandlerFunc {
+// RateLimitMiddleware 实现基于仓库计数器的请求限流
+func RateLimitMiddleware(repo repositories.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		clientIP := c.ClientIP()
 		endpoint := c.FullPath()
@@ -28,28 +30,16 @@ func RateLimitMiddleware(redisClient *redis.Client) gin.HandlerFunc {
 			maxRequests = 100 // 默认限制
 		}
 
-		// 使用 Redis 实现计数器
+		// 使用仓库计数器实现限流，窗口为60秒
 		key := "ratelimit:" + clientIP + ":" + endpoint
-		count, err := redisClient.Incr(c.Request.Context(), key).Result()
+		count, err := repo.IncrementRateLimit(c.Request.Context(), key, 60*time.Second)
 		if err != nil {
-			c.Next() // Redis 错误时不阻止请求
+			c.Next() // 存储错误时不阻止请求
 			return
 		}
 
-		// 设置过期时间（60秒）
-		if count == 1 {
-			if err := redisClient.Expire(c.Request.Context(), key, 60*time.Second).Err(); err != nil {
-				c.Next()
-				return
-			}
-		}
-
 		if count > int64(maxRequests) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"success": false,
-				"error":   "请求过于频繁，请稍后再试",
-			})
-			c.Abort()
+			respondError(c, ErrRateLimitExceeded)
 			return
 		}
 
@@ -92,22 +82,14 @@ func InputValidationMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 验证请求大小
 		if c.Request.ContentLength > 1024*1024 { // 1MB
-			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
-				"success": false,
-				"error":   "请求体过大",
-			})
-			c.Abort()
+			respondError(c, ErrPayloadTooLarge)
 			return
 		}
 
 		// 验证路径参数
 		if panoID := c.Param("panoId"); panoID != "" {
 			if len(panoID) > 100 || !regexp.MustCompile(`^[a-zA-Z0-9_-]+$`).MatchString(panoID) {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"success": false,
-					"error":   "无效的位置ID格式",
-				})
-				c.Abort()
+				respondError(c, ErrInvalidInput.WithKey("INVALID_PANO_ID"))
 				return
 			}
 		}
@@ -115,11 +97,7 @@ func InputValidationMiddleware() gin.HandlerFunc {
 		// 验证查询参数
 		if page := c.Query("page"); page != "" {
 			if pageNum, err := strconv.Atoi(page); err != nil || pageNum < 1 || pageNum > 1000 {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"success": false,
-					"error":   "无效的页码",
-				})
-				c.Abort()
+				respondError(c, ErrInvalidInput.WithKey("INVALID_PAGE"))
 				return
 			}
 		}
@@ -136,11 +114,7 @@ func SessionMiddleware() gin.HandlerFunc {
 		// 验证会话ID格式
 		if sessionID != "" {
 			if !regexp.MustCompile(`^[a-zA-Z0-9-_]{32,64}$`).MatchString(sessionID) {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"success": false,
-					"error":   "无效的会话ID",
-				})
-				c.Abort()
+				respondError(c, ErrInvalidInput.WithKey("SESSION_INVALID"))
 				return
 			}
 		} else {
@@ -154,6 +128,18 @@ func SessionMiddleware() gin.HandlerFunc {
 	}
 }
 
+// AdminAuthMiddleware 校验管理接口的 Authorization: Bearer <token> 请求头
+func AdminAuthMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			respondError(c, ErrUnauthorized.WithKey("ADMIN_TOKEN_INVALID"))
+			return
+		}
+		c.Next()
+	}
+}
+
 // generateSecureSessionID 生成安全的会话ID
 func generateSecureSessionID() string {
 	b := make([]byte, 32)
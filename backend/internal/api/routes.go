@@ -11,16 +11,38 @@ func SetupRoutes(r *gin.Engine, h *Handlers) {
 		// 位置相关
 		locations := v1.Group("/locations")
 		{
+			// 按国家或城市分页列出已发现的位置
+			locations.GET("", h.ListLocations)
+
+			// 统计国家或城市下已发现的位置数量
+			locations.GET("/count", h.CountLocations)
+
 			// 获取随机位置
 			locations.GET("/random", h.GetRandomLocation)
 
+			// 随机获取指定国家下一个已发现的位置（无需请求街景元数据）
+			locations.GET("/discovered/random", h.GetRandomDiscoveredLocation)
+
 			// 获取位置描述
 			locations.GET("/:panoId/description", h.GetLocationDescription)
 
 			// 获取位置详细描述
 			locations.GET("/:panoId/detailed-description", h.GetLocationDetailedDescription)
+
+			// 以 SSE 流式获取位置描述 / 详细描述
+			locations.GET("/:panoId/description/stream", h.StreamLocationDescription)
+			locations.GET("/:panoId/detailed-description/stream", h.StreamLocationDetailedDescription)
+
+			// 服务端代理的全景图片
+			locations.GET("/:panoId/image", h.GetLocationImage)
+
+			// 针对当前全景图追问
+			locations.POST("/:panoId/chat", h.ChatAboutLocation)
 		}
 
+		// 支持的语言
+		v1.GET("/languages", h.ListLanguages)
+
 		// 探索偏好相关
 		preferences := v1.Group("/preferences")
 		{
@@ -31,3 +53,16 @@ func SetupRoutes(r *gin.Engine, h *Handlers) {
 		}
 	}
 }
+
+// SetupAdminRoutes 注册需要管理令牌的接口，token 为空时不注册
+func SetupAdminRoutes(r *gin.Engine, h *AdminHandlers, token string) {
+	if token == "" {
+		return
+	}
+
+	admin := r.Group("/api/v1/admin", AdminAuthMiddleware(token))
+	{
+		// Google API 用量和预算
+		admin.GET("/usage", h.GetUsage)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,10 +13,33 @@ type Config interface {
 	ServerAddress() string
 	RedisAddress() string
 	RedisPassword() string
+	RedisDB() int
+	StorageBackend() string
+	BoltPath() string
 	OpenAIAPIKey() string
 	GoogleMapsAPIKey() string
+	GoogleMapsBaseURL() string
+	GoogleMapsSigningSecret() string
+	StreetViewFallbackFile() string
+	GeocodeCacheTTL() time.Duration
+	GeocodeCachePrecision() int
+	StreetViewMetadataBudget() (daily, monthly int)
+	GeocodeBudget() (daily, monthly int)
+	StreetViewImageBudget() (daily, monthly int)
+	StreetViewImageCacheTTL() time.Duration
+	StreetViewImageMaxBytes() int
+	AdminToken() string
 	EnableOpenAI() bool
 	EnableGoogleAPI() bool
+	OfflineMode() bool
+	DescriptionCacheTTL() time.Duration
+	ChatMaxTurns() int
+	ChatTokenBudget() int
+	ChatThreadTTL() time.Duration
+	LocationPoolSize() int
+	LocationPoolLowWater() int
+	LocationPoolRefillInterval() time.Duration
+	LLMModels(task string) []LLMModelConfig
 	SecurityConfig() *SecurityConfig
 	ProxyURL() string
 	ProxyType() string
@@ -30,10 +54,36 @@ type config struct {
 	serverAddress    string
 	redisAddress     string
 	redisPassword    string
+	redisDB          int
+	storageBackend   string
+	boltPath         string
 	openAIAPIKey     string
 	googleMapsAPIKey string
+	googleMapsURL    string
+	signingSecret    string
+	fallbackFile     string
+	geocodeTTL       time.Duration
+	geocodePrecision int
+	metadataDaily    int
+	metadataMonthly  int
+	geocodeDaily     int
+	geocodeMonthly   int
+	imageDaily       int
+	imageMonthly     int
+	imageTTL         time.Duration
+	imageMaxBytes    int
+	adminToken       string
 	enableOpenAI     bool
 	enableGoogleAPI  bool
+	offlineMode      bool
+	descriptionTTL   time.Duration
+	chatMaxTurns     int
+	chatTokenBudget  int
+	chatThreadTTL    time.Duration
+	poolSize         int
+	poolLowWater     int
+	poolRefill       time.Duration
+	llmModels        map[string][]LLMModelConfig
 	securityConfig   *SecurityConfig
 	proxyURL         string
 	proxyType        string
@@ -72,6 +122,19 @@ func (c *config) RedisPassword() string {
 	return c.redisPassword
 }
 
+// RedisDB Redis 数据库编号
+func (c *config) RedisDB() int {
+	return c.redisDB
+}
+
+func (c *config) StorageBackend() string {
+	return c.storageBackend
+}
+
+func (c *config) BoltPath() string {
+	return c.boltPath
+}
+
 func (c *config) OpenAIAPIKey() string {
 	return c.openAIAPIKey
 }
@@ -80,6 +143,61 @@ func (c *config) GoogleMapsAPIKey() string {
 	return c.googleMapsAPIKey
 }
 
+// GoogleMapsBaseURL 后端请求 Street View 元数据和 Geocoding 的地址，可以指向测试用的模拟服务器
+func (c *config) GoogleMapsBaseURL() string {
+	return c.googleMapsURL
+}
+
+// GoogleMapsSigningSecret Google Maps Platform 的 URL 签名密钥（URL 安全的 Base64 编码），为空时不签名
+func (c *config) GoogleMapsSigningSecret() string {
+	return c.signingSecret
+}
+
+// StreetViewFallbackFile 兜底全景列表的 JSON 文件路径，为空时使用内置列表
+func (c *config) StreetViewFallbackFile() string {
+	return c.fallbackFile
+}
+
+// GeocodeCacheTTL 逆地理编码缓存的有效期，<= 0 表示不使用缓存
+func (c *config) GeocodeCacheTTL() time.Duration {
+	return c.geocodeTTL
+}
+
+// GeocodeCachePrecision 逆地理编码缓存键中坐标保留的小数位数
+func (c *config) GeocodeCachePrecision() int {
+	return c.geocodePrecision
+}
+
+// StreetViewMetadataBudget Street View 元数据请求的每日和每月预算，0 表示不限制
+func (c *config) StreetViewMetadataBudget() (daily, monthly int) {
+	return c.metadataDaily, c.metadataMonthly
+}
+
+// GeocodeBudget Geocoding 请求的每日和每月预算，0 表示不限制
+func (c *config) GeocodeBudget() (daily, monthly int) {
+	return c.geocodeDaily, c.geocodeMonthly
+}
+
+// StreetViewImageBudget Street View Static API 图片请求的每日和每月预算，0 表示不限制
+func (c *config) StreetViewImageBudget() (daily, monthly int) {
+	return c.imageDaily, c.imageMonthly
+}
+
+// StreetViewImageCacheTTL 代理的街景图片的缓存有效期，<= 0 表示不缓存
+func (c *config) StreetViewImageCacheTTL() time.Duration {
+	return c.imageTTL
+}
+
+// StreetViewImageMaxBytes 代理的单张街景图片的最大字节数，超过时拒绝返回和缓存
+func (c *config) StreetViewImageMaxBytes() int {
+	return c.imageMaxBytes
+}
+
+// AdminToken 管理接口的访问令牌，为空时不启用管理接口
+func (c *config) AdminToken() string {
+	return c.adminToken
+}
+
 func (c *config) EnableOpenAI() bool {
 	return c.enableOpenAI
 }
@@ -88,6 +206,46 @@ func (c *config) EnableGoogleAPI() bool {
 	return c.enableGoogleAPI
 }
 
+// OfflineMode 是否以完全离线模式运行，开启时同时禁用 AI 和 Google API
+func (c *config) OfflineMode() bool {
+	return c.offlineMode
+}
+
+// DescriptionCacheTTL AI 描述缓存的新鲜度窗口，<= 0 表示不使用缓存
+func (c *config) DescriptionCacheTTL() time.Duration {
+	return c.descriptionTTL
+}
+
+// ChatMaxTurns 每个会话针对同一全景图最多可以追问的次数
+func (c *config) ChatMaxTurns() int {
+	return c.chatMaxTurns
+}
+
+// ChatTokenBudget 每个会话针对同一全景图的追问对话可消耗的 token 总数
+func (c *config) ChatTokenBudget() int {
+	return c.chatTokenBudget
+}
+
+// ChatThreadTTL 追问对话在最后一次提问后保留的时间，<= 0 表示不过期
+func (c *config) ChatThreadTTL() time.Duration {
+	return c.chatThreadTTL
+}
+
+// LocationPoolSize 每个预生成位置池补充到的位置数量，<= 0 表示不使用位置池
+func (c *config) LocationPoolSize() int {
+	return c.poolSize
+}
+
+// LocationPoolLowWater 位置池低于该数量时开始补充
+func (c *config) LocationPoolLowWater() int {
+	return c.poolLowWater
+}
+
+// LocationPoolRefillInterval 后台检查位置池的间隔
+func (c *config) LocationPoolRefillInterval() time.Duration {
+	return c.poolRefill
+}
+
 func (c *config) SecurityConfig() *SecurityConfig {
 	return c.securityConfig
 }
@@ -134,14 +292,41 @@ func New() Config {
 		// 忽略错误，因为在生产环境中通常不使用 .env 文件
 	}
 
+	offlineMode := getEnvOrDefault("OFFLINE_MODE", "false") == "true"
+
 	cfg := &config{
 		serverAddress:    getEnvOrDefault("SERVER_ADDRESS", ":8080"),
 		redisAddress:     getEnvOrDefault("REDIS_ADDRESS", "localhost:6379"),
 		redisPassword:    os.Getenv("REDIS_PASSWORD"),
+		redisDB:          getEnvAsIntOrDefault("REDIS_DB", 0),
+		storageBackend:   strings.ToLower(getEnvOrDefault("STORAGE_BACKEND", "redis")),
+		boltPath:         getEnvOrDefault("BOLT_PATH", "data/streetview.db"),
 		openAIAPIKey:     os.Getenv("AI_API_KEY"),
 		googleMapsAPIKey: os.Getenv("GOOGLE_API_KEY"),
-		enableOpenAI:     getEnvOrDefault("ENABLE_AI", "true") == "true",
-		enableGoogleAPI:  getEnvOrDefault("ENABLE_GOOGLE_API", "true") == "true",
+		googleMapsURL:    getEnvOrDefault("GOOGLE_MAPS_BASE_URL", "https://maps.googleapis.com"),
+		signingSecret:    os.Getenv("GOOGLE_MAPS_SIGNING_SECRET"),
+		fallbackFile:     os.Getenv("STREETVIEW_FALLBACK_FILE"),
+		geocodeTTL:       time.Duration(getEnvAsIntOrDefault("GEOCODE_CACHE_TTL_HOURS", 720)) * time.Hour,
+		geocodePrecision: getEnvAsIntOrDefault("GEOCODE_CACHE_PRECISION", 4),
+		metadataDaily:    getEnvAsIntOrDefault("STREETVIEW_METADATA_DAILY_BUDGET", 0),
+		metadataMonthly:  getEnvAsIntOrDefault("STREETVIEW_METADATA_MONTHLY_BUDGET", 0),
+		geocodeDaily:     getEnvAsIntOrDefault("GEOCODE_DAILY_BUDGET", 0),
+		geocodeMonthly:   getEnvAsIntOrDefault("GEOCODE_MONTHLY_BUDGET", 0),
+		imageDaily:       getEnvAsIntOrDefault("STREETVIEW_IMAGE_DAILY_BUDGET", 0),
+		imageMonthly:     getEnvAsIntOrDefault("STREETVIEW_IMAGE_MONTHLY_BUDGET", 0),
+		imageTTL:         time.Duration(getEnvAsIntOrDefault("STREETVIEW_IMAGE_CACHE_TTL_HOURS", 24)) * time.Hour,
+		imageMaxBytes:    getEnvAsIntOrDefault("STREETVIEW_IMAGE_MAX_BYTES", 1024*1024),
+		adminToken:       os.Getenv("ADMIN_TOKEN"),
+		enableOpenAI:     !offlineMode && getEnvOrDefault("ENABLE_AI", "true") == "true",
+		enableGoogleAPI:  !offlineMode && getEnvOrDefault("ENABLE_GOOGLE_API", "true") == "true",
+		offlineMode:      offlineMode,
+		descriptionTTL:   time.Duration(getEnvAsIntOrDefault("DESCRIPTION_CACHE_TTL_HOURS", 720)) * time.Hour,
+		chatMaxTurns:     getEnvAsIntOrDefault("CHAT_MAX_TURNS", 10),
+		chatTokenBudget:  getEnvAsIntOrDefault("CHAT_TOKEN_BUDGET", 30000),
+		chatThreadTTL:    time.Duration(getEnvAsIntOrDefault("CHAT_THREAD_TTL_HOURS", 24)) * time.Hour,
+		poolSize:         getEnvAsIntOrDefault("LOCATION_POOL_SIZE", 0),
+		poolLowWater:     getEnvAsIntOrDefault("LOCATION_POOL_LOW_WATER", 5),
+		poolRefill:       time.Duration(getEnvAsIntOrDefault("LOCATION_POOL_REFILL_INTERVAL_SECONDS", 30)) * time.Second,
 		proxyURL:         os.Getenv("PROXY_URL"),
 		proxyType:        getEnvOrDefault("PROXY_TYPE", "http"),
 		proxyUser:        os.Getenv("PROXY_USER"),
@@ -151,6 +336,8 @@ func New() Config {
 		skipProxyCheck:   false,
 	}
 
+	cfg.llmModels = loadLLMModels(cfg.openAIAPIKey)
+
 	// 加载安全配置
 	cfg.securityConfig = &SecurityConfig{
 		RateLimit: struct {
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LLM 任务，每个任务可以单独配置模型和调用参数
+const (
+	LLMTaskDescription         = "description"          // 简短描述
+	LLMTaskDetailedDescription = "detailed_description" // 详细描述
+	LLMTaskRegions             = "regions"              // 根据探索兴趣生成区域
+	LLMTaskChat                = "chat"                 // 针对全景图的追问
+)
+
+const (
+	defaultLLMBaseURL = "https://openrouter.ai/api/v1"
+	defaultLLMModel   = "google/gemini-2.5-flash"
+)
+
+// 各任务的默认超时时间
+var defaultLLMTimeouts = map[string]time.Duration{
+	LLMTaskDescription:         15 * time.Second,
+	LLMTaskDetailedDescription: 30 * time.Second,
+	LLMTaskRegions:             15 * time.Second,
+	LLMTaskChat:                30 * time.Second,
+}
+
+// LLMModelConfig 一个 OpenAI 兼容接口上的模型及其调用参数
+type LLMModelConfig struct {
+	BaseURL     string        // 接口地址，例如 https://openrouter.ai/api/v1 或 http://localhost:11434/v1
+	APIKey      string        // 为空时不发送 Authorization 头（本地模型服务通常不需要）
+	Model       string        // 模型名称
+	Temperature *float64      // nil 表示使用服务端默认值
+	MaxTokens   int           // <= 0 表示不限制
+	Timeout     time.Duration // 该模型的超时时间，包括它的所有重试
+}
+
+// LLMModels 返回任务的模型链，第一个为主模型，其余按顺序作为主模型出错或超时时的回退
+func (c *config) LLMModels(task string) []LLMModelConfig {
+	if models, ok := c.llmModels[task]; ok {
+		return models
+	}
+	return c.llmModels[LLMTaskDescription]
+}
+
+// loadLLMModels 读取所有任务的模型配置
+//
+// 全局配置 LLM_BASE_URL / LLM_API_KEY / LLM_MODEL / LLM_TEMPERATURE / LLM_MAX_TOKENS / LLM_FALLBACK_MODELS
+// 可以被任务级配置 LLM_<TASK>_* 覆盖，超时只能按任务配置：LLM_<TASK>_TIMEOUT_SECONDS。
+// 回退模型用逗号分隔，每项可以写成 model 或 model@base_url，其余参数与主模型相同。
+// 接口地址与主模型不同的回退模型不使用主模型的 API Key，而是使用 LLM_FALLBACK_API_KEY / LLM_<TASK>_FALLBACK_API_KEY，
+// 避免把主模型服务商的密钥发送到其他服务。
+func loadLLMModels(aiAPIKey string) map[string][]LLMModelConfig {
+	global := LLMModelConfig{
+		BaseURL:     getEnvOrDefault("LLM_BASE_URL", defaultLLMBaseURL),
+		APIKey:      getEnvOrDefault("LLM_API_KEY", aiAPIKey),
+		Model:       getEnvOrDefault("LLM_MODEL", defaultLLMModel),
+		Temperature: getEnvAsFloatPointer("LLM_TEMPERATURE", nil),
+		MaxTokens:   getEnvAsIntOrDefault("LLM_MAX_TOKENS", 0),
+	}
+	globalFallbacks := os.Getenv("LLM_FALLBACK_MODELS")
+	globalFallbackKey := os.Getenv("LLM_FALLBACK_API_KEY")
+
+	result := make(map[string][]LLMModelConfig, len(defaultLLMTimeouts))
+	for task, timeout := range defaultLLMTimeouts {
+		prefix := "LLM_" + strings.ToUpper(task) + "_"
+
+		primary := LLMModelConfig{
+			BaseURL:     getEnvOrDefault(prefix+"BASE_URL", global.BaseURL),
+			APIKey:      getEnvOrDefault(prefix+"API_KEY", global.APIKey),
+			Model:       getEnvOrDefault(prefix+"MODEL", global.Model),
+			Temperature: getEnvAsFloatPointer(prefix+"TEMPERATURE", global.Temperature),
+			MaxTokens:   getEnvAsIntOrDefault(prefix+"MAX_TOKENS", global.MaxTokens),
+			Timeout:     time.Duration(getEnvAsIntOrDefault(prefix+"TIMEOUT_SECONDS", int(timeout/time.Second))) * time.Second,
+		}
+
+		chain := []LLMModelConfig{primary}
+		for _, entry := range strings.Split(getEnvOrDefault(prefix+"FALLBACK_MODELS", globalFallbacks), ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			fallback := primary
+			fallback.Model = entry
+			if model, baseURL, ok := strings.Cut(entry, "@"); ok {
+				fallback.Model = strings.TrimSpace(model)
+				fallback.BaseURL = strings.TrimSpace(baseURL)
+			}
+			if !sameBaseURL(fallback.BaseURL, primary.BaseURL) {
+				fallback.APIKey = getEnvOrDefault(prefix+"FALLBACK_API_KEY", globalFallbackKey)
+			}
+			chain = append(chain, fallback)
+		}
+
+		result[task] = chain
+	}
+
+	return result
+}
+
+// sameBaseURL 判断两个接口地址是否相同，忽略末尾的斜杠
+func sameBaseURL(a, b string) bool {
+	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+}
+
+func getEnvAsFloatPointer(key string, defaultValue *float64) *float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return &floatValue
+		}
+	}
+	return defaultValue
+}
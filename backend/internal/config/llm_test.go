@@ -0,0 +1,27 @@
+package config
+
+import "testing"
+
+func TestLLMFallbackAPIKey(t *testing.T) {
+	t.Setenv("LLM_BASE_URL", "https://openrouter.ai/api/v1")
+	t.Setenv("LLM_API_KEY", "primary-key")
+	t.Setenv("LLM_FALLBACK_MODELS", "openai/gpt-4o-mini,llama3.1@http://localhost:11434/v1,other@https://openrouter.ai/api/v1/")
+	t.Setenv("LLM_CHAT_FALLBACK_API_KEY", "chat-fallback-key")
+
+	chain := loadLLMModels("")[LLMTaskDescription]
+	if len(chain) != 4 {
+		t.Fatalf("模型链应该有 4 个模型，实际为 %d", len(chain))
+	}
+	if chain[1].APIKey != "primary-key" || chain[3].APIKey != "primary-key" {
+		t.Errorf("同一接口地址的回退模型应该使用主模型的 API Key: %+v", chain)
+	}
+	if chain[2].BaseURL != "http://localhost:11434/v1" || chain[2].APIKey != "" {
+		t.Errorf("其他接口地址的回退模型不应该使用主模型的 API Key: %+v", chain[2])
+	}
+
+	// 任务级的回退 API Key 只用于其他接口地址的回退模型
+	chat := loadLLMModels("")[LLMTaskChat]
+	if chat[2].APIKey != "chat-fallback-key" || chat[1].APIKey != "primary-key" {
+		t.Errorf("回退 API Key 不正确: %+v", chat)
+	}
+}
@@ -0,0 +1,112 @@
+package i18n
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/language"
+)
+
+// 检测所需的最少字母数，文本太短时不做判断
+const minDetectLetters = 20
+
+// latinStopwords 拉丁字母语言的常见虚词，用于区分使用同一种文字的语言
+var latinStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "that", "with", "for", "are", "this", "its", "as", "by", "from"},
+	"es": {"el", "la", "de", "que", "y", "en", "los", "las", "del", "es", "una", "por", "con", "para", "se"},
+	"fr": {"le", "la", "les", "de", "des", "et", "est", "un", "une", "du", "que", "dans", "pour", "qui", "sur"},
+	"de": {"der", "die", "das", "und", "ist", "ein", "eine", "mit", "von", "zu", "den", "im", "nicht", "sich", "auf"},
+	"it": {"il", "la", "di", "che", "e", "è", "un", "una", "per", "del", "della", "con", "sono", "gli", "nel"},
+	"pt": {"o", "a", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "com", "os", "no", "na"},
+}
+
+// DetectLanguage 根据文字和常见虚词粗略检测文本的语言，返回支持语言的代码
+// 文本太短或无法可靠判断时 ok 为 false，中文不区分简体和繁体
+func DetectLanguage(text string) (code string, ok bool) {
+	var han, kana, hangul, cyrillic, latin, letters int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	if letters < minDetectLetters {
+		return "", false
+	}
+
+	share := func(n int) float64 { return float64(n) / float64(letters) }
+	switch {
+	case share(kana) > 0.05:
+		return "ja", true
+	case share(hangul) > 0.3:
+		return "ko", true
+	case share(han) > 0.3:
+		return "zh", true
+	case share(cyrillic) > 0.5:
+		return "ru", true
+	case share(latin) > 0.5:
+		return detectLatin(text)
+	}
+	return "", false
+}
+
+// detectLatin 统计各语言虚词出现的次数，最多的语言需要明显领先第二名
+func detectLatin(text string) (string, bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	counts := make(map[string]int, len(words))
+	for _, word := range words {
+		counts[word]++
+	}
+
+	best, bestScore, secondScore := "", 0, 0
+	for lang, stopwords := range latinStopwords {
+		score := 0
+		for _, word := range stopwords {
+			score += counts[word]
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, secondScore = lang, score, bestScore
+		case score > secondScore:
+			secondScore = score
+		}
+	}
+	if bestScore < 3 || float64(bestScore) < float64(secondScore)*1.5 {
+		return "", false
+	}
+	return best, true
+}
+
+// Detectable 判断 DetectLanguage 能否识别该语言，不能识别的语言不做输出校验
+func Detectable(code string) bool {
+	switch baseLanguage(code) {
+	case "ja", "ko", "zh", "ru":
+		return true
+	}
+	_, ok := latinStopwords[baseLanguage(code)]
+	return ok
+}
+
+// SameLanguage 判断两个语言代码的主语言是否相同，例如 zh 与 zh-TW 相同
+func SameLanguage(a, b string) bool {
+	return baseLanguage(a) == baseLanguage(b)
+}
+
+func baseLanguage(code string) string {
+	base, _ := language.Make(code).Base()
+	return base.String()
+}
@@ -0,0 +1,98 @@
+// Package i18n API 响应的消息目录和语言协商
+// 每种语言对应 locales 目录下的一个 JSON 文件（文件名为语言代码），新增语言时还需要在 languages.go 中注册
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultLanguage 请求语言不受支持或目录中缺少消息时使用的语言
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+var catalog = mustLoadCatalog(localeFiles)
+
+// mustLoadCatalog 读取内嵌的消息目录，目录随程序一起编译，格式错误时直接 panic
+func mustLoadCatalog(fsys fs.FS) map[string]map[string]string {
+	files, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		panic(fmt.Sprintf("读取消息目录失败: %v", err))
+	}
+
+	result := make(map[string]map[string]string, len(files))
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			panic(fmt.Sprintf("读取消息目录 %s 失败: %v", file, err))
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("解析消息目录 %s 失败: %v", file, err))
+		}
+		lang := strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))
+		result[lang] = messages
+	}
+
+	if _, ok := result[DefaultLanguage]; !ok {
+		panic(fmt.Sprintf("消息目录缺少默认语言 %s", DefaultLanguage))
+	}
+	return result
+}
+
+// Languages 返回消息目录支持的语言，按字母排序
+func Languages() []string {
+	langs := make([]string, 0, len(catalog))
+	for lang := range catalog {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Match 返回语言标签对应的目录语言：先按完整标签匹配（例如 zh-tw），再按主语言匹配（例如 zh-CN 匹配 zh）
+func Match(tag string) (string, bool) {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if tag == "" || tag == "*" {
+		return "", false
+	}
+	if _, ok := catalog[tag]; ok {
+		return tag, true
+	}
+	base, _, _ := strings.Cut(tag, "-")
+	if _, ok := catalog[base]; ok {
+		return base, true
+	}
+	return "", false
+}
+
+// Has 判断默认语言的目录中是否有该消息
+func Has(key string) bool {
+	_, ok := catalog[DefaultLanguage][key]
+	return ok
+}
+
+// T 返回 key 在 lang 下的消息，args 非空时按 fmt 格式化
+// lang 不受支持或缺少该消息时使用默认语言，默认语言也没有时返回 key 本身
+func T(lang, key string, args ...interface{}) string {
+	message, ok := "", false
+	if matched, found := Match(lang); found {
+		message, ok = catalog[matched][key]
+	}
+	if !ok {
+		if message, ok = catalog[DefaultLanguage][key]; !ok {
+			return key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
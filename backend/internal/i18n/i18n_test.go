@@ -0,0 +1,46 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+)
+
+// 所有语言的目录都应该覆盖默认语言的全部消息，避免新增消息时遗漏翻译
+func TestCatalogsComplete(t *testing.T) {
+	for _, lang := range Languages() {
+		for key := range catalog[DefaultLanguage] {
+			if _, ok := catalog[lang][key]; !ok {
+				t.Errorf("%s 缺少消息 %s", lang, key)
+			}
+		}
+		for key := range catalog[lang] {
+			if !Has(key) {
+				t.Errorf("%s 中的消息 %s 在默认语言中不存在", lang, key)
+			}
+		}
+	}
+}
+
+// 每种支持的界面和描述语言都应该有自己的消息目录，不能回退到默认语言或同一主语言的其他目录
+func TestCatalogCoversSupportedLanguages(t *testing.T) {
+	for _, lang := range SupportedLanguages() {
+		if matched, ok := Match(lang.Code); !ok || matched != strings.ToLower(lang.Code) {
+			t.Errorf("%s 没有对应的消息目录，实际匹配到 %q", lang.Code, matched)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("zh-Hans-CN", "NOT_FOUND"); got != "请求的资源不存在" {
+		t.Errorf("应该按主语言匹配: %q", got)
+	}
+	if got := T("zh-TW", "NOT_FOUND"); got != "請求的資源不存在" {
+		t.Errorf("繁体中文应该使用 zh-TW 的目录: %q", got)
+	}
+	if got := T("sw", "NOT_FOUND"); got != catalog[DefaultLanguage]["NOT_FOUND"] {
+		t.Errorf("不支持的语言应该回退到默认语言: %q", got)
+	}
+	if got := T("en", "NO_SUCH_KEY"); got != "NO_SUCH_KEY" {
+		t.Errorf("缺少的消息应该返回 key: %q", got)
+	}
+}
@@ -0,0 +1,104 @@
+package i18n
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Language 支持的界面和描述语言
+type Language struct {
+	Code   string // 对外使用的语言代码，同时用于描述缓存的键，例如 zh、zh-TW
+	Name   string // 提示词中使用的英文名称
+	Google string // Google Maps API 的 language 参数
+}
+
+// supportedLanguages 支持的语言，第一个为默认语言
+var supportedLanguages = []Language{
+	{Code: "en", Name: "English", Google: "en"},
+	{Code: "zh", Name: "Simplified Chinese", Google: "zh-CN"},
+	{Code: "zh-TW", Name: "Traditional Chinese", Google: "zh-TW"},
+	{Code: "ja", Name: "Japanese", Google: "ja"},
+	{Code: "ko", Name: "Korean", Google: "ko"},
+	{Code: "es", Name: "Spanish", Google: "es"},
+	{Code: "fr", Name: "French", Google: "fr"},
+	{Code: "de", Name: "German", Google: "de"},
+	{Code: "it", Name: "Italian", Google: "it"},
+	{Code: "pt", Name: "Portuguese", Google: "pt"},
+	{Code: "ru", Name: "Russian", Google: "ru"},
+}
+
+// ErrInvalidLanguage 语言标签不是合法的 BCP-47 标签
+var ErrInvalidLanguage = errors.New("无效的语言标签")
+
+// ErrUnsupportedLanguage 语言标签合法但不受支持
+var ErrUnsupportedLanguage = errors.New("不支持的语言")
+
+var languageMatcher = func() language.Matcher {
+	tags := make([]language.Tag, len(supportedLanguages))
+	for i, lang := range supportedLanguages {
+		tags[i] = language.MustParse(lang.Code)
+	}
+	return language.NewMatcher(tags)
+}()
+
+// SupportedLanguages 返回支持的语言，第一个为默认语言
+func SupportedLanguages() []Language {
+	return append([]Language(nil), supportedLanguages...)
+}
+
+// DefaultSupportedLanguage 请求没有指定语言时使用的语言
+func DefaultSupportedLanguage() Language {
+	return supportedLanguages[0]
+}
+
+// ParseLanguage 校验 BCP-47 语言标签并匹配到支持的语言，例如 zh-CN 匹配 zh、zh-Hant-HK 匹配 zh-TW
+func ParseLanguage(tag string) (Language, error) {
+	parsed, err := language.Parse(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if err != nil {
+		return Language{}, ErrInvalidLanguage
+	}
+	lang, ok := matchLanguage(parsed)
+	if !ok {
+		return Language{}, ErrUnsupportedLanguage
+	}
+	return lang, nil
+}
+
+// matchLanguage 匹配支持的语言，只接受主语言相同的匹配
+// （Matcher 会把斯瓦希里语等语言以较高的可信度匹配到英语，这里不把它当作支持）
+func matchLanguage(tag language.Tag) (Language, bool) {
+	_, index, confidence := languageMatcher.Match(tag)
+	if confidence == language.No {
+		return Language{}, false
+	}
+	lang := supportedLanguages[index]
+	if !SameLanguage(tag.String(), lang.Code) {
+		return Language{}, false
+	}
+	return lang, true
+}
+
+// LookupLanguage 返回语言代码对应的支持语言，不受支持时返回默认语言
+func LookupLanguage(code string) Language {
+	if lang, err := ParseLanguage(code); err == nil {
+		return lang
+	}
+	return DefaultSupportedLanguage()
+}
+
+// Negotiate 从 Accept-Language 请求头中选出最匹配的支持语言代码，没有时返回空字符串
+func Negotiate(acceptLanguage string) string {
+	// 返回的标签已按权重从高到低排序
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil {
+		return ""
+	}
+	for _, tag := range tags {
+		if lang, ok := matchLanguage(tag); ok {
+			return lang.Code
+		}
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package i18n
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseLanguage(t *testing.T) {
+	tests := map[string]string{
+		"en":         "en",
+		"en-GB":      "en",
+		"zh":         "zh",
+		"zh-CN":      "zh",
+		"zh_Hans":    "zh",
+		"zh-TW":      "zh-TW",
+		"zh-Hant-HK": "zh-TW",
+		"ja-JP":      "ja",
+		"pt-BR":      "pt",
+	}
+	for tag, want := range tests {
+		lang, err := ParseLanguage(tag)
+		if err != nil || lang.Code != want {
+			t.Errorf("ParseLanguage(%q) = %q, %v，期望 %q", tag, lang.Code, err, want)
+		}
+	}
+
+	if _, err := ParseLanguage("en--US"); !errors.Is(err, ErrInvalidLanguage) {
+		t.Errorf("格式错误的标签应该返回 ErrInvalidLanguage: %v", err)
+	}
+	if _, err := ParseLanguage("sw"); !errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("不支持的语言应该返回 ErrUnsupportedLanguage: %v", err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]string{
+		"":                        "",
+		"zh-CN,zh;q=0.9,en;q=0.8": "zh",
+		"sw-KE,fr;q=0.9,en;q=0.5": "fr",
+		"en;q=0.3, zh-TW;q=0.7":   "zh-TW",
+		"sw, am":                  "",
+	}
+	for header, want := range tests {
+		if got := Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q，期望 %q", header, got, want)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"这条街道两旁是上世纪三十年代建造的石库门住宅，弄堂里至今仍能听到邻居们用上海话聊天。", "zh"},
+		{"この通りは昭和初期に作られた商店街で、今でも地元の人々に愛されています。", "ja"},
+		{"이 거리는 1930년대에 지어진 오래된 주택들로 둘러싸여 있으며 지금도 많은 사람들이 찾습니다.", "ko"},
+		{"Эта улица застроена домами тридцатых годов, и здесь до сих пор живут местные жители.", "ru"},
+		{"This street is lined with houses built in the thirties, and the neighbours still chat on the corner of the square.", "en"},
+		{"Esta calle está llena de casas de los años treinta y los vecinos todavía se reúnen en la plaza del barrio.", "es"},
+		{"Cette rue est bordée de maisons des années trente et les habitants se retrouvent encore sur la place du quartier.", "fr"},
+		{"Diese Straße ist von Häusern aus den dreißiger Jahren gesäumt, und die Nachbarn treffen sich noch auf dem Platz.", "de"},
+	}
+	for _, tt := range tests {
+		if got, ok := DetectLanguage(tt.text); !ok || got != tt.want {
+			t.Errorf("DetectLanguage(%q) = %q, %v，期望 %q", tt.text, got, ok, tt.want)
+		}
+	}
+
+	if _, ok := DetectLanguage("Hello!"); ok {
+		t.Error("文本太短时不应该给出判断")
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import "errors"
+
+// 错误分类。openai、services、repositories 产生的错误通过 Classify / NewError 标记分类并用 %w 逐层包装，
+// API 层用 errors.Is 判断分类，统一映射为 HTTP 状态码和错误码
+var (
+	ErrInvalidInput        = errors.New("输入参数无效")
+	ErrNotFound            = errors.New("资源不存在")
+	ErrTimeout             = errors.New("请求超时")
+	ErrUpstreamUnavailable = errors.New("上游服务暂时不可用")
+	ErrQuotaExhausted      = errors.New("配额已用完")
+	ErrRateLimited         = errors.New("请求过于频繁")
+	ErrInvalidInterest     = errors.New("无法理解该探索兴趣")
+	ErrNoStreetView        = errors.New("未找到可用的街景")
+)
+
+// Error 带分类的错误。Error() 保留原始错误信息，errors.Is 同时匹配分类和原始错误链
+type Error struct {
+	Kind    error  // 错误分类，取值为上面的分类之一
+	Code    string // 消息目录中的错误码，API 层据此输出本地化的说明
+	Message string // 可以直接展示给用户的说明，Code 为空或目录中没有对应消息时使用
+	Err     error  // 原始错误
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Classify 为错误标记分类，err 或 kind 为 nil 时原样返回 err
+func Classify(kind, err error) error {
+	if err == nil || kind == nil {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// NewError 创建带分类的错误，code 为消息目录中的错误码（可以为空），message 同时作为错误信息和默认说明
+func NewError(kind error, code, message string) error {
+	return &Error{Kind: kind, Code: code, Message: message, Err: errors.New(message)}
+}
+
+// Detail 返回错误链上最外层带说明的分类错误的错误码和用户可见说明，没有时均为空字符串
+func Detail(err error) (code, message string) {
+	switch e := err.(type) {
+	case nil:
+		return "", ""
+	case *Error:
+		if e.Code != "" || e.Message != "" {
+			return e.Code, e.Message
+		}
+		return Detail(e.Err)
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			if code, message = Detail(inner); code != "" || message != "" {
+				return code, message
+			}
+		}
+		return "", ""
+	case interface{ Unwrap() error }:
+		return Detail(e.Unwrap())
+	}
+	return "", ""
+}
@@ -0,0 +1,205 @@
+package models
+
+import "sort"
+
+// 逆地理编码结果的来源
+const (
+	GeocodeSourceGoogle  = "google"
+	GeocodeSourceOffline = "offline" // 基于 Natural Earth 数据的离线地理编码，只包含国家和州/省
+	GeocodeSourceMock    = "mock"    // 离线数据也不可用时的模拟地址
+)
+
+// GeocodeResult 一次逆地理编码的完整结果
+// Results 保留上游返回的所有结果，按具体程度从高到低排列，第一个是最具体的结果（通常是门牌地址）
+type GeocodeResult struct {
+	Source   string         `json:"source"`              // 结果来源：google / offline / mock
+	Language string         `json:"language"`            // 地址使用的语言代码
+	PlusCode PlusCode       `json:"plus_code,omitempty"` // 坐标本身的 Plus Code
+	Results  []GeocodePlace `json:"results"`
+}
+
+// GeocodePlace 逆地理编码返回的一个地点
+type GeocodePlace struct {
+	PlaceID          string            `json:"place_id,omitempty"`
+	FormattedAddress string            `json:"formatted_address"`
+	Types            []string          `json:"types,omitempty"`              // 地点类型，例如 street_address、locality、country
+	LocationType     string            `json:"location_type,omitempty"`      // 坐标精度，例如 ROOFTOP、APPROXIMATE
+	Address          AddressHierarchy  `json:"address"`                      // 按层级整理的地址组件
+	PointsOfInterest []PointOfInterest `json:"points_of_interest,omitempty"` // 地址组件中的兴趣点和自然地物
+	PlusCode         PlusCode          `json:"plus_code,omitempty"`
+	Viewport         *Viewport         `json:"viewport,omitempty"`
+}
+
+// AddressHierarchy 按从具体到宽泛的层级整理的地址组件，没有的层级为空字符串
+type AddressHierarchy struct {
+	StreetNumber      string `json:"street_number,omitempty"`
+	Route             string `json:"route,omitempty"`
+	Intersection      string `json:"intersection,omitempty"`
+	Premise           string `json:"premise,omitempty"`    // 建筑
+	Subpremise        string `json:"subpremise,omitempty"` // 单元
+	Neighborhood      string `json:"neighborhood,omitempty"`
+	Sublocality       string `json:"sublocality,omitempty"`
+	SublocalityLevel2 string `json:"sublocality_level_2,omitempty"`
+	City              string `json:"city,omitempty"`
+	PostalTown        string `json:"postal_town,omitempty"`
+	ColloquialArea    string `json:"colloquial_area,omitempty"`
+	Subdistrict       string `json:"subdistrict,omitempty"` // 三级行政区
+	County            string `json:"county,omitempty"`      // 二级行政区
+	StateProvince     string `json:"state_province,omitempty"`
+	StateProvinceCode string `json:"state_province_code,omitempty"`
+	Country           string `json:"country,omitempty"`
+	CountryCode       string `json:"country_code,omitempty"`
+	PostalCode        string `json:"postal_code,omitempty"`
+	PostalCodeSuffix  string `json:"postal_code_suffix,omitempty"`
+}
+
+// PointOfInterest 地址组件中的兴趣点，例如公园、车站、大学
+type PointOfInterest struct {
+	Name  string   `json:"name"`
+	Types []string `json:"types,omitempty"`
+}
+
+// PlusCode Open Location Code
+type PlusCode struct {
+	GlobalCode   string `json:"global_code,omitempty"`
+	CompoundCode string `json:"compound_code,omitempty"`
+}
+
+// Viewport 推荐的显示范围
+type Viewport struct {
+	North float64 `json:"north"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	West  float64 `json:"west"`
+}
+
+// placeTypeRank 地点类型的具体程度，数值越小越具体，未列出的类型排在已知类型之后
+var placeTypeRank = map[string]int{
+	"subpremise":                  0,
+	"premise":                     1,
+	"street_address":              1,
+	"establishment":               2,
+	"point_of_interest":           2,
+	"intersection":                3,
+	"route":                       3,
+	"plus_code":                   4,
+	"neighborhood":                5,
+	"sublocality_level_2":         5,
+	"sublocality_level_1":         6,
+	"sublocality":                 6,
+	"postal_code":                 7,
+	"locality":                    8,
+	"postal_town":                 8,
+	"colloquial_area":             9,
+	"administrative_area_level_4": 9,
+	"administrative_area_level_3": 10,
+	"administrative_area_level_2": 11,
+	"administrative_area_level_1": 12,
+	"country":                     13,
+}
+
+// specificity 返回地点的具体程度，取所有类型中最具体的一个
+func (p GeocodePlace) specificity() int {
+	rank := len(placeTypeRank) + 1
+	for _, t := range p.Types {
+		if r, ok := placeTypeRank[t]; ok && r < rank {
+			rank = r
+		}
+	}
+	return rank
+}
+
+// SortBySpecificity 把结果按具体程度从高到低排列，具体程度相同的保持原有顺序
+func (r *GeocodeResult) SortBySpecificity() {
+	sort.SliceStable(r.Results, func(i, j int) bool {
+		return r.Results[i].specificity() < r.Results[j].specificity()
+	})
+}
+
+// Best 返回最具体的结果，没有结果时返回空地点
+func (r GeocodeResult) Best() GeocodePlace {
+	if len(r.Results) == 0 {
+		return GeocodePlace{}
+	}
+	return r.Results[0]
+}
+
+// FormattedAddress 返回最具体的结果的完整地址
+func (r GeocodeResult) FormattedAddress() string {
+	return r.Best().FormattedAddress
+}
+
+// Address 合并所有结果的地址层级，优先使用更具体的结果中的值
+// 最具体的结果有时缺少部分层级（例如 plus_code 结果没有街道），由更宽泛的结果补齐
+func (r GeocodeResult) Address() AddressHierarchy {
+	var merged AddressHierarchy
+	for _, place := range r.Results {
+		a := place.Address
+		fill := func(dst *string, src string) {
+			if *dst == "" {
+				*dst = src
+			}
+		}
+		fill(&merged.StreetNumber, a.StreetNumber)
+		fill(&merged.Route, a.Route)
+		fill(&merged.Intersection, a.Intersection)
+		fill(&merged.Premise, a.Premise)
+		fill(&merged.Subpremise, a.Subpremise)
+		fill(&merged.Neighborhood, a.Neighborhood)
+		fill(&merged.Sublocality, a.Sublocality)
+		fill(&merged.SublocalityLevel2, a.SublocalityLevel2)
+		fill(&merged.City, a.City)
+		fill(&merged.PostalTown, a.PostalTown)
+		fill(&merged.ColloquialArea, a.ColloquialArea)
+		fill(&merged.Subdistrict, a.Subdistrict)
+		fill(&merged.County, a.County)
+		fill(&merged.StateProvince, a.StateProvince)
+		fill(&merged.StateProvinceCode, a.StateProvinceCode)
+		fill(&merged.Country, a.Country)
+		fill(&merged.CountryCode, a.CountryCode)
+		fill(&merged.PostalCode, a.PostalCode)
+		fill(&merged.PostalCodeSuffix, a.PostalCodeSuffix)
+	}
+	return merged
+}
+
+// Clone 返回深拷贝，缓存和内存仓库中保存的结果不与调用方共享
+func (r *GeocodeResult) Clone() *GeocodeResult {
+	if r == nil {
+		return nil
+	}
+	clone := *r
+	clone.Results = make([]GeocodePlace, len(r.Results))
+	for i, place := range r.Results {
+		place.Types = append([]string(nil), place.Types...)
+		if place.PointsOfInterest != nil {
+			pois := make([]PointOfInterest, len(place.PointsOfInterest))
+			for j, poi := range place.PointsOfInterest {
+				poi.Types = append([]string(nil), poi.Types...)
+				pois[j] = poi
+			}
+			place.PointsOfInterest = pois
+		}
+		if place.Viewport != nil {
+			viewport := *place.Viewport
+			place.Viewport = &viewport
+		}
+		clone.Results[i] = place
+	}
+	return &clone
+}
+
+// PointsOfInterest 返回所有结果中的兴趣点，按名称去重，保持从具体到宽泛的顺序
+func (r GeocodeResult) PointsOfInterest() []PointOfInterest {
+	var pois []PointOfInterest
+	seen := make(map[string]bool)
+	for _, place := range r.Results {
+		for _, poi := range place.PointsOfInterest {
+			if !seen[poi.Name] {
+				seen[poi.Name] = true
+				pois = append(pois, poi)
+			}
+		}
+	}
+	return pois
+}
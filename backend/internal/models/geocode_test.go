@@ -0,0 +1,49 @@
+package models
+
+import "testing"
+
+func TestGeocodeResultSortAndMerge(t *testing.T) {
+	result := GeocodeResult{Results: []GeocodePlace{
+		{PlaceID: "country", Types: []string{"country", "political"}, Address: AddressHierarchy{Country: "Japan", CountryCode: "JP"}},
+		{PlaceID: "unknown", Types: []string{"archipelago"}},
+		{PlaceID: "plus_code", Types: []string{"plus_code"}, Address: AddressHierarchy{City: "Shibuya", Country: "Japan"}},
+		{PlaceID: "address", Types: []string{"street_address"}, FormattedAddress: "1 Dogenzaka", Address: AddressHierarchy{Route: "Dogenzaka"}},
+	}}
+	result.SortBySpecificity()
+
+	want := []string{"address", "plus_code", "country", "unknown"}
+	for i, place := range result.Results {
+		if place.PlaceID != want[i] {
+			t.Fatalf("第 %d 个结果为 %s，期望 %s", i, place.PlaceID, want[i])
+		}
+	}
+	if result.FormattedAddress() != "1 Dogenzaka" {
+		t.Errorf("完整地址为 %q，期望最具体的结果的地址", result.FormattedAddress())
+	}
+
+	address := result.Address()
+	if address.Route != "Dogenzaka" || address.City != "Shibuya" || address.CountryCode != "JP" {
+		t.Errorf("合并后的地址层级不正确: %+v", address)
+	}
+}
+
+func TestGeocodeResultClone(t *testing.T) {
+	original := &GeocodeResult{Results: []GeocodePlace{{
+		Types:            []string{"park"},
+		PointsOfInterest: []PointOfInterest{{Name: "Yoyogi Park", Types: []string{"park"}}},
+		Viewport:         &Viewport{North: 1},
+	}}}
+
+	clone := original.Clone()
+	clone.Results[0].Types[0] = "changed"
+	clone.Results[0].PointsOfInterest[0].Types[0] = "changed"
+	clone.Results[0].Viewport.North = 2
+
+	place := original.Results[0]
+	if place.Types[0] != "park" || place.PointsOfInterest[0].Types[0] != "park" || place.Viewport.North != 1 {
+		t.Errorf("修改副本影响了原结果: %+v", place)
+	}
+	if (*GeocodeResult)(nil).Clone() != nil {
+		t.Error("nil 的副本应为 nil")
+	}
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
 
 type Location struct {
 	// 基础坐标信息
@@ -8,18 +12,21 @@ type Location struct {
 	Longitude float64 `json:"longitude"` // 实际街景经度
 
 	// Street View 元数据
-	PanoID string `json:"pano_id"` // 街景全景图ID
+	PanoID      string `json:"pano_id"`                // 街景全景图ID
+	CaptureDate string `json:"capture_date,omitempty"` // 拍摄年月，例如 2023-05
+	Copyright   string `json:"copyright,omitempty"`    // 版权信息，例如 © Google
 
 	// 地理位置信息
-	FormattedAddress string `json:"formatted_address"` // 格式化地址
-	Country          string `json:"country"`           // 国家
-	City             string `json:"city"`              // 城市
+	FormattedAddress string         `json:"formatted_address"` // 格式化地址
+	Country          string         `json:"country"`           // 国家
+	City             string         `json:"city"`              // 城市
+	Geocode          *GeocodeResult `json:"geocode,omitempty"` // 完整的逆地理编码结果，旧记录可能没有
 
 	// AI 生成的内容
 	AIDescription        string    `json:"ai_description"`        // AI 生成的描述
 	DescriptionLanguage  string    `json:"description_language"`  // 描述语言
 	DescriptionGenerated time.Time `json:"description_generated"` // 描述生成时间
-	ConversationHistory  string    `json:"conversation_history"`  // 对话历史（JSON格式）
+	ConversationHistory  string    `json:"-"`                     // 对话历史（JSON格式），包含系统提示词，只保存在存储中不返回给客户端
 
 	// 元数据
 	CreatedAt      time.Time `json:"created_at"`       // 创建时间
@@ -27,3 +34,86 @@ type Location struct {
 	AccessCount    int       `json:"access_count"`     // 访问次数
 	IsMock         bool      `json:"is_mock"`          // 是否为 mock 数据
 }
+
+// captureDatePattern 拍摄日期格式，Google 返回 YYYY-MM，筛选条件也可以只写年份
+var captureDatePattern = regexp.MustCompile(`^\d{4}(-(0[1-9]|1[0-2]))?$`)
+
+// CaptureDateRange 街景拍摄日期范围，From 和 To 为 YYYY 或 YYYY-MM，空字符串表示不限制
+type CaptureDateRange struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// ParseCaptureDateRange 解析拍摄日期范围，From 只写年份时从该年 1 月开始，To 只写年份时到该年 12 月为止
+func ParseCaptureDateRange(from, to string) (CaptureDateRange, error) {
+	for _, date := range []string{from, to} {
+		if date != "" && !captureDatePattern.MatchString(date) {
+			return CaptureDateRange{}, fmt.Errorf("拍摄日期格式无效: %s", date)
+		}
+	}
+	if len(from) == 4 {
+		from += "-01"
+	}
+	if len(to) == 4 {
+		to += "-12"
+	}
+	if from != "" && to != "" && from > to {
+		return CaptureDateRange{}, fmt.Errorf("拍摄日期范围无效: %s 晚于 %s", from, to)
+	}
+	return CaptureDateRange{From: from, To: to}, nil
+}
+
+// IsZero 判断是否没有日期限制
+func (r CaptureDateRange) IsZero() bool {
+	return r.From == "" && r.To == ""
+}
+
+// Contains 判断拍摄日期是否在范围内，有限制时日期未知的全景不符合条件
+func (r CaptureDateRange) Contains(date string) bool {
+	if r.IsZero() {
+		return true
+	}
+	if len(date) > 7 {
+		date = date[:7]
+	}
+	if !captureDatePattern.MatchString(date) {
+		return false
+	}
+	if len(date) == 4 {
+		date += "-01"
+	}
+	return (r.From == "" || date >= r.From) && (r.To == "" || date <= r.To)
+}
+
+// AI 描述类型
+const (
+	DescriptionShort    = "short"    // 简短描述
+	DescriptionDetailed = "detailed" // 详细描述
+)
+
+// LocationDescription 按全景图ID、语言和描述类型缓存的 AI 描述
+type LocationDescription struct {
+	PanoID      string    `json:"pano_id"`      // 街景全景图ID
+	Language    string    `json:"language"`     // 描述语言
+	Kind        string    `json:"kind"`         // 描述类型：short / detailed
+	Content     string    `json:"content"`      // 描述内容
+	GeneratedAt time.Time `json:"generated_at"` // 生成时间
+}
+
+// GeocodeCacheEntry 按取整后的坐标和语言缓存的逆地理编码结果
+type GeocodeCacheEntry struct {
+	Key       string         `json:"key"`        // 取整后的坐标和语言，例如 35.6595,139.7006:en
+	Result    *GeocodeResult `json:"result"`     // 逆地理编码结果
+	CachedAt  time.Time      `json:"cached_at"`  // 缓存时间
+	ExpiresAt time.Time      `json:"expires_at"` // 过期时间
+}
+
+// StreetViewImageCacheEntry 按全景图ID和视角参数缓存的街景静态图片
+type StreetViewImageCacheEntry struct {
+	Key         string    `json:"key"`          // 全景图ID、视角和尺寸，例如 CAoSLEFG:h90:p0:f90:640x400
+	ContentType string    `json:"content_type"` // 图片类型，例如 image/jpeg
+	Data        []byte    `json:"data"`         // 图片内容
+	ETag        string    `json:"etag"`         // 由图片内容的 SHA-256 摘要生成的强 ETag
+	CachedAt    time.Time `json:"cached_at"`    // 缓存时间
+	ExpiresAt   time.Time `json:"expires_at"`   // 过期时间
+}
@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+func TestParseCaptureDateRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     CaptureDateRange
+		wantErr  bool
+	}{
+		{"不限制", "", "", CaptureDateRange{}, false},
+		{"只写年份", "2019", "2021", CaptureDateRange{From: "2019-01", To: "2021-12"}, false},
+		{"年月", "2019-06", "", CaptureDateRange{From: "2019-06"}, false},
+		{"月份无效", "2019-13", "", CaptureDateRange{}, true},
+		{"格式无效", "19", "", CaptureDateRange{}, true},
+		{"开始晚于结束", "2022", "2021-05", CaptureDateRange{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCaptureDateRange(tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误为 %v，期望出错: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("结果为 %+v，期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptureDateRangeContains(t *testing.T) {
+	dates, _ := ParseCaptureDateRange("2019", "2021-06")
+	tests := map[string]bool{
+		"2018-12": false,
+		"2019-01": true,
+		"2021-06": true,
+		"2021-07": false,
+		"2020":    true,
+		"":        false, // 有限制时日期未知的全景不符合条件
+	}
+	for date, want := range tests {
+		if got := dates.Contains(date); got != want {
+			t.Errorf("%q 为 %v，期望 %v", date, got, want)
+		}
+	}
+	if !(CaptureDateRange{}).Contains("") {
+		t.Error("没有限制时任何全景都符合条件")
+	}
+}
@@ -20,3 +20,33 @@ type Region struct {
 	} `json:"coordinates"`
 	RegionInfo string `json:"region_info"`
 }
+
+// ChatMessage 表示对话中的一条消息
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatThread 表示某个会话针对某个全景图的追问对话
+type ChatThread struct {
+	SessionID  string        `json:"session_id"`
+	PanoID     string        `json:"pano_id"`
+	Language   string        `json:"language"`
+	Messages   []ChatMessage `json:"messages"`    // 完整对话，包含系统提示词和位置上下文
+	Turns      int           `json:"turns"`       // 用户已提问次数
+	TokensUsed int           `json:"tokens_used"` // 已消耗的 token 总数
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	ExpiresAt  time.Time     `json:"expires_at"` // 过期时间，零值表示不过期
+}
+
+// ChatUsage 追问对话的提问次数和 token 用量，与对话内容分开原子计数
+type ChatUsage struct {
+	Turns      int `json:"turns"`
+	TokensUsed int `json:"tokens_used"`
+}
+
+// Expired 判断对话在 now 时是否已过期，没有过期时间的对话不过期
+func (t ChatThread) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
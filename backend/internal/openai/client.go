@@ -1,28 +1,22 @@
 package openai
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
-	"time"
 
+	"github.com/my-streetview-project/backend/internal/config"
+	"github.com/my-streetview-project/backend/internal/i18n"
 	"github.com/my-streetview-project/backend/internal/models"
-	"github.com/my-streetview-project/backend/internal/utils"
 )
 
 const (
-	apiEndpoint = "https://openrouter.ai/api/v1/chat/completions"
-	model       = "google/gemini-2.5-flash"
-	maxRetries  = 2
-	timeout     = 15 * time.Second
-
 	geographerSystemPrompt = "You're a 30-year-old world traveler who's been exploring the globe for 15 years, living in different countries and visiting almost every nation on Earth - though there are still countless hidden corners waiting to be discovered. You have a warm, humorous, and easygoing personality with a touch of wistfulness, seeking life's deeper meaning through your journeys.\n\n" +
 		"Your academic background combines History, Geography, and Anthropology, giving you deep insights into the interconnections between places, peoples, and cultures. You're passionate about cultural diversity, respectful of differences, and approach the world with both curiosity and rationality.\n\n" +
 		"The user provides you with detailed geographic information extracted from Google Maps reverse geocoding. Your primary focus should be on analyzing the most specific geographic unit available (street level, neighborhood, or establishment), while using broader geographic context as supporting information.\n\n" +
@@ -49,29 +43,40 @@ const (
 		"Remember: You're sharing the world through the eyes of someone who truly understands and appreciates the beautiful complexity of human cultures and places, with special attention to the most specific location details available."
 )
 
+// Client 的所有方法都接收调用方的 context，客户端断开或请求超时时会取消对上游的调用
 type Client interface {
-	GenerateLocationDescription(latitude, longitude float64, locationInfo map[string]string, language string) (string, []ChatMessage, error)
-	GenerateDetailedLocationDescription(latitude, longitude float64, locationInfo map[string]string, language string) (string, error)
-	GenerateRegionsForInterest(interest string) ([]models.Region, error)
+	GenerateLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string) (string, []ChatMessage, error)
+	GenerateDetailedLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string, history []ChatMessage) (string, error)
+	GenerateRegionsForInterest(ctx context.Context, interest, language string) ([]models.Region, error)
+	Chat(ctx context.Context, messages []ChatMessage) (string, int, error)
+
+	// 流式版本：每收到一段文本就调用 onDelta，返回值与非流式版本一致
+	// 输出语言不符需要重新生成时先调用 onReset，之前的片段作废，随后流式输出重新生成的内容
+	// onDelta / onReset 返回错误时中止生成（例如客户端已断开）
+	StreamLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string, onDelta func(string) error, onReset func() error) (string, []ChatMessage, error)
+	StreamDetailedLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string, history []ChatMessage, onDelta func(string) error, onReset func() error) (string, error)
+}
+
+// ProviderConfig 提供各任务的模型链配置，由 config.Config 实现
+type ProviderConfig interface {
+	LLMModels(task string) []config.LLMModelConfig
 }
 
 type client struct {
-	apiKey     string
+	cfg        ProviderConfig
 	httpClient *http.Client
 }
 
 type chatRequest struct {
-	Model    string        `json:"model"`
-	Messages []chatMessage `json:"messages"`
+	Model       string        `json:"model"`
+	Messages    []ChatMessage `json:"messages"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Stream      bool          `json:"stream,omitempty"`
 }
 
-type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-// 为了向后兼容保留小写版本
-type chatMessage = ChatMessage
+// ChatMessage 定义在 models 中，以便对话记录可以直接持久化
+type ChatMessage = models.ChatMessage
 
 type chatResponse struct {
 	Choices []struct {
@@ -79,12 +84,27 @@ type chatResponse struct {
 			Content string `json:"content"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage *struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage,omitempty"`
 	Error *struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
-func NewClient(apiKey string) Client {
+// chatStreamChunk 流式响应中每个 data 事件的内容
+type chatStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func NewClient(cfg ProviderConfig) Client {
 	// 从环境变量获取代理URL
 	proxyURLStr := os.Getenv("AI_PROXY_URL")
 	if proxyURLStr == "" {
@@ -99,9 +119,8 @@ func NewClient(apiKey string) Client {
 	proxyUser := os.Getenv("PROXY_USER")
 	proxyPass := os.Getenv("PROXY_PASS")
 
-	httpClient := &http.Client{
-		Timeout: timeout,
-	}
+	// 超时按任务配置，由每次请求的 context 控制
+	httpClient := &http.Client{}
 
 	// 如果设置了代理，配置HTTP客户端使用代理
 	if proxyURLStr != "" {
@@ -161,7 +180,7 @@ func NewClient(apiKey string) Client {
 	}
 
 	return &client{
-		apiKey:     apiKey,
+		cfg:        cfg,
 		httpClient: httpClient,
 	}
 }
@@ -174,250 +193,186 @@ func truncateString(s string, maxLength int) string {
 	return s[:maxLength] + "..."
 }
 
-func (c *client) GenerateLocationDescription(latitude, longitude float64, locationInfo map[string]string, language string) (string, []ChatMessage, error) {
-	startTime := time.Now()
-	timeout := 15 * time.Second
-
-	logger := utils.AILogger()
-	logger.Info("ai_request_start", "Starting AI description generation", map[string]interface{}{
-		"function": "GenerateLocationDescription",
-		"coords":   fmt.Sprintf("(%.6f,%.6f)", latitude, longitude),
-		"language": language,
-		"model":    model,
-		"timeout":  timeout.String(),
-	})
-
-	// 根据语言选择提示词格式
-	outputFormat := "Give it to me in Chinese"
-	if language != "zh" {
-		outputFormat = "Give it to me in English"
-	}
-
-	// 构建详细的地理信息字符串
-	var geoDetails strings.Builder
-	geoDetails.WriteString(fmt.Sprintf("**Complete Address:** %s\n", locationInfo["formatted_address"]))
-	geoDetails.WriteString(fmt.Sprintf("**Coordinates:** (%.6f, %.6f)\n\n", latitude, longitude))
-
-	// 按照地理层级组织信息，从最具体到最广泛
-	geoDetails.WriteString("**Detailed Geographic Components:**\n")
+// GenerateLocationDescription 生成简短描述，同时返回对话历史供详细描述和追问继续使用
+func (c *client) GenerateLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string) (string, []ChatMessage, error) {
+	return c.describe(ctx, "GenerateLocationDescription", latitude, longitude, geocode, language, nil, nil)
+}
 
-	// 最具体层级 - 街道和建筑信息
-	if val, exists := locationInfo["street_number"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Street Number: %s\n", val))
-	}
-	if val, exists := locationInfo["route"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Street/Route: %s\n", val))
-	}
-	if val, exists := locationInfo["intersection"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Intersection: %s\n", val))
-	}
-	if val, exists := locationInfo["premise"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Building/Premise: %s\n", val))
-	}
-	if val, exists := locationInfo["subpremise"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Unit/Subpremise: %s\n", val))
-	}
-	if val, exists := locationInfo["establishment"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Establishment: %s\n", val))
-	}
-	if val, exists := locationInfo["point_of_interest"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Point of Interest: %s\n", val))
-	}
+// StreamLocationDescription 流式生成简短描述
+func (c *client) StreamLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string, onDelta func(string) error, onReset func() error) (string, []ChatMessage, error) {
+	return c.describe(ctx, "StreamLocationDescription", latitude, longitude, geocode, language, onDelta, onReset)
+}
 
-	// 地区层级
-	if val, exists := locationInfo["sublocality"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Neighborhood/Sublocality: %s\n", val))
-	}
-	if val, exists := locationInfo["sublocality_level_1"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Sublocality Level 1: %s\n", val))
-	}
-	if val, exists := locationInfo["sublocality_level_2"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Sublocality Level 2: %s\n", val))
-	}
+func (c *client) describe(ctx context.Context, function string, latitude, longitude float64, geocode *models.GeocodeResult, language string, onDelta func(string) error, onReset func() error) (string, []ChatMessage, error) {
+	messages := buildDescriptionMessages(latitude, longitude, geocode, language)
 
-	// 城市和行政区域
-	if val, exists := locationInfo["locality"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- City/Locality: %s\n", val))
-	}
-	if val, exists := locationInfo["administrative_area_level_3"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Administrative Area Level 3: %s\n", val))
-	}
-	if val, exists := locationInfo["administrative_area_level_2"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Administrative Area Level 2: %s\n", val))
-	}
-	if val, exists := locationInfo["administrative_area_level_1"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Administrative Area Level 1: %s\n", val))
-	}
-
-	// 国家和邮政编码
-	if val, exists := locationInfo["country"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Country: %s\n", val))
-	}
-	if val, exists := locationInfo["postal_code"]; exists && val != "" {
-		if suffix, exists := locationInfo["postal_code_suffix"]; exists && suffix != "" {
-			geoDetails.WriteString(fmt.Sprintf("- Postal Code: %s-%s\n", val, suffix))
-		} else {
-			geoDetails.WriteString(fmt.Sprintf("- Postal Code: %s\n", val))
-		}
+	desc, err := c.completeInLanguage(ctx, config.LLMTaskDescription, function, messages, language, onDelta, onReset)
+	if err != nil {
+		return "", nil, err
 	}
 
-	// Plus Code信息
-	if val, exists := locationInfo["plus_code_global"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Plus Code (Global): %s\n", val))
-	}
-	if val, exists := locationInfo["plus_code_compound"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Plus Code (Compound): %s\n", val))
-	}
-	if val, exists := locationInfo["plus_code"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Plus Code: %s\n", val))
-	}
+	// 返回对话历史以供详细描述使用
+	conversationHistory := append(messages, ChatMessage{
+		Role:    "assistant",
+		Content: desc,
+	})
 
-	// 自然特征
-	if val, exists := locationInfo["natural_feature"]; exists && val != "" {
-		geoDetails.WriteString(fmt.Sprintf("- Natural Feature: %s\n", val))
-	}
+	return desc, conversationHistory, nil
+}
 
+// buildDescriptionMessages 构建简短描述的对话消息（系统提示词 + 地理信息）
+func buildDescriptionMessages(latitude, longitude float64, geocode *models.GeocodeResult, language string) []ChatMessage {
 	prompt := fmt.Sprintf(
 		"%s\n\n"+
 			"**Analysis Instructions:**\n"+
 			"Focus primarily on the most specific geographic information available (street, establishment, or neighborhood level). "+
 			"Use broader geographic context (city, region, country) as supporting information to provide deeper cultural and historical insights.\n\n"+
 			"%s",
-		geoDetails.String(),
-		outputFormat,
+		formatGeoDetails(latitude, longitude, geocode),
+		languageInstruction(language),
 	)
 
-	reqBody := chatRequest{
-		Model: model,
-		Messages: []chatMessage{
-			{
-				Role:    "system",
-				Content: geographerSystemPrompt,
-			},
-			{
-				Role:    "user",
-				Content: prompt,
-			},
+	return []ChatMessage{
+		{
+			Role:    "system",
+			Content: geographerSystemPrompt,
+		},
+		{
+			Role:    "user",
+			Content: prompt,
 		},
 	}
+}
 
-	reqJSON, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", nil, fmt.Errorf("编码请求失败: %w", err)
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// languageInstruction 要求模型全文使用指定语言，language 为支持语言的代码
+func languageInstruction(language string) string {
+	lang := i18n.LookupLanguage(language)
+	return fmt.Sprintf("Write your entire response in %s (language code: %s). Do not switch to any other language, except for proper nouns that are usually written in their original form.", lang.Name, lang.Code)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", apiEndpoint, bytes.NewBuffer(reqJSON))
-	if err != nil {
-		return "", nil, fmt.Errorf("创建请求失败: %w", err)
+// formatGeoDetails 将逆地理编码结果按从具体到宽泛的层级整理成提示词中的地理信息
+// 地址层级合并自所有结果，最具体的结果缺少的层级由更宽泛的结果补齐
+func formatGeoDetails(latitude, longitude float64, geocode *models.GeocodeResult) string {
+	if geocode == nil {
+		geocode = &models.GeocodeResult{}
 	}
+	address := geocode.Address()
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	var geoDetails strings.Builder
+	geoDetails.WriteString(fmt.Sprintf("**Complete Address:** %s\n", geocode.FormattedAddress()))
+	geoDetails.WriteString(fmt.Sprintf("**Coordinates:** (%.6f, %.6f)\n\n", latitude, longitude))
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			log.Printf("[AI_ERROR] action=timeout function=GenerateLocationDescription duration=%v timeout=%v error=request_timeout", time.Since(startTime), timeout)
-			return "", nil, fmt.Errorf("位置描述生成超时")
+	// 按照地理层级组织信息，从最具体到最广泛
+	geoDetails.WriteString("**Detailed Geographic Components:**\n")
+	writeComponent := func(label, value string) {
+		if value != "" {
+			geoDetails.WriteString(fmt.Sprintf("- %s: %s\n", label, value))
 		}
-		log.Printf("[AI_ERROR] action=request_failed function=GenerateLocationDescription duration=%v error=%v", time.Since(startTime), err)
-		return "", nil, fmt.Errorf("发送请求失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("[AI_ERROR] action=read_response_failed function=GenerateLocationDescription duration=%v error=%v", time.Since(startTime), err)
-		return "", nil, fmt.Errorf("读取响应失败: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("[AI_ERROR] action=api_error function=GenerateLocationDescription duration=%v status=%d response=%s", time.Since(startTime), resp.StatusCode, truncateString(string(body), 200))
-		return "", nil, fmt.Errorf("API 请求失败 (状态码: %d): %s", resp.StatusCode, string(body))
+	// 最具体层级 - 街道、建筑和兴趣点
+	writeComponent("Street Number", address.StreetNumber)
+	writeComponent("Street/Route", address.Route)
+	writeComponent("Intersection", address.Intersection)
+	writeComponent("Building/Premise", address.Premise)
+	writeComponent("Unit/Subpremise", address.Subpremise)
+	for _, poi := range geocode.PointsOfInterest() {
+		writeComponent(poiLabel(poi), poi.Name)
 	}
 
-	var chatResp chatResponse
-	if err := json.Unmarshal(body, &chatResp); err != nil {
-		log.Printf("[AI_ERROR] action=parse_failed function=GenerateLocationDescription duration=%v error=%v response=%s", time.Since(startTime), err, truncateString(string(body), 200))
-		return "", nil, fmt.Errorf("解析响应失败: %w", err)
-	}
+	// 地区层级
+	writeComponent("Neighborhood", address.Neighborhood)
+	writeComponent("Sublocality", address.Sublocality)
+	writeComponent("Sublocality Level 2", address.SublocalityLevel2)
+	writeComponent("Colloquial Area", address.ColloquialArea)
 
-	if chatResp.Error != nil {
-		log.Printf("[AI_ERROR] action=api_business_error function=GenerateLocationDescription duration=%v error=%s", time.Since(startTime), chatResp.Error.Message)
-		return "", nil, fmt.Errorf("AI API错误: %s", chatResp.Error.Message)
-	}
+	// 城市和行政区域
+	writeComponent("City/Locality", address.City)
+	writeComponent("Postal Town", address.PostalTown)
+	writeComponent("Administrative Area Level 3", address.Subdistrict)
+	writeComponent("Administrative Area Level 2", address.County)
+	writeComponent("State/Province", address.StateProvince)
 
-	if len(chatResp.Choices) == 0 {
-		log.Printf("[AI_ERROR] action=empty_response function=GenerateLocationDescription duration=%v error=no_choices_returned", time.Since(startTime))
-		return "", nil, fmt.Errorf("AI未返回任何结果")
+	// 国家和邮政编码
+	writeComponent("Country", address.Country)
+	if address.PostalCode != "" && address.PostalCodeSuffix != "" {
+		writeComponent("Postal Code", address.PostalCode+"-"+address.PostalCodeSuffix)
+	} else {
+		writeComponent("Postal Code", address.PostalCode)
 	}
 
-	desc := chatResp.Choices[0].Message.Content
-	logger.Info("ai_request_completed", "AI description generation completed", map[string]interface{}{
-		"function":        "GenerateLocationDescription",
-		"duration":        time.Since(startTime).String(),
-		"response_length": len(desc),
-	})
-
-	// 返回对话历史以供详细描述使用
-	conversationHistory := append(reqBody.Messages, ChatMessage{
-		Role:    "assistant",
-		Content: desc,
-	})
+	// Plus Code信息
+	writeComponent("Plus Code (Global)", geocode.PlusCode.GlobalCode)
+	writeComponent("Plus Code (Compound)", geocode.PlusCode.CompoundCode)
 
-	return desc, conversationHistory, nil
+	return geoDetails.String()
 }
 
-func (c *client) GenerateDetailedLocationDescription(latitude, longitude float64, locationInfo map[string]string, language string) (string, error) {
-	startTime := time.Now()
-	detailedTimeout := 30 * time.Second
-
-	logger := utils.AILogger()
-	logger.Info("ai_request_start", "Starting AI detailed description generation", map[string]interface{}{
-		"function": "GenerateDetailedLocationDescription",
-		"coords":   fmt.Sprintf("(%.6f,%.6f)", latitude, longitude),
-		"language": language,
-		"model":    model,
-		"timeout":  detailedTimeout.String(),
-	})
-
-	ctx, cancel := context.WithTimeout(context.Background(), detailedTimeout)
-	defer cancel()
-
-	// 为详细描述创建一个临时的HTTP客户端，使用更长的超时时间
-	// 重要：避免超时冲突，确保HTTP客户端超时比context超时稍长
-	httpTimeout := detailedTimeout + 5*time.Second
-	detailedHTTPClient := &http.Client{
-		Timeout:   httpTimeout,
-		Transport: c.httpClient.Transport, // 复用原客户端的代理设置
-	}
-
-	// 构建位置信息字符串
-	var locationStrings []string
-	for key, value := range locationInfo {
-		if value != "" {
-			locationStrings = append(locationStrings, fmt.Sprintf("%s: %s", key, value))
+// poiLabel 返回兴趣点在提示词中的标签，自然地物单独标注
+func poiLabel(poi models.PointOfInterest) string {
+	for _, t := range poi.Types {
+		if t == "natural_feature" {
+			return "Natural Feature"
 		}
 	}
-	locationText := strings.Join(locationStrings, ", ")
-	if locationText == "" {
-		locationText = fmt.Sprintf("Coordinates: %.6f, %.6f", latitude, longitude)
+	return "Point of Interest"
+}
+
+// ChatConversation 构建追问对话的初始消息：旅行者人设 + 当前位置的地理信息
+// 用于位置还没有可用的描述对话历史时开启新对话
+func ChatConversation(latitude, longitude float64, geocode *models.GeocodeResult, language string) []ChatMessage {
+	systemPrompt := geographerSystemPrompt + "\n\n" +
+		"**Current Location:**\n" +
+		formatGeoDetails(latitude, longitude, geocode) + "\n" +
+		"Your friend is looking at a Street View panorama taken at this location and will ask you follow-up questions about what they see. " +
+		"Answer conversationally and concisely (under 120 words). If you are not sure about something, say so instead of making it up. " +
+		languageInstruction(language)
+
+	return []ChatMessage{
+		{
+			Role:    "system",
+			Content: systemPrompt,
+		},
 	}
+}
 
-	// 根据语言选择提示词格式
-	outputFormat := "Please respond in Chinese"
-	if language != "zh" {
-		outputFormat = "Please respond in English"
+// DescriptionConversation 根据已有的简短描述重建对话历史，
+// 与 GenerateLocationDescription 返回的对话历史结构一致，用于缓存命中时继续对话
+func DescriptionConversation(latitude, longitude float64, geocode *models.GeocodeResult, language, description string) []ChatMessage {
+	return append(buildDescriptionMessages(latitude, longitude, geocode, language), ChatMessage{
+		Role:    "assistant",
+		Content: description,
+	})
+}
+
+// buildDetailedMessages 构建详细描述的对话消息
+// 有对话历史时追加一轮追问；没有时退化为独立的分析请求
+func buildDetailedMessages(latitude, longitude float64, geocode *models.GeocodeResult, language string, history []ChatMessage) []ChatMessage {
+	if len(history) > 0 {
+		followUp := "That was lovely! Now I'd like a much deeper dive into this place. " +
+			"Building on what you just told me - without repeating it - please give me a comprehensive, professional analysis covering:\n" +
+			"1. Historical Context & Development: Trace the historical evolution, significant events, and cultural development\n" +
+			"2. Architectural & Urban Characteristics: Analyze building styles, urban planning, infrastructure\n" +
+			"3. Cultural & Social Dynamics: Examine local customs, demographics, lifestyle, and social patterns\n" +
+			"4. Economic Profile: Discuss major industries, economic drivers, and commercial activities\n" +
+			"5. Geographic & Environmental Context: Describe natural features, climate, and ecological aspects\n" +
+			"6. Transportation & Connectivity: Analyze transport networks and regional connections\n" +
+			"7. Regional Significance: Explain the location's role within its broader region\n\n" +
+			"Provide professional, in-depth insights that go beyond basic tourist information. Length: 3-5 detailed paragraphs.\n\n" +
+			languageInstruction(language)
+
+		messages := make([]ChatMessage, 0, len(history)+1)
+		messages = append(messages, history...)
+		return append(messages, ChatMessage{
+			Role:    "user",
+			Content: followUp,
+		})
 	}
 
 	// 构建详细分析请求（英文版本）
 	detailedPrompt := fmt.Sprintf(
-		"Please provide a comprehensive, professional analysis report for the following geographic location:\n"+
-			"Coordinates: %.6f, %.6f\n"+
-			"Location Info: %s\n\n"+
+		"Please provide a comprehensive, professional analysis report for the following geographic location:\n\n"+
+			"%s\n"+
 			"Please analyze from the following aspects:\n"+
 			"1. Historical Context & Development: Trace the historical evolution, significant events, and cultural development\n"+
 			"2. Architectural & Urban Characteristics: Analyze building styles, urban planning, infrastructure\n"+
@@ -428,100 +383,41 @@ func (c *client) GenerateDetailedLocationDescription(latitude, longitude float64
 			"7. Regional Significance: Explain the location's role within its broader region\n\n"+
 			"Provide professional, in-depth insights that go beyond basic tourist information. Length: 3-5 detailed paragraphs.\n\n"+
 			"%s",
-		latitude, longitude, locationText, outputFormat)
+		formatGeoDetails(latitude, longitude, geocode), languageInstruction(language))
 
-	// 构建消息
-	messages := []ChatMessage{
+	return []ChatMessage{
 		{
 			Role:    "user",
 			Content: detailedPrompt,
 		},
 	}
+}
 
-	reqBody := chatRequest{
-		Model:    model,
-		Messages: messages,
-	}
-
-	reqJSON, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("编码请求失败: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", apiEndpoint, bytes.NewBuffer(reqJSON))
-	if err != nil {
-		return "", fmt.Errorf("创建请求失败: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-
-	resp, err := detailedHTTPClient.Do(req)
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			log.Printf("[AI_ERROR] action=timeout function=GenerateDetailedLocationDescription duration=%v timeout=%v",
-				time.Since(startTime), detailedTimeout)
-			return "", fmt.Errorf("详细描述生成超时")
-		}
-		log.Printf("[AI_ERROR] action=request_failed function=GenerateDetailedLocationDescription duration=%v error=%v",
-			time.Since(startTime), err)
-		return "", fmt.Errorf("发送请求失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("[AI_ERROR] action=read_response_failed function=GenerateDetailedLocationDescription duration=%v error=%v",
-			time.Since(startTime), err)
-		return "", fmt.Errorf("读取响应失败: %w", err)
-	}
-
-	// 检查HTTP状态码
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("[AI_ERROR] action=api_error function=GenerateDetailedLocationDescription duration=%v status=%d",
-			time.Since(startTime), resp.StatusCode)
-		return "", fmt.Errorf("API 请求失败 (状态码: %d): %s", resp.StatusCode, string(body))
-	}
-
-	var chatResp chatResponse
-	if err := json.Unmarshal(body, &chatResp); err != nil {
-		log.Printf("[AI_ERROR] action=parse_failed function=GenerateDetailedLocationDescription duration=%v error=%v",
-			time.Since(startTime), err)
-		return "", fmt.Errorf("解析响应失败: %w", err)
-	}
-
-	if chatResp.Error != nil {
-		log.Printf("[AI_ERROR] action=api_business_error function=GenerateDetailedLocationDescription duration=%v error=%s",
-			time.Since(startTime), chatResp.Error.Message)
-		return "", fmt.Errorf("AI API错误: %s", chatResp.Error.Message)
-	}
-
-	if len(chatResp.Choices) == 0 {
-		log.Printf("[AI_ERROR] action=empty_response function=GenerateDetailedLocationDescription duration=%v",
-			time.Since(startTime))
-		return "", fmt.Errorf("AI未返回任何结果")
-	}
-
-	result := chatResp.Choices[0].Message.Content
-
-	// 简化的成功日志
-	logger.Info("ai_request_completed", "AI detailed description generation completed", map[string]interface{}{
-		"function":        "GenerateDetailedLocationDescription",
-		"duration":        time.Since(startTime).String(),
-		"response_length": len(result),
-	})
+// GenerateDetailedLocationDescription 生成详细描述
+// history 为简短描述的对话历史，非空时在该对话基础上追问，让详细描述承接用户刚读到的内容而不是重复
+func (c *client) GenerateDetailedLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string, history []ChatMessage) (string, error) {
+	messages := buildDetailedMessages(latitude, longitude, geocode, language, history)
+	return c.completeInLanguage(ctx, config.LLMTaskDetailedDescription, "GenerateDetailedLocationDescription", messages, language, nil, nil)
+}
 
-	return result, nil
+// StreamDetailedLocationDescription 流式生成详细描述，history 的含义与 GenerateDetailedLocationDescription 相同
+func (c *client) StreamDetailedLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string, history []ChatMessage, onDelta func(string) error, onReset func() error) (string, error) {
+	messages := buildDetailedMessages(latitude, longitude, geocode, language, history)
+	return c.completeInLanguage(ctx, config.LLMTaskDetailedDescription, "StreamDetailedLocationDescription", messages, language, onDelta, onReset)
 }
 
-func (c *client) GenerateRegionsForInterest(interest string) ([]models.Region, error) {
-	return c.tryGenerateRegions(interest)
+// Chat 在已有对话的基础上生成下一条回复
+// 第二个返回值为本次请求消耗的 token 数，上游未返回用量时按字符数估算
+func (c *client) Chat(ctx context.Context, messages []ChatMessage) (string, int, error) {
+	return c.complete(ctx, config.LLMTaskChat, "Chat", messages, nil)
 }
 
-func (c *client) tryGenerateRegions(interest string) ([]models.Region, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// GenerateRegionsForInterest 根据探索兴趣生成区域，无法生成时的说明会原样展示给用户，使用 language 书写
+func (c *client) GenerateRegionsForInterest(ctx context.Context, interest, language string) ([]models.Region, error) {
+	return c.tryGenerateRegions(ctx, interest, language)
+}
 
+func (c *client) tryGenerateRegions(ctx context.Context, interest, language string) ([]models.Region, error) {
 	prompt := fmt.Sprintf(
 		"You are a geography expert who needs to generate a list of geographical regions based on the user's exploration theme. "+
 			"Your goal is to interpret ANY input that could possibly be related to geographical locations and convert it into explorable regions.\n\n"+
@@ -574,71 +470,27 @@ func (c *client) tryGenerateRegions(interest string) ([]models.Region, error) {
 			"4. Coordinates should be precise to 3 decimal places\n"+
 			"5. Ensure coordinates are valid (latitude: -90 to 90, longitude: -180 to 180)\n"+
 			"6. Prioritize areas with road access and likely street view coverage\n"+
-			"7. For cities/landmarks, use appropriate coordinate ranges to cover the area",
-		interest,
+			"7. For cities/landmarks, use appropriate coordinate ranges to cover the area\n\n"+
+			"%s Keep the JSON keys exactly as shown; only the text values (region_info, error, explanation) follow this rule.",
+		interest, languageInstruction(language),
 	)
 
-	reqBody := chatRequest{
-		Model: model,
-		Messages: []chatMessage{
-			{
-				Role:    "system",
-				Content: geographerSystemPrompt, // 复用随机探索的system prompt
-			},
-			{
-				Role:    "user",
-				Content: prompt,
-			},
+	messages := []ChatMessage{
+		{
+			Role:    "system",
+			Content: geographerSystemPrompt, // 复用随机探索的system prompt
+		},
+		{
+			Role:    "user",
+			Content: prompt,
 		},
 	}
 
-	reqJSON, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("编码请求失败: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", apiEndpoint, bytes.NewBuffer(reqJSON))
-	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return nil, fmt.Errorf("请求超时")
-		}
-		return nil, fmt.Errorf("发送请求失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	responseContent, _, err := c.complete(ctx, config.LLMTaskRegions, "GenerateRegionsForInterest", messages, nil)
 	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %w", err)
-	}
-
-	// 检查响应状态码
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API 请求失败 (状态码: %d): %s", resp.StatusCode, string(body))
-	}
-
-	var chatResp chatResponse
-	if err := json.Unmarshal(body, &chatResp); err != nil {
-		return nil, fmt.Errorf("解析响应失败: %w", err)
+		return nil, err
 	}
 
-	if chatResp.Error != nil {
-		return nil, fmt.Errorf("AI API错误: %s", chatResp.Error.Message)
-	}
-
-	if len(chatResp.Choices) == 0 {
-		return nil, fmt.Errorf("AI未返回任何结果")
-	}
-
-	responseContent := chatResp.Choices[0].Message.Content
-
 	// 先尝试解析区域数据
 	var result struct {
 		Regions     []models.Region `json:"regions"`
@@ -655,30 +507,30 @@ func (c *client) tryGenerateRegions(interest string) ([]models.Region, error) {
 				// 再次尝试解析清理后的内容
 				if err := json.Unmarshal([]byte(content), &result); err != nil {
 					// 直接返回AI的原始回复内容，让前端展示
-					return nil, fmt.Errorf("%s", responseContent)
+					return nil, models.NewError(models.ErrInvalidInterest, "", responseContent)
 				}
 			} else {
 				// 没有找到完整的JSON结构，直接返回AI的回复
-				return nil, fmt.Errorf("%s", responseContent)
+				return nil, models.NewError(models.ErrInvalidInterest, "", responseContent)
 			}
 		} else {
 			// 没有找到JSON开始标记，直接返回AI的回复
-			return nil, fmt.Errorf("%s", responseContent)
+			return nil, models.NewError(models.ErrInvalidInterest, "", responseContent)
 		}
 	}
 
 	// 检查是否返回了错误信息
 	if result.Error != "" {
 		if result.Explanation != "" {
-			return nil, fmt.Errorf("%s", result.Explanation)
+			return nil, models.NewError(models.ErrInvalidInterest, "", result.Explanation)
 		} else {
-			return nil, fmt.Errorf("%s", result.Error)
+			return nil, models.NewError(models.ErrInvalidInterest, "", result.Error)
 		}
 	}
 
 	// 验证区域数据
 	if len(result.Regions) == 0 {
-		return nil, fmt.Errorf("无法理解该探索兴趣")
+		return nil, models.ErrInvalidInterest
 	}
 
 	// 验证每个区域的数据
@@ -699,7 +551,7 @@ func (c *client) tryGenerateRegions(interest string) ([]models.Region, error) {
 
 	// 如果没有有效区域，返回错误
 	if len(validRegions) == 0 {
-		return nil, fmt.Errorf("无法生成有效的探索区域")
+		return nil, models.Classify(models.ErrInvalidInterest, errors.New("无法生成有效的探索区域"))
 	}
 
 	return validRegions, nil
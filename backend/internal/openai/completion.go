@@ -0,0 +1,336 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/config"
+	"github.com/my-streetview-project/backend/internal/i18n"
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/utils"
+)
+
+// complete 按任务配置的模型链依次请求聊天补全，主模型出错或超时后回退到下一个模型
+// onDelta 非空时使用流式请求；已经向调用方转发过内容后不再回退，避免输出混杂两个模型的结果
+// 每个模型的超时覆盖它的所有重试，整个调用的截止时间为模型链的超时之和
+// 第二个返回值为本次请求消耗的 token 数
+func (c *client) complete(ctx context.Context, task, function string, messages []ChatMessage, onDelta func(string) error) (string, int, error) {
+	chain := c.cfg.LLMModels(task)
+	if len(chain) == 0 {
+		return "", 0, fmt.Errorf("未配置任务 %s 的模型", task)
+	}
+
+	if total := chainTimeout(chain); total > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, total)
+		defer cancel()
+	}
+
+	var lastErr error
+	for i, modelCfg := range chain {
+		if i > 0 {
+			utils.AILogger().Info("ai_model_fallback", "Primary model failed, falling back", map[string]interface{}{
+				"function":       function,
+				"model":          modelCfg.Model,
+				"attempt":        i + 1,
+				"previous_error": lastErr.Error(),
+			})
+		}
+
+		forwarded := false
+		var deltaFn func(string) error
+		if onDelta != nil {
+			deltaFn = func(delta string) error {
+				forwarded = true
+				return onDelta(delta)
+			}
+		}
+
+		// 429、5xx 和网络错误先按重试策略在同一模型上重试，仍失败再回退
+		var content string
+		var tokens int
+		modelCtx, cancel := ctx, context.CancelFunc(func() {})
+		if modelCfg.Timeout > 0 {
+			modelCtx, cancel = context.WithTimeout(ctx, modelCfg.Timeout)
+		}
+		retries, err := utils.Retry(modelCtx, utils.DefaultRetryPolicy, utils.AILogger(), "ai."+function, func(ctx context.Context) error {
+			var err error
+			content, tokens, err = c.completeWith(ctx, modelCfg, function, messages, deltaFn)
+			return err
+		})
+		cancel()
+		if err == nil {
+			if retries > 0 {
+				utils.AILogger().Info("ai_request_retried", "AI request succeeded after retries", map[string]interface{}{
+					"function": function,
+					"model":    modelCfg.Model,
+					"retries":  retries,
+				})
+			}
+			return content, tokens, nil
+		}
+		lastErr = err
+
+		// 调用方已取消时不再尝试其他模型
+		if ctx.Err() != nil || forwarded {
+			break
+		}
+	}
+
+	return "", 0, lastErr
+}
+
+// chainTimeout 返回模型链的超时之和，有模型未设置超时时返回 0 表示不限制
+func chainTimeout(chain []config.LLMModelConfig) time.Duration {
+	var total time.Duration
+	for _, modelCfg := range chain {
+		if modelCfg.Timeout <= 0 {
+			return 0
+		}
+		total += modelCfg.Timeout
+	}
+	return total
+}
+
+// completeInLanguage 请求补全并检测输出语言，检测结果与 language 不一致时追加一轮纠正请求重新生成一次
+// 流式请求先调用 onReset 通知调用方丢弃已转发的片段，再流式输出重新生成的内容；
+// onReset 为 nil 时重新生成的结果不再流式输出，调用方应以返回的完整内容为准
+func (c *client) completeInLanguage(ctx context.Context, task, function string, messages []ChatMessage, language string, onDelta func(string) error, onReset func() error) (string, error) {
+	content, _, err := c.complete(ctx, task, function, messages, onDelta)
+	if err != nil {
+		return "", err
+	}
+
+	detected, ok := i18n.DetectLanguage(content)
+	if !ok || !i18n.Detectable(language) || i18n.SameLanguage(detected, language) {
+		return content, nil
+	}
+
+	lang := i18n.LookupLanguage(language)
+	utils.AILogger().Info("ai_language_mismatch", "Output language differs from requested, regenerating", map[string]interface{}{
+		"function":  function,
+		"requested": lang.Code,
+		"detected":  detected,
+	})
+
+	retry := make([]ChatMessage, 0, len(messages)+2)
+	retry = append(retry, messages...)
+	retry = append(retry,
+		ChatMessage{Role: "assistant", Content: content},
+		ChatMessage{Role: "user", Content: fmt.Sprintf("Your previous answer was not written in %s. Rewrite the same answer entirely in %s.", lang.Name, lang.Name)},
+	)
+	var retryDelta func(string) error
+	if onDelta != nil && onReset != nil {
+		if err := onReset(); err != nil {
+			return "", err
+		}
+		retryDelta = onDelta
+	}
+	regenerated, _, err := c.complete(ctx, task, function, retry, retryDelta)
+	if err != nil {
+		// 重新生成失败时保留第一次的结果
+		utils.AILogger().Error("ai_language_regenerate_failed", "Failed to regenerate in requested language", err, map[string]interface{}{
+			"function":  function,
+			"requested": lang.Code,
+		})
+		return content, nil
+	}
+	return regenerated, nil
+}
+
+// completeWith 使用指定模型发送一次聊天补全请求，ctx 的截止时间即该模型剩余的超时时间
+func (c *client) completeWith(ctx context.Context, modelCfg config.LLMModelConfig, function string, messages []ChatMessage, onDelta func(string) error) (string, int, error) {
+	startTime := time.Now()
+	stream := onDelta != nil
+
+	logger := utils.AILogger()
+	logger.Info("ai_request_start", "Starting AI request", map[string]interface{}{
+		"function": function,
+		"model":    modelCfg.Model,
+		"messages": len(messages),
+		"stream":   stream,
+		"timeout":  modelCfg.Timeout.String(),
+	})
+
+	reqBody := chatRequest{
+		Model:       modelCfg.Model,
+		Messages:    messages,
+		Temperature: modelCfg.Temperature,
+		MaxTokens:   modelCfg.MaxTokens,
+		Stream:      stream,
+	}
+
+	reqJSON, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", 0, fmt.Errorf("编码请求失败: %w", err)
+	}
+
+	// 超时由 complete 按模型设置，同一模型的重试共用
+	req, err := http.NewRequestWithContext(ctx, "POST", chatCompletionsURL(modelCfg.BaseURL), bytes.NewBuffer(reqJSON))
+	if err != nil {
+		return "", 0, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	if modelCfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+modelCfg.APIKey)
+	}
+
+	// contextError 将超时/取消转换为统一的错误，调用方据此区分超时和客户端断开
+	contextError := func() error {
+		if ctx.Err() == context.DeadlineExceeded {
+			log.Printf("[AI_ERROR] action=timeout function=%s model=%s duration=%v timeout=%v", function, modelCfg.Model, time.Since(startTime), modelCfg.Timeout)
+			return models.Classify(models.ErrTimeout, fmt.Errorf("AI 请求超时 (模型: %s)", modelCfg.Model))
+		}
+		log.Printf("[AI_ERROR] action=canceled function=%s model=%s duration=%v", function, modelCfg.Model, time.Since(startTime))
+		return fmt.Errorf("AI 请求已取消: %w", ctx.Err())
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", 0, contextError()
+		}
+		log.Printf("[AI_ERROR] action=request_failed function=%s model=%s duration=%v error=%v", function, modelCfg.Model, time.Since(startTime), err)
+		return "", 0, utils.Retryable(models.Classify(models.ErrUpstreamUnavailable, fmt.Errorf("发送请求失败: %w", err)), 0)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		log.Printf("[AI_ERROR] action=api_error function=%s model=%s duration=%v status=%d response=%s", function, modelCfg.Model, time.Since(startTime), resp.StatusCode, truncateString(string(body), 200))
+		err := models.Classify(utils.StatusErrorKind(resp.StatusCode), fmt.Errorf("API 请求失败 (状态码: %d): %s", resp.StatusCode, string(body)))
+		if utils.RetryableStatus(resp.StatusCode) {
+			return "", 0, utils.Retryable(err, utils.ParseRetryAfter(resp.Header.Get("Retry-After")))
+		}
+		return "", 0, err
+	}
+
+	var content string
+	var tokens int
+	if stream {
+		content, err = readStream(resp.Body, onDelta)
+	} else {
+		content, tokens, err = readCompletion(resp.Body)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", 0, contextError()
+		}
+		log.Printf("[AI_ERROR] action=response_failed function=%s model=%s duration=%v error=%v", function, modelCfg.Model, time.Since(startTime), err)
+		return "", 0, err
+	}
+
+	if content == "" {
+		log.Printf("[AI_ERROR] action=empty_response function=%s model=%s duration=%v", function, modelCfg.Model, time.Since(startTime))
+		return "", 0, fmt.Errorf("AI未返回任何结果")
+	}
+
+	if tokens <= 0 {
+		tokens = EstimateTokens(messages) + EstimateTokens([]ChatMessage{{Role: "assistant", Content: content}})
+	}
+
+	logger.Info("ai_request_completed", "AI request completed", map[string]interface{}{
+		"function":        function,
+		"model":           modelCfg.Model,
+		"duration":        time.Since(startTime).String(),
+		"response_length": len(content),
+		"tokens":          tokens,
+	})
+
+	return content, tokens, nil
+}
+
+// readCompletion 解析非流式响应，返回回复内容和上游报告的 token 用量
+func readCompletion(body io.Reader) (string, int, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", 0, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	var chatResp chatResponse
+	if err := json.Unmarshal(data, &chatResp); err != nil {
+		return "", 0, fmt.Errorf("解析响应失败: %w", err)
+	}
+
+	if chatResp.Error != nil {
+		return "", 0, fmt.Errorf("AI API错误: %s", chatResp.Error.Message)
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return "", 0, fmt.Errorf("AI未返回任何结果")
+	}
+
+	tokens := 0
+	if chatResp.Usage != nil {
+		tokens = chatResp.Usage.TotalTokens
+	}
+
+	return chatResp.Choices[0].Message.Content, tokens, nil
+}
+
+// readStream 解析 SSE 流式响应，逐段转发文本并返回完整内容
+func readStream(body io.Reader, onDelta func(string) error) (string, error) {
+	var content strings.Builder
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// 空行分隔事件，冒号开头的是注释（例如 OpenRouter 的 keep-alive）
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk chatStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", fmt.Errorf("解析流式响应失败: %w", err)
+		}
+		if chunk.Error != nil {
+			return "", fmt.Errorf("AI API错误: %s", chunk.Error.Message)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		content.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return "", err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	return content.String(), nil
+}
+
+// chatCompletionsURL 由接口地址拼出聊天补全端点
+func chatCompletionsURL(baseURL string) string {
+	return strings.TrimRight(baseURL, "/") + "/chat/completions"
+}
+
+// EstimateTokens 粗略估算消息的 token 数（约 4 个字节一个 token），用于上游未返回用量时的预算控制
+func EstimateTokens(messages []ChatMessage) int {
+	total := 0
+	for _, msg := range messages {
+		total += len(msg.Content)/4 + 4
+	}
+	return total
+}
@@ -0,0 +1,236 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/config"
+	"github.com/my-streetview-project/backend/internal/models"
+)
+
+type testProviderConfig []config.LLMModelConfig
+
+func (c testProviderConfig) LLMModels(task string) []config.LLMModelConfig { return c }
+
+// newTestLLMServer 模拟 OpenAI 兼容接口，failModel 对应的模型返回 500
+func newTestLLMServer(t *testing.T, failModel string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Model == failModel {
+			http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusInternalServerError)
+			return
+		}
+
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ": OPENROUTER PROCESSING\n\n")
+			for _, part := range []string{"Hello", ", ", req.Model} {
+				fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", part)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+
+		fmt.Fprintf(w, `{"choices":[{"message":{"content":"reply from %s"}}],"usage":{"total_tokens":42}}`, req.Model)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCompleteFallsBackToNextModel(t *testing.T) {
+	server := newTestLLMServer(t, "primary")
+	c := NewClient(testProviderConfig{
+		{BaseURL: server.URL + "/v1", Model: "primary", Timeout: time.Second},
+		{BaseURL: server.URL + "/v1/", Model: "backup", Timeout: time.Second},
+	})
+
+	reply, tokens, err := c.Chat(context.Background(), []ChatMessage{{Role: "user", Content: "hi"}})
+	if err != nil {
+		t.Fatalf("回退模型应该成功: %v", err)
+	}
+	if reply != "reply from backup" || tokens != 42 {
+		t.Errorf("回复不正确: %q, tokens=%d", reply, tokens)
+	}
+}
+
+func TestCompleteStreamsDeltas(t *testing.T) {
+	server := newTestLLMServer(t, "")
+	c := NewClient(testProviderConfig{
+		{BaseURL: server.URL + "/v1", Model: "streamer", Timeout: time.Second},
+	})
+
+	var deltas []string
+	desc, history, err := c.StreamLocationDescription(context.Background(), 1, 2, nil, "en", func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("流式生成失败: %v", err)
+	}
+	if desc != "Hello, streamer" || strings.Join(deltas, "") != desc || len(deltas) != 3 {
+		t.Errorf("流式内容不正确: %q, %v", desc, deltas)
+	}
+	if len(history) == 0 || history[len(history)-1].Content != desc {
+		t.Errorf("对话历史应该以完整回复结尾: %+v", history)
+	}
+}
+
+func TestCompleteStopsWhenAllModelsFail(t *testing.T) {
+	server := newTestLLMServer(t, "broken")
+	c := NewClient(testProviderConfig{
+		{BaseURL: server.URL + "/v1", Model: "broken", Timeout: time.Second},
+	})
+
+	if _, _, err := c.Chat(context.Background(), []ChatMessage{{Role: "user", Content: "hi"}}); err == nil {
+		t.Error("所有模型失败时应该返回错误")
+	}
+}
+
+func TestCompleteTimeoutCoversRetries(t *testing.T) {
+	// 每次请求 200ms 后返回 500，单次请求不超时，但三次尝试加上重试等待会超过模型的超时
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(200 * time.Millisecond)
+		http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+
+	c := NewClient(testProviderConfig{
+		{BaseURL: server.URL + "/v1", Model: "slow", Timeout: 300 * time.Millisecond},
+	})
+
+	start := time.Now()
+	if _, _, err := c.Chat(context.Background(), []ChatMessage{{Role: "user", Content: "hi"}}); err == nil {
+		t.Fatal("模型失败时应该返回错误")
+	}
+	if elapsed := time.Since(start); elapsed > 600*time.Millisecond {
+		t.Errorf("重试应该受模型超时限制，实际耗时 %v", elapsed)
+	}
+	if got := requests.Load(); got >= int32(3) {
+		t.Errorf("剩余时间不足时不应继续重试，实际请求 %d 次", got)
+	}
+}
+
+func TestCompleteRegeneratesWrongLanguage(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests++
+
+		// 第一次用中文回答，收到纠正请求后改用英文
+		reply := "这条街道两旁是上世纪三十年代建造的石库门住宅，弄堂里至今仍能听到邻居们聊天。"
+		if strings.HasPrefix(req.Messages[len(req.Messages)-1].Content, "Your previous answer") {
+			reply = "This street is lined with houses built in the thirties, and the neighbours still chat in the lanes."
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": reply}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	c := NewClient(testProviderConfig{{BaseURL: server.URL, Model: "m", Timeout: time.Second}})
+	desc, history, err := c.GenerateLocationDescription(context.Background(), 1, 2, nil, "en")
+	if err != nil {
+		t.Fatalf("生成描述失败: %v", err)
+	}
+	if requests != 2 || !strings.HasPrefix(desc, "This street") {
+		t.Errorf("语言不符时应该重新生成一次: requests=%d desc=%q", requests, desc)
+	}
+	if last := history[len(history)-1]; last.Content != desc || len(history) != 3 {
+		t.Errorf("对话历史不应该包含纠正请求: %+v", history)
+	}
+}
+
+func TestCompleteStreamsRegeneratedLanguage(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests++
+
+		// 第一次用中文回答，收到纠正请求后改用英文
+		parts := []string{"这条街道两旁是上世纪三十年代建造的石库门住宅，", "弄堂里至今仍能听到邻居们聊天。"}
+		if strings.HasPrefix(req.Messages[len(req.Messages)-1].Content, "Your previous answer") {
+			parts = []string{"This street is lined with houses built in the thirties, ", "and the neighbours still chat in the lanes."}
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, part := range parts {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", part)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	// 记录收到的事件，reset 之前的片段作废
+	var events []string
+	c := NewClient(testProviderConfig{{BaseURL: server.URL, Model: "m", Timeout: time.Second}})
+	desc, _, err := c.StreamLocationDescription(context.Background(), 1, 2, nil, "en", func(delta string) error {
+		events = append(events, "delta")
+		return nil
+	}, func() error {
+		events = append(events, "reset")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("生成描述失败: %v", err)
+	}
+	if requests != 2 || !strings.HasPrefix(desc, "This street") {
+		t.Errorf("语言不符时应该重新生成一次: requests=%d desc=%q", requests, desc)
+	}
+	if got := strings.Join(events, ","); got != "delta,delta,reset,delta,delta" {
+		t.Errorf("事件顺序为 %s，期望 delta,delta,reset,delta,delta", got)
+	}
+}
+
+func TestGenerateRegionsReturnsReplyForNonJSON(t *testing.T) {
+	var prompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		prompt = string(body)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": "请换一个和地理有关的主题"}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	// 模型没有返回 JSON 时，它的回复作为用户可见说明返回
+	c := NewClient(testProviderConfig{{BaseURL: server.URL, Model: "m", Timeout: time.Second}})
+	_, err := c.GenerateRegionsForInterest(context.Background(), "???", "zh")
+	if !errors.Is(err, models.ErrInvalidInterest) {
+		t.Fatalf("错误应为 ErrInvalidInterest，实际为 %v", err)
+	}
+	if _, message := models.Detail(err); message != "请换一个和地理有关的主题" {
+		t.Errorf("用户可见说明为 %q，期望模型的回复", message)
+	}
+	// 说明会原样展示给用户，提示词要求使用请求语言
+	if !strings.Contains(prompt, "language code: zh") {
+		t.Errorf("提示词应该要求使用请求语言: %s", prompt)
+	}
+}
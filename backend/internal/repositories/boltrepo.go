@@ -0,0 +1,988 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/utils"
+	bolt "go.etcd.io/bbolt"
+)
+
+// bbolt 中的存储桶，相当于关系型数据库中的表
+var (
+	bucketLocations    = []byte("locations")              // pano_id -> 位置信息
+	bucketCountryIndex = []byte("locations_by_country")   // country\x00pano_id -> 空
+	bucketCityIndex    = []byte("locations_by_city")      // city\x00pano_id -> 空
+	bucketDescriptions = []byte("location_descriptions")  // pano_id\x00language\x00kind -> 描述
+	bucketChatThreads  = []byte("chat_threads")           // session_id\x00pano_id -> 追问对话
+	bucketChatUsage    = []byte("chat_usage")             // session_id\x00pano_id -> 追问对话计数
+	bucketGeocodes     = []byte("geocode_cache")          // 取整后的坐标:语言 -> 逆地理编码缓存
+	bucketImages       = []byte("streetview_image_cache") // 全景图ID:视角:尺寸 -> 街景图片缓存
+	bucketImageETags   = []byte("streetview_image_etags") // 全景图ID:视角:尺寸 -> 街景图片 ETag
+	bucketPreferences  = []byte("exploration_preferences")
+	bucketLocationPool = []byte("location_pool") // 池名 -> 子桶（序号 -> 位置信息）
+	bucketAPIUsage     = []byte("api_usage")     // 接口:窗口 -> 用量计数
+)
+
+// 索引键中名称与全景图ID之间的分隔符
+const indexKeySeparator = "\x00"
+
+type BoltConfig interface {
+	BoltPath() string
+}
+
+// boltPruneInterval 清理已过期的缓存和追问对话的间隔
+const boltPruneInterval = time.Hour
+
+// BoltRepository 基于 bbolt 嵌入式数据库的仓库实现，适合无需 Redis 的小型自托管部署
+// 打开后在后台定期清理已过期的缓存，Close 时停止
+type BoltRepository struct {
+	db       *bolt.DB
+	counters *memoryCounters
+	stop     chan struct{}
+	pruned   chan struct{}
+}
+
+func NewBoltRepository(cfg BoltConfig) (*BoltRepository, error) {
+	path := cfg.BoltPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+	}
+
+	// 数据库文件被其他进程占用时，最多等待1秒
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketLocations, bucketCountryIndex, bucketCityIndex, bucketDescriptions, bucketGeocodes, bucketImages, bucketImageETags, bucketChatThreads, bucketChatUsage, bucketPreferences, bucketLocationPool, bucketAPIUsage} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化数据库失败: %w", err)
+	}
+
+	repo := &BoltRepository{
+		db:       db,
+		counters: newMemoryCounters(),
+		stop:     make(chan struct{}),
+		pruned:   make(chan struct{}),
+	}
+	go repo.pruneLoop(boltPruneInterval)
+	return repo, nil
+}
+
+// Close 停止后台清理并关闭数据库文件
+func (r *BoltRepository) Close() error {
+	close(r.stop)
+	<-r.pruned
+	return r.db.Close()
+}
+
+// pruneLoop 打开时清理一次，之后每隔 interval 清理一次
+func (r *BoltRepository) pruneLoop(interval time.Duration) {
+	defer close(r.pruned)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.PruneExpired(); err != nil {
+			utils.SystemLogger().Error("bolt_prune_failed", "Failed to prune expired cache entries", err)
+		}
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PruneExpired 删除已过期的逆地理编码、街景图片和图片 ETag 缓存以及追问对话和计数，返回删除的条目数
+// 缓存的键由坐标和视角组成，对话的键包含会话ID，都很少被重复写入，不清理时数据库文件会持续增长
+// 没有过期时间的追问对话不删除
+func (r *BoltRepository) PruneExpired() (int, error) {
+	now := time.Now()
+	deleted := 0
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketGeocodes, bucketImages, bucketImageETags, bucketChatThreads, bucketChatUsage} {
+			bucket := tx.Bucket(name)
+			keepForever := bytes.Equal(name, bucketChatThreads) || bytes.Equal(name, bucketChatUsage)
+			var expired [][]byte
+			err := bucket.ForEach(func(k, v []byte) error {
+				var entry cacheExpiry
+				if err := json.Unmarshal(v, &entry); err != nil {
+					expired = append(expired, append([]byte(nil), k...))
+					return nil
+				}
+				if keepForever && entry.ExpiresAt.IsZero() {
+					return nil
+				}
+				if !now.Before(entry.ExpiresAt) {
+					expired = append(expired, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range expired {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+			deleted += len(expired)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("清理过期缓存失败: %w", err)
+	}
+	return deleted, nil
+}
+
+// cacheExpiry 缓存条目中用于判断过期的字段
+type cacheExpiry struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SaveLocation 保存位置信息并维护国家、城市索引
+func (r *BoltRepository) SaveLocation(ctx context.Context, location models.Location) error {
+	// 设置创建时间
+	if location.CreatedAt.IsZero() {
+		location.CreatedAt = time.Now()
+	}
+
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		return saveLocationTx(tx, location)
+	})
+	if err != nil {
+		return fmt.Errorf("保存位置信息失败: %w", err)
+	}
+
+	return nil
+}
+
+// saveLocationTx 在事务中保存位置信息，并移除旧记录遗留的索引
+func saveLocationTx(tx *bolt.Tx, location models.Location) error {
+	locations := tx.Bucket(bucketLocations)
+	countryIndex := tx.Bucket(bucketCountryIndex)
+	cityIndex := tx.Bucket(bucketCityIndex)
+
+	key := []byte(location.PanoID)
+
+	// 如果国家或城市发生变化，删除旧的索引项
+	if data := locations.Get(key); data != nil {
+		var previous models.Location
+		if err := decodeLocation(data, &previous); err == nil {
+			if previous.Country != "" && previous.Country != location.Country {
+				if err := countryIndex.Delete(indexKey(previous.Country, previous.PanoID)); err != nil {
+					return err
+				}
+			}
+			if previous.City != "" && previous.City != location.City {
+				if err := cityIndex.Delete(indexKey(previous.City, previous.PanoID)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	data, err := encodeLocation(location)
+	if err != nil {
+		return fmt.Errorf("序列化位置信息失败: %w", err)
+	}
+	if err := locations.Put(key, data); err != nil {
+		return err
+	}
+
+	// 添加到国家和城市的索引中
+	if location.Country != "" {
+		if err := countryIndex.Put(indexKey(location.Country, location.PanoID), nil); err != nil {
+			return err
+		}
+	}
+	if location.City != "" {
+		if err := cityIndex.Put(indexKey(location.City, location.PanoID), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetLocationByPanoID 通过全景图ID获取位置信息
+func (r *BoltRepository) GetLocationByPanoID(ctx context.Context, panoID string) (models.Location, error) {
+	var location models.Location
+
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketLocations).Get([]byte(panoID))
+		if data == nil {
+			return fmt.Errorf("%s: %w", panoID, ErrLocationNotFound)
+		}
+		if err := decodeLocation(data, &location); err != nil {
+			return fmt.Errorf("解析位置信息失败: %w", err)
+		}
+
+		// 更新访问信息
+		location.LastAccessedAt = time.Now()
+		location.AccessCount++
+		return saveLocationTx(tx, location)
+	})
+	if err != nil {
+		return models.Location{}, fmt.Errorf("获取位置信息失败: %w", err)
+	}
+
+	return location, nil
+}
+
+// UpdateLocationDescription 只更新位置记录的简短描述和对话历史
+func (r *BoltRepository) UpdateLocationDescription(ctx context.Context, desc models.LocationDescription, history string) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketLocations).Get([]byte(desc.PanoID))
+		if data == nil {
+			return fmt.Errorf("%s: %w", desc.PanoID, ErrLocationNotFound)
+		}
+		var location models.Location
+		if err := decodeLocation(data, &location); err != nil {
+			return fmt.Errorf("解析位置信息失败: %w", err)
+		}
+
+		setLocationDescription(&location, desc, history)
+		return saveLocationTx(tx, location)
+	})
+	if err != nil {
+		return fmt.Errorf("更新位置描述失败: %w", err)
+	}
+
+	return nil
+}
+
+// SaveDescription 保存 AI 描述缓存
+func (r *BoltRepository) SaveDescription(ctx context.Context, desc models.LocationDescription) error {
+	data, err := json.Marshal(desc)
+	if err != nil {
+		return fmt.Errorf("序列化描述失败: %w", err)
+	}
+
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketDescriptions).Put([]byte(descriptionKey(desc.PanoID, desc.Language, desc.Kind)), data)
+	})
+	if err != nil {
+		return fmt.Errorf("保存描述失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetDescription 获取 AI 描述缓存
+func (r *BoltRepository) GetDescription(ctx context.Context, panoID, language, kind string) (*models.LocationDescription, error) {
+	var desc *models.LocationDescription
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketDescriptions).Get([]byte(descriptionKey(panoID, language, kind)))
+		if data == nil {
+			return nil // 没有缓存
+		}
+		desc = &models.LocationDescription{}
+		return json.Unmarshal(data, desc)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取描述失败: %w", err)
+	}
+
+	return desc, nil
+}
+
+// SaveGeocode 保存逆地理编码缓存，已过期的条目由后台清理删除
+func (r *BoltRepository) SaveGeocode(ctx context.Context, entry models.GeocodeCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化地理编码缓存失败: %w", err)
+	}
+
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketGeocodes).Put([]byte(entry.Key), data)
+	})
+	if err != nil {
+		return fmt.Errorf("保存地理编码缓存失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetGeocode 获取未过期的逆地理编码缓存
+func (r *BoltRepository) GetGeocode(ctx context.Context, key string) (*models.GeocodeCacheEntry, error) {
+	var entry *models.GeocodeCacheEntry
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketGeocodes).Get([]byte(key))
+		if data == nil {
+			return nil // 没有缓存
+		}
+		entry = &models.GeocodeCacheEntry{}
+		return json.Unmarshal(data, entry)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取地理编码缓存失败: %w", err)
+	}
+	if entry != nil && !time.Now().Before(entry.ExpiresAt) {
+		return nil, nil
+	}
+
+	return entry, nil
+}
+
+// SaveStreetViewImage 保存街景图片缓存，已过期的条目在读取时或后台清理时删除
+func (r *BoltRepository) SaveStreetViewImage(ctx context.Context, entry models.StreetViewImageCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化街景图片缓存失败: %w", err)
+	}
+
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketImages).Put([]byte(entry.Key), data)
+	})
+	if err != nil {
+		return fmt.Errorf("保存街景图片缓存失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetStreetViewImage 获取未过期的街景图片缓存，图片占用空间较大，过期的条目直接删除
+func (r *BoltRepository) GetStreetViewImage(ctx context.Context, key string) (*models.StreetViewImageCacheEntry, error) {
+	var entry *models.StreetViewImageCacheEntry
+	var expired bool
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketImages).Get([]byte(key))
+		if data == nil {
+			return nil // 没有缓存
+		}
+		entry = &models.StreetViewImageCacheEntry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			return err
+		}
+		expired = !time.Now().Before(entry.ExpiresAt)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取街景图片缓存失败: %w", err)
+	}
+	if !expired {
+		return entry, nil
+	}
+
+	// 两个事务之间其他请求可能已写入新的图片，删除前在同一个写事务中重新检查
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketImages)
+		data := bucket.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		var current cacheExpiry
+		if err := json.Unmarshal(data, &current); err == nil && time.Now().Before(current.ExpiresAt) {
+			return nil
+		}
+		return bucket.Delete([]byte(key))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("删除过期的街景图片缓存失败: %w", err)
+	}
+	return nil, nil
+}
+
+// SaveStreetViewImageETag 保存街景图片的 ETag，已过期的记录在读取时忽略，由后台清理删除
+func (r *BoltRepository) SaveStreetViewImageETag(ctx context.Context, key, etag string, expiresAt time.Time) error {
+	data, err := json.Marshal(imageETagRecord{ETag: etag, ExpiresAt: expiresAt})
+	if err != nil {
+		return fmt.Errorf("序列化街景图片 ETag 失败: %w", err)
+	}
+
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketImageETags).Put([]byte(key), data)
+	})
+	if err != nil {
+		return fmt.Errorf("保存街景图片 ETag 失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetStreetViewImageETag 获取未过期的街景图片 ETag
+func (r *BoltRepository) GetStreetViewImageETag(ctx context.Context, key string) (string, error) {
+	var record imageETagRecord
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketImageETags).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &record)
+	})
+	if err != nil {
+		return "", fmt.Errorf("获取街景图片 ETag 失败: %w", err)
+	}
+	if !time.Now().Before(record.ExpiresAt) {
+		return "", nil
+	}
+
+	return record.ETag, nil
+}
+
+// SaveChatThread 保存追问对话，已过期的对话由后台清理删除
+func (r *BoltRepository) SaveChatThread(ctx context.Context, thread models.ChatThread) error {
+	data, err := json.Marshal(thread)
+	if err != nil {
+		return fmt.Errorf("序列化对话失败: %w", err)
+	}
+
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketChatThreads).Put([]byte(chatThreadKey(thread.SessionID, thread.PanoID)), data)
+	})
+	if err != nil {
+		return fmt.Errorf("保存对话失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetChatThread 获取追问对话
+func (r *BoltRepository) GetChatThread(ctx context.Context, sessionID, panoID string) (*models.ChatThread, error) {
+	var thread *models.ChatThread
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketChatThreads).Get([]byte(chatThreadKey(sessionID, panoID)))
+		if data == nil {
+			return nil // 还没有开始对话
+		}
+		thread = &models.ChatThread{}
+		return json.Unmarshal(data, thread)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取对话失败: %w", err)
+	}
+	if thread != nil && thread.Expired(time.Now()) {
+		return nil, nil // 对话已过期，由后台清理删除
+	}
+
+	return thread, nil
+}
+
+// AppendChatMessages 在写事务中读取对话并追加消息
+func (r *BoltRepository) AppendChatMessages(ctx context.Context, thread models.ChatThread, messages ...models.ChatMessage) (models.ChatThread, error) {
+	var merged models.ChatThread
+
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketChatThreads)
+		key := []byte(chatThreadKey(thread.SessionID, thread.PanoID))
+
+		var stored *models.ChatThread
+		if data := bucket.Get(key); data != nil {
+			stored = &models.ChatThread{}
+			if err := json.Unmarshal(data, stored); err != nil {
+				return err
+			}
+			if stored.Expired(time.Now()) {
+				stored = nil
+			}
+		}
+		merged = appendChatThread(stored, thread, messages)
+
+		data, err := json.Marshal(merged)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, data)
+	})
+	if err != nil {
+		return models.ChatThread{}, fmt.Errorf("追加对话消息失败: %w", err)
+	}
+
+	return merged, nil
+}
+
+// AddChatUsage 在写事务中累加追问对话计数，已过期的计数重新开始，由后台清理删除
+func (r *BoltRepository) AddChatUsage(ctx context.Context, sessionID, panoID string, turns, tokens int, ttl time.Duration) (models.ChatUsage, error) {
+	var record chatUsageRecord
+
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketChatUsage)
+		key := []byte(chatThreadKey(sessionID, panoID))
+		now := time.Now()
+
+		if data := bucket.Get(key); data != nil {
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+		}
+		if record.expired(now) {
+			record = chatUsageRecord{}
+		}
+		record.Turns += turns
+		record.TokensUsed += tokens
+		if ttl > 0 {
+			record.ExpiresAt = now.Add(ttl)
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, data)
+	})
+	if err != nil {
+		return models.ChatUsage{}, fmt.Errorf("追问计数失败: %w", err)
+	}
+
+	return record.ChatUsage, nil
+}
+
+// SaveExplorationPreference 保存用户的探索偏好
+func (r *BoltRepository) SaveExplorationPreference(ctx context.Context, sessionID string, pref models.ExplorationPreference) error {
+	data, err := json.Marshal(pref)
+	if err != nil {
+		return fmt.Errorf("序列化探索偏好失败: %w", err)
+	}
+
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPreferences).Put([]byte(sessionID), data)
+	})
+	if err != nil {
+		return fmt.Errorf("保存探索偏好失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetExplorationPreference 获取用户的探索偏好
+func (r *BoltRepository) GetExplorationPreference(ctx context.Context, sessionID string) (*models.ExplorationPreference, error) {
+	var pref *models.ExplorationPreference
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketPreferences).Get([]byte(sessionID))
+		if data == nil {
+			return nil // 没有找到探索偏好
+		}
+		pref = &models.ExplorationPreference{}
+		return json.Unmarshal(data, pref)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取探索偏好失败: %w", err)
+	}
+
+	return pref, nil
+}
+
+// DeleteExplorationPreference 删除用户的探索偏好
+func (r *BoltRepository) DeleteExplorationPreference(ctx context.Context, sessionID string) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPreferences).Delete([]byte(sessionID))
+	})
+	if err != nil {
+		return fmt.Errorf("删除探索偏好失败: %w", err)
+	}
+
+	return nil
+}
+
+// LocationExists 判断位置记录是否存在
+func (r *BoltRepository) LocationExists(ctx context.Context, panoID string) (bool, error) {
+	var exists bool
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(bucketLocations).Get([]byte(panoID)) != nil
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("查询位置信息失败: %w", err)
+	}
+
+	return exists, nil
+}
+
+// ListLocationsByCountry 通过国家索引分页查询位置信息
+func (r *BoltRepository) ListLocationsByCountry(ctx context.Context, country string, offset, limit int) ([]models.Location, error) {
+	return r.listIndexedLocations(bucketCountryIndex, country, offset, limit)
+}
+
+// ListLocationsByCity 通过城市索引分页查询位置信息
+func (r *BoltRepository) ListLocationsByCity(ctx context.Context, city string, offset, limit int) ([]models.Location, error) {
+	return r.listIndexedLocations(bucketCityIndex, city, offset, limit)
+}
+
+// CountLocationsByCountry 统计国家索引中的位置数量
+func (r *BoltRepository) CountLocationsByCountry(ctx context.Context, country string) (int64, error) {
+	panoIDs, err := r.lookupIndex(ctx, bucketCountryIndex, country)
+	return int64(len(panoIDs)), err
+}
+
+// CountLocationsByCity 统计城市索引中的位置数量
+func (r *BoltRepository) CountLocationsByCity(ctx context.Context, city string) (int64, error) {
+	panoIDs, err := r.lookupIndex(ctx, bucketCityIndex, city)
+	return int64(len(panoIDs)), err
+}
+
+// GetRandomLocationByCountry 从国家索引中随机取一个已发现的位置
+func (r *BoltRepository) GetRandomLocationByCountry(ctx context.Context, country string) (models.Location, error) {
+	var location models.Location
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		panoIDs := scanIndex(tx.Bucket(bucketCountryIndex), country)
+		if len(panoIDs) == 0 {
+			return fmt.Errorf("国家 %s 没有已发现的位置: %w", country, ErrLocationNotFound)
+		}
+
+		data := tx.Bucket(bucketLocations).Get([]byte(panoIDs[rand.Intn(len(panoIDs))]))
+		if data == nil {
+			return fmt.Errorf("国家 %s 的索引已失效: %w", country, ErrLocationNotFound)
+		}
+		return decodeLocation(data, &location)
+	})
+	if err != nil {
+		return models.Location{}, fmt.Errorf("随机获取位置失败: %w", err)
+	}
+
+	return location, nil
+}
+
+// GetRandomLocation 从所有已发现的位置中随机取一个，需要遍历位置记录，只用于降级模式
+func (r *BoltRepository) GetRandomLocation(ctx context.Context) (models.Location, error) {
+	var location models.Location
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketLocations)
+		count := bucket.Stats().KeyN
+		if count == 0 {
+			return fmt.Errorf("没有已发现的位置: %w", ErrLocationNotFound)
+		}
+
+		cursor := bucket.Cursor()
+		_, data := cursor.First()
+		for skip := rand.Intn(count); skip > 0 && data != nil; skip-- {
+			_, data = cursor.Next()
+		}
+		if data == nil {
+			return fmt.Errorf("没有已发现的位置: %w", ErrLocationNotFound)
+		}
+		return decodeLocation(data, &location)
+	})
+	if err != nil {
+		return models.Location{}, fmt.Errorf("随机获取位置失败: %w", err)
+	}
+
+	return location, nil
+}
+
+// listIndexedLocations 索引键按字节序存储，前缀扫描的结果已按全景图ID排序
+func (r *BoltRepository) listIndexedLocations(bucket []byte, name string, offset, limit int) ([]models.Location, error) {
+	var locations []models.Location
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		panoIDs := scanIndex(tx.Bucket(bucket), name)
+		start, end := paginate(len(panoIDs), offset, limit)
+
+		locations = make([]models.Location, 0, end-start)
+		store := tx.Bucket(bucketLocations)
+		for _, panoID := range panoIDs[start:end] {
+			data := store.Get([]byte(panoID))
+			if data == nil {
+				continue
+			}
+			var location models.Location
+			if err := decodeLocation(data, &location); err != nil {
+				return fmt.Errorf("解析位置信息 %s 失败: %w", panoID, err)
+			}
+			locations = append(locations, location)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询位置信息失败: %w", err)
+	}
+
+	return locations, nil
+}
+
+// PanoIDsByCountry 通过国家索引查询该国家下的全景图ID
+func (r *BoltRepository) PanoIDsByCountry(ctx context.Context, country string) ([]string, error) {
+	return r.lookupIndex(ctx, bucketCountryIndex, country)
+}
+
+// PanoIDsByCity 通过城市索引查询该城市下的全景图ID
+func (r *BoltRepository) PanoIDsByCity(ctx context.Context, city string) ([]string, error) {
+	return r.lookupIndex(ctx, bucketCityIndex, city)
+}
+
+func (r *BoltRepository) lookupIndex(ctx context.Context, bucket []byte, name string) ([]string, error) {
+	var panoIDs []string
+	err := r.db.View(func(tx *bolt.Tx) error {
+		panoIDs = scanIndex(tx.Bucket(bucket), name)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询索引失败: %w", err)
+	}
+	return panoIDs, nil
+}
+
+// PushPoolLocation 把位置加入预生成位置池的末尾，池中的键为递增序号
+func (r *BoltRepository) PushPoolLocation(ctx context.Context, pool string, location models.Location) error {
+	data, err := encodeLocation(location)
+	if err != nil {
+		return fmt.Errorf("序列化位置信息失败: %w", err)
+	}
+
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(bucketLocationPool).CreateBucketIfNotExists([]byte(pool))
+		if err != nil {
+			return err
+		}
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return bucket.Put(key, data)
+	})
+	if err != nil {
+		return fmt.Errorf("加入位置池失败: %w", err)
+	}
+
+	return nil
+}
+
+// PopPoolLocation 取出预生成位置池中序号最小（最早加入）的位置
+func (r *BoltRepository) PopPoolLocation(ctx context.Context, pool string) (*models.Location, error) {
+	var location *models.Location
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketLocationPool).Bucket([]byte(pool))
+		if bucket == nil {
+			return nil
+		}
+		key, data := bucket.Cursor().First()
+		if key == nil {
+			return nil
+		}
+		location = &models.Location{}
+		if err := decodeLocation(data, location); err != nil {
+			return err
+		}
+		return bucket.Delete(key)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("从位置池取出位置失败: %w", err)
+	}
+
+	return location, nil
+}
+
+// PoolSize 返回预生成位置池中的位置数量
+func (r *BoltRepository) PoolSize(ctx context.Context, pool string) (int64, error) {
+	var size int64
+	err := r.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketLocationPool).Bucket([]byte(pool))
+		if bucket == nil {
+			return nil
+		}
+		size = int64(bucket.Stats().KeyN)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("获取位置池大小失败: %w", err)
+	}
+
+	return size, nil
+}
+
+// DeletePool 删除预生成位置池的 bucket
+func (r *BoltRepository) DeletePool(ctx context.Context, pool string) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(bucketLocationPool).DeleteBucket([]byte(pool))
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("删除位置池失败: %w", err)
+	}
+
+	return nil
+}
+
+// ListPools 列出位置池 bucket 下所有子 bucket 的名称
+func (r *BoltRepository) ListPools(ctx context.Context) ([]string, error) {
+	var pools []string
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketLocationPool).ForEachBucket(func(name []byte) error {
+			pools = append(pools, string(name))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("列出位置池失败: %w", err)
+	}
+
+	return pools, nil
+}
+
+// IncrementRateLimit 限流计数无需持久化，使用进程内计数器，避免每个请求都写磁盘
+func (r *BoltRepository) IncrementRateLimit(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return r.counters.increment(key, window), nil
+}
+
+// usageRecord 持久化的用量计数
+type usageRecord struct {
+	Count     int64     `json:"count"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IncrementUsage 外部 API 用量计数加一，计数保存在数据库中，重启后不会丢失
+// 每个统计窗口只在开始时新建一次计数，此时顺带删除已过期的计数
+func (r *BoltRepository) IncrementUsage(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	var count int64
+
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketAPIUsage)
+		now := time.Now()
+
+		var record usageRecord
+		if data := bucket.Get([]byte(key)); data != nil {
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+		}
+		if !now.Before(record.ExpiresAt) {
+			if err := deleteExpiredUsage(bucket, now); err != nil {
+				return err
+			}
+			record = usageRecord{ExpiresAt: now.Add(ttl)}
+		}
+		record.Count++
+		count = record.Count
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), data)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("用量计数失败: %w", err)
+	}
+
+	return count, nil
+}
+
+// DecrementUsage 撤销一次外部 API 用量计数
+func (r *BoltRepository) DecrementUsage(ctx context.Context, key string) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketAPIUsage)
+		data := bucket.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+
+		var record usageRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		if !time.Now().Before(record.ExpiresAt) || record.Count == 0 {
+			return nil
+		}
+		record.Count--
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), data)
+	})
+	if err != nil {
+		return fmt.Errorf("撤销用量计数失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetUsage 返回外部 API 用量计数
+func (r *BoltRepository) GetUsage(ctx context.Context, key string) (int64, error) {
+	var record usageRecord
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketAPIUsage).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &record)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("获取用量计数失败: %w", err)
+	}
+	if !time.Now().Before(record.ExpiresAt) {
+		return 0, nil
+	}
+
+	return record.Count, nil
+}
+
+// deleteExpiredUsage 删除已过期的用量计数
+func deleteExpiredUsage(bucket *bolt.Bucket, now time.Time) error {
+	var expired [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var record usageRecord
+		if err := json.Unmarshal(v, &record); err != nil || !now.Before(record.ExpiresAt) {
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range expired {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexKey 构造索引键：名称 + 分隔符 + 全景图ID
+func indexKey(name, panoID string) []byte {
+	return []byte(name + indexKeySeparator + panoID)
+}
+
+// indexPrefix 构造用于前缀扫描的索引键前缀
+func indexPrefix(name string) []byte {
+	return []byte(name + indexKeySeparator)
+}
+
+// scanIndex 按前缀扫描索引，返回该名称下所有全景图ID
+func scanIndex(bucket *bolt.Bucket, name string) []string {
+	prefix := indexPrefix(name)
+	var panoIDs []string
+
+	c := bucket.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		panoIDs = append(panoIDs, string(k[len(prefix):]))
+	}
+
+	return panoIDs
+}
@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+type testBoltConfig string
+
+func (p testBoltConfig) BoltPath() string { return string(p) }
+
+func newTestBoltRepository(t *testing.T) *BoltRepository {
+	t.Helper()
+	repo, err := NewBoltRepository(testBoltConfig(filepath.Join(t.TempDir(), "test.db")))
+	if err != nil {
+		t.Fatalf("创建 bbolt 仓库失败: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestBoltRepositoryLocations(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestBoltRepository(t)
+
+	loc := models.Location{PanoID: "pano-1", Country: "France", City: "Paris"}
+	if err := repo.SaveLocation(ctx, loc); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	if err := repo.SaveLocation(ctx, models.Location{PanoID: "pano-2", Country: "France", City: "Lyon"}); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+
+	got, err := repo.GetLocationByPanoID(ctx, "pano-1")
+	if err != nil {
+		t.Fatalf("获取位置失败: %v", err)
+	}
+	if got.City != "Paris" || got.AccessCount != 1 {
+		t.Errorf("位置内容不正确: %+v", got)
+	}
+
+	ids, err := repo.PanoIDsByCountry(ctx, "France")
+	if err != nil || len(ids) != 2 {
+		t.Errorf("France 应该有 2 个全景图，实际为 %v (%v)", ids, err)
+	}
+
+	// 城市变化后旧的索引项应该被移除
+	loc.City = "Versailles"
+	if err := repo.SaveLocation(ctx, loc); err != nil {
+		t.Fatalf("更新位置失败: %v", err)
+	}
+	if ids, _ := repo.PanoIDsByCity(ctx, "Paris"); len(ids) != 0 {
+		t.Errorf("Paris 索引应该为空，实际为 %v", ids)
+	}
+	if ids, _ := repo.PanoIDsByCity(ctx, "Versailles"); len(ids) != 1 || ids[0] != "pano-1" {
+		t.Errorf("Versailles 索引不正确: %v", ids)
+	}
+
+	if _, err := repo.GetLocationByPanoID(ctx, "missing"); err == nil {
+		t.Error("获取不存在的位置应该返回错误")
+	}
+}
+
+func TestBoltRepositoryExplorationPreference(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestBoltRepository(t)
+
+	pref, err := repo.GetExplorationPreference(ctx, "session")
+	if err != nil || pref != nil {
+		t.Fatalf("不存在的偏好应该返回 nil, nil，实际为 %v, %v", pref, err)
+	}
+
+	if err := repo.SaveExplorationPreference(ctx, "session", models.ExplorationPreference{Interest: "castles"}); err != nil {
+		t.Fatalf("保存偏好失败: %v", err)
+	}
+	pref, err = repo.GetExplorationPreference(ctx, "session")
+	if err != nil || pref == nil || pref.Interest != "castles" {
+		t.Fatalf("获取偏好失败: %v, %v", pref, err)
+	}
+
+	if err := repo.DeleteExplorationPreference(ctx, "session"); err != nil {
+		t.Fatalf("删除偏好失败: %v", err)
+	}
+	if pref, _ := repo.GetExplorationPreference(ctx, "session"); pref != nil {
+		t.Error("删除后偏好应该不存在")
+	}
+}
+
+func TestBoltRepositoryPruneExpired(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestBoltRepository(t)
+
+	now := time.Now()
+	entries := []models.GeocodeCacheEntry{
+		{Key: "fresh", Result: testGeocodeResult("Japan"), CachedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{Key: "expired", Result: testGeocodeResult("Japan"), CachedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+	}
+	for _, entry := range entries {
+		if err := repo.SaveGeocode(ctx, entry); err != nil {
+			t.Fatalf("保存地理编码缓存失败: %v", err)
+		}
+	}
+	image := models.StreetViewImageCacheEntry{Key: "pano:h0:p0:f90:640x400", Data: []byte("jpeg"), ExpiresAt: now.Add(-time.Minute)}
+	if err := repo.SaveStreetViewImage(ctx, image); err != nil {
+		t.Fatalf("保存街景图片缓存失败: %v", err)
+	}
+	threads := []models.ChatThread{
+		{SessionID: "session", PanoID: "expired", ExpiresAt: now.Add(-time.Minute)},
+		{SessionID: "session", PanoID: "forever"},
+	}
+	for _, thread := range threads {
+		if err := repo.SaveChatThread(ctx, thread); err != nil {
+			t.Fatalf("保存对话失败: %v", err)
+		}
+	}
+
+	// 打开数据库时的后台清理可能已经删除了部分条目，按清理后剩余的条目判断
+	if _, err := repo.PruneExpired(); err != nil {
+		t.Fatalf("清理过期条目失败: %v", err)
+	}
+	remaining := 0
+	repo.db.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketGeocodes, bucketImages, bucketChatThreads} {
+			remaining += tx.Bucket(name).Stats().KeyN
+		}
+		return nil
+	})
+	if remaining != 2 {
+		t.Fatalf("清理后应剩余 2 个条目，实际为 %d", remaining)
+	}
+	if entry, _ := repo.GetGeocode(ctx, "fresh"); entry == nil {
+		t.Error("未过期的缓存不应被删除")
+	}
+	if thread, _ := repo.GetChatThread(ctx, "session", "forever"); thread == nil {
+		t.Error("没有过期时间的对话不应被删除")
+	}
+}
@@ -0,0 +1,708 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+)
+
+// MemoryRepository 基于进程内存的仓库实现，用于测试和无外部依赖的本地运行
+// 进程退出后数据即丢失
+type MemoryRepository struct {
+	mu           sync.RWMutex
+	locations    map[string]models.Location
+	countryIndex map[string]map[string]struct{}
+	cityIndex    map[string]map[string]struct{}
+	descriptions map[string]models.LocationDescription
+	geocodes     map[string]models.GeocodeCacheEntry
+	images       map[string]models.StreetViewImageCacheEntry
+	imageETags   map[string]imageETagRecord
+	chatThreads  map[string]models.ChatThread
+	chatUsage    map[string]chatUsageRecord
+	preferences  map[string]models.ExplorationPreference
+	pools        map[string][]models.Location
+	counters     *memoryCounters
+	usage        *memoryCounters
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		locations:    make(map[string]models.Location),
+		countryIndex: make(map[string]map[string]struct{}),
+		cityIndex:    make(map[string]map[string]struct{}),
+		descriptions: make(map[string]models.LocationDescription),
+		geocodes:     make(map[string]models.GeocodeCacheEntry),
+		images:       make(map[string]models.StreetViewImageCacheEntry),
+		imageETags:   make(map[string]imageETagRecord),
+		chatThreads:  make(map[string]models.ChatThread),
+		chatUsage:    make(map[string]chatUsageRecord),
+		preferences:  make(map[string]models.ExplorationPreference),
+		pools:        make(map[string][]models.Location),
+		counters:     newMemoryCounters(),
+		usage:        newMemoryCounters(),
+	}
+}
+
+// SaveLocation 保存位置信息到内存
+func (r *MemoryRepository) SaveLocation(ctx context.Context, location models.Location) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saveLocationLocked(location)
+	return nil
+}
+
+// saveLocationLocked 保存位置信息并维护索引，调用方需持有写锁
+func (r *MemoryRepository) saveLocationLocked(location models.Location) {
+	// 设置创建时间
+	if location.CreatedAt.IsZero() {
+		location.CreatedAt = time.Now()
+	}
+
+	// 国家或城市变化时移除旧的索引项
+	if previous, ok := r.locations[location.PanoID]; ok {
+		if previous.Country != location.Country {
+			removeFromIndex(r.countryIndex, previous.Country, location.PanoID)
+		}
+		if previous.City != location.City {
+			removeFromIndex(r.cityIndex, previous.City, location.PanoID)
+		}
+	}
+
+	r.locations[location.PanoID] = location
+
+	// 添加到国家和城市的索引中
+	if location.Country != "" {
+		addToIndex(r.countryIndex, location.Country, location.PanoID)
+	}
+	if location.City != "" {
+		addToIndex(r.cityIndex, location.City, location.PanoID)
+	}
+}
+
+// GetLocationByPanoID 通过全景图ID获取位置信息
+// 位置不存在时只持有读锁；访问信息不影响索引，更新时只改写记录本身
+func (r *MemoryRepository) GetLocationByPanoID(ctx context.Context, panoID string) (models.Location, error) {
+	r.mu.RLock()
+	_, ok := r.locations[panoID]
+	r.mu.RUnlock()
+	if !ok {
+		return models.Location{}, fmt.Errorf("获取位置信息失败: %s: %w", panoID, ErrLocationNotFound)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 两次加锁之间记录可能已被删除或更新，以写锁下读到的为准
+	location, ok := r.locations[panoID]
+	if !ok {
+		return models.Location{}, fmt.Errorf("获取位置信息失败: %s: %w", panoID, ErrLocationNotFound)
+	}
+
+	// 更新访问信息
+	location.LastAccessedAt = time.Now()
+	location.AccessCount++
+	r.locations[panoID] = location
+
+	return location, nil
+}
+
+// UpdateLocationDescription 只更新位置记录的简短描述和对话历史
+func (r *MemoryRepository) UpdateLocationDescription(ctx context.Context, desc models.LocationDescription, history string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	location, ok := r.locations[desc.PanoID]
+	if !ok {
+		return fmt.Errorf("更新位置描述失败: %s: %w", desc.PanoID, ErrLocationNotFound)
+	}
+	setLocationDescription(&location, desc, history)
+	r.locations[desc.PanoID] = location
+
+	return nil
+}
+
+// LocationExists 判断位置记录是否存在
+func (r *MemoryRepository) LocationExists(ctx context.Context, panoID string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.locations[panoID]
+	return ok, nil
+}
+
+// ListLocationsByCountry 通过国家索引分页查询位置信息
+func (r *MemoryRepository) ListLocationsByCountry(ctx context.Context, country string, offset, limit int) ([]models.Location, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.listIndexedLocationsLocked(r.countryIndex[country], offset, limit), nil
+}
+
+// ListLocationsByCity 通过城市索引分页查询位置信息
+func (r *MemoryRepository) ListLocationsByCity(ctx context.Context, city string, offset, limit int) ([]models.Location, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.listIndexedLocationsLocked(r.cityIndex[city], offset, limit), nil
+}
+
+// CountLocationsByCountry 统计国家索引中的位置数量
+func (r *MemoryRepository) CountLocationsByCountry(ctx context.Context, country string) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.countryIndex[country])), nil
+}
+
+// CountLocationsByCity 统计城市索引中的位置数量
+func (r *MemoryRepository) CountLocationsByCity(ctx context.Context, city string) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.cityIndex[city])), nil
+}
+
+// GetRandomLocationByCountry 从国家索引中随机取一个已发现的位置
+func (r *MemoryRepository) GetRandomLocationByCountry(ctx context.Context, country string) (models.Location, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := r.countryIndex[country]
+	if len(set) == 0 {
+		return models.Location{}, fmt.Errorf("国家 %s 没有已发现的位置: %w", country, ErrLocationNotFound)
+	}
+
+	// map 遍历顺序不保证随机分布，按下标随机选取
+	target := rand.Intn(len(set))
+	for panoID := range set {
+		if target == 0 {
+			return r.locations[panoID], nil
+		}
+		target--
+	}
+	return models.Location{}, fmt.Errorf("国家 %s 没有已发现的位置: %w", country, ErrLocationNotFound)
+}
+
+// GetRandomLocation 从所有已发现的位置中随机取一个
+func (r *MemoryRepository) GetRandomLocation(ctx context.Context) (models.Location, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.locations) == 0 {
+		return models.Location{}, fmt.Errorf("没有已发现的位置: %w", ErrLocationNotFound)
+	}
+
+	target := rand.Intn(len(r.locations))
+	for _, location := range r.locations {
+		if target == 0 {
+			return location, nil
+		}
+		target--
+	}
+	return models.Location{}, fmt.Errorf("没有已发现的位置: %w", ErrLocationNotFound)
+}
+
+// listIndexedLocationsLocked 按全景图ID排序后分页，调用方需持有读锁
+func (r *MemoryRepository) listIndexedLocationsLocked(set map[string]struct{}, offset, limit int) []models.Location {
+	panoIDs := make([]string, 0, len(set))
+	for panoID := range set {
+		panoIDs = append(panoIDs, panoID)
+	}
+	sort.Strings(panoIDs)
+
+	start, end := paginate(len(panoIDs), offset, limit)
+	locations := make([]models.Location, 0, end-start)
+	for _, panoID := range panoIDs[start:end] {
+		locations = append(locations, r.locations[panoID])
+	}
+	return locations
+}
+
+// 内存中最多缓存的 AI 描述数量，离线或演示服务长时间运行时不会无限增长
+const maxMemoryDescriptions = 10000
+
+// SaveDescription 保存 AI 描述缓存，数量达到上限时淘汰生成时间最早的描述
+// 仓库不知道描述的新鲜度窗口，最早生成的描述也最先过期
+func (r *MemoryRepository) SaveDescription(ctx context.Context, desc models.LocationDescription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := descriptionKey(desc.PanoID, desc.Language, desc.Kind)
+	if _, ok := r.descriptions[key]; !ok && len(r.descriptions) >= maxMemoryDescriptions {
+		var oldestKey string
+		var oldest time.Time
+		for k, cached := range r.descriptions {
+			if oldestKey == "" || cached.GeneratedAt.Before(oldest) {
+				oldestKey, oldest = k, cached.GeneratedAt
+			}
+		}
+		delete(r.descriptions, oldestKey)
+	}
+	r.descriptions[key] = desc
+	return nil
+}
+
+// GetDescription 获取 AI 描述缓存
+func (r *MemoryRepository) GetDescription(ctx context.Context, panoID, language, kind string) (*models.LocationDescription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	desc, ok := r.descriptions[descriptionKey(panoID, language, kind)]
+	if !ok {
+		return nil, nil // 没有缓存
+	}
+	return &desc, nil
+}
+
+// 触发过期逆地理编码缓存清理的数量阈值
+const maxMemoryGeocodes = 10000
+
+// SaveGeocode 保存逆地理编码缓存
+func (r *MemoryRepository) SaveGeocode(ctx context.Context, entry models.GeocodeCacheEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 缓存过多时顺带清理已过期的条目，避免长时间运行时内存增长
+	if len(r.geocodes) >= maxMemoryGeocodes {
+		now := time.Now()
+		for key, cached := range r.geocodes {
+			if !now.Before(cached.ExpiresAt) {
+				delete(r.geocodes, key)
+			}
+		}
+	}
+	entry.Result = entry.Result.Clone()
+	r.geocodes[entry.Key] = entry
+	return nil
+}
+
+// GetGeocode 获取未过期的逆地理编码缓存
+func (r *MemoryRepository) GetGeocode(ctx context.Context, key string) (*models.GeocodeCacheEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, ok := r.geocodes[key]
+	if !ok || !time.Now().Before(entry.ExpiresAt) {
+		return nil, nil
+	}
+	entry.Result = entry.Result.Clone()
+	return &entry, nil
+}
+
+// 内存中最多缓存的街景图片数量，每张图片约几十 KB
+const maxMemoryImages = 1000
+
+// SaveStreetViewImage 保存街景图片缓存
+func (r *MemoryRepository) SaveStreetViewImage(ctx context.Context, entry models.StreetViewImageCacheEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 缓存已满时先清理已过期的条目，仍然已满时随机淘汰一张
+	if _, ok := r.images[entry.Key]; !ok && len(r.images) >= maxMemoryImages {
+		now := time.Now()
+		for key, cached := range r.images {
+			if !now.Before(cached.ExpiresAt) {
+				delete(r.images, key)
+			}
+		}
+		for key := range r.images {
+			if len(r.images) < maxMemoryImages {
+				break
+			}
+			delete(r.images, key)
+		}
+	}
+	entry.Data = append([]byte(nil), entry.Data...)
+	r.images[entry.Key] = entry
+	return nil
+}
+
+// GetStreetViewImage 获取未过期的街景图片缓存
+func (r *MemoryRepository) GetStreetViewImage(ctx context.Context, key string) (*models.StreetViewImageCacheEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, ok := r.images[key]
+	if !ok || !time.Now().Before(entry.ExpiresAt) {
+		return nil, nil
+	}
+	entry.Data = append([]byte(nil), entry.Data...)
+	return &entry, nil
+}
+
+// 内存中最多保存的图片 ETag 数量，每条只有几十字节
+const maxMemoryImageETags = 10 * maxMemoryImages
+
+// SaveStreetViewImageETag 保存街景图片的 ETag
+func (r *MemoryRepository) SaveStreetViewImageETag(ctx context.Context, key, etag string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 数量达到上限时先清理已过期的记录，仍然已满时随机淘汰一条
+	if _, ok := r.imageETags[key]; !ok && len(r.imageETags) >= maxMemoryImageETags {
+		now := time.Now()
+		for k, cached := range r.imageETags {
+			if !now.Before(cached.ExpiresAt) {
+				delete(r.imageETags, k)
+			}
+		}
+		for k := range r.imageETags {
+			if len(r.imageETags) < maxMemoryImageETags {
+				break
+			}
+			delete(r.imageETags, k)
+		}
+	}
+	r.imageETags[key] = imageETagRecord{ETag: etag, ExpiresAt: expiresAt}
+	return nil
+}
+
+// GetStreetViewImageETag 获取未过期的街景图片 ETag
+func (r *MemoryRepository) GetStreetViewImageETag(ctx context.Context, key string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, ok := r.imageETags[key]
+	if !ok || !time.Now().Before(record.ExpiresAt) {
+		return "", nil
+	}
+	return record.ETag, nil
+}
+
+// 触发过期追问对话清理的数量阈值
+const maxMemoryChatThreads = 1000
+
+// SaveChatThread 保存追问对话
+func (r *MemoryRepository) SaveChatThread(ctx context.Context, thread models.ChatThread) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 对话过多时顺带清理已过期的对话，避免长时间运行时内存增长
+	if len(r.chatThreads) >= maxMemoryChatThreads {
+		now := time.Now()
+		for key, cached := range r.chatThreads {
+			if cached.Expired(now) {
+				delete(r.chatThreads, key)
+			}
+		}
+	}
+	r.chatThreads[chatThreadKey(thread.SessionID, thread.PanoID)] = copyChatThread(thread)
+	return nil
+}
+
+// GetChatThread 获取追问对话
+func (r *MemoryRepository) GetChatThread(ctx context.Context, sessionID, panoID string) (*models.ChatThread, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	thread, ok := r.chatThreads[chatThreadKey(sessionID, panoID)]
+	if !ok || thread.Expired(time.Now()) {
+		return nil, nil // 还没有开始对话或对话已过期
+	}
+	thread = copyChatThread(thread)
+	return &thread, nil
+}
+
+// AppendChatMessages 在对话末尾追加消息
+func (r *MemoryRepository) AppendChatMessages(ctx context.Context, thread models.ChatThread, messages ...models.ChatMessage) (models.ChatThread, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := chatThreadKey(thread.SessionID, thread.PanoID)
+	var stored *models.ChatThread
+	if cached, ok := r.chatThreads[key]; ok && !cached.Expired(time.Now()) {
+		stored = &cached
+	}
+	merged := appendChatThread(stored, thread, messages)
+	r.chatThreads[key] = merged
+	return copyChatThread(merged), nil
+}
+
+// AddChatUsage 累加追问对话计数
+func (r *MemoryRepository) AddChatUsage(ctx context.Context, sessionID, panoID string, turns, tokens int, ttl time.Duration) (models.ChatUsage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	key := chatThreadKey(sessionID, panoID)
+	record, ok := r.chatUsage[key]
+	if !ok || record.expired(now) {
+		// 计数过多时顺带清理已过期的计数，避免长时间运行时内存增长
+		if len(r.chatUsage) >= maxMemoryChatThreads {
+			for k, cached := range r.chatUsage {
+				if cached.expired(now) {
+					delete(r.chatUsage, k)
+				}
+			}
+		}
+		record = chatUsageRecord{}
+	}
+	record.Turns += turns
+	record.TokensUsed += tokens
+	if ttl > 0 {
+		record.ExpiresAt = now.Add(ttl)
+	}
+	r.chatUsage[key] = record
+
+	return record.ChatUsage, nil
+}
+
+// SaveExplorationPreference 保存用户的探索偏好
+func (r *MemoryRepository) SaveExplorationPreference(ctx context.Context, sessionID string, pref models.ExplorationPreference) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.preferences[sessionID] = copyPreference(pref)
+	return nil
+}
+
+// GetExplorationPreference 获取用户的探索偏好
+func (r *MemoryRepository) GetExplorationPreference(ctx context.Context, sessionID string) (*models.ExplorationPreference, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pref, ok := r.preferences[sessionID]
+	if !ok {
+		return nil, nil // 没有找到探索偏好
+	}
+
+	result := copyPreference(pref)
+	return &result, nil
+}
+
+// DeleteExplorationPreference 删除用户的探索偏好
+func (r *MemoryRepository) DeleteExplorationPreference(ctx context.Context, sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.preferences, sessionID)
+	return nil
+}
+
+// PushPoolLocation 把位置加入预生成位置池的末尾
+func (r *MemoryRepository) PushPoolLocation(ctx context.Context, pool string, location models.Location) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pools[pool] = append(r.pools[pool], location)
+	return nil
+}
+
+// PopPoolLocation 取出预生成位置池中最早加入的位置
+func (r *MemoryRepository) PopPoolLocation(ctx context.Context, pool string) (*models.Location, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	locations := r.pools[pool]
+	if len(locations) == 0 {
+		return nil, nil
+	}
+	location := locations[0]
+	r.pools[pool] = locations[1:]
+	return &location, nil
+}
+
+// PoolSize 返回预生成位置池中的位置数量
+func (r *MemoryRepository) PoolSize(ctx context.Context, pool string) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.pools[pool])), nil
+}
+
+// DeletePool 删除预生成位置池
+func (r *MemoryRepository) DeletePool(ctx context.Context, pool string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.pools, pool)
+	return nil
+}
+
+// ListPools 列出所有位置池的名称
+func (r *MemoryRepository) ListPools(ctx context.Context) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pools := make([]string, 0, len(r.pools))
+	for pool := range r.pools {
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// IncrementRateLimit 使用进程内计数器实现限流计数
+func (r *MemoryRepository) IncrementRateLimit(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return r.counters.increment(key, window), nil
+}
+
+// IncrementUsage 外部 API 用量计数加一
+func (r *MemoryRepository) IncrementUsage(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return r.usage.increment(key, ttl), nil
+}
+
+// DecrementUsage 撤销一次外部 API 用量计数
+func (r *MemoryRepository) DecrementUsage(ctx context.Context, key string) error {
+	r.usage.decrement(key)
+	return nil
+}
+
+// GetUsage 返回外部 API 用量计数
+func (r *MemoryRepository) GetUsage(ctx context.Context, key string) (int64, error) {
+	return r.usage.get(key), nil
+}
+
+// descriptionKey 构造描述缓存的键
+func descriptionKey(panoID, language, kind string) string {
+	return panoID + "\x00" + language + "\x00" + kind
+}
+
+func chatThreadKey(sessionID, panoID string) string {
+	return sessionID + "\x00" + panoID
+}
+
+// appendChatThread 把 messages 追加到已保存的对话 stored 末尾，stored 为 nil 时追加到 thread 的消息末尾
+// 返回的对话使用新的消息切片，不与 stored 和 thread 共用底层数组
+func appendChatThread(stored *models.ChatThread, thread models.ChatThread, messages []models.ChatMessage) models.ChatThread {
+	merged := thread
+	if stored != nil {
+		merged = *stored
+		merged.Turns = max(stored.Turns, thread.Turns)
+		merged.TokensUsed = max(stored.TokensUsed, thread.TokensUsed)
+		merged.UpdatedAt = thread.UpdatedAt
+		merged.ExpiresAt = thread.ExpiresAt
+	}
+	combined := make([]models.ChatMessage, 0, len(merged.Messages)+len(messages))
+	combined = append(combined, merged.Messages...)
+	merged.Messages = append(combined, messages...)
+	return merged
+}
+
+// chatUsageRecord 带过期时间的追问对话计数，ExpiresAt 为零值时不过期
+type chatUsageRecord struct {
+	models.ChatUsage
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (c chatUsageRecord) expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt)
+}
+
+// imageETagRecord 带过期时间的街景图片 ETag
+type imageETagRecord struct {
+	ETag      string    `json:"etag"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// addToIndex 将全景图ID加入指定名称的索引集合
+func addToIndex(index map[string]map[string]struct{}, name, panoID string) {
+	set, ok := index[name]
+	if !ok {
+		set = make(map[string]struct{})
+		index[name] = set
+	}
+	set[panoID] = struct{}{}
+}
+
+// removeFromIndex 从索引中移除全景图，集合为空时删除该名称
+func removeFromIndex(index map[string]map[string]struct{}, name, panoID string) {
+	set, ok := index[name]
+	if !ok {
+		return
+	}
+	delete(set, panoID)
+	if len(set) == 0 {
+		delete(index, name)
+	}
+}
+
+// copyPreference 复制探索偏好，避免调用方修改内部存储的切片
+func copyPreference(pref models.ExplorationPreference) models.ExplorationPreference {
+	if pref.Regions != nil {
+		regions := make([]models.Region, len(pref.Regions))
+		copy(regions, pref.Regions)
+		pref.Regions = regions
+	}
+	return pref
+}
+
+func copyChatThread(thread models.ChatThread) models.ChatThread {
+	if thread.Messages != nil {
+		messages := make([]models.ChatMessage, len(thread.Messages))
+		copy(messages, thread.Messages)
+		thread.Messages = messages
+	}
+	return thread
+}
+
+// 触发过期计数器清理的数量阈值
+const maxMemoryCounters = 1024
+
+// memoryCounter 带过期时间的计数器
+type memoryCounter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// memoryCounters 进程内的过期计数器集合，供不需要持久化的限流计数使用
+type memoryCounters struct {
+	mu       sync.Mutex
+	counters map[string]*memoryCounter
+}
+
+func newMemoryCounters() *memoryCounters {
+	return &memoryCounters{counters: make(map[string]*memoryCounter)}
+}
+
+// increment 对 key 计数加一，窗口过期后重新计数
+func (m *memoryCounters) increment(key string, window time.Duration) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	counter, ok := m.counters[key]
+	if !ok || !now.Before(counter.expiresAt) {
+		// 计数器过多时顺带清理已过期的计数器，避免长时间运行时内存增长
+		if len(m.counters) >= maxMemoryCounters {
+			for k, c := range m.counters {
+				if !now.Before(c.expiresAt) {
+					delete(m.counters, k)
+				}
+			}
+		}
+		counter = &memoryCounter{expiresAt: now.Add(window)}
+		m.counters[key] = counter
+	}
+	counter.count++
+
+	return counter.count
+}
+
+// decrement 对 key 计数减一，没有计数、已过期或计数为 0 时不做任何事
+func (m *memoryCounters) decrement(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter, ok := m.counters[key]
+	if ok && time.Now().Before(counter.expiresAt) && counter.count > 0 {
+		counter.count--
+	}
+}
+
+// get 返回 key 在当前窗口内的计数，没有计数或已过期时返回 0
+func (m *memoryCounters) get(key string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter, ok := m.counters[key]
+	if !ok || !time.Now().Before(counter.expiresAt) {
+		return 0
+	}
+	return counter.count
+}
@@ -0,0 +1,229 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+)
+
+func TestMemoryRepositoryLocations(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	loc := models.Location{
+		PanoID:    "pano-1",
+		Latitude:  35.6812,
+		Longitude: 139.7671,
+		Country:   "Japan",
+		City:      "Tokyo",
+	}
+	if err := repo.SaveLocation(ctx, loc); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+
+	got, err := repo.GetLocationByPanoID(ctx, "pano-1")
+	if err != nil {
+		t.Fatalf("获取位置失败: %v", err)
+	}
+	if got.CreatedAt.IsZero() {
+		t.Error("CreatedAt 应该被自动设置")
+	}
+	if got.AccessCount != 1 {
+		t.Errorf("AccessCount 应该为 1，实际为 %d", got.AccessCount)
+	}
+
+	got, _ = repo.GetLocationByPanoID(ctx, "pano-1")
+	if got.AccessCount != 2 {
+		t.Errorf("AccessCount 应该为 2，实际为 %d", got.AccessCount)
+	}
+
+	if _, ok := repo.countryIndex["Japan"]["pano-1"]; !ok {
+		t.Error("国家索引中缺少 pano-1")
+	}
+	if _, ok := repo.cityIndex["Tokyo"]["pano-1"]; !ok {
+		t.Error("城市索引中缺少 pano-1")
+	}
+
+	if _, err := repo.GetLocationByPanoID(ctx, "missing"); err == nil {
+		t.Error("获取不存在的位置应该返回错误")
+	}
+}
+
+func TestMemoryRepositoryExplorationPreference(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	pref, err := repo.GetExplorationPreference(ctx, "session")
+	if err != nil || pref != nil {
+		t.Fatalf("不存在的偏好应该返回 nil, nil，实际为 %v, %v", pref, err)
+	}
+
+	region := models.Region{RegionInfo: "Alps"}
+	if err := repo.SaveExplorationPreference(ctx, "session", models.ExplorationPreference{
+		Interest: "skiing",
+		Regions:  []models.Region{region},
+	}); err != nil {
+		t.Fatalf("保存偏好失败: %v", err)
+	}
+
+	pref, err = repo.GetExplorationPreference(ctx, "session")
+	if err != nil || pref == nil {
+		t.Fatalf("获取偏好失败: %v", err)
+	}
+	if pref.Interest != "skiing" || len(pref.Regions) != 1 {
+		t.Errorf("偏好内容不正确: %+v", pref)
+	}
+
+	// 修改返回值不应影响存储的数据
+	pref.Regions[0].RegionInfo = "changed"
+	again, _ := repo.GetExplorationPreference(ctx, "session")
+	if again.Regions[0].RegionInfo != "Alps" {
+		t.Error("返回的偏好应该是副本")
+	}
+
+	if err := repo.DeleteExplorationPreference(ctx, "session"); err != nil {
+		t.Fatalf("删除偏好失败: %v", err)
+	}
+	if pref, _ := repo.GetExplorationPreference(ctx, "session"); pref != nil {
+		t.Error("删除后偏好应该不存在")
+	}
+}
+
+func TestMemoryRepositoryRateLimit(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	window := 50 * time.Millisecond
+
+	for i := int64(1); i <= 3; i++ {
+		count, err := repo.IncrementRateLimit(ctx, "ratelimit:test", window)
+		if err != nil {
+			t.Fatalf("限流计数失败: %v", err)
+		}
+		if count != i {
+			t.Errorf("计数应该为 %d，实际为 %d", i, count)
+		}
+	}
+
+	time.Sleep(2 * window)
+
+	count, err := repo.IncrementRateLimit(ctx, "ratelimit:test", window)
+	if err != nil {
+		t.Fatalf("限流计数失败: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("窗口过期后计数应该重置为 1，实际为 %d", count)
+	}
+}
+
+func TestMemoryRepositoryLocationQueries(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	for _, id := range []string{"c", "a", "b"} {
+		if err := repo.SaveLocation(ctx, models.Location{PanoID: id, Country: "Italy", City: "Rome"}); err != nil {
+			t.Fatalf("保存位置失败: %v", err)
+		}
+	}
+
+	page, err := repo.ListLocationsByCountry(ctx, "Italy", 1, 5)
+	if err != nil {
+		t.Fatalf("查询位置失败: %v", err)
+	}
+	if len(page) != 2 || page[0].PanoID != "b" || page[1].PanoID != "c" {
+		t.Errorf("分页结果应该按全景图ID排序: %+v", page)
+	}
+	if page[0].AccessCount != 0 {
+		t.Error("列表查询不应更新访问次数")
+	}
+
+	if empty, _ := repo.ListLocationsByCity(ctx, "Rome", 10, 5); len(empty) != 0 {
+		t.Errorf("超出范围的分页应该为空: %+v", empty)
+	}
+
+	if count, _ := repo.CountLocationsByCity(ctx, "Rome"); count != 3 {
+		t.Errorf("Rome 应该有 3 个位置，实际为 %d", count)
+	}
+
+	loc, err := repo.GetRandomLocationByCountry(ctx, "Italy")
+	if err != nil || loc.Country != "Italy" {
+		t.Errorf("随机获取位置失败: %+v, %v", loc, err)
+	}
+
+	if _, err := repo.GetRandomLocationByCountry(ctx, "Peru"); !errors.Is(err, ErrLocationNotFound) {
+		t.Errorf("没有记录时应该返回 ErrLocationNotFound，实际为 %v", err)
+	}
+}
+
+func TestMemoryRepositoryChatThread(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	thread, err := repo.GetChatThread(ctx, "session", "pano-1")
+	if err != nil || thread != nil {
+		t.Fatalf("不存在的对话应该返回 nil, nil，实际为 %v, %v", thread, err)
+	}
+
+	if err := repo.SaveChatThread(ctx, models.ChatThread{
+		SessionID:  "session",
+		PanoID:     "pano-1",
+		Messages:   []models.ChatMessage{{Role: "user", Content: "What is that building?"}},
+		Turns:      1,
+		TokensUsed: 120,
+	}); err != nil {
+		t.Fatalf("保存对话失败: %v", err)
+	}
+
+	thread, err = repo.GetChatThread(ctx, "session", "pano-1")
+	if err != nil || thread == nil {
+		t.Fatalf("获取对话失败: %v", err)
+	}
+	if thread.Turns != 1 || thread.TokensUsed != 120 || len(thread.Messages) != 1 {
+		t.Errorf("对话内容不正确: %+v", thread)
+	}
+
+	// 修改返回值不应影响存储的数据
+	thread.Messages[0].Content = "changed"
+	again, _ := repo.GetChatThread(ctx, "session", "pano-1")
+	if again.Messages[0].Content != "What is that building?" {
+		t.Error("返回的对话应该是副本")
+	}
+
+	// 对话按会话和全景图隔离
+	if other, _ := repo.GetChatThread(ctx, "session", "pano-2"); other != nil {
+		t.Error("其他全景图不应该共享对话")
+	}
+}
+
+func TestMemoryRepositoryDescriptionLimit(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	// 缓存已满时淘汰生成时间最早的描述
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < maxMemoryDescriptions+1; i++ {
+		desc := models.LocationDescription{
+			PanoID:      fmt.Sprintf("pano-%d", i),
+			Language:    "en",
+			Kind:        models.DescriptionShort,
+			Content:     "description",
+			GeneratedAt: start.Add(time.Duration(i) * time.Second),
+		}
+		if err := repo.SaveDescription(ctx, desc); err != nil {
+			t.Fatalf("保存描述失败: %v", err)
+		}
+	}
+
+	if len(repo.descriptions) != maxMemoryDescriptions {
+		t.Errorf("描述数量应为 %d，实际为 %d", maxMemoryDescriptions, len(repo.descriptions))
+	}
+	if desc, _ := repo.GetDescription(ctx, "pano-0", "en", models.DescriptionShort); desc != nil {
+		t.Error("最早生成的描述应该被淘汰")
+	}
+	if desc, _ := repo.GetDescription(ctx, fmt.Sprintf("pano-%d", maxMemoryDescriptions), "en", models.DescriptionShort); desc == nil {
+		t.Error("最新的描述应该保留")
+	}
+}
@@ -4,14 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/utils"
 	"github.com/redis/go-redis/v9"
 )
 
 type RedisConfig interface {
 	RedisAddress() string
+	RedisPassword() string
+	RedisDB() int
 }
 
 type RedisRepository struct {
@@ -19,32 +25,112 @@ type RedisRepository struct {
 }
 
 func NewRedisRepository(cfg RedisConfig) (Repository, error) {
+	repo, err := OpenRedisRepository(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := repo.backfillLocationIndex(context.Background()); err != nil {
+		utils.SystemLogger().Error("location_index_backfill_failed", "Failed to backfill the location index", err)
+	}
+	return repo, nil
+}
+
+// OpenRedisRepository 只连接 Redis，不补建位置索引，不写入任何数据
+// 供只读取数据的迁移工具使用，服务进程使用 NewRedisRepository
+func OpenRedisRepository(cfg RedisConfig) (*RedisRepository, error) {
 	rdb := redis.NewClient(&redis.Options{
-		Addr: cfg.RedisAddress(),
-		DB:   0,
+		Addr:     cfg.RedisAddress(),
+		Password: cfg.RedisPassword(),
+		DB:       cfg.RedisDB(),
 	})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
 		return nil, fmt.Errorf("Redis连接失败: %w", err)
 	}
 
 	return &RedisRepository{client: rdb}, nil
 }
 
-// SaveLocation 保存位置信息到 Redis
-func (r *RedisRepository) SaveLocation(location models.Location) error {
-	ctx := context.Background()
+// locationIndexReadyKey 全部位置的索引已经补建完成的标记
+const locationIndexReadyKey = "locations:indexed"
+
+// backfillLocationIndex 把全部位置的索引加入之前保存的位置，每个数据库只执行一次
+// 索引只在保存位置时维护，不补建时降级模式在升级后找不到任何已发现的位置
+func (r *RedisRepository) backfillLocationIndex(ctx context.Context) error {
+	ready, err := r.client.Exists(ctx, locationIndexReadyKey).Result()
+	if err != nil {
+		return fmt.Errorf("检查位置索引失败: %w", err)
+	}
+	if ready > 0 {
+		return nil
+	}
+
+	count, err := backfillLocationIndex(ctx, r.ScanLocations, func(panoIDs []string) error {
+		members := make([]interface{}, len(panoIDs))
+		for i, panoID := range panoIDs {
+			members[i] = panoID
+		}
+		return r.client.SAdd(ctx, "locations", members...).Err()
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.client.Set(ctx, locationIndexReadyKey, time.Now().Unix(), 0).Err(); err != nil {
+		return fmt.Errorf("保存位置索引标记失败: %w", err)
+	}
+
+	utils.SystemLogger().Info("location_index_backfilled", "Backfilled the location index", map[string]interface{}{
+		"locations": count,
+	})
+	return nil
+}
+
+// locationIndexBatch 补建索引时每批加入的位置数量
+const locationIndexBatch = 500
+
+// backfillLocationIndex 遍历所有位置，分批把全景图ID交给 add，返回加入的位置数量
+func backfillLocationIndex(ctx context.Context, scan func(ctx context.Context, fn func(location models.Location) error) error, add func(panoIDs []string) error) (int, error) {
+	count := 0
+	batch := make([]string, 0, locationIndexBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := add(batch); err != nil {
+			return fmt.Errorf("补建位置索引失败: %w", err)
+		}
+		count += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	err := scan(ctx, func(location models.Location) error {
+		batch = append(batch, location.PanoID)
+		if len(batch) == locationIndexBatch {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, flush()
+}
 
+// SaveLocation 保存位置信息到 Redis
+func (r *RedisRepository) SaveLocation(ctx context.Context, location models.Location) error {
 	// 设置创建时间
 	if location.CreatedAt.IsZero() {
 		location.CreatedAt = time.Now()
 	}
 
 	// 序列化位置信息
-	data, err := json.Marshal(location)
+	data, err := encodeLocation(location)
 	if err != nil {
 		return fmt.Errorf("序列化位置信息失败: %w", err)
 	}
@@ -52,13 +138,25 @@ func (r *RedisRepository) SaveLocation(location models.Location) error {
 	// 使用 pano_id 作为键
 	key := fmt.Sprintf("location:%s", location.PanoID)
 
-	// 保存完整的位置信息
-	err = r.client.Set(ctx, key, data, 0).Err()
-	if err != nil {
+	// 保存并取回旧的位置信息，国家或城市变化时移除旧的索引项
+	previousData, err := r.client.SetArgs(ctx, key, data, redis.SetArgs{Get: true}).Bytes()
+	if err != nil && err != redis.Nil {
 		return fmt.Errorf("保存位置信息失败: %w", err)
 	}
+	if err == nil {
+		var previous models.Location
+		if decodeLocation(previousData, &previous) == nil {
+			if previous.Country != "" && previous.Country != location.Country {
+				r.client.SRem(ctx, fmt.Sprintf("country:%s", previous.Country), location.PanoID)
+			}
+			if previous.City != "" && previous.City != location.City {
+				r.client.SRem(ctx, fmt.Sprintf("city:%s", previous.City), location.PanoID)
+			}
+		}
+	}
 
-	// 添加到国家和城市的索引中
+	// 添加到全部位置、国家和城市的索引中
+	r.client.SAdd(ctx, "locations", location.PanoID)
 	if location.Country != "" {
 		r.client.SAdd(ctx, fmt.Sprintf("country:%s", location.Country), location.PanoID)
 	}
@@ -69,33 +167,493 @@ func (r *RedisRepository) SaveLocation(location models.Location) error {
 	return nil
 }
 
+// maxLocationUpdateRetries 位置记录或追问对话并发修改时读取-修改-写回的最多尝试次数
+const maxLocationUpdateRetries = 5
+
 // GetLocationByPanoID 通过全景图ID获取位置信息
-func (r *RedisRepository) GetLocationByPanoID(panoID string) (models.Location, error) {
-	ctx := context.Background()
+func (r *RedisRepository) GetLocationByPanoID(ctx context.Context, panoID string) (models.Location, error) {
+	// 更新访问信息
+	location, err := r.updateLocation(ctx, panoID, func(location *models.Location) {
+		location.LastAccessedAt = time.Now()
+		location.AccessCount++
+	})
+	if err != nil {
+		return models.Location{}, fmt.Errorf("获取位置信息失败: %w", err)
+	}
+
+	return location, nil
+}
+
+// UpdateLocationDescription 只更新位置记录的简短描述和对话历史
+func (r *RedisRepository) UpdateLocationDescription(ctx context.Context, desc models.LocationDescription, history string) error {
+	_, err := r.updateLocation(ctx, desc.PanoID, func(location *models.Location) {
+		setLocationDescription(location, desc, history)
+	})
+	if err != nil {
+		return fmt.Errorf("更新位置描述失败: %w", err)
+	}
+	return nil
+}
+
+// updateLocation 在 WATCH 事务中读取、修改并写回位置记录，记录被并发修改时重试
+// 只修改不影响国家和城市索引的字段，索引不需要更新
+func (r *RedisRepository) updateLocation(ctx context.Context, panoID string, update func(location *models.Location)) (models.Location, error) {
 	key := fmt.Sprintf("location:%s", panoID)
 
+	var location models.Location
+	for i := 0; i < maxLocationUpdateRetries; i++ {
+		err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+			data, err := tx.Get(ctx, key).Bytes()
+			if err == redis.Nil {
+				return fmt.Errorf("%s: %w", panoID, ErrLocationNotFound)
+			}
+			if err != nil {
+				return err
+			}
+
+			location = models.Location{}
+			if err := decodeLocation(data, &location); err != nil {
+				return fmt.Errorf("解析位置信息失败: %w", err)
+			}
+			update(&location)
+			data, err = encodeLocation(location)
+			if err != nil {
+				return fmt.Errorf("序列化位置信息失败: %w", err)
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, data, 0)
+				return nil
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			return location, err
+		}
+	}
+
+	return models.Location{}, fmt.Errorf("%s: 位置记录并发修改，重试 %d 次后放弃", panoID, maxLocationUpdateRetries)
+}
+
+// LocationExists 判断位置记录是否存在
+func (r *RedisRepository) LocationExists(ctx context.Context, panoID string) (bool, error) {
+	count, err := r.client.Exists(ctx, fmt.Sprintf("location:%s", panoID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("查询位置信息失败: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ListLocationsByCountry 通过国家索引分页查询位置信息
+func (r *RedisRepository) ListLocationsByCountry(ctx context.Context, country string, offset, limit int) ([]models.Location, error) {
+	return r.listIndexedLocations(ctx, fmt.Sprintf("country:%s", country), offset, limit)
+}
+
+// ListLocationsByCity 通过城市索引分页查询位置信息
+func (r *RedisRepository) ListLocationsByCity(ctx context.Context, city string, offset, limit int) ([]models.Location, error) {
+	return r.listIndexedLocations(ctx, fmt.Sprintf("city:%s", city), offset, limit)
+}
+
+// CountLocationsByCountry 统计国家索引中的位置数量
+func (r *RedisRepository) CountLocationsByCountry(ctx context.Context, country string) (int64, error) {
+	count, err := r.client.SCard(ctx, fmt.Sprintf("country:%s", country)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("统计位置数量失败: %w", err)
+	}
+	return count, nil
+}
+
+// CountLocationsByCity 统计城市索引中的位置数量
+func (r *RedisRepository) CountLocationsByCity(ctx context.Context, city string) (int64, error) {
+	count, err := r.client.SCard(ctx, fmt.Sprintf("city:%s", city)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("统计位置数量失败: %w", err)
+	}
+	return count, nil
+}
+
+// GetRandomLocationByCountry 从国家索引中随机取一个已发现的位置
+func (r *RedisRepository) GetRandomLocationByCountry(ctx context.Context, country string) (models.Location, error) {
+	panoID, err := r.client.SRandMember(ctx, fmt.Sprintf("country:%s", country)).Result()
+	if err == redis.Nil {
+		return models.Location{}, fmt.Errorf("国家 %s 没有已发现的位置: %w", country, ErrLocationNotFound)
+	}
+	if err != nil {
+		return models.Location{}, fmt.Errorf("随机获取位置失败: %w", err)
+	}
+
+	locations, err := r.getLocations(ctx, []string{panoID})
+	if err != nil {
+		return models.Location{}, err
+	}
+	if len(locations) == 0 {
+		return models.Location{}, fmt.Errorf("位置 %s 已不存在: %w", panoID, ErrLocationNotFound)
+	}
+	return locations[0], nil
+}
+
+// GetRandomLocation 从全部位置的索引中随机取一个已发现的位置
+// 索引在保存位置时维护，升级前保存的位置在启动时由 backfillLocationIndex 补建
+func (r *RedisRepository) GetRandomLocation(ctx context.Context) (models.Location, error) {
+	panoID, err := r.client.SRandMember(ctx, "locations").Result()
+	if err == redis.Nil {
+		return models.Location{}, fmt.Errorf("没有已发现的位置: %w", ErrLocationNotFound)
+	}
+	if err != nil {
+		return models.Location{}, fmt.Errorf("随机获取位置失败: %w", err)
+	}
+
+	locations, err := r.getLocations(ctx, []string{panoID})
+	if err != nil {
+		return models.Location{}, err
+	}
+	if len(locations) == 0 {
+		return models.Location{}, fmt.Errorf("位置 %s 已不存在: %w", panoID, ErrLocationNotFound)
+	}
+	return locations[0], nil
+}
+
+// listIndexedLocations 读取索引集合，按全景图ID排序后分页并批量获取位置信息
+func (r *RedisRepository) listIndexedLocations(ctx context.Context, indexKey string, offset, limit int) ([]models.Location, error) {
+	panoIDs, err := r.client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取位置索引失败: %w", err)
+	}
+
+	// Redis 集合是无序的，排序后分页结果才稳定
+	sort.Strings(panoIDs)
+	start, end := paginate(len(panoIDs), offset, limit)
+
+	return r.getLocations(ctx, panoIDs[start:end])
+}
+
+// getLocations 使用 MGET 批量获取位置信息，跳过索引中残留但已不存在的记录
+func (r *RedisRepository) getLocations(ctx context.Context, panoIDs []string) ([]models.Location, error) {
+	locations := make([]models.Location, 0, len(panoIDs))
+	if len(panoIDs) == 0 {
+		return locations, nil
+	}
+
+	keys := make([]string, len(panoIDs))
+	for i, panoID := range panoIDs {
+		keys[i] = fmt.Sprintf("location:%s", panoID)
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("批量获取位置信息失败: %w", err)
+	}
+
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var location models.Location
+		if err := decodeLocation([]byte(data), &location); err != nil {
+			return nil, fmt.Errorf("解析位置信息 %s 失败: %w", keys[i], err)
+		}
+		locations = append(locations, location)
+	}
+
+	return locations, nil
+}
+
+// SaveDescription 保存 AI 描述缓存
+func (r *RedisRepository) SaveDescription(ctx context.Context, desc models.LocationDescription) error {
+	data, err := json.Marshal(desc)
+	if err != nil {
+		return fmt.Errorf("序列化描述失败: %w", err)
+	}
+
+	key := fmt.Sprintf("description:%s:%s:%s", desc.PanoID, desc.Language, desc.Kind)
+	if err := r.client.Set(ctx, key, data, 0).Err(); err != nil {
+		return fmt.Errorf("保存描述失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetDescription 获取 AI 描述缓存
+func (r *RedisRepository) GetDescription(ctx context.Context, panoID, language, kind string) (*models.LocationDescription, error) {
+	key := fmt.Sprintf("description:%s:%s:%s", panoID, language, kind)
+
 	data, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil // 没有缓存
+	}
 	if err != nil {
-		return models.Location{}, fmt.Errorf("获取位置信息失败: %w", err)
+		return nil, fmt.Errorf("获取描述失败: %w", err)
 	}
 
-	var location models.Location
-	if err := json.Unmarshal(data, &location); err != nil {
-		return models.Location{}, fmt.Errorf("解析位置信息失败: %w", err)
+	var desc models.LocationDescription
+	if err := json.Unmarshal(data, &desc); err != nil {
+		return nil, fmt.Errorf("解析描述失败: %w", err)
 	}
 
-	// 更新访问信息
-	location.LastAccessedAt = time.Now()
-	location.AccessCount++
-	r.SaveLocation(location)
+	return &desc, nil
+}
 
-	return location, nil
+// SaveGeocode 保存逆地理编码缓存，由 Redis 按 ExpiresAt 自动过期
+func (r *RedisRepository) SaveGeocode(ctx context.Context, entry models.GeocodeCacheEntry) error {
+	ttl := time.Until(entry.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化地理编码缓存失败: %w", err)
+	}
+
+	if err := r.client.Set(ctx, geocodeKey(entry.Key), data, ttl).Err(); err != nil {
+		return fmt.Errorf("保存地理编码缓存失败: %w", err)
+	}
+
+	return nil
 }
 
+// GetGeocode 获取逆地理编码缓存
+func (r *RedisRepository) GetGeocode(ctx context.Context, key string) (*models.GeocodeCacheEntry, error) {
+	data, err := r.client.Get(ctx, geocodeKey(key)).Bytes()
+	if err == redis.Nil {
+		return nil, nil // 没有缓存
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取地理编码缓存失败: %w", err)
+	}
+
+	var entry models.GeocodeCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("解析地理编码缓存失败: %w", err)
+	}
+
+	return &entry, nil
+}
+
+func geocodeKey(key string) string {
+	return fmt.Sprintf("geocode:%s", key)
+}
+
+// streetViewImageIndexKey 记录缓存中的街景图片及其过期时间的有序集合，用于限制图片数量
+const streetViewImageIndexKey = "streetview_image_index"
+
+// maxRedisImages Redis 中最多缓存的街景图片数量，与内存后端相同，每张图片最多 STREETVIEW_IMAGE_MAX_BYTES
+const maxRedisImages = maxMemoryImages
+
+// SaveStreetViewImage 保存街景图片缓存，由 Redis 按 ExpiresAt 自动过期
+// 缓存的图片超过 maxRedisImages 张时淘汰最早过期的图片
+func (r *RedisRepository) SaveStreetViewImage(ctx context.Context, entry models.StreetViewImageCacheEntry) error {
+	ttl := time.Until(entry.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化街景图片缓存失败: %w", err)
+	}
+
+	var count *redis.IntCmd
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, streetViewImageKey(entry.Key), data, ttl)
+		pipe.ZAdd(ctx, streetViewImageIndexKey, redis.Z{Score: float64(entry.ExpiresAt.Unix()), Member: entry.Key})
+		pipe.ZRemRangeByScore(ctx, streetViewImageIndexKey, "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+		count = pipe.ZCard(ctx, streetViewImageIndexKey)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("保存街景图片缓存失败: %w", err)
+	}
+
+	if excess := count.Val() - maxRedisImages; excess > 0 {
+		evicted, err := r.client.ZPopMin(ctx, streetViewImageIndexKey, excess).Result()
+		if err != nil {
+			return fmt.Errorf("淘汰街景图片缓存失败: %w", err)
+		}
+		keys := make([]string, 0, len(evicted))
+		for _, z := range evicted {
+			if key, ok := z.Member.(string); ok {
+				keys = append(keys, streetViewImageKey(key))
+			}
+		}
+		if len(keys) > 0 {
+			if err := r.client.Del(ctx, keys...).Err(); err != nil {
+				return fmt.Errorf("淘汰街景图片缓存失败: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetStreetViewImage 获取街景图片缓存
+func (r *RedisRepository) GetStreetViewImage(ctx context.Context, key string) (*models.StreetViewImageCacheEntry, error) {
+	data, err := r.client.Get(ctx, streetViewImageKey(key)).Bytes()
+	if err == redis.Nil {
+		return nil, nil // 没有缓存
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取街景图片缓存失败: %w", err)
+	}
+
+	var entry models.StreetViewImageCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("解析街景图片缓存失败: %w", err)
+	}
+
+	return &entry, nil
+}
+
+func streetViewImageKey(key string) string {
+	return fmt.Sprintf("streetview_image:%s", key)
+}
+
+// SaveStreetViewImageETag 保存街景图片的 ETag，由 Redis 按 expiresAt 自动过期
+func (r *RedisRepository) SaveStreetViewImageETag(ctx context.Context, key, etag string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := r.client.Set(ctx, streetViewImageETagKey(key), etag, ttl).Err(); err != nil {
+		return fmt.Errorf("保存街景图片 ETag 失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetStreetViewImageETag 获取街景图片 ETag
+func (r *RedisRepository) GetStreetViewImageETag(ctx context.Context, key string) (string, error) {
+	etag, err := r.client.Get(ctx, streetViewImageETagKey(key)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("获取街景图片 ETag 失败: %w", err)
+	}
+
+	return etag, nil
+}
+
+func streetViewImageETagKey(key string) string {
+	return fmt.Sprintf("streetview_image_etag:%s", key)
+}
+
+// SaveChatThread 保存追问对话，设置了 ExpiresAt 时由 Redis 在过期后删除
+func (r *RedisRepository) SaveChatThread(ctx context.Context, thread models.ChatThread) error {
+	var ttl time.Duration
+	if !thread.ExpiresAt.IsZero() {
+		ttl = time.Until(thread.ExpiresAt)
+		if ttl <= 0 {
+			return nil // 已过期，无需保存
+		}
+	}
+
+	data, err := json.Marshal(thread)
+	if err != nil {
+		return fmt.Errorf("序列化对话失败: %w", err)
+	}
+
+	key := fmt.Sprintf("chat_thread:%s:%s", thread.SessionID, thread.PanoID)
+	if err := r.client.Set(ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("保存对话失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetChatThread 获取追问对话
+func (r *RedisRepository) GetChatThread(ctx context.Context, sessionID, panoID string) (*models.ChatThread, error) {
+	key := fmt.Sprintf("chat_thread:%s:%s", sessionID, panoID)
+
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil // 还没有开始对话
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取对话失败: %w", err)
+	}
+
+	var thread models.ChatThread
+	if err := json.Unmarshal(data, &thread); err != nil {
+		return nil, fmt.Errorf("解析对话失败: %w", err)
+	}
+
+	return &thread, nil
+}
+
+// AppendChatMessages 用 WATCH 读取对话并追加消息，对话在读写之间被修改时重试
+func (r *RedisRepository) AppendChatMessages(ctx context.Context, thread models.ChatThread, messages ...models.ChatMessage) (models.ChatThread, error) {
+	key := fmt.Sprintf("chat_thread:%s:%s", thread.SessionID, thread.PanoID)
+
+	var merged models.ChatThread
+	for i := 0; i < maxLocationUpdateRetries; i++ {
+		err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+			var stored *models.ChatThread
+			data, err := tx.Get(ctx, key).Bytes()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			if err == nil {
+				stored = &models.ChatThread{}
+				if err := json.Unmarshal(data, stored); err != nil {
+					return fmt.Errorf("解析对话失败: %w", err)
+				}
+			}
+			merged = appendChatThread(stored, thread, messages)
+
+			var ttl time.Duration
+			if !merged.ExpiresAt.IsZero() {
+				ttl = time.Until(merged.ExpiresAt)
+				if ttl <= 0 {
+					return nil // 已过期，无需保存
+				}
+			}
+			data, err = json.Marshal(merged)
+			if err != nil {
+				return fmt.Errorf("序列化对话失败: %w", err)
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, data, ttl)
+				return nil
+			})
+			return err
+		}, key)
+		if err == nil {
+			return merged, nil
+		}
+		if err != redis.TxFailedErr {
+			return models.ChatThread{}, fmt.Errorf("追加对话消息失败: %w", err)
+		}
+	}
+
+	return models.ChatThread{}, fmt.Errorf("追加对话消息失败: 对话并发修改，重试 %d 次后放弃", maxLocationUpdateRetries)
+}
+
+// AddChatUsage 在事务中累加追问对话计数哈希的两个字段
+func (r *RedisRepository) AddChatUsage(ctx context.Context, sessionID, panoID string, turns, tokens int, ttl time.Duration) (models.ChatUsage, error) {
+	key := fmt.Sprintf("chat_usage:%s:%s", sessionID, panoID)
+
+	var turnsCmd, tokensCmd *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		turnsCmd = pipe.HIncrBy(ctx, key, "turns", int64(turns))
+		tokensCmd = pipe.HIncrBy(ctx, key, "tokens_used", int64(tokens))
+		if ttl > 0 {
+			pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.ChatUsage{}, fmt.Errorf("追问计数失败: %w", err)
+	}
+
+	return models.ChatUsage{Turns: int(turnsCmd.Val()), TokensUsed: int(tokensCmd.Val())}, nil
+}
 
 // SaveExplorationPreference 保存用户的探索偏好
-func (r *RedisRepository) SaveExplorationPreference(sessionID string, pref models.ExplorationPreference) error {
-	ctx := context.Background()
+func (r *RedisRepository) SaveExplorationPreference(ctx context.Context, sessionID string, pref models.ExplorationPreference) error {
 	key := fmt.Sprintf("exploration_preference:%s", sessionID)
 
 	// 将偏好转换为 JSON
@@ -113,8 +671,7 @@ func (r *RedisRepository) SaveExplorationPreference(sessionID string, pref model
 }
 
 // GetExplorationPreference 获取用户的探索偏好
-func (r *RedisRepository) GetExplorationPreference(sessionID string) (*models.ExplorationPreference, error) {
-	ctx := context.Background()
+func (r *RedisRepository) GetExplorationPreference(ctx context.Context, sessionID string) (*models.ExplorationPreference, error) {
 	key := fmt.Sprintf("exploration_preference:%s", sessionID)
 
 	// 从 Redis 获取数据
@@ -136,8 +693,7 @@ func (r *RedisRepository) GetExplorationPreference(sessionID string) (*models.Ex
 }
 
 // DeleteExplorationPreference 删除用户的探索偏好
-func (r *RedisRepository) DeleteExplorationPreference(sessionID string) error {
-	ctx := context.Background()
+func (r *RedisRepository) DeleteExplorationPreference(ctx context.Context, sessionID string) error {
 	key := fmt.Sprintf("exploration_preference:%s", sessionID)
 
 	if err := r.client.Del(ctx, key).Err(); err != nil {
@@ -147,6 +703,230 @@ func (r *RedisRepository) DeleteExplorationPreference(sessionID string) error {
 	return nil
 }
 
+// PushPoolLocation 把位置加入预生成位置池（Redis 列表）的末尾
+func (r *RedisRepository) PushPoolLocation(ctx context.Context, pool string, location models.Location) error {
+	data, err := encodeLocation(location)
+	if err != nil {
+		return fmt.Errorf("序列化位置信息失败: %w", err)
+	}
+
+	if err := r.client.RPush(ctx, poolKey(pool), data).Err(); err != nil {
+		return fmt.Errorf("加入位置池失败: %w", err)
+	}
+
+	return nil
+}
+
+// PopPoolLocation 取出预生成位置池中最早加入的位置
+func (r *RedisRepository) PopPoolLocation(ctx context.Context, pool string) (*models.Location, error) {
+	data, err := r.client.LPop(ctx, poolKey(pool)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("从位置池取出位置失败: %w", err)
+	}
+
+	var location models.Location
+	if err := decodeLocation(data, &location); err != nil {
+		return nil, fmt.Errorf("解析位置信息失败: %w", err)
+	}
+
+	return &location, nil
+}
+
+// PoolSize 返回预生成位置池中的位置数量
+func (r *RedisRepository) PoolSize(ctx context.Context, pool string) (int64, error) {
+	size, err := r.client.LLen(ctx, poolKey(pool)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("获取位置池大小失败: %w", err)
+	}
+
+	return size, nil
+}
+
+// DeletePool 删除预生成位置池
+func (r *RedisRepository) DeletePool(ctx context.Context, pool string) error {
+	if err := r.client.Del(ctx, poolKey(pool)).Err(); err != nil {
+		return fmt.Errorf("删除位置池失败: %w", err)
+	}
+
+	return nil
+}
+
+// ListPools 使用 SCAN 列出所有位置池，避免 KEYS 阻塞 Redis
+func (r *RedisRepository) ListPools(ctx context.Context) ([]string, error) {
+	var pools []string
+	iter := r.client.Scan(ctx, 0, poolKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		pools = append(pools, strings.TrimPrefix(iter.Val(), poolKey("")))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("列出位置池失败: %w", err)
+	}
+
+	return pools, nil
+}
+
+func poolKey(pool string) string {
+	return fmt.Sprintf("location_pool:%s", pool)
+}
+
+// IncrementRateLimit 使用 Redis 计数器实现限流计数
+func (r *RedisRepository) IncrementRateLimit(ctx context.Context, key string, window time.Duration) (int64, error) {
+	count, err := r.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("限流计数失败: %w", err)
+	}
+
+	// 首次计数时设置过期时间
+	if count == 1 {
+		if err := r.client.Expire(ctx, key, window).Err(); err != nil {
+			return 0, fmt.Errorf("设置限流过期时间失败: %w", err)
+		}
+	}
+
+	return count, nil
+}
+
+// IncrementUsage 外部 API 用量计数加一，与限流计数不同，计数保存在 Redis 中，重启后不会丢失
+func (r *RedisRepository) IncrementUsage(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	count, err := r.client.Incr(ctx, usageKey(key)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("用量计数失败: %w", err)
+	}
+
+	// 首次计数时设置过期时间
+	if count == 1 {
+		if err := r.client.Expire(ctx, usageKey(key), ttl).Err(); err != nil {
+			return 0, fmt.Errorf("设置用量计数过期时间失败: %w", err)
+		}
+	}
+
+	return count, nil
+}
+
+// decrUsageScript 计数存在时才减一，避免在已过期的键上留下没有过期时间的负数计数
+var decrUsageScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("DECR", KEYS[1])
+end
+return 0
+`)
+
+// DecrementUsage 撤销一次外部 API 用量计数
+func (r *RedisRepository) DecrementUsage(ctx context.Context, key string) error {
+	if err := decrUsageScript.Run(ctx, r.client, []string{usageKey(key)}).Err(); err != nil {
+		return fmt.Errorf("撤销用量计数失败: %w", err)
+	}
+	return nil
+}
+
+// GetUsage 返回外部 API 用量计数
+func (r *RedisRepository) GetUsage(ctx context.Context, key string) (int64, error) {
+	count, err := r.client.Get(ctx, usageKey(key)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("获取用量计数失败: %w", err)
+	}
+
+	return count, nil
+}
+
+func usageKey(key string) string {
+	return fmt.Sprintf("api_usage:%s", key)
+}
+
+// ScanLocations 遍历 Redis 中保存的所有位置信息，用于数据迁移
+func (r *RedisRepository) ScanLocations(ctx context.Context, fn func(location models.Location) error) error {
+	return r.scanJSON(ctx, "location:*", func(key string, data []byte) error {
+		var location models.Location
+		if err := decodeLocation(data, &location); err != nil {
+			return fmt.Errorf("解析位置信息 %s 失败: %w", key, err)
+		}
+		return fn(location)
+	})
+}
+
+// ScanExplorationPreferences 遍历 Redis 中保存的所有探索偏好，用于数据迁移
+func (r *RedisRepository) ScanExplorationPreferences(ctx context.Context, fn func(sessionID string, pref models.ExplorationPreference) error) error {
+	return r.scanJSON(ctx, "exploration_preference:*", func(key string, data []byte) error {
+		var pref models.ExplorationPreference
+		if err := json.Unmarshal(data, &pref); err != nil {
+			return fmt.Errorf("解析探索偏好 %s 失败: %w", key, err)
+		}
+		return fn(strings.TrimPrefix(key, "exploration_preference:"), pref)
+	})
+}
+
+// ScanDescriptions 遍历 Redis 中保存的所有 AI 描述缓存，用于数据迁移
+func (r *RedisRepository) ScanDescriptions(ctx context.Context, fn func(desc models.LocationDescription) error) error {
+	return r.scanJSON(ctx, "description:*", func(key string, data []byte) error {
+		var desc models.LocationDescription
+		if err := json.Unmarshal(data, &desc); err != nil {
+			return fmt.Errorf("解析描述 %s 失败: %w", key, err)
+		}
+		return fn(desc)
+	})
+}
+
+// ScanChatThreads 遍历 Redis 中保存的所有追问对话，用于数据迁移
+func (r *RedisRepository) ScanChatThreads(ctx context.Context, fn func(thread models.ChatThread) error) error {
+	return r.scanJSON(ctx, "chat_thread:*", func(key string, data []byte) error {
+		var thread models.ChatThread
+		if err := json.Unmarshal(data, &thread); err != nil {
+			return fmt.Errorf("解析对话 %s 失败: %w", key, err)
+		}
+		return fn(thread)
+	})
+}
+
+// ScanGeocodes 遍历 Redis 中保存的所有逆地理编码缓存，用于数据迁移
+func (r *RedisRepository) ScanGeocodes(ctx context.Context, fn func(entry models.GeocodeCacheEntry) error) error {
+	return r.scanJSON(ctx, geocodeKey("*"), func(key string, data []byte) error {
+		var entry models.GeocodeCacheEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("解析地理编码缓存 %s 失败: %w", key, err)
+		}
+		return fn(entry)
+	})
+}
+
+// ScanStreetViewImages 遍历 Redis 中保存的所有街景图片缓存，用于数据迁移
+func (r *RedisRepository) ScanStreetViewImages(ctx context.Context, fn func(entry models.StreetViewImageCacheEntry) error) error {
+	return r.scanJSON(ctx, streetViewImageKey("*"), func(key string, data []byte) error {
+		var entry models.StreetViewImageCacheEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("解析街景图片缓存 %s 失败: %w", key, err)
+		}
+		return fn(entry)
+	})
+}
+
+// scanJSON 使用 SCAN 遍历匹配的键并读取其 JSON 内容，避免 KEYS 阻塞 Redis
+func (r *RedisRepository) scanJSON(ctx context.Context, pattern string, fn func(key string, data []byte) error) error {
+	iter := r.client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		data, err := r.client.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			continue // 遍历期间键已被删除
+		}
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %w", key, err)
+		}
+		if err := fn(key, data); err != nil {
+			return err
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("遍历 Redis 键失败: %w", err)
+	}
+	return nil
+}
 
 // GetRedisClient returns the underlying redis client.
 func (r *RedisRepository) GetRedisClient() *redis.Client {
@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/my-streetview-project/backend/internal/models"
+)
+
+func TestBackfillLocationIndex(t *testing.T) {
+	// 升级前保存的位置数量超过一批
+	total := locationIndexBatch + 3
+	scan := func(ctx context.Context, fn func(location models.Location) error) error {
+		for i := 0; i < total; i++ {
+			if err := fn(models.Location{PanoID: fmt.Sprintf("pano-%d", i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	indexed := make(map[string]bool)
+	batches := 0
+	count, err := backfillLocationIndex(context.Background(), scan, func(panoIDs []string) error {
+		batches++
+		for _, panoID := range panoIDs {
+			indexed[panoID] = true
+		}
+		return nil
+	})
+	if err != nil || count != total || len(indexed) != total {
+		t.Errorf("应该补建 %d 个位置，实际为 %d (%d 个不同的位置, %v)", total, count, len(indexed), err)
+	}
+	if batches != 2 {
+		t.Errorf("应该分 2 批加入索引，实际为 %d 批", batches)
+	}
+
+	// 加入索引失败时返回错误，不标记完成
+	failure := errors.New("redis unavailable")
+	if _, err := backfillLocationIndex(context.Background(), scan, func([]string) error { return failure }); !errors.Is(err, failure) {
+		t.Errorf("错误应为 %v，实际为 %v", failure, err)
+	}
+}
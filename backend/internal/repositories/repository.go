@@ -1,24 +1,163 @@
 package repositories
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/my-streetview-project/backend/internal/models"
-	"github.com/redis/go-redis/v9"
 )
 
 type Repository interface {
 	// 保存新的位置记录
-	SaveLocation(location models.Location) error
+	SaveLocation(ctx context.Context, location models.Location) error
 
 	// 获取位置记录
-	GetLocationByPanoID(panoID string) (models.Location, error)
+	GetLocationByPanoID(ctx context.Context, panoID string) (models.Location, error)
+	// 重新读取位置记录，只更新简短描述和对话历史，其余字段保留存储中的最新值；记录不存在时返回 ErrLocationNotFound
+	UpdateLocationDescription(ctx context.Context, desc models.LocationDescription, history string) error
+	// 判断位置记录是否存在，不更新访问信息
+	LocationExists(ctx context.Context, panoID string) (bool, error)
+
+	// 基于国家/城市索引查询已发现的位置，按全景图ID排序分页，不更新访问信息
+	ListLocationsByCountry(ctx context.Context, country string, offset, limit int) ([]models.Location, error)
+	ListLocationsByCity(ctx context.Context, city string, offset, limit int) ([]models.Location, error)
+	CountLocationsByCountry(ctx context.Context, country string) (int64, error)
+	CountLocationsByCity(ctx context.Context, city string) (int64, error)
+
+	// 随机获取指定国家下一个已发现的位置，没有记录时返回 ErrLocationNotFound
+	GetRandomLocationByCountry(ctx context.Context, country string) (models.Location, error)
+	// 从所有已发现的位置中随机取一个，不更新访问信息，没有记录时返回 ErrLocationNotFound
+	GetRandomLocation(ctx context.Context) (models.Location, error)
+
+	// AI 描述缓存，按全景图ID、语言和描述类型存取，不存在时返回 nil, nil
+	SaveDescription(ctx context.Context, desc models.LocationDescription) error
+	GetDescription(ctx context.Context, panoID, language, kind string) (*models.LocationDescription, error)
+
+	// 逆地理编码缓存，按取整后的坐标和语言存取，按 ExpiresAt 过期，不存在或已过期时返回 nil, nil
+	SaveGeocode(ctx context.Context, entry models.GeocodeCacheEntry) error
+	GetGeocode(ctx context.Context, key string) (*models.GeocodeCacheEntry, error)
+
+	// 街景静态图片缓存，按全景图ID和视角参数存取，按 ExpiresAt 过期，不存在或已过期时返回 nil, nil
+	SaveStreetViewImage(ctx context.Context, entry models.StreetViewImageCacheEntry) error
+	GetStreetViewImage(ctx context.Context, key string) (*models.StreetViewImageCacheEntry, error)
+	// 街景图片的 ETag，与图片缓存使用相同的键，保存时间比图片更长，图片过期后客户端重新验证时不必请求上游
+	// 不存在或已过期时 GetStreetViewImageETag 返回空字符串
+	SaveStreetViewImageETag(ctx context.Context, key, etag string, expiresAt time.Time) error
+	GetStreetViewImageETag(ctx context.Context, key string) (string, error)
 
+	// 追问对话，按会话ID和全景图ID存取，按 ExpiresAt 过期（零值不过期），不存在或已过期时返回 nil, nil
+	SaveChatThread(ctx context.Context, thread models.ChatThread) error
+	GetChatThread(ctx context.Context, sessionID, panoID string) (*models.ChatThread, error)
+	// AppendChatMessages 原子地在已保存的对话末尾追加 messages，并发的追问不会覆盖彼此的问答，返回追加后的对话
+	// 对话不存在或已过期时以 thread 的消息为起点；计数取已保存的和 thread 中较大的值，更新时间和过期时间使用 thread 的
+	AppendChatMessages(ctx context.Context, thread models.ChatThread, messages ...models.ChatMessage) (models.ChatThread, error)
+	// 追问对话的提问次数和 token 用量计数，与对话分开保存，并发的追问不会覆盖彼此的计数
+	// AddChatUsage 原子地累加 turns 和 tokens（为负数时撤销之前的预留）并返回新的计数，ttl > 0 时每次累加后重新设置过期时间
+	AddChatUsage(ctx context.Context, sessionID, panoID string, turns, tokens int, ttl time.Duration) (models.ChatUsage, error)
 
 	// 探索偏好相关
-	SaveExplorationPreference(sessionID string, pref models.ExplorationPreference) error
-	GetExplorationPreference(sessionID string) (*models.ExplorationPreference, error)
-	DeleteExplorationPreference(sessionID string) error
+	SaveExplorationPreference(ctx context.Context, sessionID string, pref models.ExplorationPreference) error
+	GetExplorationPreference(ctx context.Context, sessionID string) (*models.ExplorationPreference, error)
+	DeleteExplorationPreference(ctx context.Context, sessionID string) error
+
+	// 预生成位置池，按池名先进先出存取；池为空时 PopPoolLocation 返回 nil, nil
+	PushPoolLocation(ctx context.Context, pool string, location models.Location) error
+	PopPoolLocation(ctx context.Context, pool string) (*models.Location, error)
+	PoolSize(ctx context.Context, pool string) (int64, error)
+	// 删除整个位置池，池不存在时不返回错误
+	DeletePool(ctx context.Context, pool string) error
+	// 列出存储中所有位置池的名称，可能包含已经取空的池；用于启动时清理重启前留下的池
+	ListPools(ctx context.Context) ([]string, error)
+
+	// 限流计数：对 key 计数加一并返回当前窗口内的计数，首次计数时设置窗口过期时间
+	IncrementRateLimit(ctx context.Context, key string, window time.Duration) (int64, error)
+
+	// 外部 API 用量计数，key 包含接口和统计窗口，例如 geocode:day:2024-05-01
+	// IncrementUsage 计数加一并返回新的计数，首次计数时设置 ttl 后过期；GetUsage 没有计数或已过期时返回 0
+	// DecrementUsage 撤销一次计数，用于计数后发现超出预算的请求，没有计数或已过期时不做任何事
+	IncrementUsage(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	DecrementUsage(ctx context.Context, key string) error
+	GetUsage(ctx context.Context, key string) (int64, error)
+}
+
+// ErrLocationNotFound 请求的位置记录不存在
+var ErrLocationNotFound = models.NewError(models.ErrNotFound, "LOCATION_NOT_FOUND", "位置不存在")
+
+// 支持的存储后端
+const (
+	StorageRedis  = "redis"
+	StorageMemory = "memory"
+	StorageBolt   = "bolt"
+)
+
+type StorageConfig interface {
+	RedisConfig
+	BoltConfig
+	StorageBackend() string
+}
+
+// NewRepository 根据配置创建对应的存储后端
+func NewRepository(cfg StorageConfig) (Repository, error) {
+	switch cfg.StorageBackend() {
+	case StorageRedis, "":
+		return NewRedisRepository(cfg)
+	case StorageMemory:
+		return NewMemoryRepository(), nil
+	case StorageBolt:
+		repo, err := NewBoltRepository(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return repo, nil
+	default:
+		return nil, fmt.Errorf("不支持的存储后端: %s", cfg.StorageBackend())
+	}
+}
+
+// paginate 计算 [offset, offset+limit) 在长度为 total 的列表中的有效区间
+func paginate(total, offset, limit int) (start, end int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= total || limit <= 0 {
+		return 0, 0
+	}
+	end = offset + limit
+	if end > total {
+		end = total
+	}
+	return offset, end
+}
+
+// setLocationDescription 把简短描述和生成它的对话历史写入位置记录
+func setLocationDescription(location *models.Location, desc models.LocationDescription, history string) {
+	location.AIDescription = desc.Content
+	location.DescriptionLanguage = desc.Language
+	location.DescriptionGenerated = desc.GeneratedAt
+	location.ConversationHistory = history
+}
 
+// storedLocation 位置记录在存储中的格式
+// 对话历史包含系统提示词，models.Location 序列化给客户端时不输出，只在存储中保留
+type storedLocation struct {
+	models.Location
+	ConversationHistory string `json:"conversation_history,omitempty"`
+}
+
+// encodeLocation 把位置记录编码为存储格式
+func encodeLocation(location models.Location) ([]byte, error) {
+	return json.Marshal(storedLocation{Location: location, ConversationHistory: location.ConversationHistory})
+}
 
-	// 获取 Redis 客户端
-	GetRedisClient() *redis.Client
+// decodeLocation 解码 encodeLocation 保存的位置记录
+func decodeLocation(data []byte, location *models.Location) error {
+	var stored storedLocation
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	*location = stored.Location
+	location.ConversationHistory = stored.ConversationHistory
+	return nil
 }
@@ -0,0 +1,528 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+)
+
+// testLocationIndexes 检查国家和城市索引随位置更新而变化，所有存储后端共用
+func testLocationIndexes(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	if _, err := repo.GetRandomLocation(ctx); !errors.Is(err, ErrLocationNotFound) {
+		t.Errorf("没有位置时错误应为 ErrLocationNotFound，实际为 %v", err)
+	}
+
+	loc := models.Location{PanoID: "pano-1", Country: "France", City: "Paris"}
+	if err := repo.SaveLocation(ctx, loc); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	if err := repo.SaveLocation(ctx, models.Location{PanoID: "pano-2", Country: "France", City: "Lyon"}); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	if count, err := repo.CountLocationsByCountry(ctx, "France"); err != nil || count != 2 {
+		t.Errorf("France 应该有 2 个位置，实际为 %d (%v)", count, err)
+	}
+
+	// 城市和国家变化后旧的索引项应该被移除
+	loc.City = "Versailles"
+	if err := repo.SaveLocation(ctx, loc); err != nil {
+		t.Fatalf("更新位置失败: %v", err)
+	}
+	if count, _ := repo.CountLocationsByCity(ctx, "Paris"); count != 0 {
+		t.Errorf("Paris 索引应该为空，实际有 %d 个位置", count)
+	}
+	if locations, _ := repo.ListLocationsByCity(ctx, "Versailles", 0, 10); len(locations) != 1 || locations[0].PanoID != "pano-1" {
+		t.Errorf("Versailles 索引不正确: %+v", locations)
+	}
+
+	loc.Country, loc.City = "Belgium", "Brussels"
+	if err := repo.SaveLocation(ctx, loc); err != nil {
+		t.Fatalf("更新位置失败: %v", err)
+	}
+	if locations, _ := repo.ListLocationsByCountry(ctx, "France", 0, 10); len(locations) != 1 || locations[0].PanoID != "pano-2" {
+		t.Errorf("France 索引应该只剩 pano-2，实际为 %+v", locations)
+	}
+	if count, _ := repo.CountLocationsByCity(ctx, "Versailles"); count != 0 {
+		t.Errorf("Versailles 索引应该为空，实际有 %d 个位置", count)
+	}
+	if got, err := repo.GetRandomLocationByCountry(ctx, "Belgium"); err != nil || got.PanoID != "pano-1" {
+		t.Errorf("Belgium 应该取到 pano-1，实际为 %+v (%v)", got, err)
+	}
+	for i := 0; i < 10; i++ {
+		if got, err := repo.GetRandomLocation(ctx); err != nil || (got.PanoID != "pano-1" && got.PanoID != "pano-2") {
+			t.Fatalf("应该取到已保存的位置，实际为 %+v (%v)", got, err)
+		}
+	}
+}
+
+func TestMemoryRepositoryLocationIndexes(t *testing.T) {
+	testLocationIndexes(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryLocationIndexes(t *testing.T) {
+	testLocationIndexes(t, newTestBoltRepository(t))
+}
+
+// testLocationExists 检查存在性查询不更新访问信息，所有存储后端共用
+func testLocationExists(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	if exists, err := repo.LocationExists(ctx, "pano-1"); err != nil || exists {
+		t.Fatalf("没有保存的位置应不存在，实际为 %v, %v", exists, err)
+	}
+	if err := repo.SaveLocation(ctx, models.Location{PanoID: "pano-1", Country: "France"}); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if exists, err := repo.LocationExists(ctx, "pano-1"); err != nil || !exists {
+			t.Fatalf("保存后的位置应存在，实际为 %v, %v", exists, err)
+		}
+	}
+	if locations, _ := repo.ListLocationsByCountry(ctx, "France", 0, 10); len(locations) != 1 || locations[0].AccessCount != 0 {
+		t.Errorf("存在性查询不应更新访问次数: %+v", locations)
+	}
+}
+
+func TestMemoryRepositoryLocationExists(t *testing.T) {
+	testLocationExists(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryLocationExists(t *testing.T) {
+	testLocationExists(t, newTestBoltRepository(t))
+}
+
+// testConversationHistoryStored 检查不返回给客户端的对话历史仍然随位置记录保存，所有存储后端共用
+func testConversationHistoryStored(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	history := `[{"role":"system","content":"prompt"}]`
+	if err := repo.SaveLocation(ctx, models.Location{PanoID: "pano_history", ConversationHistory: history}); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	location, err := repo.GetLocationByPanoID(ctx, "pano_history")
+	if err != nil {
+		t.Fatalf("获取位置失败: %v", err)
+	}
+	if location.ConversationHistory != history {
+		t.Errorf("对话历史为 %q，期望 %q", location.ConversationHistory, history)
+	}
+}
+
+func TestMemoryRepositoryConversationHistoryStored(t *testing.T) {
+	testConversationHistoryStored(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryConversationHistoryStored(t *testing.T) {
+	testConversationHistoryStored(t, newTestBoltRepository(t))
+}
+
+// testUpdateLocationDescription 检查更新描述只修改描述字段，保留记录中的其他字段，所有存储后端共用
+func testUpdateLocationDescription(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	desc := models.LocationDescription{PanoID: "pano-1", Language: "en", Content: "A busy crossing", GeneratedAt: time.Now()}
+
+	if err := repo.UpdateLocationDescription(ctx, desc, "history"); !errors.Is(err, ErrLocationNotFound) {
+		t.Errorf("没有位置时错误应为 ErrLocationNotFound，实际为 %v", err)
+	}
+
+	if err := repo.SaveLocation(ctx, models.Location{PanoID: "pano-1", Country: "Japan", City: "Tokyo"}); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	if _, err := repo.GetLocationByPanoID(ctx, "pano-1"); err != nil {
+		t.Fatalf("获取位置失败: %v", err)
+	}
+	if err := repo.UpdateLocationDescription(ctx, desc, "history"); err != nil {
+		t.Fatalf("更新描述失败: %v", err)
+	}
+
+	location, err := repo.GetLocationByPanoID(ctx, "pano-1")
+	if err != nil {
+		t.Fatalf("获取位置失败: %v", err)
+	}
+	if location.AIDescription != desc.Content || location.DescriptionLanguage != "en" || !location.DescriptionGenerated.Equal(desc.GeneratedAt) || location.ConversationHistory != "history" {
+		t.Errorf("描述字段没有更新: %+v", location)
+	}
+	if location.AccessCount != 2 || location.City != "Tokyo" {
+		t.Errorf("其他字段应该保留，实际为 %+v", location)
+	}
+	if count, _ := repo.CountLocationsByCity(ctx, "Tokyo"); count != 1 {
+		t.Errorf("Tokyo 索引应该有 1 个位置，实际为 %d", count)
+	}
+}
+
+func TestMemoryRepositoryUpdateLocationDescription(t *testing.T) {
+	testUpdateLocationDescription(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryUpdateLocationDescription(t *testing.T) {
+	testUpdateLocationDescription(t, newTestBoltRepository(t))
+}
+
+// testLocationPool 检查预生成位置池的先进先出语义，所有存储后端共用
+func testLocationPool(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	if loc, err := repo.PopPoolLocation(ctx, "global:en"); err != nil || loc != nil {
+		t.Fatalf("空池应返回 nil, nil，实际为 %v, %v", loc, err)
+	}
+
+	for _, panoID := range []string{"pano-1", "pano-2", "pano-3"} {
+		if err := repo.PushPoolLocation(ctx, "global:en", models.Location{PanoID: panoID}); err != nil {
+			t.Fatalf("加入位置池失败: %v", err)
+		}
+	}
+	if err := repo.PushPoolLocation(ctx, "global:zh", models.Location{PanoID: "pano-zh"}); err != nil {
+		t.Fatalf("加入位置池失败: %v", err)
+	}
+
+	if size, err := repo.PoolSize(ctx, "global:en"); err != nil || size != 3 {
+		t.Fatalf("池大小应为 3，实际为 %d, %v", size, err)
+	}
+
+	for _, want := range []string{"pano-1", "pano-2"} {
+		loc, err := repo.PopPoolLocation(ctx, "global:en")
+		if err != nil || loc == nil || loc.PanoID != want {
+			t.Fatalf("应取出 %s，实际为 %v, %v", want, loc, err)
+		}
+	}
+
+	if size, _ := repo.PoolSize(ctx, "global:en"); size != 1 {
+		t.Errorf("取出两个后池大小应为 1，实际为 %d", size)
+	}
+	if size, _ := repo.PoolSize(ctx, "global:zh"); size != 1 {
+		t.Errorf("其他池不受影响，池大小应为 1，实际为 %d", size)
+	}
+	if size, _ := repo.PoolSize(ctx, "missing"); size != 0 {
+		t.Errorf("不存在的池大小应为 0，实际为 %d", size)
+	}
+	if pools, err := repo.ListPools(ctx); err != nil || len(pools) != 2 {
+		t.Errorf("应列出 2 个池，实际为 %v, %v", pools, err)
+	}
+
+	// 删除池后其中的位置一并移除，不存在的池删除时不报错
+	for _, pool := range []string{"global:zh", "missing"} {
+		if err := repo.DeletePool(ctx, pool); err != nil {
+			t.Fatalf("删除位置池 %s 失败: %v", pool, err)
+		}
+	}
+	if loc, err := repo.PopPoolLocation(ctx, "global:zh"); err != nil || loc != nil {
+		t.Errorf("删除后的池应为空，实际为 %v, %v", loc, err)
+	}
+	if size, _ := repo.PoolSize(ctx, "global:en"); size != 1 {
+		t.Errorf("其他池不受删除影响，池大小应为 1，实际为 %d", size)
+	}
+}
+
+func TestMemoryRepositoryLocationPool(t *testing.T) {
+	testLocationPool(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryLocationPool(t *testing.T) {
+	testLocationPool(t, newTestBoltRepository(t))
+}
+
+// testGeocodeCache 检查逆地理编码缓存的存取和过期，所有存储后端共用
+func testGeocodeCache(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	if entry, err := repo.GetGeocode(ctx, "35.6595,139.7006:en"); err != nil || entry != nil {
+		t.Fatalf("没有缓存时应返回 nil, nil，实际为 %v, %v", entry, err)
+	}
+
+	now := time.Now()
+	fresh := models.GeocodeCacheEntry{
+		Key:       "35.6595,139.7006:en",
+		Result:    testGeocodeResult("Japan"),
+		CachedAt:  now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	expired := models.GeocodeCacheEntry{
+		Key:       "35.6595,139.7006:ja",
+		Result:    testGeocodeResult("日本"),
+		CachedAt:  now.Add(-2 * time.Hour),
+		ExpiresAt: now.Add(-time.Hour),
+	}
+	for _, entry := range []models.GeocodeCacheEntry{fresh, expired} {
+		if err := repo.SaveGeocode(ctx, entry); err != nil {
+			t.Fatalf("保存地理编码缓存失败: %v", err)
+		}
+	}
+
+	entry, err := repo.GetGeocode(ctx, fresh.Key)
+	if err != nil || entry == nil || entry.Result == nil || entry.Result.Address().Country != "Japan" {
+		t.Errorf("应取到缓存的结果，实际为 %v, %v", entry, err)
+	}
+	if entry, err := repo.GetGeocode(ctx, expired.Key); err != nil || entry != nil {
+		t.Errorf("过期的缓存应返回 nil, nil，实际为 %v, %v", entry, err)
+	}
+}
+
+func testGeocodeResult(country string) *models.GeocodeResult {
+	return &models.GeocodeResult{
+		Source:   models.GeocodeSourceGoogle,
+		Language: "en",
+		Results: []models.GeocodePlace{{
+			FormattedAddress: country,
+			Types:            []string{"country", "political"},
+			Address:          models.AddressHierarchy{Country: country},
+		}},
+	}
+}
+
+func TestMemoryRepositoryGeocodeCache(t *testing.T) {
+	testGeocodeCache(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryGeocodeCache(t *testing.T) {
+	testGeocodeCache(t, newTestBoltRepository(t))
+}
+
+func testStreetViewImageCache(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	if entry, err := repo.GetStreetViewImage(ctx, "pano:h90:p0:f90:640x400"); err != nil || entry != nil {
+		t.Fatalf("没有缓存时应返回 nil, nil，实际为 %v, %v", entry, err)
+	}
+
+	now := time.Now()
+	fresh := models.StreetViewImageCacheEntry{
+		Key:         "pano:h90:p0:f90:640x400",
+		ContentType: "image/jpeg",
+		Data:        []byte{0xff, 0xd8, 0xff},
+		ETag:        `"abc"`,
+		CachedAt:    now,
+		ExpiresAt:   now.Add(time.Hour),
+	}
+	expired := fresh
+	expired.Key = "pano:h0:p0:f90:640x400"
+	expired.ExpiresAt = now.Add(-time.Hour)
+	for _, entry := range []models.StreetViewImageCacheEntry{fresh, expired} {
+		if err := repo.SaveStreetViewImage(ctx, entry); err != nil {
+			t.Fatalf("保存街景图片缓存失败: %v", err)
+		}
+	}
+
+	entry, err := repo.GetStreetViewImage(ctx, fresh.Key)
+	if err != nil || entry == nil || !bytes.Equal(entry.Data, fresh.Data) || entry.ETag != fresh.ETag || entry.ContentType != "image/jpeg" {
+		t.Errorf("应取到缓存的图片，实际为 %v, %v", entry, err)
+	}
+	if entry, err := repo.GetStreetViewImage(ctx, expired.Key); err != nil || entry != nil {
+		t.Errorf("过期的缓存应返回 nil, nil，实际为 %v, %v", entry, err)
+	}
+}
+
+func TestMemoryRepositoryStreetViewImageCache(t *testing.T) {
+	testStreetViewImageCache(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryStreetViewImageCache(t *testing.T) {
+	testStreetViewImageCache(t, newTestBoltRepository(t))
+}
+
+func testStreetViewImageETag(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	if etag, err := repo.GetStreetViewImageETag(ctx, "pano:h90:p0:f90:640x400"); err != nil || etag != "" {
+		t.Fatalf("没有记录时应返回空字符串，实际为 %q, %v", etag, err)
+	}
+
+	now := time.Now()
+	if err := repo.SaveStreetViewImageETag(ctx, "pano:h90:p0:f90:640x400", `"abc"`, now.Add(time.Hour)); err != nil {
+		t.Fatalf("保存街景图片 ETag 失败: %v", err)
+	}
+	if err := repo.SaveStreetViewImageETag(ctx, "pano:h0:p0:f90:640x400", `"def"`, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("保存街景图片 ETag 失败: %v", err)
+	}
+
+	if etag, err := repo.GetStreetViewImageETag(ctx, "pano:h90:p0:f90:640x400"); err != nil || etag != `"abc"` {
+		t.Errorf("应取到保存的 ETag，实际为 %q, %v", etag, err)
+	}
+	if etag, err := repo.GetStreetViewImageETag(ctx, "pano:h0:p0:f90:640x400"); err != nil || etag != "" {
+		t.Errorf("过期的 ETag 应返回空字符串，实际为 %q, %v", etag, err)
+	}
+}
+
+func TestMemoryRepositoryStreetViewImageETag(t *testing.T) {
+	testStreetViewImageETag(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryStreetViewImageETag(t *testing.T) {
+	testStreetViewImageETag(t, newTestBoltRepository(t))
+}
+
+func testChatThreadExpiry(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	now := time.Now()
+	threads := []models.ChatThread{
+		{SessionID: "session", PanoID: "fresh", Turns: 1, ExpiresAt: now.Add(time.Hour)},
+		{SessionID: "session", PanoID: "expired", Turns: 1, ExpiresAt: now.Add(-time.Hour)},
+		{SessionID: "session", PanoID: "forever", Turns: 1},
+	}
+	for _, thread := range threads {
+		if err := repo.SaveChatThread(ctx, thread); err != nil {
+			t.Fatalf("保存对话失败: %v", err)
+		}
+	}
+
+	if thread, err := repo.GetChatThread(ctx, "session", "fresh"); err != nil || thread == nil || thread.Turns != 1 {
+		t.Errorf("未过期的对话应取到，实际为 %v, %v", thread, err)
+	}
+	if thread, err := repo.GetChatThread(ctx, "session", "expired"); err != nil || thread != nil {
+		t.Errorf("过期的对话应返回 nil, nil，实际为 %v, %v", thread, err)
+	}
+	if thread, err := repo.GetChatThread(ctx, "session", "forever"); err != nil || thread == nil {
+		t.Errorf("没有过期时间的对话不应过期，实际为 %v, %v", thread, err)
+	}
+}
+
+func TestMemoryRepositoryChatThreadExpiry(t *testing.T) {
+	testChatThreadExpiry(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryChatThreadExpiry(t *testing.T) {
+	testChatThreadExpiry(t, newTestBoltRepository(t))
+}
+
+func testAppendChatMessages(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	// 对话不存在时以传入对话的消息为起点
+	seed := models.ChatThread{
+		SessionID: "session",
+		PanoID:    "pano-1",
+		Messages:  []models.ChatMessage{{Role: "system", Content: "seed"}},
+		Turns:     1,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	thread, err := repo.AppendChatMessages(ctx, seed, models.ChatMessage{Role: "user", Content: "q1"}, models.ChatMessage{Role: "assistant", Content: "a1"})
+	if err != nil || len(thread.Messages) != 3 {
+		t.Fatalf("追加后应有 3 条消息，实际为 %+v, %v", thread, err)
+	}
+
+	// 基于同一份旧对话的第二次追加不会覆盖第一次的问答，计数不会变小
+	seed.Turns = 2
+	if _, err := repo.AppendChatMessages(ctx, seed, models.ChatMessage{Role: "user", Content: "q2"}, models.ChatMessage{Role: "assistant", Content: "a2"}); err != nil {
+		t.Fatalf("追加对话消息失败: %v", err)
+	}
+	seed.Turns = 1
+	if _, err := repo.AppendChatMessages(ctx, seed, models.ChatMessage{Role: "user", Content: "q3"}, models.ChatMessage{Role: "assistant", Content: "a3"}); err != nil {
+		t.Fatalf("追加对话消息失败: %v", err)
+	}
+
+	stored, err := repo.GetChatThread(ctx, "session", "pano-1")
+	if err != nil || stored == nil {
+		t.Fatalf("应取到保存的对话: %v, %v", stored, err)
+	}
+	var contents []string
+	for _, msg := range stored.Messages {
+		contents = append(contents, msg.Content)
+	}
+	if got := strings.Join(contents, ","); got != "seed,q1,a1,q2,a2,q3,a3" || stored.Turns != 2 {
+		t.Errorf("对话为 %s，计数为 %d", got, stored.Turns)
+	}
+}
+
+func TestMemoryRepositoryAppendChatMessages(t *testing.T) {
+	testAppendChatMessages(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryAppendChatMessages(t *testing.T) {
+	testAppendChatMessages(t, newTestBoltRepository(t))
+}
+
+func testChatUsage(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		usage, err := repo.AddChatUsage(ctx, "session", "pano-1", 1, 100, time.Hour)
+		if err != nil || usage.Turns != i || usage.TokensUsed != i*100 {
+			t.Fatalf("第 %d 次计数返回 %+v, %v", i, usage, err)
+		}
+	}
+
+	// 撤销预留，不同的全景分别计数
+	if usage, err := repo.AddChatUsage(ctx, "session", "pano-1", -1, -100, time.Hour); err != nil || usage.Turns != 2 || usage.TokensUsed != 200 {
+		t.Errorf("撤销后计数应为 2 次 200 token，实际为 %+v, %v", usage, err)
+	}
+	if usage, _ := repo.AddChatUsage(ctx, "session", "pano-2", 0, 0, time.Hour); usage.Turns != 0 {
+		t.Errorf("不同的全景应分别计数，实际为 %+v", usage)
+	}
+
+	// 过期后重新计数
+	if _, err := repo.AddChatUsage(ctx, "session", "pano-3", 1, 10, time.Millisecond); err != nil {
+		t.Fatalf("计数失败: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if usage, _ := repo.AddChatUsage(ctx, "session", "pano-3", 1, 10, time.Hour); usage.Turns != 1 || usage.TokensUsed != 10 {
+		t.Errorf("过期后应重新计数，实际为 %+v", usage)
+	}
+}
+
+func TestMemoryRepositoryChatUsage(t *testing.T) {
+	testChatUsage(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryChatUsage(t *testing.T) {
+	testChatUsage(t, newTestBoltRepository(t))
+}
+
+func testUsageCounter(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	if count, err := repo.GetUsage(ctx, "geocode:day:2024-05-01"); err != nil || count != 0 {
+		t.Fatalf("没有计数时应返回 0，实际为 %d, %v", count, err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		count, err := repo.IncrementUsage(ctx, "geocode:day:2024-05-01", time.Hour)
+		if err != nil || count != i {
+			t.Fatalf("第 %d 次计数返回 %d, %v", i, count, err)
+		}
+	}
+	if count, err := repo.GetUsage(ctx, "geocode:day:2024-05-01"); err != nil || count != 3 {
+		t.Errorf("计数应为 3，实际为 %d, %v", count, err)
+	}
+	if count, _ := repo.GetUsage(ctx, "geocode:month:2024-05"); count != 0 {
+		t.Errorf("不同的键应分别计数，实际为 %d", count)
+	}
+
+	// 撤销计数，没有计数的键不受影响
+	if err := repo.DecrementUsage(ctx, "geocode:day:2024-05-01"); err != nil {
+		t.Fatalf("撤销计数失败: %v", err)
+	}
+	if count, _ := repo.GetUsage(ctx, "geocode:day:2024-05-01"); count != 2 {
+		t.Errorf("撤销后计数应为 2，实际为 %d", count)
+	}
+	if err := repo.DecrementUsage(ctx, "geocode:month:2024-05"); err != nil {
+		t.Fatalf("撤销计数失败: %v", err)
+	}
+	if count, _ := repo.GetUsage(ctx, "geocode:month:2024-05"); count != 0 {
+		t.Errorf("没有计数的键撤销后应为 0，实际为 %d", count)
+	}
+
+	// 过期后重新计数
+	if _, err := repo.IncrementUsage(ctx, "geocode:day:2024-04-30", time.Millisecond); err != nil {
+		t.Fatalf("计数失败: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if count, _ := repo.GetUsage(ctx, "geocode:day:2024-04-30"); count != 0 {
+		t.Errorf("过期的计数应返回 0，实际为 %d", count)
+	}
+	if count, _ := repo.IncrementUsage(ctx, "geocode:day:2024-04-30", time.Hour); count != 1 {
+		t.Errorf("过期后应重新计数，实际为 %d", count)
+	}
+}
+
+func TestMemoryRepositoryUsageCounter(t *testing.T) {
+	testUsageCounter(t, NewMemoryRepository())
+}
+
+func TestBoltRepositoryUsageCounter(t *testing.T) {
+	testUsageCounter(t, newTestBoltRepository(t))
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/getsentry/sentry-go"
 	sentrygin "github.com/getsentry/sentry-go/gin"
 	"github.com/gin-gonic/gin"
+	"github.com/my-streetview-project/backend/internal/utils"
 )
 
 // Middleware returns a Gin middleware for Sentry integration
@@ -110,7 +111,7 @@ func Middleware(repanic bool) gin.HandlerFunc {
 				Data: map[string]interface{}{
 					"status_code": c.Writer.Status(),
 					"method":      c.Request.Method,
-					"url":         c.Request.URL.String(),
+					"url":         utils.RedactSecrets(c.Request.URL.String()),
 				},
 			}, nil)
 		}
@@ -0,0 +1,89 @@
+package sentry
+
+import (
+	"net/url"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/my-streetview-project/backend/internal/utils"
+)
+
+// redactEvent 去掉事件中所有 URL 里的 key= 和 signature= 参数值
+// 错误信息、请求信息、面包屑和上下文都可能带有完整的请求 URL
+func redactEvent(event *sentry.Event) {
+	event.Message = utils.RedactSecrets(event.Message)
+	for i := range event.Exception {
+		event.Exception[i].Value = utils.RedactSecrets(event.Exception[i].Value)
+	}
+
+	if req := event.Request; req != nil {
+		req.URL = utils.RedactSecrets(req.URL)
+		req.QueryString = utils.RedactSecrets(req.QueryString)
+		for name, value := range req.Headers {
+			req.Headers[name] = utils.RedactSecrets(value)
+		}
+	}
+
+	for _, breadcrumb := range event.Breadcrumbs {
+		breadcrumb.Message = utils.RedactSecrets(breadcrumb.Message)
+		for key, value := range breadcrumb.Data {
+			breadcrumb.Data[key] = redactValue(value)
+		}
+	}
+	for name, ctx := range event.Contexts {
+		event.Contexts[name] = redactValue(ctx).(map[string]interface{})
+	}
+	for key, value := range event.Extra {
+		event.Extra[key] = redactValue(value)
+	}
+}
+
+// redactValue 递归处理上下文中的字符串、URL 参数和嵌套结构，其他类型原样返回
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return utils.RedactSecrets(v)
+	case url.Values:
+		return redactQuery(v)
+	case map[string][]string:
+		return map[string][]string(redactQuery(v))
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = redactValue(item)
+		}
+		return v
+	case gin.H: // gin 错误的 JSON 表示
+		return gin.H(redactValue(map[string]interface{}(v)).(map[string]interface{}))
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+		return v
+	case []string:
+		redacted := make([]string, len(v))
+		for i, item := range v {
+			redacted[i] = utils.RedactSecrets(item)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// redactQuery 返回去掉 key 和 signature 参数值的副本，不修改请求本身的参数
+func redactQuery(query url.Values) url.Values {
+	redacted := make(url.Values, len(query))
+	for name, values := range query {
+		switch name {
+		case "key", "signature":
+			redacted[name] = []string{"REDACTED"}
+		default:
+			items := make([]string, len(values))
+			for i, item := range values {
+				items[i] = utils.RedactSecrets(item)
+			}
+			redacted[name] = items
+		}
+	}
+	return redacted
+}
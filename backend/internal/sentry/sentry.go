@@ -70,6 +70,12 @@ func Init(cfg *Config) error {
 				"type":    "go-gin-api",
 			}
 
+			redactEvent(event)
+			return event
+		},
+		// 性能事件同样带有请求 URL
+		BeforeSendTransaction: func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			redactEvent(event)
 			return event
 		},
 	})
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -13,6 +14,12 @@ import (
 	"github.com/my-streetview-project/backend/internal/utils"
 )
 
+// 追问对话的限制错误
+var (
+	ErrChatTurnLimit   = models.NewError(models.ErrQuotaExhausted, "CHAT_TURN_LIMIT", "追问次数已达上限")
+	ErrChatTokenBudget = models.NewError(models.ErrQuotaExhausted, "CHAT_TOKEN_BUDGET", "对话 token 预算已用完")
+)
+
 type AIService struct {
 	repo   repositories.Repository
 	openAI openai.Client
@@ -20,56 +27,183 @@ type AIService struct {
 	config config.Config
 }
 
-func NewAIService(cfg config.Config, repo repositories.Repository) (*AIService, error) {
-	mapsService, err := NewMapsService(cfg.GoogleMapsAPIKey())
-	if err != nil {
-		return nil, fmt.Errorf("创建 MapsService 失败: %w", err)
-	}
+// NewAIService 创建 AIService，maps 为服务端共用的 MapsService（共享 Google API 预算和逆地理编码缓存），禁用 Google API 时传 nil
+func NewAIService(cfg config.Config, repo repositories.Repository, maps *MapsService) *AIService {
+	return NewAIServiceWithClient(cfg, repo, openai.NewClient(cfg), maps)
+}
 
+// NewAIServiceWithClient 使用指定的 LLM 客户端创建 AIService，测试中用于替换真实的 LLM 接口
+func NewAIServiceWithClient(cfg config.Config, repo repositories.Repository, client openai.Client, maps *MapsService) *AIService {
 	return &AIService{
 		repo:   repo,
-		openAI: openai.NewClient(cfg.OpenAIAPIKey()),
-		maps:   mapsService,
+		openAI: client,
+		maps:   maps,
 		config: cfg,
-	}, nil
+	}
 }
 
-func (ai *AIService) GetDescriptionForLocation(loc models.Location, language string) (string, error) {
-	startTime := time.Now()
-	logger := utils.AILogger()
+// GetDescriptionForLocation 获取位置的简短AI描述，优先返回新鲜的缓存
+// refresh 为 true 时忽略缓存强制重新生成；第二个返回值表示是否命中缓存
+func (ai *AIService) GetDescriptionForLocation(ctx context.Context, loc models.Location, language string, refresh bool) (models.LocationDescription, bool, error) {
+	return ai.describe(ctx, loc, language, refresh, nil, nil)
+}
 
-	// Get location info
-	var locationInfo map[string]string
-	var err error
+// StreamDescriptionForLocation 与 GetDescriptionForLocation 相同，但生成时每收到一段文本就调用 onDelta
+// 输出语言不符需要重新生成时调用 onReset，之前收到的片段作废；命中缓存时都不会调用，调用方应以返回的完整描述为准
+func (ai *AIService) StreamDescriptionForLocation(ctx context.Context, loc models.Location, language string, refresh bool, onDelta func(string) error, onReset func() error) (models.LocationDescription, bool, error) {
+	return ai.describe(ctx, loc, language, refresh, onDelta, onReset)
+}
 
-	if ai.config.EnableGoogleAPI() {
-		locationInfo, err = ai.maps.GetLocationInfo(context.Background(), loc.Latitude, loc.Longitude, language)
+func (ai *AIService) describe(ctx context.Context, loc models.Location, language string, refresh bool, onDelta func(string) error, onReset func() error) (models.LocationDescription, bool, error) {
+	if !refresh {
+		if cached := ai.getCachedDescription(ctx, loc.PanoID, language, models.DescriptionShort); cached != nil {
+			return *cached, true, nil
+		}
+	}
+
+	desc, history, err := ai.generateDescription(ctx, loc, language, onDelta, onReset)
+	if err != nil {
+		return models.LocationDescription{}, false, err
+	}
+
+	// 保存对话历史，详细描述会在这段对话的基础上继续
+	if len(history) > 0 {
+		historyJSON, err := json.Marshal(history)
 		if err != nil {
-			logger.Error("maps_failed", "Failed to get location info from Google Maps", err, map[string]interface{}{
-				"pano_id":   loc.PanoID,
-				"language":  language,
-				"latitude":  loc.Latitude,
-				"longitude": loc.Longitude,
+			utils.AILogger().Error("encode_history_failed", "Failed to encode conversation history", err, map[string]interface{}{
+				"pano_id": loc.PanoID,
 			})
-			return "", fmt.Errorf("获取位置信息失败: %v", err)
+		} else {
+			loc.ConversationHistory = string(historyJSON)
 		}
-	} else {
-		locationInfo = getDefaultLocationInfo(loc)
+	}
+
+	return ai.cacheDescription(ctx, loc, language, models.DescriptionShort, desc), false, nil
+}
+
+// GetDetailedDescriptionForLocation 获取位置的详细AI描述，优先返回新鲜的缓存
+func (ai *AIService) GetDetailedDescriptionForLocation(ctx context.Context, loc models.Location, language string, refresh bool) (models.LocationDescription, bool, error) {
+	return ai.describeDetailed(ctx, loc, language, refresh, nil, nil)
+}
+
+// StreamDetailedDescriptionForLocation 详细描述的流式版本，语义同 StreamDescriptionForLocation
+func (ai *AIService) StreamDetailedDescriptionForLocation(ctx context.Context, loc models.Location, language string, refresh bool, onDelta func(string) error, onReset func() error) (models.LocationDescription, bool, error) {
+	return ai.describeDetailed(ctx, loc, language, refresh, onDelta, onReset)
+}
+
+func (ai *AIService) describeDetailed(ctx context.Context, loc models.Location, language string, refresh bool, onDelta func(string) error, onReset func() error) (models.LocationDescription, bool, error) {
+	if !refresh {
+		if cached := ai.getCachedDescription(ctx, loc.PanoID, language, models.DescriptionDetailed); cached != nil {
+			return *cached, true, nil
+		}
+	}
+
+	desc, err := ai.generateDetailedDescription(ctx, loc, language, onDelta, onReset)
+	if err != nil {
+		return models.LocationDescription{}, false, err
+	}
+
+	return ai.cacheDescription(ctx, loc, language, models.DescriptionDetailed, desc), false, nil
+}
+
+// getCachedDescription 读取仍在新鲜度窗口内的描述缓存，未命中或读取失败时返回 nil
+func (ai *AIService) getCachedDescription(ctx context.Context, panoID, language, kind string) *models.LocationDescription {
+	// mock 描述不写入缓存，也不读取缓存
+	ttl := ai.config.DescriptionCacheTTL()
+	if !ai.config.EnableOpenAI() || ttl <= 0 {
+		return nil
+	}
+
+	cached, err := ai.repo.GetDescription(ctx, panoID, language, kind)
+	if err != nil {
+		utils.AILogger().Error("description_cache_read_failed", "Failed to read cached description", err, map[string]interface{}{
+			"pano_id":  panoID,
+			"language": language,
+			"kind":     kind,
+		})
+		return nil
+	}
+	if cached == nil || strings.TrimSpace(cached.Content) == "" || time.Since(cached.GeneratedAt) > ttl {
+		return nil
+	}
+
+	return cached
+}
+
+// cacheDescription 保存新生成的描述，简短描述同时回写到位置记录
+// 缓存写入失败只记录日志，不影响本次返回
+func (ai *AIService) cacheDescription(ctx context.Context, loc models.Location, language, kind, content string) models.LocationDescription {
+	desc := models.LocationDescription{
+		PanoID:      loc.PanoID,
+		Language:    language,
+		Kind:        kind,
+		Content:     content,
+		GeneratedAt: time.Now(),
+	}
+
+	if !ai.config.EnableOpenAI() {
+		return desc
+	}
+
+	logger := utils.AILogger()
+	if err := ai.repo.SaveDescription(ctx, desc); err != nil {
+		logger.Error("description_cache_write_failed", "Failed to cache description", err, map[string]interface{}{
+			"pano_id":  loc.PanoID,
+			"language": language,
+			"kind":     kind,
+		})
+	}
+
+	if kind == models.DescriptionShort {
+		// loc 是生成前读取的快照，只更新描述字段，避免覆盖生成期间其他请求写入的访问信息
+		if err := ai.repo.UpdateLocationDescription(ctx, desc, loc.ConversationHistory); err != nil {
+			logger.Error("save_location_description_failed", "Failed to save description to location", err, map[string]interface{}{
+				"pano_id": loc.PanoID,
+			})
+		}
+	}
+
+	return desc
+}
+
+// generateDescription 调用 AI 生成简短描述，onDelta 非空时使用流式生成
+func (ai *AIService) generateDescription(ctx context.Context, loc models.Location, language string, onDelta func(string) error, onReset func() error) (string, []openai.ChatMessage, error) {
+	startTime := time.Now()
+	logger := utils.AILogger()
+
+	// Get location info
+	locationInfo, err := ai.locationInfo(ctx, loc, language)
+	if err != nil {
+		logger.Error("maps_failed", "Failed to get location info from Google Maps", err, map[string]interface{}{
+			"pano_id":   loc.PanoID,
+			"language":  language,
+			"latitude":  loc.Latitude,
+			"longitude": loc.Longitude,
+		})
+		return "", nil, fmt.Errorf("获取位置信息失败: %w", err)
 	}
 
 	// Generate description using AI
 	var desc string
+	var history []openai.ChatMessage
 	if ai.config.EnableOpenAI() {
-		description, _, err := ai.openAI.GenerateLocationDescription(loc.Latitude, loc.Longitude, locationInfo, language)
+		var description string
+		var messages []openai.ChatMessage
+		if onDelta != nil {
+			description, messages, err = ai.openAI.StreamLocationDescription(ctx, loc.Latitude, loc.Longitude, locationInfo, language, onDelta, onReset)
+		} else {
+			description, messages, err = ai.openAI.GenerateLocationDescription(ctx, loc.Latitude, loc.Longitude, locationInfo, language)
+		}
 		if err != nil {
 			logger.Error("ai_generation_failed", "Failed to generate AI description", err, map[string]interface{}{
 				"pano_id":  loc.PanoID,
 				"language": language,
 				"duration": time.Since(startTime).String(),
 			})
-			return "", fmt.Errorf("AI 描述生成失败: %v", err)
+			return "", nil, fmt.Errorf("AI 描述生成失败: %w", err)
 		}
 		desc = description
+		history = messages
 	} else {
 		desc = getDefaultDescription(locationInfo)
 	}
@@ -81,45 +215,43 @@ func (ai *AIService) GetDescriptionForLocation(loc models.Location, language str
 			"language":    language,
 			"desc_length": len(desc),
 		})
-		return "", fmt.Errorf("生成的AI描述为空或无效")
+		return "", nil, fmt.Errorf("生成的AI描述为空或无效")
 	}
 
-	return desc, nil
+	return desc, history, nil
 }
 
-// GetDetailedDescriptionForLocation 获取位置的详细AI描述
-func (ai *AIService) GetDetailedDescriptionForLocation(loc models.Location, language string) (string, error) {
+// generateDetailedDescription 调用 AI 生成详细描述，onDelta 非空时使用流式生成
+func (ai *AIService) generateDetailedDescription(ctx context.Context, loc models.Location, language string, onDelta func(string) error, onReset func() error) (string, error) {
 	startTime := time.Now()
 	logger := utils.AILogger()
 
 	// Get location info
-	var locationInfo map[string]string
-	var err error
-
-	if ai.config.EnableGoogleAPI() {
-		locationInfo, err = ai.maps.GetLocationInfo(context.Background(), loc.Latitude, loc.Longitude, language)
-		if err != nil {
-			logger.Error("maps_failed", "Failed to get location info for detailed description", err, map[string]interface{}{
-				"pano_id":  loc.PanoID,
-				"language": language,
-			})
-			return "", fmt.Errorf("获取位置信息失败: %v", err)
-		}
-	} else {
-		locationInfo = getDefaultLocationInfo(loc)
+	locationInfo, err := ai.locationInfo(ctx, loc, language)
+	if err != nil {
+		logger.Error("maps_failed", "Failed to get location info for detailed description", err, map[string]interface{}{
+			"pano_id":  loc.PanoID,
+			"language": language,
+		})
+		return "", fmt.Errorf("获取位置信息失败: %w", err)
 	}
 
 	// Generate detailed description using AI
 	var desc string
 	if ai.config.EnableOpenAI() {
-		desc, err = ai.openAI.GenerateDetailedLocationDescription(loc.Latitude, loc.Longitude, locationInfo, language)
+		history := ai.conversationHistory(ctx, loc, language, locationInfo)
+		if onDelta != nil {
+			desc, err = ai.openAI.StreamDetailedLocationDescription(ctx, loc.Latitude, loc.Longitude, locationInfo, language, history, onDelta, onReset)
+		} else {
+			desc, err = ai.openAI.GenerateDetailedLocationDescription(ctx, loc.Latitude, loc.Longitude, locationInfo, language, history)
+		}
 		if err != nil {
 			logger.Error("detailed_ai_failed", "Failed to generate detailed AI description", err, map[string]interface{}{
 				"pano_id":  loc.PanoID,
 				"language": language,
 				"duration": time.Since(startTime).String(),
 			})
-			return "", fmt.Errorf("AI 详细描述生成失败: %v", err)
+			return "", fmt.Errorf("AI 详细描述生成失败: %w", err)
 		}
 	} else {
 		desc = getDefaultDetailedDescription(locationInfo)
@@ -138,16 +270,214 @@ func (ai *AIService) GetDetailedDescriptionForLocation(loc models.Location, lang
 	return desc, nil
 }
 
+// conversationHistory 取出简短描述的对话历史，供详细描述继续对话
+// 优先使用位置记录中保存的历史；历史缺失时用缓存的简短描述重建；都没有则返回 nil，由详细描述独立生成
+func (ai *AIService) conversationHistory(ctx context.Context, loc models.Location, language string, locationInfo *models.GeocodeResult) []openai.ChatMessage {
+	if loc.ConversationHistory != "" && loc.DescriptionLanguage == language {
+		var history []openai.ChatMessage
+		err := json.Unmarshal([]byte(loc.ConversationHistory), &history)
+		if err == nil && len(history) > 0 {
+			return history
+		}
+		utils.AILogger().Error("decode_history_failed", "Stored conversation history is invalid, rebuilding", err, map[string]interface{}{
+			"pano_id": loc.PanoID,
+		})
+	}
+
+	if cached := ai.getCachedDescription(ctx, loc.PanoID, language, models.DescriptionShort); cached != nil {
+		return openai.DescriptionConversation(loc.Latitude, loc.Longitude, locationInfo, language, cached.Content)
+	}
+
+	return nil
+}
+
+// ChatAboutLocation 在会话针对该全景图的追问对话中追加一个问题并返回回复
+// 对话首次开启时以位置的描述对话为起点，没有描述时以旅行者人设和地理信息为起点
+// 请求 LLM 之前原子地预留一次提问和预估的 token，超过追问次数或 token 预算时返回 ErrChatTurnLimit / ErrChatTokenBudget
+func (ai *AIService) ChatAboutLocation(ctx context.Context, sessionID string, loc models.Location, language, question string) (string, models.ChatThread, error) {
+	logger := utils.AILogger()
+
+	thread, err := ai.repo.GetChatThread(ctx, sessionID, loc.PanoID)
+	if err != nil {
+		return "", models.ChatThread{}, fmt.Errorf("获取对话失败: %w", err)
+	}
+	if thread == nil {
+		seed, err := ai.chatSeed(ctx, loc, language)
+		if err != nil {
+			return "", models.ChatThread{}, err
+		}
+		thread = &models.ChatThread{
+			SessionID: sessionID,
+			PanoID:    loc.PanoID,
+			Language:  language,
+			Messages:  seed,
+			CreatedAt: time.Now(),
+		}
+	}
+
+	messages := make([]openai.ChatMessage, 0, len(thread.Messages)+2)
+	messages = append(messages, thread.Messages...)
+	messages = append(messages, openai.ChatMessage{Role: "user", Content: question})
+
+	// 每次请求都会携带完整对话，按本次请求的预估用量预留
+	estimate := openai.EstimateTokens(messages)
+	usage, err := ai.reserveChatTurn(ctx, sessionID, loc.PanoID, estimate)
+	if err != nil {
+		thread.Turns, thread.TokensUsed = usage.Turns, usage.TokensUsed
+		return "", *thread, err
+	}
+
+	var reply string
+	var tokens int
+	if ai.config.EnableOpenAI() {
+		startTime := time.Now()
+		reply, tokens, err = ai.openAI.Chat(ctx, messages)
+		if err != nil {
+			ai.releaseChatTurn(sessionID, loc.PanoID, estimate)
+			logger.Error("chat_failed", "Failed to generate chat reply", err, map[string]interface{}{
+				"pano_id":  loc.PanoID,
+				"turn":     usage.Turns,
+				"duration": time.Since(startTime).String(),
+			})
+			return "", *thread, fmt.Errorf("AI 对话回复生成失败: %w", err)
+		}
+	} else {
+		reply = fmt.Sprintf("[MOCK DATA] This is a reply to your question about the location at (%.6f, %.6f).", loc.Latitude, loc.Longitude)
+		tokens = estimate
+	}
+
+	if strings.TrimSpace(reply) == "" {
+		ai.releaseChatTurn(sessionID, loc.PanoID, estimate)
+		return "", *thread, fmt.Errorf("生成的对话回复为空")
+	}
+
+	// 预留的是预估用量，按实际用量修正计数
+	if tokens != estimate {
+		adjusted, err := ai.repo.AddChatUsage(ctx, sessionID, loc.PanoID, 0, tokens-estimate, ai.config.ChatThreadTTL())
+		if err != nil {
+			logger.Error("chat_usage_adjust_failed", "Failed to adjust chat token usage", err, map[string]interface{}{
+				"pano_id": loc.PanoID,
+			})
+			adjusted = models.ChatUsage{Turns: usage.Turns, TokensUsed: usage.TokensUsed + tokens - estimate}
+		}
+		usage = adjusted
+	}
+
+	// 对话中的计数只用于展示，以原子计数为准，并发的追问不会把计数写回较小的值
+	thread.Turns = usage.Turns
+	thread.TokensUsed = usage.TokensUsed
+	thread.UpdatedAt = time.Now()
+	// 每次提问后重新计算过期时间，会话结束后对话由存储删除
+	if ttl := ai.config.ChatThreadTTL(); ttl > 0 {
+		thread.ExpiresAt = thread.UpdatedAt.Add(ttl)
+	}
+
+	// 问答在存储中原子地追加到对话末尾，同时进行的追问都会保留
+	// 对话保存失败只记录日志，本次回复仍然返回
+	answer := openai.ChatMessage{Role: "assistant", Content: reply}
+	saved, err := ai.repo.AppendChatMessages(ctx, *thread, messages[len(messages)-1], answer)
+	if err != nil {
+		logger.Error("save_chat_thread_failed", "Failed to save chat thread", err, map[string]interface{}{
+			"pano_id": loc.PanoID,
+			"turns":   thread.Turns,
+		})
+		thread.Messages = append(messages, answer)
+		return reply, *thread, nil
+	}
+
+	return reply, saved, nil
+}
+
+// reserveChatTurn 原子地为一次追问预留提问次数和 tokens 个 token，返回预留后的计数
+// 超过追问次数或 token 预算时撤销预留，返回预留前的计数和 ErrChatTurnLimit / ErrChatTokenBudget
+func (ai *AIService) reserveChatTurn(ctx context.Context, sessionID, panoID string, tokens int) (models.ChatUsage, error) {
+	usage, err := ai.repo.AddChatUsage(ctx, sessionID, panoID, 1, tokens, ai.config.ChatThreadTTL())
+	if err != nil {
+		return models.ChatUsage{}, fmt.Errorf("预留追问次数失败: %w", err)
+	}
+
+	var limitErr error
+	if maxTurns := ai.config.ChatMaxTurns(); maxTurns > 0 && usage.Turns > maxTurns {
+		limitErr = ErrChatTurnLimit
+	} else if budget := ai.config.ChatTokenBudget(); budget > 0 && usage.TokensUsed > budget {
+		limitErr = ErrChatTokenBudget
+	}
+	if limitErr == nil {
+		return usage, nil
+	}
+
+	ai.releaseChatTurn(sessionID, panoID, tokens)
+	return models.ChatUsage{Turns: usage.Turns - 1, TokensUsed: usage.TokensUsed - tokens}, limitErr
+}
+
+// releaseChatTurn 撤销没有用上的一次提问和 tokens 个 token 的预留，失败时只记录日志，计数最多多算一次
+// 请求已取消时也要撤销，因此不使用请求的 context
+func (ai *AIService) releaseChatTurn(sessionID, panoID string, tokens int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := ai.repo.AddChatUsage(ctx, sessionID, panoID, -1, -tokens, ai.config.ChatThreadTTL()); err != nil {
+		utils.AILogger().Error("chat_usage_release_failed", "Failed to release reserved chat turn", err, map[string]interface{}{
+			"pano_id": panoID,
+		})
+	}
+}
+
+// ChatMaxTurns 每个会话针对同一全景图最多可追问的次数，<= 0 表示不限制
+func (ai *AIService) ChatMaxTurns() int {
+	return ai.config.ChatMaxTurns()
+}
+
+// ChatTokenBudget 每个追问对话的 token 预算，<= 0 表示不限制
+func (ai *AIService) ChatTokenBudget() int {
+	return ai.config.ChatTokenBudget()
+}
+
+// chatSeed 构建追问对话的起始消息
+func (ai *AIService) chatSeed(ctx context.Context, loc models.Location, language string) ([]openai.ChatMessage, error) {
+	locationInfo, err := ai.locationInfo(ctx, loc, language)
+	if err != nil {
+		utils.AILogger().Error("maps_failed", "Failed to get location info for chat", err, map[string]interface{}{
+			"pano_id":  loc.PanoID,
+			"language": language,
+		})
+		return nil, fmt.Errorf("获取位置信息失败: %w", err)
+	}
+
+	if history := ai.conversationHistory(ctx, loc, language, locationInfo); history != nil {
+		return history, nil
+	}
+	return openai.ChatConversation(loc.Latitude, loc.Longitude, locationInfo, language), nil
+}
+
+// locationInfo 获取生成描述用的位置信息，位置记录中保存了相同语言的逆地理编码结果时直接使用
+// 启用 Google API 且传入了 MapsService 时使用 Google Geocoding（失败时回退到离线地理编码），否则只使用离线地理编码，离线数据也不可用时使用模拟数据
+func (ai *AIService) locationInfo(ctx context.Context, loc models.Location, language string) (*models.GeocodeResult, error) {
+	if loc.Geocode != nil && loc.Geocode.Language == language && len(loc.Geocode.Results) > 0 {
+		return loc.Geocode, nil
+	}
+	if ai.config.EnableGoogleAPI() && ai.maps != nil {
+		return ai.maps.ResolveLocationInfo(ctx, loc.Latitude, loc.Longitude, language)
+	}
+	if info, ok := utils.ReverseGeocodeOffline(loc.Latitude, loc.Longitude, language); ok {
+		return info, nil
+	}
+	return getDefaultLocationInfo(loc, language), nil
+}
+
 // 生成默认的位置信息
-func getDefaultLocationInfo(loc models.Location) map[string]string {
-	return map[string]string{
-		"formatted_address": fmt.Sprintf("[MOCK DATA] Location at coordinates (%.6f, %.6f)", loc.Latitude, loc.Longitude),
+func getDefaultLocationInfo(loc models.Location, language string) *models.GeocodeResult {
+	return &models.GeocodeResult{
+		Source:   models.GeocodeSourceMock,
+		Language: language,
+		Results: []models.GeocodePlace{{
+			FormattedAddress: fmt.Sprintf("[MOCK DATA] Location at coordinates (%.6f, %.6f)", loc.Latitude, loc.Longitude),
+		}},
 	}
 }
 
 // 生成默认的描述
-func getDefaultDescription(locationInfo map[string]string) string {
-	address := locationInfo["formatted_address"]
+func getDefaultDescription(locationInfo *models.GeocodeResult) string {
+	address := locationInfo.FormattedAddress()
 	if address == "" || strings.TrimSpace(address) == "" {
 		address = "an unknown location"
 	}
@@ -155,8 +485,8 @@ func getDefaultDescription(locationInfo map[string]string) string {
 }
 
 // 生成默认的详细描述
-func getDefaultDetailedDescription(locationInfo map[string]string) string {
-	address := locationInfo["formatted_address"]
+func getDefaultDetailedDescription(locationInfo *models.GeocodeResult) string {
+	address := locationInfo.FormattedAddress()
 	if address == "" || strings.TrimSpace(address) == "" {
 		address = "an unknown location"
 	}
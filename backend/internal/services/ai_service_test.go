@@ -0,0 +1,418 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/config"
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/openai"
+	"github.com/my-streetview-project/backend/internal/repositories"
+)
+
+// testAIConfig 只实现 AIService 用到的配置项，其余方法调用时会 panic
+type testAIConfig struct {
+	config.Config
+	descriptionTTL  time.Duration
+	chatMaxTurns    int
+	chatTokenBudget int
+	chatThreadTTL   time.Duration
+}
+
+func (c testAIConfig) EnableOpenAI() bool                 { return true }
+func (c testAIConfig) EnableGoogleAPI() bool              { return false }
+func (c testAIConfig) DescriptionCacheTTL() time.Duration { return c.descriptionTTL }
+func (c testAIConfig) ChatMaxTurns() int                  { return c.chatMaxTurns }
+func (c testAIConfig) ChatTokenBudget() int               { return c.chatTokenBudget }
+func (c testAIConfig) ChatThreadTTL() time.Duration       { return c.chatThreadTTL }
+
+// fakeLLM 按调用次数生成不同的回复并记录调用，流式版本把回复分两段传给 onDelta
+type fakeLLM struct {
+	mu     sync.Mutex
+	calls  int
+	tokens int   // 每次对话回复消耗的 token 数
+	err    error // 非空时所有调用都返回该错误
+}
+
+func (f *fakeLLM) reply(kind string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return "", f.err
+	}
+	return fmt.Sprintf("%s reply %d", kind, f.calls), nil
+}
+
+func (f *fakeLLM) stream(kind string, onDelta func(string) error) (string, error) {
+	reply, err := f.reply(kind)
+	if err != nil {
+		return "", err
+	}
+	half := len(reply) / 2
+	for _, delta := range []string{reply[:half], reply[half:]} {
+		if err := onDelta(delta); err != nil {
+			return "", err
+		}
+	}
+	return reply, nil
+}
+
+func (f *fakeLLM) GenerateLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string) (string, []openai.ChatMessage, error) {
+	reply, err := f.reply("short")
+	if err != nil {
+		return "", nil, err
+	}
+	return reply, openai.DescriptionConversation(latitude, longitude, geocode, language, reply), nil
+}
+
+func (f *fakeLLM) GenerateDetailedLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string, history []openai.ChatMessage) (string, error) {
+	return f.reply("detailed")
+}
+
+func (f *fakeLLM) GenerateRegionsForInterest(ctx context.Context, interest, language string) ([]models.Region, error) {
+	return nil, fmt.Errorf("fakeLLM 不支持生成区域")
+}
+
+func (f *fakeLLM) Chat(ctx context.Context, messages []openai.ChatMessage) (string, int, error) {
+	reply, err := f.reply("chat")
+	return reply, f.tokens, err
+}
+
+func (f *fakeLLM) StreamLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string, onDelta func(string) error, onReset func() error) (string, []openai.ChatMessage, error) {
+	reply, err := f.stream("short", onDelta)
+	if err != nil {
+		return "", nil, err
+	}
+	return reply, openai.DescriptionConversation(latitude, longitude, geocode, language, reply), nil
+}
+
+func (f *fakeLLM) StreamDetailedLocationDescription(ctx context.Context, latitude, longitude float64, geocode *models.GeocodeResult, language string, history []openai.ChatMessage, onDelta func(string) error, onReset func() error) (string, error) {
+	return f.stream("detailed", onDelta)
+}
+
+// newTestAIService 创建使用内存仓库和 fakeLLM 的 AIService
+func newTestAIService(t *testing.T, cfg testAIConfig, llm *fakeLLM) (*AIService, repositories.Repository) {
+	t.Helper()
+	repo := repositories.NewMemoryRepository()
+	return NewAIServiceWithClient(cfg, repo, llm, nil), repo
+}
+
+// testDescribedLocation 带有逆地理编码结果的位置，生成描述时不需要查询地址
+func testDescribedLocation(panoID string) models.Location {
+	return models.Location{
+		PanoID:    panoID,
+		Latitude:  35.6595,
+		Longitude: 139.7006,
+		Geocode: &models.GeocodeResult{
+			Source:   models.GeocodeSourceGoogle,
+			Language: "en",
+			Results:  []models.GeocodePlace{{FormattedAddress: "Shibuya, Tokyo, Japan"}},
+		},
+	}
+}
+
+func TestDescriptionCache(t *testing.T) {
+	llm := &fakeLLM{}
+	ai, _ := newTestAIService(t, testAIConfig{descriptionTTL: time.Hour}, llm)
+	ctx := context.Background()
+	loc := testDescribedLocation("pano_cache")
+
+	first, cached, err := ai.GetDescriptionForLocation(ctx, loc, "en", false)
+	if err != nil {
+		t.Fatalf("生成描述失败: %v", err)
+	}
+	if cached || first.Content != "short reply 1" || first.GeneratedAt.IsZero() {
+		t.Errorf("首次请求应该生成新描述: %+v, cached=%v", first, cached)
+	}
+
+	// 第二次命中缓存，返回首次生成的时间
+	second, cached, err := ai.GetDescriptionForLocation(ctx, loc, "en", false)
+	if err != nil || !cached {
+		t.Fatalf("第二次请求应该命中缓存: cached=%v, err=%v", cached, err)
+	}
+	if second.Content != first.Content || !second.GeneratedAt.Equal(first.GeneratedAt) {
+		t.Errorf("缓存的描述为 %+v，期望 %+v", second, first)
+	}
+	if llm.calls != 1 {
+		t.Errorf("命中缓存时不应调用 LLM，实际调用 %d 次", llm.calls)
+	}
+
+	// 不同语言和详细描述分别缓存
+	if _, cached, _ := ai.GetDescriptionForLocation(ctx, loc, "zh", false); cached {
+		t.Error("不同语言不应命中缓存")
+	}
+	if _, cached, _ := ai.GetDetailedDescriptionForLocation(ctx, loc, "en", false); cached {
+		t.Error("详细描述不应命中简短描述的缓存")
+	}
+}
+
+func TestDescriptionKeepsConcurrentUpdates(t *testing.T) {
+	ai, repo := newTestAIService(t, testAIConfig{descriptionTTL: time.Hour}, &fakeLLM{})
+	ctx := context.Background()
+	if err := repo.SaveLocation(ctx, testDescribedLocation("pano_snapshot")); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+
+	// 生成描述期间其他请求访问了该位置，回写描述时不应覆盖访问次数
+	snapshot, err := repo.GetLocationByPanoID(ctx, "pano_snapshot")
+	if err != nil {
+		t.Fatalf("获取位置失败: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		repo.GetLocationByPanoID(ctx, "pano_snapshot")
+	}
+	desc, _, err := ai.GetDescriptionForLocation(ctx, snapshot, "en", false)
+	if err != nil {
+		t.Fatalf("生成描述失败: %v", err)
+	}
+
+	stored, err := repo.GetLocationByPanoID(ctx, "pano_snapshot")
+	if err != nil {
+		t.Fatalf("获取位置失败: %v", err)
+	}
+	if stored.AccessCount != 4 {
+		t.Errorf("访问次数应为 4，实际为 %d", stored.AccessCount)
+	}
+	if stored.AIDescription != desc.Content || stored.DescriptionLanguage != "en" || stored.ConversationHistory == "" {
+		t.Errorf("位置记录应该写入描述和对话历史: %+v", stored)
+	}
+}
+
+func TestDescriptionCacheRefresh(t *testing.T) {
+	llm := &fakeLLM{}
+	ai, _ := newTestAIService(t, testAIConfig{descriptionTTL: time.Hour}, llm)
+	ctx := context.Background()
+	loc := testDescribedLocation("pano_refresh")
+
+	first, _, err := ai.GetDescriptionForLocation(ctx, loc, "en", false)
+	if err != nil {
+		t.Fatalf("生成描述失败: %v", err)
+	}
+
+	refreshed, cached, err := ai.GetDescriptionForLocation(ctx, loc, "en", true)
+	if err != nil {
+		t.Fatalf("刷新描述失败: %v", err)
+	}
+	if cached || refreshed.Content != "short reply 2" || refreshed.GeneratedAt.Before(first.GeneratedAt) {
+		t.Errorf("refresh=true 应该重新生成描述: %+v, cached=%v", refreshed, cached)
+	}
+
+	// 刷新后的描述替换旧缓存
+	latest, cached, _ := ai.GetDescriptionForLocation(ctx, loc, "en", false)
+	if !cached || latest.Content != refreshed.Content || !latest.GeneratedAt.Equal(refreshed.GeneratedAt) {
+		t.Errorf("缓存应为刷新后的描述: %+v, cached=%v", latest, cached)
+	}
+}
+
+func TestDescriptionCacheExpiry(t *testing.T) {
+	llm := &fakeLLM{}
+	ai, repo := newTestAIService(t, testAIConfig{descriptionTTL: time.Hour}, llm)
+	ctx := context.Background()
+	loc := testDescribedLocation("pano_expired")
+
+	stale := models.LocationDescription{
+		PanoID:      loc.PanoID,
+		Language:    "en",
+		Kind:        models.DescriptionShort,
+		Content:     "stale description",
+		GeneratedAt: time.Now().Add(-2 * time.Hour),
+	}
+	if err := repo.SaveDescription(ctx, stale); err != nil {
+		t.Fatalf("保存描述失败: %v", err)
+	}
+
+	desc, cached, err := ai.GetDescriptionForLocation(ctx, loc, "en", false)
+	if err != nil {
+		t.Fatalf("生成描述失败: %v", err)
+	}
+	if cached || desc.Content != "short reply 1" || !desc.GeneratedAt.After(stale.GeneratedAt) {
+		t.Errorf("过期的缓存应该重新生成: %+v, cached=%v", desc, cached)
+	}
+
+	// TTL 为 0 时不使用缓存
+	uncached, _ := newTestAIService(t, testAIConfig{}, llm)
+	for i := 0; i < 2; i++ {
+		if _, cached, _ := uncached.GetDescriptionForLocation(ctx, loc, "en", false); cached {
+			t.Error("TTL 为 0 时不应命中缓存")
+		}
+	}
+}
+
+func TestChatAboutLocationTurnLimit(t *testing.T) {
+	llm := &fakeLLM{}
+	ai, _ := newTestAIService(t, testAIConfig{chatMaxTurns: 2}, llm)
+	ctx := context.Background()
+	loc := testDescribedLocation("pano_turns")
+
+	for i := 1; i <= 2; i++ {
+		if _, thread, err := ai.ChatAboutLocation(ctx, "session", loc, "en", "What is this?"); err != nil || thread.Turns != i {
+			t.Fatalf("第 %d 次追问失败: turns=%d, err=%v", i, thread.Turns, err)
+		}
+	}
+
+	_, thread, err := ai.ChatAboutLocation(ctx, "session", loc, "en", "One more?")
+	if !errors.Is(err, ErrChatTurnLimit) || !errors.Is(err, models.ErrQuotaExhausted) {
+		t.Fatalf("超过追问次数时错误应为 ErrChatTurnLimit，实际为 %v", err)
+	}
+	if code, _ := models.Detail(err); code != "CHAT_TURN_LIMIT" {
+		t.Errorf("错误码为 %q，期望 CHAT_TURN_LIMIT", code)
+	}
+	if thread.Turns != 2 || llm.calls != 2 {
+		t.Errorf("超过限制时不应调用 LLM: turns=%d, calls=%d", thread.Turns, llm.calls)
+	}
+
+	// 其他会话不受影响
+	if _, _, err := ai.ChatAboutLocation(ctx, "other", loc, "en", "What is this?"); err != nil {
+		t.Errorf("其他会话应该可以追问: %v", err)
+	}
+}
+
+func TestChatAboutLocationConcurrentTurns(t *testing.T) {
+	llm := &fakeLLM{}
+	ai, repo := newTestAIService(t, testAIConfig{chatMaxTurns: 3}, llm)
+	ctx := context.Background()
+	loc := testDescribedLocation("pano_concurrent")
+
+	// 并发的追问读到的是同一份对话，预留是原子的，只有 3 个请求能调用 LLM
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded, limited := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := ai.ChatAboutLocation(ctx, "session", loc, "en", "What is this?")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, ErrChatTurnLimit):
+				limited++
+			default:
+				t.Errorf("追问失败: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 3 || limited != 7 || llm.calls != 3 {
+		t.Errorf("应该有 3 次追问成功、7 次被拦截，实际成功 %d 次、拦截 %d 次、调用 LLM %d 次", succeeded, limited, llm.calls)
+	}
+	if usage, _ := repo.AddChatUsage(ctx, "session", loc.PanoID, 0, 0, 0); usage.Turns != 3 {
+		t.Errorf("追问计数应为 3，实际为 %d", usage.Turns)
+	}
+
+	// 成功的 3 次问答都保存在对话中，不会被并发的保存覆盖
+	thread, err := repo.GetChatThread(ctx, "session", loc.PanoID)
+	if err != nil || thread == nil {
+		t.Fatalf("应取到保存的对话: %v", err)
+	}
+	questions := 0
+	for _, msg := range thread.Messages {
+		if msg.Role == "user" && msg.Content == "What is this?" {
+			questions++
+		}
+	}
+	if questions != 3 || thread.Turns != 3 {
+		t.Errorf("对话中应有 3 个问题，实际为 %d 个，计数为 %d", questions, thread.Turns)
+	}
+}
+
+func TestChatAboutLocationReleasesFailedTurn(t *testing.T) {
+	llm := &fakeLLM{err: errors.New("llm unavailable")}
+	ai, _ := newTestAIService(t, testAIConfig{chatMaxTurns: 1}, llm)
+	ctx := context.Background()
+	loc := testDescribedLocation("pano_release")
+
+	if _, _, err := ai.ChatAboutLocation(ctx, "session", loc, "en", "What is this?"); err == nil {
+		t.Fatal("LLM 失败时应该返回错误")
+	}
+
+	// 失败的追问撤销预留，不占用次数
+	llm.err = nil
+	if _, thread, err := ai.ChatAboutLocation(ctx, "session", loc, "en", "What is this?"); err != nil || thread.Turns != 1 {
+		t.Errorf("失败的追问不应占用次数: turns=%d, err=%v", thread.Turns, err)
+	}
+}
+
+func TestChatAboutLocationTokenBudget(t *testing.T) {
+	// 第一轮回复用完全部预算，第二轮在请求 LLM 之前被拦截
+	llm := &fakeLLM{tokens: 5000}
+	ai, _ := newTestAIService(t, testAIConfig{chatTokenBudget: 5000}, llm)
+	ctx := context.Background()
+	loc := testDescribedLocation("pano_budget")
+
+	_, thread, err := ai.ChatAboutLocation(ctx, "session", loc, "en", "What is this?")
+	if err != nil || thread.TokensUsed != 5000 {
+		t.Fatalf("首次追问失败: tokens=%d, err=%v", thread.TokensUsed, err)
+	}
+
+	_, _, err = ai.ChatAboutLocation(ctx, "session", loc, "en", "And that?")
+	if !errors.Is(err, ErrChatTokenBudget) || !errors.Is(err, models.ErrQuotaExhausted) {
+		t.Fatalf("超过 token 预算时错误应为 ErrChatTokenBudget，实际为 %v", err)
+	}
+	if code, _ := models.Detail(err); code != "CHAT_TOKEN_BUDGET" {
+		t.Errorf("错误码为 %q，期望 CHAT_TOKEN_BUDGET", code)
+	}
+	if llm.calls != 1 {
+		t.Errorf("超过预算时不应调用 LLM，实际调用 %d 次", llm.calls)
+	}
+}
+
+func TestChatAboutLocationPersistence(t *testing.T) {
+	llm := &fakeLLM{tokens: 10}
+	ai, repo := newTestAIService(t, testAIConfig{descriptionTTL: time.Hour, chatThreadTTL: time.Hour}, llm)
+	ctx := context.Background()
+	loc := testDescribedLocation("pano_chat")
+	other := testDescribedLocation("pano_chat_other")
+
+	// 有描述时对话以描述对话为起点
+	if _, _, err := ai.GetDescriptionForLocation(ctx, loc, "en", false); err != nil {
+		t.Fatalf("生成描述失败: %v", err)
+	}
+	reply, _, err := ai.ChatAboutLocation(ctx, "session", loc, "en", "What is this?")
+	if err != nil {
+		t.Fatalf("追问失败: %v", err)
+	}
+	if _, _, err := ai.ChatAboutLocation(ctx, "session", other, "en", "And here?"); err != nil {
+		t.Fatalf("追问失败: %v", err)
+	}
+
+	thread, err := repo.GetChatThread(ctx, "session", loc.PanoID)
+	if err != nil || thread == nil {
+		t.Fatalf("对话应该按会话和全景保存: %v, %v", thread, err)
+	}
+	messages := thread.Messages
+	if thread.Turns != 1 || thread.TokensUsed != 10 || len(messages) < 4 {
+		t.Fatalf("保存的对话不正确: %+v", thread)
+	}
+	if !thread.ExpiresAt.After(time.Now()) || thread.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("对话应该在 CHAT_THREAD_TTL_HOURS 后过期: %v", thread.ExpiresAt)
+	}
+	if messages[len(messages)-3].Content != "short reply 1" || messages[len(messages)-2].Content != "What is this?" ||
+		messages[len(messages)-1].Role != "assistant" || messages[len(messages)-1].Content != reply {
+		t.Errorf("对话应该接在描述之后并以本次回复结束: %+v", messages)
+	}
+
+	// 第二轮在已保存的对话上继续
+	if _, _, err := ai.ChatAboutLocation(ctx, "session", loc, "en", "Tell me more"); err != nil {
+		t.Fatalf("追问失败: %v", err)
+	}
+	if thread, _ := repo.GetChatThread(ctx, "session", loc.PanoID); thread == nil || thread.Turns != 2 || len(thread.Messages) != len(messages)+2 {
+		t.Errorf("第二轮应该追加到已保存的对话: %+v", thread)
+	}
+
+	// 另一个全景和另一个会话各自独立
+	if thread, _ := repo.GetChatThread(ctx, "session", other.PanoID); thread == nil || thread.Turns != 1 {
+		t.Errorf("另一个全景的对话应该独立保存: %+v", thread)
+	}
+	if thread, _ := repo.GetChatThread(ctx, "other", loc.PanoID); thread != nil {
+		t.Errorf("其他会话不应有对话: %+v", thread)
+	}
+}
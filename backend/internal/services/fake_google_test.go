@@ -0,0 +1,310 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/utils"
+)
+
+const fakeGoogleAPIKey = "test-key"
+
+// fakeResponse 模拟服务器的一次响应
+type fakeResponse struct {
+	status     string        // Google 返回的 status，例如 OK、ZERO_RESULTS、OVER_QUERY_LIMIT
+	httpStatus int           // 非 0 时返回该 HTTP 状态码而不是 200
+	body       string        // 非空时原样返回，用于模拟格式错误的 JSON
+	delay      time.Duration // 响应前等待的时间，用于模拟超时
+}
+
+// fakeGoogle 基于 httptest 的 Google Street View 元数据、Static API 图片和 Geocoding 模拟服务器
+// 响应按请求顺序依次返回，用完后重复最后一个；街景元数据也可以按半径指定响应
+type fakeGoogle struct {
+	*httptest.Server
+
+	mu               sync.Mutex
+	metadata         []fakeResponse
+	metadataByRadius map[string]fakeResponse
+	geocode          []fakeResponse
+	images           []fakeResponse
+	metadataRequests []url.Values
+	geocodeRequests  []url.Values
+	imageRequests    []url.Values
+
+	// signingSecret 非空时街景元数据请求必须带有按该密钥计算的 signature 参数，创建服务器后、发出请求前设置
+	signingSecret string
+}
+
+func newFakeGoogle(t *testing.T) *fakeGoogle {
+	f := &fakeGoogle{
+		metadata: []fakeResponse{{status: "OK"}},
+		geocode:  []fakeResponse{{status: "OK"}},
+		images:   []fakeResponse{{status: "OK"}},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/maps/api/streetview/metadata", f.handleMetadata)
+	mux.HandleFunc("/maps/api/geocode/json", f.handleGeocode)
+	mux.HandleFunc("/maps/api/streetview", f.handleImage)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// setMetadata 设置街景元数据接口依次返回的响应
+func (f *fakeGoogle) setMetadata(responses ...fakeResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metadata = responses
+}
+
+// setMetadataByRadius 按 radius 参数设置街景元数据接口的响应，不限半径的请求对应空字符串
+// 并发探测时请求顺序不确定，需要用这种方式指定响应
+func (f *fakeGoogle) setMetadataByRadius(responses map[string]fakeResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metadataByRadius = responses
+}
+
+// setGeocode 设置 Geocoding 接口依次返回的响应
+func (f *fakeGoogle) setGeocode(responses ...fakeResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.geocode = responses
+}
+
+// setImage 设置街景图片接口依次返回的响应，status 为 ZERO_RESULTS 时返回 404
+func (f *fakeGoogle) setImage(responses ...fakeResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images = responses
+}
+
+func (f *fakeGoogle) imageCalls() []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values(nil), f.imageRequests...)
+}
+
+func (f *fakeGoogle) metadataCalls() []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values(nil), f.metadataRequests...)
+}
+
+func (f *fakeGoogle) geocodeCalls() []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values(nil), f.geocodeRequests...)
+}
+
+// next 记录请求并返回本次应使用的响应
+func (f *fakeGoogle) next(requests *[]url.Values, responses []fakeResponse, query url.Values) fakeResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	*requests = append(*requests, query)
+	index := len(*requests) - 1
+	if index >= len(responses) {
+		index = len(responses) - 1
+	}
+	return responses[index]
+}
+
+// write 等待 delay 后写出响应，返回 false 表示已经写出了原样响应或错误状态码
+func (resp fakeResponse) write(w http.ResponseWriter, r *http.Request) bool {
+	if resp.delay > 0 {
+		select {
+		case <-time.After(resp.delay):
+		case <-r.Context().Done():
+			return false
+		}
+	}
+	if resp.httpStatus != 0 {
+		http.Error(w, http.StatusText(resp.httpStatus), resp.httpStatus)
+		return false
+	}
+	if resp.body != "" {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, resp.body)
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return true
+}
+
+func (f *fakeGoogle) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	f.mu.Lock()
+	responses := f.metadata
+	byRadius, found := f.metadataByRadius[query.Get("radius")]
+	f.mu.Unlock()
+	resp := f.next(&f.metadataRequests, responses, query)
+	if found {
+		resp = byRadius
+	}
+	if !resp.write(w, r) {
+		return
+	}
+	if query.Get("key") != fakeGoogleAPIKey || (f.signingSecret != "" && !validFakeSignature(r, f.signingSecret)) {
+		json.NewEncoder(w).Encode(map[string]string{"status": "REQUEST_DENIED"})
+		return
+	}
+
+	body := map[string]interface{}{"status": resp.status}
+	if resp.status == "OK" {
+		lat, lng := parseFakeLocation(query.Get("location"))
+		body["pano_id"] = fakePanoID(query.Get("radius"))
+		body["location"] = map[string]float64{"lat": lat, "lng": lng}
+		body["date"] = "2023-05"
+		body["copyright"] = "© Google"
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeGoogle) handleGeocode(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	f.mu.Lock()
+	responses := f.geocode
+	f.mu.Unlock()
+	resp := f.next(&f.geocodeRequests, responses, query)
+	if !resp.write(w, r) {
+		return
+	}
+	if query.Get("key") != fakeGoogleAPIKey {
+		json.NewEncoder(w).Encode(map[string]string{"status": "REQUEST_DENIED", "error_message": "invalid key"})
+		return
+	}
+
+	body := map[string]interface{}{"status": resp.status, "results": []interface{}{}}
+	if resp.status == "OK" {
+		// 故意打乱结果顺序，由 ReverseGeocode 按具体程度排列
+		body["results"] = []interface{}{
+			map[string]interface{}{
+				"place_id":          "fake_country",
+				"formatted_address": "Testland",
+				"types":             []string{"country", "political"},
+				"address_components": []interface{}{
+					map[string]interface{}{"long_name": "Testland", "short_name": "TL", "types": []string{"country", "political"}},
+				},
+			},
+			map[string]interface{}{
+				"place_id":          "fake_street_address",
+				"formatted_address": "1 Test Street, Testville, Testland",
+				"types":             []string{"street_address"},
+				"plus_code":         map[string]string{"global_code": "7FG9V3C8+2X", "compound_code": "V3C8+2X Testville, Testland"},
+				"geometry": map[string]interface{}{
+					"location_type": "ROOFTOP",
+					"viewport": map[string]interface{}{
+						"northeast": map[string]float64{"lat": 10.001, "lng": 20.001},
+						"southwest": map[string]float64{"lat": 9.999, "lng": 19.999},
+					},
+				},
+				"address_components": []interface{}{
+					map[string]interface{}{"long_name": "Test Park", "short_name": "Test Park", "types": []string{"park", "point_of_interest", "establishment"}},
+					map[string]interface{}{"long_name": "Test Street", "short_name": "Test St", "types": []string{"route"}},
+					map[string]interface{}{"long_name": "Testville", "short_name": "Testville", "types": []string{"locality", "political"}},
+					map[string]interface{}{"long_name": "Test State", "short_name": "TS", "types": []string{"administrative_area_level_1", "political"}},
+					map[string]interface{}{"long_name": "Testland", "short_name": "TL", "types": []string{"country", "political"}},
+				},
+			},
+			map[string]interface{}{
+				"place_id":          "fake_locality",
+				"formatted_address": "Testville, Testland",
+				"types":             []string{"locality", "political"},
+				"address_components": []interface{}{
+					map[string]interface{}{"long_name": "Testville", "short_name": "Testville", "types": []string{"locality", "political"}},
+					map[string]interface{}{"long_name": "Test County", "short_name": "Test County", "types": []string{"administrative_area_level_2", "political"}},
+					map[string]interface{}{"long_name": "Testland", "short_name": "TL", "types": []string{"country", "political"}},
+				},
+			},
+		}
+	} else if resp.status != "ZERO_RESULTS" {
+		body["error_message"] = "simulated " + resp.status
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeGoogle) handleImage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	f.mu.Lock()
+	responses := f.images
+	f.mu.Unlock()
+	resp := f.next(&f.imageRequests, responses, query)
+	if !resp.write(w, r) {
+		return
+	}
+	if query.Get("key") != fakeGoogleAPIKey {
+		http.Error(w, "invalid key", http.StatusForbidden)
+		return
+	}
+	if resp.status == "ZERO_RESULTS" {
+		http.Error(w, "no imagery", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(fakeImage(query.Get("pano"), query.Get("size")))
+}
+
+// fakeImage 模拟服务器返回的图片内容，由全景 ID 和尺寸决定
+func fakeImage(panoID, size string) []byte {
+	return []byte("fake-jpeg:" + panoID + ":" + size)
+}
+
+// fakePanoID 模拟服务器返回的全景 ID，由请求的半径决定
+func fakePanoID(radius string) string {
+	if radius == "" {
+		radius = "unlimited"
+	}
+	return "fake_pano_" + radius
+}
+
+func parseFakeLocation(location string) (float64, float64) {
+	latStr, lngStr, _ := strings.Cut(location, ",")
+	lat, _ := strconv.ParseFloat(latStr, 64)
+	lng, _ := strconv.ParseFloat(lngStr, 64)
+	return lat, lng
+}
+
+// validFakeSignature 按 Google 的规则校验请求签名：signature 是最后一个参数，
+// 对路径和其之前的查询字符串计算 HMAC-SHA1
+func validFakeSignature(r *http.Request, secret string) bool {
+	raw := r.URL.RawQuery
+	index := strings.LastIndex(raw, "&signature=")
+	if index < 0 {
+		return false
+	}
+	key, err := base64.URLEncoding.DecodeString(secret)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, key)
+	mac.Write([]byte(r.URL.Path + "?" + raw[:index]))
+	expected := base64.URLEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(raw[index+len("&signature="):]))
+}
+
+// newFakeProvider 创建指向模拟服务器的 Google 数据源，重试间隔缩短到毫秒级
+// 模拟服务器设置了签名密钥时数据源使用同一个密钥
+func newFakeProvider(t *testing.T, f *fakeGoogle) *GoogleStreetViewProvider {
+	provider, err := NewGoogleStreetViewProvider(fakeGoogleAPIKey, f.signingSecret, f.URL, f.Client())
+	if err != nil {
+		t.Fatalf("创建 Google 数据源失败: %v", err)
+	}
+	provider.retryPolicy = utils.RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    5 * time.Millisecond,
+	}
+	return provider
+}
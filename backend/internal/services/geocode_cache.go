@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/repositories"
+	"github.com/my-streetview-project/backend/internal/utils"
+	"golang.org/x/sync/singleflight"
+)
+
+// geocodeFetchTimeout 合并后的上游请求不随单个调用方取消，用该超时限制最长时间
+const geocodeFetchTimeout = 30 * time.Second
+
+// GeocodeCache 逆地理编码缓存，按取整后的坐标和语言保存在仓库中
+// 同一个键的并发查询只向上游发出一次请求，其余调用方等待并共享结果
+type GeocodeCache struct {
+	repo      repositories.Repository
+	precision int
+	ttl       time.Duration
+	group     singleflight.Group
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	coalesced atomic.Int64
+}
+
+// GeocodeCacheStats 逆地理编码缓存的命中统计
+type GeocodeCacheStats struct {
+	Precision int     `json:"precision"`
+	TTL       string  `json:"ttl"`
+	Hits      int64   `json:"hits"`      // 命中缓存的次数
+	Misses    int64   `json:"misses"`    // 请求上游的次数
+	Coalesced int64   `json:"coalesced"` // 与其他并发查询合并、没有单独请求上游的次数
+	HitRate   float64 `json:"hit_rate"`  // 没有请求上游的查询所占比例
+}
+
+// NewGeocodeCache 创建逆地理编码缓存，precision 为坐标保留的小数位数（4 位约 11 米）
+func NewGeocodeCache(repo repositories.Repository, precision int, ttl time.Duration) *GeocodeCache {
+	return &GeocodeCache{repo: repo, precision: precision, ttl: ttl}
+}
+
+// geocodeCacheKey 把坐标按精度取整后与语言组成缓存键，例如 35.6595,139.7006:en
+func geocodeCacheKey(latitude, longitude float64, precision int, language string) string {
+	return fmt.Sprintf("%.*f,%.*f:%s", precision, latitude, precision, longitude, language)
+}
+
+// Lookup 返回缓存的逆地理编码结果，没有缓存时调用 fetch 并缓存成功的结果
+func (c *GeocodeCache) Lookup(ctx context.Context, latitude, longitude float64, language string, fetch func(ctx context.Context) (*models.GeocodeResult, error)) (*models.GeocodeResult, error) {
+	logger := utils.MapsLogger()
+	key := geocodeCacheKey(latitude, longitude, c.precision, language)
+
+	entry, err := c.repo.GetGeocode(ctx, key)
+	if err != nil {
+		// 缓存不可用时直接请求上游
+		logger.Error("geocode_cache_read_failed", "Failed to read geocode cache", err, map[string]interface{}{
+			"key": key,
+		})
+	}
+	// 旧格式的缓存条目没有 Result，视为未命中并用新结果覆盖
+	if entry != nil && entry.Result != nil {
+		c.hits.Add(1)
+		return entry.Result.Clone(), nil
+	}
+
+	var leader bool
+	results := c.group.DoChan(key, func() (interface{}, error) {
+		leader = true
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), geocodeFetchTimeout)
+		defer cancel()
+
+		result, err := fetch(fetchCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		entry := models.GeocodeCacheEntry{Key: key, Result: result.Clone(), CachedAt: now, ExpiresAt: now.Add(c.ttl)}
+		if err := c.repo.SaveGeocode(fetchCtx, entry); err != nil {
+			logger.Error("geocode_cache_write_failed", "Failed to write geocode cache", err, map[string]interface{}{
+				"key": key,
+			})
+		}
+		return result, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		// 结果通过 channel 返回，读取 leader 时 fn 已经执行完毕
+		if leader {
+			c.misses.Add(1)
+		} else {
+			c.coalesced.Add(1)
+		}
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*models.GeocodeResult).Clone(), nil
+	}
+}
+
+// Stats 返回缓存的命中统计
+func (c *GeocodeCache) Stats() GeocodeCacheStats {
+	stats := GeocodeCacheStats{
+		Precision: c.precision,
+		TTL:       c.ttl.String(),
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Coalesced: c.coalesced.Load(),
+	}
+	if total := stats.Hits + stats.Misses + stats.Coalesced; total > 0 {
+		stats.HitRate = float64(stats.Hits+stats.Coalesced) / float64(total)
+	}
+	return stats
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/repositories"
+)
+
+func newCachedMapsService(t *testing.T, fake *fakeGoogle) (*MapsService, *GeocodeCache) {
+	maps := NewMapsServiceWithProvider(newFakeProvider(t, fake))
+	cache := NewGeocodeCache(repositories.NewMemoryRepository(), 4, time.Hour)
+	maps.SetGeocodeCache(cache)
+	return maps, cache
+}
+
+func TestGeocodeCacheHits(t *testing.T) {
+	fake := newFakeGoogle(t)
+	maps, cache := newCachedMapsService(t, fake)
+	ctx := context.Background()
+
+	if _, err := maps.GetLocationInfo(ctx, 35.659487, 139.700553, "en"); err != nil {
+		t.Fatalf("逆地理编码失败: %v", err)
+	}
+	// 取整到 4 位小数后是同一个键
+	info, err := maps.GetLocationInfo(ctx, 35.65951, 139.70058, "en")
+	if err != nil || info.Address().Country != "Testland" {
+		t.Fatalf("应该命中缓存，实际为 %v, %v", info, err)
+	}
+	// 修改返回的结果不影响缓存
+	info.Results[0].Address.Country = "changed"
+	if info, _ := maps.GetLocationInfo(ctx, 35.659487, 139.700553, "en"); info.Best().Address.Country != "Testland" {
+		t.Errorf("缓存的结果被修改: %v", info)
+	}
+	// 不同语言分别缓存
+	if _, err := maps.GetLocationInfo(ctx, 35.659487, 139.700553, "ja"); err != nil {
+		t.Fatalf("逆地理编码失败: %v", err)
+	}
+
+	if calls := len(fake.geocodeCalls()); calls != 2 {
+		t.Errorf("应该请求上游 2 次，实际为 %d 次", calls)
+	}
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 2 || stats.HitRate != 0.5 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+}
+
+func TestGeocodeCacheDoesNotCacheErrors(t *testing.T) {
+	fake := newFakeGoogle(t)
+	fake.setGeocode(fakeResponse{status: "ZERO_RESULTS"}, fakeResponse{status: "OK"})
+	maps, _ := newCachedMapsService(t, fake)
+
+	if _, err := maps.GetLocationInfo(context.Background(), 10, 20, "en"); err == nil {
+		t.Fatal("第一次请求应该失败")
+	}
+	if _, err := maps.GetLocationInfo(context.Background(), 10, 20, "en"); err != nil {
+		t.Errorf("失败的结果不应该被缓存: %v", err)
+	}
+}
+
+func TestGeocodeCacheCoalescesConcurrentLookups(t *testing.T) {
+	fake := newFakeGoogle(t)
+	fake.setGeocode(fakeResponse{status: "OK", delay: 100 * time.Millisecond})
+	maps, cache := newCachedMapsService(t, fake)
+
+	const lookups = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, lookups)
+	for i := 0; i < lookups; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := maps.GetLocationInfo(context.Background(), 10, 20, "en")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("逆地理编码失败: %v", err)
+		}
+	}
+
+	if calls := len(fake.geocodeCalls()); calls != 1 {
+		t.Errorf("并发查询应该只请求上游 1 次，实际为 %d 次", calls)
+	}
+	if stats := cache.Stats(); stats.Misses != 1 || stats.Coalesced != lookups-1 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+}
@@ -0,0 +1,549 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/my-streetview-project/backend/internal/i18n"
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/utils"
+	"googlemaps.github.io/maps"
+)
+
+// DefaultGoogleMapsBaseURL Google Maps Platform 的默认地址
+const DefaultGoogleMapsBaseURL = "https://maps.googleapis.com"
+
+// Panorama 街景全景图的位置和元数据
+type Panorama struct {
+	PanoID    string
+	Latitude  float64
+	Longitude float64
+	Date      string // 拍摄年月，例如 2023-05
+	Copyright string
+}
+
+// StreetViewProvider 街景和逆地理编码的数据源
+type StreetViewProvider interface {
+	// NearestPanorama 查找 radius 米内最近的户外全景，radius <= 0 时不限制半径
+	// 附近没有全景时返回 models.ErrNoStreetView 分类的错误
+	NearestPanorama(ctx context.Context, latitude, longitude float64, radius int) (*Panorama, error)
+	// ReverseGeocode 返回坐标的所有地址结果，没有结果时返回 models.ErrNotFound 分类的错误
+	ReverseGeocode(ctx context.Context, latitude, longitude float64, language string) (*models.GeocodeResult, error)
+}
+
+// GoogleStreetViewProvider 基于 Street View Static API 元数据接口和 Geocoding API 的数据源
+type GoogleStreetViewProvider struct {
+	apiKey        string
+	signingSecret []byte // 解码后的 URL 签名密钥，为空时不签名
+	baseURL       string
+	httpClient    *http.Client
+	client        *maps.Client
+	retryPolicy   utils.RetryPolicy
+	quota         *QuotaTracker
+}
+
+// NewGoogleStreetViewProvider 创建 Google 数据源，baseURL 为空时使用 DefaultGoogleMapsBaseURL，httpClient 为 nil 时使用默认客户端
+// signingSecret 是 Google Cloud 控制台中的 URL 签名密钥（URL 安全的 Base64 编码），非空时街景元数据请求带上 signature 参数
+func NewGoogleStreetViewProvider(apiKey, signingSecret, baseURL string, httpClient *http.Client) (*GoogleStreetViewProvider, error) {
+	if baseURL == "" {
+		baseURL = DefaultGoogleMapsBaseURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	var secret []byte
+	if signingSecret != "" {
+		var err error
+		if secret, err = base64.URLEncoding.DecodeString(signingSecret); err != nil {
+			return nil, fmt.Errorf("Google Maps URL 签名密钥格式错误: %w", err)
+		}
+	}
+
+	client, err := maps.NewClient(
+		maps.WithAPIKey(apiKey),
+		maps.WithBaseURL(strings.TrimRight(baseURL, "/")),
+		maps.WithHTTPClient(httpClient),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Google Maps 客户端失败: %w", err)
+	}
+
+	return &GoogleStreetViewProvider{
+		apiKey:        apiKey,
+		signingSecret: secret,
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		httpClient:    httpClient,
+		client:        client,
+		retryPolicy:   utils.DefaultRetryPolicy,
+	}, nil
+}
+
+// signedQuery 返回编码后的查询字符串，配置了签名密钥时按 Google Maps Platform 的规则
+// 对路径和查询字符串计算 HMAC-SHA1，以 URL 安全的 Base64 编码追加为最后一个参数 signature
+func (p *GoogleStreetViewProvider) signedQuery(path string, query url.Values) string {
+	encoded := query.Encode()
+	if len(p.signingSecret) == 0 {
+		return encoded
+	}
+	mac := hmac.New(sha1.New, p.signingSecret)
+	mac.Write([]byte(path + "?" + encoded))
+	return encoded + "&signature=" + base64.URLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SetQuota 设置 Google API 用量统计，每次 HTTP 请求（包括重试）都计入用量，预算用完时不再发出请求
+func (p *GoogleStreetViewProvider) SetQuota(quota *QuotaTracker) {
+	p.quota = quota
+}
+
+// NearestPanorama 请求 Street View 元数据，只搜索户外全景
+func (p *GoogleStreetViewProvider) NearestPanorama(ctx context.Context, latitude, longitude float64, radius int) (*Panorama, error) {
+	query := url.Values{}
+	query.Set("location", fmt.Sprintf("%.6f,%.6f", latitude, longitude))
+	query.Set("source", "outdoor")
+	if radius > 0 {
+		query.Set("radius", fmt.Sprintf("%d", radius)) // 单位：米
+	}
+	query.Set("key", p.apiKey)
+
+	const path = "/maps/api/streetview/metadata"
+	metadata, err := p.fetchStreetViewMetadata(ctx, p.baseURL+path+"?"+p.signedQuery(path, query))
+	if err != nil {
+		return nil, err
+	}
+
+	switch metadata.Status {
+	case "OK":
+		return &Panorama{
+			PanoID:    metadata.PanoId,
+			Latitude:  metadata.Location.Lat,
+			Longitude: metadata.Location.Lng,
+			Date:      metadata.Date,
+			Copyright: metadata.Copyright,
+		}, nil
+	case "ZERO_RESULTS", "NOT_FOUND":
+		return nil, models.Classify(models.ErrNoStreetView, fmt.Errorf("附近没有街景: %s", metadata.Status))
+	default:
+		return nil, fmt.Errorf("街景元数据返回错误: %s", metadata.Status)
+	}
+}
+
+// streetViewMetadata Street View 元数据接口的响应
+type streetViewMetadata struct {
+	Status   string `json:"status"`
+	Location struct {
+		Lat float64 `json:"lat"`
+		Lng float64 `json:"lng"`
+	} `json:"location"`
+	Copyright string `json:"copyright"`
+	Date      string `json:"date"`
+	PanoId    string `json:"pano_id"`
+}
+
+// fetchStreetViewMetadata 请求 Street View 元数据，429/5xx、网络错误以及
+// OVER_QUERY_LIMIT / UNKNOWN_ERROR 状态按重试策略重试
+func (p *GoogleStreetViewProvider) fetchStreetViewMetadata(ctx context.Context, metadataURL string) (*streetViewMetadata, error) {
+	var result *streetViewMetadata
+
+	_, err := utils.Retry(ctx, p.retryPolicy, utils.MapsLogger(), "maps.streetview_metadata", func(ctx context.Context) error {
+		if err := p.quota.Acquire(ctx, APIStreetViewMetadata); err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", metadataURL, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := p.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return models.Classify(models.ErrTimeout, fmt.Errorf("街景元数据请求超时: %w", stripURL(err)))
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return utils.Retryable(models.Classify(models.ErrUpstreamUnavailable, fmt.Errorf("街景元数据请求失败: %w", stripURL(err))), 0)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			err := models.Classify(utils.StatusErrorKind(resp.StatusCode), fmt.Errorf("街景元数据请求失败 (状态码: %d)", resp.StatusCode))
+			if utils.RetryableStatus(resp.StatusCode) {
+				return utils.Retryable(err, utils.ParseRetryAfter(resp.Header.Get("Retry-After")))
+			}
+			return err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return utils.Retryable(models.Classify(models.ErrUpstreamUnavailable, fmt.Errorf("读取街景元数据失败: %w", err)), 0)
+		}
+
+		var metadata streetViewMetadata
+		if err := json.Unmarshal(body, &metadata); err != nil {
+			return models.Classify(models.ErrUpstreamUnavailable, fmt.Errorf("解析街景元数据失败: %w", err))
+		}
+
+		switch metadata.Status {
+		case "OVER_QUERY_LIMIT":
+			return utils.Retryable(models.Classify(models.ErrQuotaExhausted, fmt.Errorf("街景元数据返回临时错误: %s", metadata.Status)), 0)
+		case "UNKNOWN_ERROR":
+			return utils.Retryable(models.Classify(models.ErrUpstreamUnavailable, fmt.Errorf("街景元数据返回临时错误: %s", metadata.Status)), 0)
+		}
+
+		result = &metadata
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// StreetViewImage Street View Static API 返回的图片
+type StreetViewImage struct {
+	ContentType string
+	Data        []byte
+}
+
+// StreetViewImage 请求 Street View Static API 的全景图片，429/5xx 和网络错误按重试策略重试
+// 全景不存在时返回 models.ErrNoStreetView 分类的错误，图片超过 maxBytes 时返回 STREETVIEW_IMAGE_TOO_LARGE
+func (p *GoogleStreetViewProvider) StreetViewImage(ctx context.Context, req StreetViewImageRequest, maxBytes int64) (*StreetViewImage, error) {
+	query := url.Values{}
+	query.Set("pano", req.PanoID)
+	query.Set("size", fmt.Sprintf("%dx%d", req.Width, req.Height))
+	query.Set("heading", fmt.Sprintf("%g", req.Heading))
+	query.Set("pitch", fmt.Sprintf("%g", req.Pitch))
+	query.Set("fov", fmt.Sprintf("%g", req.FOV))
+	query.Set("return_error_code", "true") // 全景不存在时返回 404，而不是灰色的占位图片
+	query.Set("key", p.apiKey)
+
+	const path = "/maps/api/streetview"
+	imageURL := p.baseURL + path + "?" + p.signedQuery(path, query)
+
+	var image *StreetViewImage
+	_, err := utils.Retry(ctx, p.retryPolicy, utils.MapsLogger(), "maps.streetview_image", func(ctx context.Context) error {
+		if err := p.quota.Acquire(ctx, APIStreetViewImage); err != nil {
+			return err
+		}
+
+		httpReq, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+		if err != nil {
+			return stripURL(err)
+		}
+
+		resp, err := p.httpClient.Do(httpReq)
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return models.Classify(models.ErrTimeout, fmt.Errorf("街景图片请求超时: %w", stripURL(err)))
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return utils.Retryable(models.Classify(models.ErrUpstreamUnavailable, fmt.Errorf("街景图片请求失败: %w", stripURL(err))), 0)
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return models.Classify(models.ErrNoStreetView, fmt.Errorf("全景图片不存在: %s", req.PanoID))
+		case resp.StatusCode != http.StatusOK:
+			err := models.Classify(utils.StatusErrorKind(resp.StatusCode), fmt.Errorf("街景图片请求失败 (状态码: %d)", resp.StatusCode))
+			if utils.RetryableStatus(resp.StatusCode) {
+				return utils.Retryable(err, utils.ParseRetryAfter(resp.Header.Get("Retry-After")))
+			}
+			return err
+		}
+
+		contentType := resp.Header.Get("Content-Type")
+		if !strings.HasPrefix(contentType, "image/") {
+			return models.Classify(models.ErrUpstreamUnavailable, fmt.Errorf("街景图片类型错误: %s", contentType))
+		}
+		tooLarge := models.NewError(models.ErrUpstreamUnavailable, "STREETVIEW_IMAGE_TOO_LARGE", "街景图片超过大小限制")
+		if resp.ContentLength > maxBytes {
+			return tooLarge
+		}
+
+		// 多读一个字节，用于判断没有 Content-Length 的响应是否超过限制
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+		if err != nil {
+			return utils.Retryable(models.Classify(models.ErrUpstreamUnavailable, fmt.Errorf("读取街景图片失败: %w", err)), 0)
+		}
+		if int64(len(data)) > maxBytes {
+			return tooLarge
+		}
+
+		image = &StreetViewImage{ContentType: contentType, Data: data}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// stripURL 去掉 *url.Error 中包含 API Key 和签名的请求地址，只保留底层错误
+func stripURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// ReverseGeocode 调用 Geocoding API，返回按具体程度排列的所有结果
+func (p *GoogleStreetViewProvider) ReverseGeocode(ctx context.Context, latitude, longitude float64, language string) (*models.GeocodeResult, error) {
+	// 创建 Geocoding 请求
+	req := &maps.GeocodingRequest{
+		LatLng: &maps.LatLng{
+			Lat: latitude,
+			Lng: longitude,
+		},
+	}
+
+	// 使用与描述一致的语言返回地址，例如 zh 对应 Google 的 zh-CN
+	if language != "" {
+		req.Language = i18n.LookupLanguage(language).Google
+	}
+
+	// 发送请求，配额超限和临时错误按重试策略重试
+	var resp []maps.GeocodingResult
+	_, err := utils.Retry(ctx, p.retryPolicy, utils.MapsLogger(), "maps.reverse_geocode", func(ctx context.Context) error {
+		if err := p.quota.Acquire(ctx, APIGeocode); err != nil {
+			return err
+		}
+
+		var err error
+		resp, err = p.client.ReverseGeocode(ctx, req)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return models.Classify(models.ErrTimeout, stripURL(err))
+		}
+		if ctx.Err() != nil {
+			return stripURL(err)
+		}
+		classified := models.Classify(geocodeErrorKind(err), stripURL(err))
+		if transientGeocodeError(err) {
+			return utils.Retryable(classified, 0)
+		}
+		return classified
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Geocoding API 请求失败: %w", err)
+	}
+
+	// 如果没有结果，返回错误
+	if len(resp) == 0 {
+		return nil, models.NewError(models.ErrNotFound, "GEOCODE_NOT_FOUND", "未找到位置信息")
+	}
+
+	return geocodeResultFromGoogle(resp, language), nil
+}
+
+// pointOfInterestTypes 作为兴趣点提取的地址组件类型
+var pointOfInterestTypes = map[string]bool{
+	"establishment":     true,
+	"point_of_interest": true,
+	"park":              true,
+	"natural_feature":   true,
+	"airport":           true,
+	"university":        true,
+	"school":            true,
+	"hospital":          true,
+	"pharmacy":          true,
+	"church":            true,
+	"finance":           true,
+	"post_box":          true,
+	"bus_station":       true,
+	"train_station":     true,
+	"transit_station":   true,
+}
+
+// geocodeResultFromGoogle 把 Geocoding API 的所有结果转换为 GeocodeResult 并按具体程度排列
+func geocodeResultFromGoogle(resp []maps.GeocodingResult, language string) *models.GeocodeResult {
+	result := &models.GeocodeResult{
+		Source:   models.GeocodeSourceGoogle,
+		Language: language,
+		Results:  make([]models.GeocodePlace, 0, len(resp)),
+	}
+
+	for _, r := range resp {
+		place := models.GeocodePlace{
+			PlaceID:          r.PlaceID,
+			FormattedAddress: r.FormattedAddress,
+			Types:            r.Types,
+			LocationType:     r.Geometry.LocationType,
+			PlusCode: models.PlusCode{
+				GlobalCode:   r.PlusCode.GlobalCode,
+				CompoundCode: r.PlusCode.CompoundCode,
+			},
+		}
+		if vp := r.Geometry.Viewport; vp != (maps.LatLngBounds{}) {
+			place.Viewport = &models.Viewport{
+				North: vp.NorthEast.Lat,
+				South: vp.SouthWest.Lat,
+				East:  vp.NorthEast.Lng,
+				West:  vp.SouthWest.Lng,
+			}
+		}
+		for _, component := range r.AddressComponents {
+			addAddressComponent(&place, component)
+		}
+		// 坐标本身的 Plus Code 取第一个带 Plus Code 的结果
+		if result.PlusCode == (models.PlusCode{}) {
+			result.PlusCode = place.PlusCode
+		}
+		result.Results = append(result.Results, place)
+	}
+
+	result.SortBySpecificity()
+	return result
+}
+
+// addAddressComponent 把地址组件按类型填入地点的地址层级，兴趣点类型的组件加入兴趣点列表
+func addAddressComponent(place *models.GeocodePlace, component maps.AddressComponent) {
+	a := &place.Address
+	set := func(dst *string, value string) {
+		if *dst == "" {
+			*dst = value
+		}
+	}
+
+	poi := false
+	for _, t := range component.Types {
+		switch t {
+		case "street_number":
+			set(&a.StreetNumber, component.LongName)
+		case "route":
+			set(&a.Route, component.LongName)
+		case "intersection":
+			set(&a.Intersection, component.LongName)
+		case "premise":
+			set(&a.Premise, component.LongName)
+		case "subpremise":
+			set(&a.Subpremise, component.LongName)
+		case "neighborhood", "administrative_area_level_4":
+			set(&a.Neighborhood, component.LongName)
+		case "sublocality", "sublocality_level_1":
+			set(&a.Sublocality, component.LongName)
+		case "sublocality_level_2":
+			set(&a.SublocalityLevel2, component.LongName)
+		case "locality":
+			set(&a.City, component.LongName)
+		case "postal_town":
+			set(&a.PostalTown, component.LongName)
+		case "colloquial_area":
+			set(&a.ColloquialArea, component.LongName)
+		case "administrative_area_level_3":
+			set(&a.Subdistrict, component.LongName)
+		case "administrative_area_level_2":
+			set(&a.County, component.LongName)
+		case "administrative_area_level_1":
+			set(&a.StateProvince, component.LongName)
+			set(&a.StateProvinceCode, component.ShortName)
+		case "country":
+			set(&a.Country, component.LongName)
+			set(&a.CountryCode, component.ShortName)
+		case "postal_code":
+			set(&a.PostalCode, component.LongName)
+		case "postal_code_suffix":
+			set(&a.PostalCodeSuffix, component.LongName)
+		}
+		if pointOfInterestTypes[t] {
+			poi = true
+		}
+	}
+
+	if poi {
+		place.PointsOfInterest = append(place.PointsOfInterest, models.PointOfInterest{
+			Name:  component.LongName,
+			Types: component.Types,
+		})
+	}
+}
+
+// geocodeErrorKind 返回 Geocoding 错误的分类
+// maps 客户端把非 OK 状态转换为 "maps: STATUS - message"；网络错误和非 JSON 响应（通常是网关 5xx 页面）视为上游不可用
+func geocodeErrorKind(err error) error {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "OVER_QUERY_LIMIT"), strings.Contains(msg, "OVER_DAILY_LIMIT"):
+		return models.ErrQuotaExhausted
+	case strings.Contains(msg, "UNKNOWN_ERROR"):
+		return models.ErrUpstreamUnavailable
+	}
+
+	var urlErr *url.Error
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &urlErr) || errors.As(err, &syntaxErr) {
+		return models.ErrUpstreamUnavailable
+	}
+	return nil
+}
+
+// transientGeocodeError 判断 Geocoding 错误是否为可重试的临时失败，OVER_DAILY_LIMIT 当天内不会恢复，不再重试
+func transientGeocodeError(err error) bool {
+	return geocodeErrorKind(err) != nil && !strings.Contains(err.Error(), "OVER_DAILY_LIMIT")
+}
+
+// newMapsHTTPClient 根据 MAPS_PROXY_URL / PROXY_URL 创建 HTTP 客户端，第二个返回值表示是否配置了代理
+func newMapsHTTPClient() (*http.Client, bool) {
+	// 从环境变量获取代理URL
+	proxyURL := os.Getenv("MAPS_PROXY_URL")
+	if proxyURL == "" {
+		proxyURL = os.Getenv("PROXY_URL")
+	}
+
+	// 如果没有代理配置，返回默认客户端
+	if proxyURL == "" {
+		return &http.Client{}, false
+	}
+
+	proxyType := os.Getenv("PROXY_TYPE")
+	if proxyType == "" {
+		proxyType = "http"
+	}
+
+	proxyUser := os.Getenv("PROXY_USER")
+	proxyPass := os.Getenv("PROXY_PASS")
+
+	// 创建代理URL
+	proxy, err := url.Parse(proxyURL)
+	if err != nil {
+		utils.MapsLogger().Error("proxy_parse_failed", "Failed to parse proxy URL, using direct connection", err, map[string]interface{}{
+			"proxy_url": proxyURL,
+		})
+		return &http.Client{}, false
+	}
+
+	// 如果提供了用户名和密码，添加到代理URL
+	if proxyUser != "" && proxyPass != "" {
+		proxy.User = url.UserPassword(proxyUser, proxyPass)
+	}
+
+	// 创建带有代理的Transport
+	transport := &http.Transport{
+		Proxy: http.ProxyURL(proxy),
+	}
+
+	httpClient := &http.Client{
+		Transport: transport,
+	}
+
+	return httpClient, true
+}
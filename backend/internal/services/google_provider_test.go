@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+)
+
+func TestNearestPanorama(t *testing.T) {
+	fake := newFakeGoogle(t)
+	provider := newFakeProvider(t, fake)
+
+	pano, err := provider.NearestPanorama(context.Background(), 35.681236, 139.767125, 5000)
+	if err != nil {
+		t.Fatalf("应该找到全景: %v", err)
+	}
+	if pano.PanoID != "fake_pano_5000" || pano.Latitude != 35.681236 || pano.Longitude != 139.767125 {
+		t.Errorf("全景不正确: %+v", pano)
+	}
+	if pano.Date != "2023-05" || pano.Copyright != "© Google" {
+		t.Errorf("全景元数据不正确: %+v", pano)
+	}
+
+	query := fake.metadataCalls()[0]
+	if query.Get("location") != "35.681236,139.767125" || query.Get("radius") != "5000" ||
+		query.Get("source") != "outdoor" || query.Get("key") != fakeGoogleAPIKey {
+		t.Errorf("请求参数不正确: %v", query)
+	}
+
+	// radius <= 0 时不限制半径
+	if _, err := provider.NearestPanorama(context.Background(), 35.681236, 139.767125, 0); err != nil {
+		t.Fatalf("应该找到全景: %v", err)
+	}
+	if query := fake.metadataCalls()[1]; query.Has("radius") {
+		t.Errorf("不应该带 radius 参数: %v", query)
+	}
+}
+
+func TestNearestPanoramaSignedRequest(t *testing.T) {
+	fake := newFakeGoogle(t)
+	fake.signingSecret = "dGVzdC1zaWduaW5nLXNlY3JldA=="
+	provider := newFakeProvider(t, fake)
+
+	if _, err := provider.NearestPanorama(context.Background(), 35.681236, 139.767125, 5000); err != nil {
+		t.Fatalf("签名正确时应该找到全景: %v", err)
+	}
+	if query := fake.metadataCalls()[0]; query.Get("signature") == "" {
+		t.Errorf("请求应该带 signature 参数: %v", query)
+	}
+
+	// 密钥不一致时签名校验失败
+	other, err := NewGoogleStreetViewProvider(fakeGoogleAPIKey, "b3RoZXItc2VjcmV0", fake.URL, fake.Client())
+	if err != nil {
+		t.Fatalf("创建 Google 数据源失败: %v", err)
+	}
+	if _, err := other.NearestPanorama(context.Background(), 35.681236, 139.767125, 5000); err == nil {
+		t.Error("签名错误时请求应该被拒绝")
+	}
+
+	if _, err := NewGoogleStreetViewProvider(fakeGoogleAPIKey, "not base64!", fake.URL, fake.Client()); err == nil {
+		t.Error("签名密钥格式错误时应该返回错误")
+	}
+}
+
+func TestNearestPanoramaErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response fakeResponse
+		timeout  time.Duration
+		want     error
+		attempts int
+	}{
+		{"没有街景", fakeResponse{status: "ZERO_RESULTS"}, 0, models.ErrNoStreetView, 1},
+		{"配额超限重试", fakeResponse{status: "OVER_QUERY_LIMIT"}, 0, models.ErrQuotaExhausted, 3},
+		{"上游错误重试", fakeResponse{status: "UNKNOWN_ERROR"}, 0, models.ErrUpstreamUnavailable, 3},
+		{"HTTP 503 重试", fakeResponse{httpStatus: http.StatusServiceUnavailable}, 0, models.ErrUpstreamUnavailable, 3},
+		{"格式错误的 JSON", fakeResponse{body: `{"status": "OK", "pano_id":`}, 0, models.ErrUpstreamUnavailable, 1},
+		{"超时", fakeResponse{status: "OK", delay: time.Second}, 50 * time.Millisecond, models.ErrTimeout, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGoogle(t)
+			fake.setMetadata(tt.response)
+			provider := newFakeProvider(t, fake)
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			_, err := provider.NearestPanorama(ctx, 10, 20, 100)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("错误应为 %v，实际为 %v", tt.want, err)
+			}
+			if got := len(fake.metadataCalls()); got != tt.attempts {
+				t.Errorf("应该请求 %d 次，实际为 %d 次", tt.attempts, got)
+			}
+		})
+	}
+}
+
+func TestReverseGeocode(t *testing.T) {
+	fake := newFakeGoogle(t)
+	provider := newFakeProvider(t, fake)
+
+	result, err := provider.ReverseGeocode(context.Background(), 10, 20, "zh")
+	if err != nil {
+		t.Fatalf("逆地理编码失败: %v", err)
+	}
+	if result.Source != models.GeocodeSourceGoogle || result.Language != "zh" {
+		t.Errorf("来源和语言为 %s/%s，期望 google/zh", result.Source, result.Language)
+	}
+
+	// 保留所有结果并按具体程度排列
+	var placeIDs []string
+	for _, place := range result.Results {
+		placeIDs = append(placeIDs, place.PlaceID)
+	}
+	if want := []string{"fake_street_address", "fake_locality", "fake_country"}; !reflect.DeepEqual(placeIDs, want) {
+		t.Errorf("结果顺序为 %v，期望 %v", placeIDs, want)
+	}
+
+	best := result.Best()
+	if best.FormattedAddress != "1 Test Street, Testville, Testland" || best.LocationType != "ROOFTOP" {
+		t.Errorf("最具体的结果不正确: %+v", best)
+	}
+	if best.Viewport == nil || best.Viewport.North != 10.001 || best.Viewport.West != 19.999 {
+		t.Errorf("显示范围不正确: %+v", best.Viewport)
+	}
+	if result.PlusCode.GlobalCode != "7FG9V3C8+2X" {
+		t.Errorf("Plus Code 为 %+v，期望 7FG9V3C8+2X", result.PlusCode)
+	}
+	if pois := result.PointsOfInterest(); len(pois) != 1 || pois[0].Name != "Test Park" {
+		t.Errorf("兴趣点为 %+v，期望 Test Park", pois)
+	}
+
+	// 县只出现在城市结果中，合并后的地址层级由更宽泛的结果补齐
+	want := models.AddressHierarchy{
+		Route:             "Test Street",
+		City:              "Testville",
+		County:            "Test County",
+		StateProvince:     "Test State",
+		StateProvinceCode: "TS",
+		Country:           "Testland",
+		CountryCode:       "TL",
+	}
+	if address := result.Address(); address != want {
+		t.Errorf("地址层级为 %+v，期望 %+v", address, want)
+	}
+
+	// 描述语言 zh 对应 Google 的 zh-CN
+	if query := fake.geocodeCalls()[0]; query.Get("language") != "zh-CN" || query.Get("latlng") == "" {
+		t.Errorf("请求参数不正确: %v", query)
+	}
+}
+
+func TestReverseGeocodeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response fakeResponse
+		timeout  time.Duration
+		want     error
+		attempts int
+	}{
+		{"没有结果", fakeResponse{status: "ZERO_RESULTS"}, 0, models.ErrNotFound, 1},
+		{"配额超限重试", fakeResponse{status: "OVER_QUERY_LIMIT"}, 0, models.ErrQuotaExhausted, 3},
+		{"每日配额用完不重试", fakeResponse{status: "OVER_DAILY_LIMIT"}, 0, models.ErrQuotaExhausted, 1},
+		{"格式错误的 JSON", fakeResponse{body: `<html>502 Bad Gateway</html>`}, 0, models.ErrUpstreamUnavailable, 3},
+		{"超时", fakeResponse{status: "OK", delay: time.Second}, 50 * time.Millisecond, models.ErrTimeout, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGoogle(t)
+			fake.setGeocode(tt.response)
+			provider := newFakeProvider(t, fake)
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			_, err := provider.ReverseGeocode(ctx, 10, 20, "en")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("错误应为 %v，实际为 %v", tt.want, err)
+			}
+			if got := len(fake.geocodeCalls()); got != tt.attempts {
+				t.Errorf("应该请求 %d 次，实际为 %d 次", tt.attempts, got)
+			}
+		})
+	}
+}
+
+func TestResolveLocationInfoWithoutOfflineResult(t *testing.T) {
+	fake := newFakeGoogle(t)
+	fake.setGeocode(fakeResponse{status: "REQUEST_DENIED"})
+	maps := NewMapsServiceWithProvider(newFakeProvider(t, fake))
+
+	// 离线数据不可用或坐标在海上时返回 Google 的错误
+	if _, err := maps.ResolveLocationInfo(context.Background(), 0, -30, "en"); err == nil {
+		t.Error("离线地理编码也没有结果时应该返回错误")
+	}
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/i18n"
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/utils"
+)
+
+const (
+	// poolActiveTTL 偏好池在这段时间内没有被请求就停止补充
+	poolActiveTTL = 30 * time.Minute
+	// poolGenerateTimeout 后台生成单个位置的超时时间
+	poolGenerateTimeout = 60 * time.Second
+	// poolMaxActive 同时补充的非默认池数量上限，每个活跃的池都持续消耗 Google 配额
+	poolMaxActive = 8
+)
+
+// PoolConfig 预生成位置池配置
+type PoolConfig struct {
+	Size           int           // 每个池补充到的数量，<= 0 时不启用位置池
+	LowWater       int           // 池中数量低于该值时开始补充
+	RefillInterval time.Duration // 后台检查所有池的间隔
+}
+
+// locationPool 预生成位置池，后台预先完成街景搜索和地理编码，请求时直接取出
+// 全局池按语言区分，偏好池按区域和语言区分，只补充最近被请求过的偏好池
+type locationPool struct {
+	ls     *LocationService
+	config PoolConfig
+
+	mu     sync.Mutex
+	active map[string]*poolSpec
+	refill chan struct{}
+}
+
+// poolSpec 一个位置池的生成条件
+type poolSpec struct {
+	name          string
+	regions       []models.Region
+	language      string
+	lastRequested time.Time
+	permanent     bool // 默认语言的全局池始终保持补充
+}
+
+// StartLocationPool 启动预生成位置池的后台补充任务，ctx 取消时停止
+func (ls *LocationService) StartLocationPool(ctx context.Context, config PoolConfig) {
+	if config.Size <= 0 {
+		return
+	}
+	if config.LowWater <= 0 || config.LowWater > config.Size {
+		config.LowWater = config.Size
+	}
+	if config.RefillInterval <= 0 {
+		config.RefillInterval = 30 * time.Second
+	}
+
+	pool := newLocationPool(ls, config)
+	ls.pool = pool
+	go pool.run(ctx)
+
+	utils.LocationLogger().Info("location_pool_started", "Location pool started", map[string]interface{}{
+		"size":            config.Size,
+		"low_water":       config.LowWater,
+		"refill_interval": config.RefillInterval.String(),
+	})
+}
+
+// newLocationPool 创建位置池，默认语言的全局池始终处于活跃状态
+func newLocationPool(ls *LocationService, config PoolConfig) *locationPool {
+	pool := &locationPool{
+		ls:     ls,
+		config: config,
+		active: make(map[string]*poolSpec),
+		refill: make(chan struct{}, 1),
+	}
+	language := i18n.DefaultSupportedLanguage().Code
+	name := poolName(nil, language)
+	pool.active[name] = &poolSpec{
+		name:          name,
+		language:      language,
+		lastRequested: time.Now(),
+		permanent:     true,
+	}
+	return pool
+}
+
+// poolName 返回位置池名称，全局池为 global:<语言>，偏好池使用区域列表的哈希
+func poolName(regions []models.Region, language string) string {
+	if regions == nil {
+		return "global:" + language
+	}
+	data, _ := json.Marshal(regions)
+	sum := sha1.Sum(data)
+	return fmt.Sprintf("pref:%s:%s", hex.EncodeToString(sum[:])[:16], language)
+}
+
+// run 启动时清理重启前留下的池并立即补充一次，之后按间隔或在池被取空时补充
+func (p *locationPool) run(ctx context.Context) {
+	p.sweep(ctx)
+
+	ticker := time.NewTicker(p.config.RefillInterval)
+	defer ticker.Stop()
+
+	for {
+		p.refillAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.refill:
+		}
+	}
+}
+
+// refillAll 补充所有活跃的池，并删除长时间没有请求的池及其中剩余的位置
+func (p *locationPool) refillAll(ctx context.Context) {
+	p.mu.Lock()
+	specs := make([]poolSpec, 0, len(p.active))
+	var expired []string
+	for name, spec := range p.active {
+		if !spec.permanent && time.Since(spec.lastRequested) > poolActiveTTL {
+			delete(p.active, name)
+			expired = append(expired, name)
+			continue
+		}
+		specs = append(specs, *spec)
+	}
+	p.mu.Unlock()
+
+	for _, name := range expired {
+		if err := p.ls.repo.DeletePool(ctx, name); err != nil {
+			utils.LocationLogger().Error("location_pool_delete_failed", "Failed to delete inactive location pool", err, map[string]interface{}{
+				"pool": name,
+			})
+		}
+	}
+
+	for _, spec := range specs {
+		if ctx.Err() != nil {
+			return
+		}
+		p.refillPool(ctx, spec)
+	}
+}
+
+// sweep 删除存储中不活跃的池
+// 活跃的池只记录在内存中，重启前按请求创建的池不会再被 refillAll 发现，不清理时会一直留在存储中
+// 多个实例共用存储时可能删除其他实例正在使用的池，这些池会在下次请求时重新补充
+func (p *locationPool) sweep(ctx context.Context) {
+	logger := utils.LocationLogger()
+
+	pools, err := p.ls.repo.ListPools(ctx)
+	if err != nil {
+		logger.Error("location_pool_list_failed", "Failed to list stored location pools", err)
+		return
+	}
+
+	deleted := 0
+	for _, name := range pools {
+		p.mu.Lock()
+		_, active := p.active[name]
+		p.mu.Unlock()
+		if active {
+			continue
+		}
+		if err := p.ls.repo.DeletePool(ctx, name); err != nil {
+			logger.Error("location_pool_delete_failed", "Failed to delete inactive location pool", err, map[string]interface{}{
+				"pool": name,
+			})
+			continue
+		}
+		deleted++
+	}
+
+	if deleted > 0 {
+		logger.Info("location_pool_swept", "Deleted location pools left from a previous run", map[string]interface{}{
+			"deleted": deleted,
+		})
+	}
+}
+
+// refillPool 池中数量低于低水位时补充到目标数量
+func (p *locationPool) refillPool(ctx context.Context, spec poolSpec) {
+	logger := utils.LocationLogger()
+
+	size, err := p.ls.repo.PoolSize(ctx, spec.name)
+	if err != nil {
+		logger.Error("location_pool_size_failed", "Failed to get location pool size", err, map[string]interface{}{
+			"pool": spec.name,
+		})
+		return
+	}
+	if size >= int64(p.config.LowWater) {
+		return
+	}
+	// 街景元数据预算用完时暂停补充，池中剩余的位置留给请求使用
+	if p.ls.maps != nil && p.ls.maps.quota.Exhausted(ctx, APIStreetViewMetadata) {
+		logger.Info("location_pool_paused", "Street View metadata budget exhausted, skipping refill", map[string]interface{}{
+			"pool": spec.name,
+			"size": size,
+		})
+		return
+	}
+
+	start := time.Now()
+	added := 0
+	for ; size < int64(p.config.Size) && ctx.Err() == nil; size++ {
+		genCtx, cancel := context.WithTimeout(ctx, poolGenerateTimeout)
+		// 兜底全景不放入池中，请求时实时生成会再尝试一次
+		location, err := p.ls.buildRandomLocation(genCtx, spec.regions, models.CaptureDateRange{}, spec.language, "")
+		cancel()
+		if err != nil {
+			logger.Error("location_pool_generate_failed", "Failed to generate pooled location", err, map[string]interface{}{
+				"pool": spec.name,
+			})
+			break
+		}
+		if err := p.ls.repo.PushPoolLocation(ctx, spec.name, location); err != nil {
+			logger.Error("location_pool_push_failed", "Failed to push location into pool", err, map[string]interface{}{
+				"pool": spec.name,
+			})
+			break
+		}
+		added++
+	}
+
+	logger.Info("location_pool_refilled", "Location pool refilled", map[string]interface{}{
+		"pool":        spec.name,
+		"added":       added,
+		"size":        size,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+}
+
+// pop 从对应的池中取出一个位置，池为空时 ok 为 false
+// 同时把该池标记为活跃，取出后低于低水位时通知后台补充
+// 活跃的池达到 poolMaxActive 个时不再创建新的池，这些请求实时生成位置
+func (p *locationPool) pop(ctx context.Context, regions []models.Region, language string) (models.Location, bool) {
+	name := poolName(regions, language)
+
+	p.mu.Lock()
+	spec, found := p.active[name]
+	if !found {
+		if p.dynamicCount() >= poolMaxActive {
+			p.mu.Unlock()
+			return models.Location{}, false
+		}
+		spec = &poolSpec{name: name, regions: regions, language: language}
+		p.active[name] = spec
+	}
+	spec.lastRequested = time.Now()
+	p.mu.Unlock()
+
+	location, err := p.ls.repo.PopPoolLocation(ctx, name)
+	if err != nil {
+		utils.LocationLogger().Error("location_pool_pop_failed", "Failed to pop location from pool", err, map[string]interface{}{
+			"pool": name,
+		})
+	}
+
+	if size, err := p.ls.repo.PoolSize(ctx, name); err != nil || size < int64(p.config.LowWater) {
+		p.notify()
+	}
+
+	if location == nil {
+		return models.Location{}, false
+	}
+	utils.LocationLogger().Info("location_served_from_pool", "Served location from pool", map[string]interface{}{
+		"pool":    name,
+		"pano_id": location.PanoID,
+	})
+	return *location, true
+}
+
+// dynamicCount 返回按请求创建的活跃池数量，调用方需持有 p.mu
+func (p *locationPool) dynamicCount() int {
+	count := 0
+	for _, spec := range p.active {
+		if !spec.permanent {
+			count++
+		}
+	}
+	return count
+}
+
+// notify 唤醒后台补充任务，已有待处理的通知时不重复发送
+func (p *locationPool) notify() {
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/repositories"
+)
+
+func TestLocationPoolServesPregeneratedLocations(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryRepository()
+	ls := NewOfflineLocationService(repo, nil)
+	pool := newLocationPool(ls, PoolConfig{Size: 3, LowWater: 2, RefillInterval: time.Minute})
+	ls.pool = pool
+
+	// 使用探索偏好的区域，不依赖世界地图数据
+	var region models.Region
+	region.Coordinates.North, region.Coordinates.South = 36, 35
+	region.Coordinates.East, region.Coordinates.West = 140, 139
+	regions := []models.Region{region}
+	pref := models.ExplorationPreference{Interest: "东京", Regions: regions, CreatedAt: time.Now(), LastUsedAt: time.Now()}
+	if err := repo.SaveExplorationPreference(ctx, "session-1", pref); err != nil {
+		t.Fatalf("保存探索偏好失败: %v", err)
+	}
+
+	name := poolName(regions, "en")
+	pool.refillPool(ctx, poolSpec{name: name, regions: regions, language: "en"})
+	if size, _ := repo.PoolSize(ctx, name); size != 3 {
+		t.Fatalf("池应补充到 3 个位置，实际为 %d", size)
+	}
+
+	location, err := ls.GetRandomLocation(ctx, "session-1", "en", models.CaptureDateRange{})
+	if err != nil {
+		t.Fatalf("获取随机位置失败: %v", err)
+	}
+	if size, _ := repo.PoolSize(ctx, name); size != 2 {
+		t.Errorf("应该从池中取出一个位置，剩余 %d 个", size)
+	}
+	if location.Latitude < 35 || location.Latitude > 36 || location.Longitude < 139 || location.Longitude > 140 {
+		t.Errorf("位置不在偏好区域内: %+v", location)
+	}
+	if _, err := ls.GetLocation(ctx, location.PanoID); err != nil {
+		t.Errorf("从池中取出的位置应该被保存: %v", err)
+	}
+
+	// 池中数量未低于低水位时已有的偏好池不重复补充
+	pool.refillPool(ctx, poolSpec{name: name, regions: regions, language: "en"})
+	if size, _ := repo.PoolSize(ctx, name); size != 2 {
+		t.Errorf("未低于低水位时不应补充，实际为 %d 个", size)
+	}
+
+	// 低于低水位时通知后台补充
+	if _, err := ls.GetRandomLocation(ctx, "session-1", "en", models.CaptureDateRange{}); err != nil {
+		t.Fatalf("获取随机位置失败: %v", err)
+	}
+	select {
+	case <-pool.refill:
+	default:
+		t.Error("低于低水位时应该通知后台补充")
+	}
+}
+
+func TestLocationPoolFallsBackWhenEmpty(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryRepository()
+	ls := NewOfflineLocationService(repo, nil)
+	ls.pool = newLocationPool(ls, PoolConfig{Size: 3, LowWater: 1, RefillInterval: time.Minute})
+
+	var region models.Region
+	region.Coordinates.North, region.Coordinates.South = 50, 45
+	region.Coordinates.East, region.Coordinates.West = 10, 5
+	pref := models.ExplorationPreference{Interest: "阿尔卑斯", Regions: []models.Region{region}, CreatedAt: time.Now(), LastUsedAt: time.Now()}
+	if err := repo.SaveExplorationPreference(ctx, "session-2", pref); err != nil {
+		t.Fatalf("保存探索偏好失败: %v", err)
+	}
+
+	// 池为空时实时生成，并把偏好池标记为活跃
+	location, err := ls.GetRandomLocation(ctx, "session-2", "zh", models.CaptureDateRange{})
+	if err != nil {
+		t.Fatalf("池为空时应该实时生成位置: %v", err)
+	}
+	if !isSyntheticPanoID(location.PanoID) {
+		t.Errorf("离线模式应该返回合成全景 ID，实际为 %q", location.PanoID)
+	}
+	if _, found := ls.pool.active[poolName(pref.Regions, "zh")]; !found {
+		t.Error("请求过的偏好池应该被标记为活跃")
+	}
+}
+
+func TestLocationPoolLimitsActivePools(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryRepository()
+	ls := NewOfflineLocationService(repo, nil)
+	pool := newLocationPool(ls, PoolConfig{Size: 3, LowWater: 1, RefillInterval: time.Minute})
+
+	regions := func(i int) []models.Region {
+		var region models.Region
+		region.Coordinates.North, region.Coordinates.South = float64(i+1), float64(i)
+		region.Coordinates.East, region.Coordinates.West = 1, 0
+		return []models.Region{region}
+	}
+	for i := 0; i < poolMaxActive+2; i++ {
+		pool.pop(ctx, regions(i), "en")
+	}
+	// 默认语言的全局池加上 poolMaxActive 个按请求创建的池
+	if len(pool.active) != poolMaxActive+1 {
+		t.Errorf("活跃的池应为 %d 个，实际为 %d", poolMaxActive+1, len(pool.active))
+	}
+	if _, found := pool.active[poolName(regions(poolMaxActive), "en")]; found {
+		t.Error("达到上限后不应创建新的池")
+	}
+
+	// 长时间没有请求的池被移除，其中剩余的位置一并删除
+	name := poolName(regions(0), "en")
+	if err := repo.PushPoolLocation(ctx, name, models.Location{PanoID: "pooled"}); err != nil {
+		t.Fatalf("加入位置池失败: %v", err)
+	}
+	pool.active[name].lastRequested = time.Now().Add(-2 * poolActiveTTL)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	pool.refillAll(cancelled)
+	if _, found := pool.active[name]; found {
+		t.Error("不活跃的池应该被移除")
+	}
+	if size, _ := repo.PoolSize(ctx, name); size != 0 {
+		t.Errorf("不活跃的池中的位置应该被删除，剩余 %d 个", size)
+	}
+
+	// 有空位后可以创建新的池
+	pool.pop(ctx, regions(poolMaxActive), "en")
+	if _, found := pool.active[poolName(regions(poolMaxActive), "en")]; !found {
+		t.Error("有空位后应该创建新的池")
+	}
+}
+
+func TestLocationPoolSweepsStalePools(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryRepository()
+	ls := NewOfflineLocationService(repo, nil)
+
+	// 重启前按请求创建的池留在存储中，新进程的活跃列表里没有它们
+	defaultPool := poolName(nil, "en")
+	for _, name := range []string{defaultPool, "pref:0123456789abcdef:en", "global:ja"} {
+		if err := repo.PushPoolLocation(ctx, name, models.Location{PanoID: "pooled"}); err != nil {
+			t.Fatalf("加入位置池失败: %v", err)
+		}
+	}
+
+	pool := newLocationPool(ls, PoolConfig{Size: 3, LowWater: 1, RefillInterval: time.Minute})
+	pool.sweep(ctx)
+
+	pools, err := repo.ListPools(ctx)
+	if err != nil || len(pools) != 1 || pools[0] != defaultPool {
+		t.Errorf("只应保留默认语言的全局池，实际为 %v, %v", pools, err)
+	}
+	if size, _ := repo.PoolSize(ctx, defaultPool); size != 1 {
+		t.Errorf("活跃的池中的位置不应被删除，剩余 %d 个", size)
+	}
+}
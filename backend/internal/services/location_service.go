@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"time"
@@ -11,32 +12,100 @@ import (
 	"github.com/my-streetview-project/backend/internal/utils"
 )
 
+// captureDateMaxAttempts 限制拍摄日期时最多搜索几个随机坐标，每次搜索最多请求六次街景元数据
+const captureDateMaxAttempts = 3
+
+// discoveredMaxSamples 降级模式下最多抽取几个已发现的位置，寻找在偏好区域和拍摄日期范围内的位置
+const discoveredMaxSamples = 5
+
 type LocationService struct {
-	repo      repositories.Repository
-	aiService *AIService
-	maps      *MapsService
+	repo       repositories.Repository
+	aiService  *AIService
+	maps       *MapsService
+	streetView streetViewFinder
+	offline    bool
+	pool       *locationPool
 }
 
 func NewLocationService(repo repositories.Repository, ai *AIService, maps *MapsService) *LocationService {
 	return &LocationService{
-		repo:      repo,
-		aiService: ai,
-		maps:      maps,
+		repo:       repo,
+		aiService:  ai,
+		maps:       maps,
+		streetView: maps,
+	}
+}
+
+// NewOfflineLocationService 创建不访问 Google 的位置服务：街景使用合成全景 ID，地址使用离线地理编码
+// 用于演示、端到端测试和没有 API Key 的前端开发
+func NewOfflineLocationService(repo repositories.Repository, ai *AIService) *LocationService {
+	return &LocationService{
+		repo:       repo,
+		aiService:  ai,
+		streetView: OfflineStreetView{},
+		offline:    true,
+	}
+}
+
+func (ls *LocationService) GetLocation(ctx context.Context, panoID string) (models.Location, error) {
+	return ls.repo.GetLocationByPanoID(ctx, panoID)
+}
+
+// LocationExists 判断位置是否已发现，只读查询，不更新访问次数
+func (ls *LocationService) LocationExists(ctx context.Context, panoID string) (bool, error) {
+	return ls.repo.LocationExists(ctx, panoID)
+}
+
+// LocationQuery 已发现位置的查询条件，Country 与 City 二选一
+type LocationQuery struct {
+	Country  string
+	City     string
+	Page     int
+	PageSize int
+}
+
+// ListLocations 通过国家或城市索引分页查询已发现的位置，返回当前页和总数
+func (ls *LocationService) ListLocations(ctx context.Context, query LocationQuery) ([]models.Location, int64, error) {
+	offset := (query.Page - 1) * query.PageSize
+
+	if query.Country != "" {
+		total, err := ls.repo.CountLocationsByCountry(ctx, query.Country)
+		if err != nil {
+			return nil, 0, err
+		}
+		locations, err := ls.repo.ListLocationsByCountry(ctx, query.Country, offset, query.PageSize)
+		return locations, total, err
+	}
+
+	total, err := ls.repo.CountLocationsByCity(ctx, query.City)
+	if err != nil {
+		return nil, 0, err
+	}
+	locations, err := ls.repo.ListLocationsByCity(ctx, query.City, offset, query.PageSize)
+	return locations, total, err
+}
+
+// CountLocations 统计国家或城市下已发现的位置数量
+func (ls *LocationService) CountLocations(ctx context.Context, country, city string) (int64, error) {
+	if country != "" {
+		return ls.repo.CountLocationsByCountry(ctx, country)
 	}
+	return ls.repo.CountLocationsByCity(ctx, city)
 }
 
-func (ls *LocationService) GetLocation(panoID string) (models.Location, error) {
-	return ls.repo.GetLocationByPanoID(panoID)
+// GetRandomDiscoveredLocation 随机返回指定国家下一个已发现的位置，无需再请求街景元数据
+func (ls *LocationService) GetRandomDiscoveredLocation(ctx context.Context, country string) (models.Location, error) {
+	return ls.repo.GetRandomLocationByCountry(ctx, country)
 }
 
-// GetRandomLocation 获取随机位置，支持用户偏好
+// GetRandomLocation 获取随机位置，支持用户偏好和拍摄日期范围
 // 如果 sessionID 为空，则使用默认的全球随机生成
-func (ls *LocationService) GetRandomLocation(sessionID string, language string) (models.Location, error) {
+func (ls *LocationService) GetRandomLocation(ctx context.Context, sessionID string, language string, dates models.CaptureDateRange) (models.Location, error) {
 	var regions []models.Region
 
 	// 如果提供了 sessionID，尝试获取用户的探索偏好
 	if sessionID != "" {
-		pref, err := ls.repo.GetExplorationPreference(sessionID)
+		pref, err := ls.repo.GetExplorationPreference(ctx, sessionID)
 		if err != nil {
 			return models.Location{}, fmt.Errorf("获取探索偏好失败: %w", err)
 		}
@@ -47,41 +116,178 @@ func (ls *LocationService) GetRandomLocation(sessionID string, language string)
 
 			// 更新最后使用时间
 			pref.LastUsedAt = time.Now()
-			if err := ls.repo.SaveExplorationPreference(sessionID, *pref); err != nil {
+			if err := ls.repo.SaveExplorationPreference(ctx, sessionID, *pref); err != nil {
 				return models.Location{}, fmt.Errorf("更新探索偏好使用时间失败: %w", err)
 			}
 		}
 	}
 
+	// 优先从预生成位置池中取出，池为空或限制了拍摄日期时实时生成
+	if ls.pool != nil && dates.IsZero() {
+		if location, ok := ls.pool.pop(ctx, regions, language); ok {
+			location.CreatedAt = time.Now()
+			if err := ls.saveLocation(ctx, location, sessionID); err != nil {
+				return models.Location{}, err
+			}
+			return location, nil
+		}
+	}
+
 	// 生成随机位置（regions 为 nil 时使用默认全球区域）
-	return ls.generateRandomLocation(regions, language, sessionID)
+	return ls.generateRandomLocation(ctx, regions, dates, language, sessionID)
 }
 
 // generateRandomLocation 统一的随机位置生成逻辑
 // regions 为 nil 时使用默认大陆区域，否则使用用户偏好区域
-// 使用带兜底机制的街景搜索，确保总是能找到可用位置
-func (ls *LocationService) generateRandomLocation(regions []models.Region, language string, sessionID string) (models.Location, error) {
-	ctx := context.Background()
+// 附近找不到街景（通常是 Google 不可用）或街景元数据预算用完时，先使用已发现的位置，再使用兜底全景列表
+func (ls *LocationService) generateRandomLocation(ctx context.Context, regions []models.Region, dates models.CaptureDateRange, language string, sessionID string) (models.Location, error) {
+	if ls.maps == nil || !ls.maps.StreetViewExhausted(ctx) {
+		location, err := ls.buildRandomLocation(ctx, regions, dates, language, sessionID)
+		if err == nil {
+			if err := ls.saveLocation(ctx, location, sessionID); err != nil {
+				return models.Location{}, err
+			}
+			return location, nil
+		}
+		if ls.maps == nil || ctx.Err() != nil || !errors.Is(err, models.ErrNoStreetView) {
+			return models.Location{}, err
+		}
+	}
+
+	// 已发现的位置可能换成了请求语言的地址，不保存，避免覆盖原记录和国家/城市索引
+	if location, ok := ls.discoveredLocation(ctx, regions, dates, language, sessionID); ok {
+		return location, nil
+	}
+
+	location, err := ls.fallbackLocation(ctx, regions, dates, language, sessionID)
+	if err != nil {
+		return models.Location{}, err
+	}
+	if err := ls.saveLocation(ctx, location, sessionID); err != nil {
+		return models.Location{}, err
+	}
+	return location, nil
+}
 
-	// 生成随机坐标
-	lat, lng := utils.GenerateRandomCoordinate(regions)
+// discoveredLocation 从已发现的位置中随机选择一个拍摄日期在范围内的位置，不请求街景元数据
+// 优先选择位于偏好区域内的位置；地址语言与请求不同时重新获取地址，失败时保留原地址
+// 返回的是供本次响应使用的副本，调用方不应保存
+func (ls *LocationService) discoveredLocation(ctx context.Context, regions []models.Region, dates models.CaptureDateRange, language string, sessionID string) (models.Location, bool) {
 	logger := utils.LocationLogger()
 
-	// 使用带兜底机制的街景搜索，总是能找到可用街景
-	hasStreetView, validLat, validLng, panoId := ls.maps.HasStreetView(ctx, lat, lng, regions != nil)
+	var location models.Location
+	found := false
+	for i := 0; i < discoveredMaxSamples; i++ {
+		candidate, err := ls.repo.GetRandomLocation(ctx)
+		if err != nil {
+			if !errors.Is(err, repositories.ErrLocationNotFound) {
+				logger.Error("discovered_location_failed", "Failed to read discovered location", err, map[string]interface{}{
+					"session_id": sessionID,
+				})
+			}
+			break
+		}
+		if candidate.IsMock || !dates.Contains(candidate.CaptureDate) {
+			continue
+		}
+		if !found {
+			location, found = candidate, true
+		}
+		if inRegions(regions, candidate.Latitude, candidate.Longitude) {
+			location = candidate
+			break
+		}
+	}
+	if !found {
+		return models.Location{}, false
+	}
+
+	if location.Geocode == nil || location.Geocode.Language != language {
+		if geocode, err := ls.locationInfo(ctx, location.Latitude, location.Longitude, language); err == nil {
+			address := geocode.Address()
+			location.Country = address.Country
+			location.City = address.City
+			location.FormattedAddress = geocode.FormattedAddress()
+			location.Geocode = geocode
+		}
+	}
+
+	logger.Info("discovered_location_used", "Street View budget exhausted, using discovered location", map[string]interface{}{
+		"pano_id":    location.PanoID,
+		"country":    location.Country,
+		"session_id": sessionID,
+		"language":   language,
+	})
+	return location, true
+}
+
+// inRegions 判断坐标是否在任一区域内，没有区域时总是返回 true
+func inRegions(regions []models.Region, latitude, longitude float64) bool {
+	if len(regions) == 0 {
+		return true
+	}
+	for _, region := range regions {
+		if regionContains(region, latitude, longitude) {
+			return true
+		}
+	}
+	return false
+}
 
-	// 由于有兜底机制，这里应该总是成功，但保留检查以防万一
-	if !hasStreetView {
-		logger.Error("streetview_fallback_failed", "Critical error: fallback mechanism failed", nil, map[string]interface{}{
-			"original_lat": lat,
-			"original_lng": lng,
+// buildRandomLocation 生成一个有街景并完成地理编码的随机位置，不保存到仓库
+// 找到的全景不在拍摄日期范围内时换一个随机坐标重新搜索；离线模式的合成全景没有拍摄日期，不按日期筛选
+// 附近找不到符合条件的街景时返回 ErrNoStreetView，由调用方决定是否使用已发现的位置或兜底全景
+func (ls *LocationService) buildRandomLocation(ctx context.Context, regions []models.Region, dates models.CaptureDateRange, language string, sessionID string) (models.Location, error) {
+	logger := utils.LocationLogger()
+
+	// 生成随机坐标，逐步扩大半径搜索街景
+	var lat, lng float64
+	var pano *Panorama
+	for attempt := 1; attempt <= captureDateMaxAttempts; attempt++ {
+		lat, lng = utils.GenerateRandomCoordinate(regions)
+		pano = ls.streetView.FindStreetView(ctx, lat, lng, regions != nil)
+		if pano == nil || ls.offline || dates.Contains(pano.Date) {
+			break
+		}
+		logger.Info("streetview_date_rejected", "Panorama capture date outside requested range", map[string]interface{}{
+			"pano_id":      pano.PanoID,
+			"capture_date": pano.Date,
+			"date_from":    dates.From,
+			"date_to":      dates.To,
+			"attempt":      attempt,
 			"session_id":   sessionID,
 		})
-		return models.Location{}, fmt.Errorf("严重错误：即使使用兜底机制也无法找到街景")
+		pano = nil
 	}
 
-	// 获取位置信息
-	locationInfo, err := ls.maps.GetLocationInfo(ctx, validLat, validLng, language)
+	if pano == nil {
+		if ctx.Err() != nil {
+			return models.Location{}, fmt.Errorf("街景搜索已取消: %w", ctx.Err())
+		}
+		return models.Location{}, models.Classify(models.ErrNoStreetView, fmt.Errorf("附近找不到符合条件的街景"))
+	}
+	return ls.panoramaLocation(ctx, pano, lat, lng, language, sessionID)
+}
+
+// fallbackLocation 使用兜底全景列表中的位置，不保存到仓库
+func (ls *LocationService) fallbackLocation(ctx context.Context, regions []models.Region, dates models.CaptureDateRange, language string, sessionID string) (models.Location, error) {
+	pano, err := ls.maps.FallbackPanorama(ctx, regions, dates)
+	if err != nil {
+		utils.LocationLogger().Error("streetview_fallback_failed", "Critical error: fallback mechanism failed", err, map[string]interface{}{
+			"session_id": sessionID,
+		})
+		return models.Location{}, err
+	}
+	return ls.panoramaLocation(ctx, pano, pano.Latitude, pano.Longitude, language, sessionID)
+}
+
+// panoramaLocation 为找到的全景获取地址并创建位置记录，lat/lng 为最初搜索的坐标，只用于日志
+func (ls *LocationService) panoramaLocation(ctx context.Context, pano *Panorama, lat, lng float64, language string, sessionID string) (models.Location, error) {
+	logger := utils.LocationLogger()
+	validLat, validLng := pano.Latitude, pano.Longitude
+
+	// 获取位置信息，Google Geocoding 失败时使用离线地理编码
+	geocode, err := ls.locationInfo(ctx, validLat, validLng, language)
 	if err != nil {
 		logger.Error("geocoding_failed", "Failed to get location info", err, map[string]interface{}{
 			"latitude":   validLat,
@@ -92,25 +298,20 @@ func (ls *LocationService) generateRandomLocation(regions []models.Region, langu
 		return models.Location{}, fmt.Errorf("获取位置信息失败: %w", err)
 	}
 
-	// 创建位置记录
+	// 创建位置记录，国家和城市取所有结果合并后的地址层级
+	address := geocode.Address()
 	location := models.Location{
-		PanoID:           panoId,
+		PanoID:           pano.PanoID,
+		CaptureDate:      pano.Date,
+		Copyright:        pano.Copyright,
 		Latitude:         validLat,
 		Longitude:        validLng,
-		Country:          locationInfo["country"],
-		City:             locationInfo["city"],
-		FormattedAddress: locationInfo["formatted_address"],
+		Country:          address.Country,
+		City:             address.City,
+		FormattedAddress: geocode.FormattedAddress(),
+		Geocode:          geocode,
 		CreatedAt:        time.Now(),
-		IsMock:           false,
-	}
-
-	// 保存位置记录
-	if err := ls.repo.SaveLocation(location); err != nil {
-		logger.Error("save_location_failed", "Failed to save location record", err, map[string]interface{}{
-			"pano_id":    panoId,
-			"session_id": sessionID,
-		})
-		return models.Location{}, fmt.Errorf("保存位置记录失败: %w", err)
+		IsMock:           ls.offline,
 	}
 
 	logger.Info("location_generated", "Successfully generated random location", map[string]interface{}{
@@ -125,39 +326,71 @@ func (ls *LocationService) generateRandomLocation(regions []models.Region, langu
 	return location, nil
 }
 
-// SetExplorationPreference 设置用户的探索偏好
-func (ls *LocationService) SetExplorationPreference(sessionID, interest string) error {
+// saveLocation 保存返回给用户的新位置记录
+// 兜底全景和池中的位置经常是已发现的全景，已存在的记录不覆盖，保留其对话历史、访问次数和创建时间
+func (ls *LocationService) saveLocation(ctx context.Context, location models.Location, sessionID string) error {
+	exists, err := ls.repo.LocationExists(ctx, location.PanoID)
+	if err != nil {
+		return fmt.Errorf("检查位置记录失败: %w", err)
+	}
+	if exists {
+		return nil
+	}
+	if err := ls.repo.SaveLocation(ctx, location); err != nil {
+		utils.LocationLogger().Error("save_location_failed", "Failed to save location record", err, map[string]interface{}{
+			"pano_id":    location.PanoID,
+			"session_id": sessionID,
+		})
+		return fmt.Errorf("保存位置记录失败: %w", err)
+	}
+	return nil
+}
+
+// locationInfo 获取坐标的位置信息，离线模式下只使用离线地理编码，离线数据不可用时使用模拟地址
+func (ls *LocationService) locationInfo(ctx context.Context, latitude, longitude float64, language string) (*models.GeocodeResult, error) {
+	if !ls.offline {
+		return ls.maps.ResolveLocationInfo(ctx, latitude, longitude, language)
+	}
+	if info, ok := utils.ReverseGeocodeOffline(latitude, longitude, language); ok {
+		return info, nil
+	}
+	return getDefaultLocationInfo(models.Location{Latitude: latitude, Longitude: longitude}, language), nil
+}
+
+// SetExplorationPreference 设置用户的探索偏好，language 为请求语言，无法生成区域时 AI 的说明使用该语言
+func (ls *LocationService) SetExplorationPreference(ctx context.Context, sessionID, interest, language string) error {
 	// 输入验证
 	if len(interest) < 2 {
-		return fmt.Errorf("探索兴趣太短")
+		return models.NewError(models.ErrInvalidInput, "INTEREST_TOO_SHORT", "探索兴趣太短")
 	}
 	if len(interest) > 50 {
-		return fmt.Errorf("探索兴趣太长")
+		return models.NewError(models.ErrInvalidInput, "INTEREST_TOO_LONG", "探索兴趣太长")
 	}
 
 	// 检查是否包含敏感字符
 	if containsSensitiveChars(interest) {
-		return fmt.Errorf("探索兴趣包含无效字符")
+		return models.NewError(models.ErrInvalidInput, "INTEREST_INVALID_CHARS", "探索兴趣包含无效字符")
 	}
 
 	// 获取用户当前的偏好设置，检查更新频率
-	existingPref, err := ls.repo.GetExplorationPreference(sessionID)
+	existingPref, err := ls.repo.GetExplorationPreference(ctx, sessionID)
 	if err == nil && existingPref != nil {
 		// 只有在已存在偏好设置的情况下才检查更新频率
 		if time.Since(existingPref.LastUsedAt) < 100*time.Millisecond {
-			return fmt.Errorf("请求过于频繁，请稍后再试")
+			return models.NewError(models.ErrRateLimited, "RATE_LIMIT_EXCEEDED", "请求过于频繁，请稍后再试")
 		}
 	}
 
 	// 通过 AI 获取相关区域
-	regions, err := ls.aiService.openAI.GenerateRegionsForInterest(interest)
+	// AI 超时、上游不可用等错误保留原有分类，API 层会优先按这些分类响应
+	regions, err := ls.aiService.openAI.GenerateRegionsForInterest(ctx, interest, language)
 	if err != nil {
-		return fmt.Errorf("无法理解该探索兴趣")
+		return models.Classify(models.ErrInvalidInterest, fmt.Errorf("生成探索区域失败: %w", err))
 	}
 
 	// 验证返回的区域数据
 	if err := validateRegions(regions); err != nil {
-		return fmt.Errorf("无法理解该探索兴趣")
+		return models.Classify(models.ErrInvalidInterest, fmt.Errorf("探索区域无效: %w", err))
 	}
 
 	// 创建探索偏好
@@ -169,7 +402,7 @@ func (ls *LocationService) SetExplorationPreference(sessionID, interest string)
 	}
 
 	// 保存到 Redis
-	if err := ls.repo.SaveExplorationPreference(sessionID, pref); err != nil {
+	if err := ls.repo.SaveExplorationPreference(ctx, sessionID, pref); err != nil {
 		return fmt.Errorf("保存探索偏好失败: %w", err)
 	}
 
@@ -241,6 +474,6 @@ func validateRegions(regions []models.Region) error {
 }
 
 // DeleteExplorationPreference 删除用户的探索偏好
-func (ls *LocationService) DeleteExplorationPreference(sessionID string) error {
-	return ls.repo.DeleteExplorationPreference(sessionID)
+func (ls *LocationService) DeleteExplorationPreference(ctx context.Context, sessionID string) error {
+	return ls.repo.DeleteExplorationPreference(ctx, sessionID)
 }
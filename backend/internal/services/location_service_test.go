@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/repositories"
+)
+
+func TestBuildRandomLocationCaptureDate(t *testing.T) {
+	fake := newFakeGoogle(t)
+	maps := NewMapsServiceWithProvider(newFakeProvider(t, fake))
+	ls := NewLocationService(repositories.NewMemoryRepository(), nil, maps)
+	regions := []models.Region{testRegion(36, 35, 140, 139)}
+
+	// 模拟服务器的全景拍摄于 2023-05
+	newer, _ := models.ParseCaptureDateRange("2019", "")
+	location, err := ls.buildRandomLocation(context.Background(), regions, newer, "en", "")
+	if err != nil {
+		t.Fatalf("应该找到 2019 年以后的街景: %v", err)
+	}
+	if location.CaptureDate != "2023-05" || location.Copyright != "© Google" {
+		t.Errorf("位置应该带有拍摄日期和版权信息: %+v", location)
+	}
+	if location.Geocode == nil || len(location.Geocode.Results) != 3 || location.City != "Testville" || location.Country != "Testland" {
+		t.Errorf("位置应该保存完整的逆地理编码结果: %+v", location)
+	}
+
+	// 太旧的全景换坐标重新搜索，兜底全景也不符合条件时返回 ErrNoStreetView
+	before := len(fake.metadataCalls())
+	newest, _ := models.ParseCaptureDateRange("2024", "")
+	_, err = ls.buildRandomLocation(context.Background(), regions, newest, "en", "")
+	if !errors.Is(err, models.ErrNoStreetView) {
+		t.Errorf("错误应为 ErrNoStreetView，实际为 %v", err)
+	}
+	if calls := len(fake.metadataCalls()) - before; calls < captureDateMaxAttempts {
+		t.Errorf("应该重新搜索 %d 次，实际只请求了 %d 次", captureDateMaxAttempts, calls)
+	}
+}
+
+func TestGetRandomLocationQuotaExhausted(t *testing.T) {
+	fake := newFakeGoogle(t)
+	maps := NewMapsServiceWithProvider(newFakeProvider(t, fake))
+	repo := repositories.NewMemoryRepository()
+	quota := NewQuotaTracker(repositories.NewMemoryRepository(), map[string]QuotaBudget{APIStreetViewMetadata: {Daily: 1}})
+	maps.SetQuota(quota)
+	ls := NewLocationService(repo, nil, maps)
+	ctx := context.Background()
+
+	if err := quota.Acquire(ctx, APIStreetViewMetadata); err != nil {
+		t.Fatalf("预算内的请求不应被拒绝: %v", err)
+	}
+
+	// 没有已发现的位置，内置兜底列表也没有 pano_id 时返回 ErrNoStreetView
+	if _, err := ls.GetRandomLocation(ctx, "", "en", models.CaptureDateRange{}); !errors.Is(err, models.ErrNoStreetView) {
+		t.Errorf("错误应为 ErrNoStreetView，实际为 %v", err)
+	}
+
+	// 有已发现的位置时直接使用，不请求 Google
+	discovered := testDescribedLocation("discovered_pano")
+	discovered.Country = "Japan"
+	if err := repo.SaveLocation(ctx, discovered); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	location, err := ls.GetRandomLocation(ctx, "", "en", models.CaptureDateRange{})
+	if err != nil {
+		t.Fatalf("预算用完时应该使用已发现的位置: %v", err)
+	}
+	if location.PanoID != "discovered_pano" || location.Country != "Japan" {
+		t.Errorf("位置为 %+v，期望 discovered_pano", location)
+	}
+	if calls := len(fake.metadataCalls()) + len(fake.geocodeCalls()); calls != 0 {
+		t.Errorf("预算用完后不应请求 Google，实际请求 %d 次", calls)
+	}
+
+	// 其他语言的请求返回换了地址的副本，不改写保存的位置和国家索引
+	location, err = ls.GetRandomLocation(ctx, "", "ja", models.CaptureDateRange{})
+	if err != nil || location.PanoID != "discovered_pano" || location.Geocode.Language != "ja" {
+		t.Fatalf("应该返回请求语言的地址，实际为 %+v, %v", location, err)
+	}
+	if locations, _ := repo.ListLocationsByCountry(ctx, "Japan", 0, 10); len(locations) != 1 || locations[0].Geocode.Language != "en" {
+		t.Errorf("保存的位置不应被改写: %+v", locations)
+	}
+}
+
+func TestGetRandomLocationGoogleUnavailable(t *testing.T) {
+	provider := &failingProvider{}
+	repo := repositories.NewMemoryRepository()
+	ls := NewLocationService(repo, nil, NewMapsServiceWithProvider(provider))
+	ctx := context.Background()
+
+	// Google 不可用时，内置兜底列表的条目无法查找，使用已发现的位置
+	discovered := testDescribedLocation("discovered_pano")
+	if err := repo.SaveLocation(ctx, discovered); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	location, err := ls.GetRandomLocation(ctx, "", "en", models.CaptureDateRange{})
+	if err != nil {
+		t.Fatalf("Google 不可用时应该使用已发现的位置: %v", err)
+	}
+	if location.PanoID != "discovered_pano" {
+		t.Errorf("位置为 %+v，期望 discovered_pano", location)
+	}
+}
+
+func TestSaveLocationKeepsExistingRecord(t *testing.T) {
+	repo := repositories.NewMemoryRepository()
+	ls := NewLocationService(repo, nil, NewMapsServiceWithProvider(&failingProvider{}))
+	ctx := context.Background()
+
+	existing := testDescribedLocation("fallback_pano")
+	existing.ConversationHistory = `[{"role":"user","content":"describe"}]`
+	if err := repo.SaveLocation(ctx, existing); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+
+	// 兜底全景或池中的位置再次返回时，不覆盖已保存的记录
+	reused := testDescribedLocation("fallback_pano")
+	reused.City = "Reused"
+	if err := ls.saveLocation(ctx, reused, ""); err != nil {
+		t.Fatalf("保存位置失败: %v", err)
+	}
+	stored, err := repo.GetLocationByPanoID(ctx, "fallback_pano")
+	if err != nil {
+		t.Fatalf("读取位置失败: %v", err)
+	}
+	if stored.ConversationHistory != existing.ConversationHistory || stored.City == "Reused" {
+		t.Errorf("已保存的记录不应被覆盖: %+v", stored)
+	}
+}
@@ -2,38 +2,30 @@ package services
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
-	"sync"
+	"time"
 
+	"github.com/my-streetview-project/backend/internal/models"
 	"github.com/my-streetview-project/backend/internal/utils"
-	"googlemaps.github.io/maps"
 )
 
 type MapsService struct {
-	client          *maps.Client
-	apiKey          string
-	httpClient      *http.Client
-	proxyConfigured bool
-	mu              sync.RWMutex
+	provider  StreetViewProvider
+	probeWave int
+	fallbacks *FallbackSet
+	geocodes  *GeocodeCache
+	quota     *QuotaTracker
 }
 
-func NewMapsService(apiKey string) (*MapsService, error) {
+// NewMapsService 创建使用 Google 数据源的 Maps 服务，baseURL 为空时使用 DefaultGoogleMapsBaseURL
+// signingSecret 非空时街景元数据请求带上 URL 签名
+func NewMapsService(apiKey, signingSecret, baseURL string) (*MapsService, error) {
 	logger := utils.MapsLogger()
 
-	// 创建基础的Maps服务实例
-	service := &MapsService{
-		apiKey: apiKey,
-	}
-
 	// 配置HTTP客户端和代理
-	httpClient, proxyConfigured := service.configureHTTPClient()
-	service.httpClient = httpClient
-	service.proxyConfigured = proxyConfigured
+	httpClient, proxyConfigured := newMapsHTTPClient()
 
 	// 如果配置了代理，记录一次日志
 	if proxyConfigured {
@@ -46,84 +38,55 @@ func NewMapsService(apiKey string) (*MapsService, error) {
 		})
 	}
 
-	// 创建Maps客户端选项
-	var opts []maps.ClientOption
-	opts = append(opts, maps.WithAPIKey(apiKey))
-
-	if httpClient != nil {
-		opts = append(opts, maps.WithHTTPClient(httpClient))
-	}
-
-	client, err := maps.NewClient(opts...)
+	provider, err := NewGoogleStreetViewProvider(apiKey, signingSecret, baseURL, httpClient)
 	if err != nil {
-		return nil, fmt.Errorf("创建 Google Maps 客户端失败: %w", err)
+		return nil, err
 	}
-
-	service.client = client
-	return service, nil
+	return NewMapsServiceWithProvider(provider), nil
 }
 
-// configureHTTPClient 配置HTTP客户端和代理设置
-func (s *MapsService) configureHTTPClient() (*http.Client, bool) {
-	// 从环境变量获取代理URL
-	proxyURL := os.Getenv("MAPS_PROXY_URL")
-	if proxyURL == "" {
-		proxyURL = os.Getenv("PROXY_URL")
-	}
-
-	// 如果没有代理配置，返回默认客户端
-	if proxyURL == "" {
-		return &http.Client{}, false
-	}
-
-	proxyType := os.Getenv("PROXY_TYPE")
-	if proxyType == "" {
-		proxyType = "http"
-	}
-
-	proxyUser := os.Getenv("PROXY_USER")
-	proxyPass := os.Getenv("PROXY_PASS")
-
-	// 创建代理URL
-	proxy, err := url.Parse(proxyURL)
-	if err != nil {
-		utils.MapsLogger().Error("proxy_parse_failed", "Failed to parse proxy URL, using direct connection", err, map[string]interface{}{
-			"proxy_url": proxyURL,
-		})
-		return &http.Client{}, false
+// NewMapsServiceWithProvider 使用指定的数据源创建 Maps 服务
+func NewMapsServiceWithProvider(provider StreetViewProvider) *MapsService {
+	return &MapsService{
+		provider:  provider,
+		probeWave: streetViewProbeWave,
+		fallbacks: mustDefaultFallbackSet(),
 	}
+}
 
-	// 如果提供了用户名和密码，添加到代理URL
-	if proxyUser != "" && proxyPass != "" {
-		proxy.User = url.UserPassword(proxyUser, proxyPass)
-	}
+// quotaSetter 支持 Google API 用量统计的数据源
+type quotaSetter interface {
+	SetQuota(quota *QuotaTracker)
+}
 
-	// 创建带有代理的Transport
-	transport := &http.Transport{
-		Proxy: http.ProxyURL(proxy),
+// SetQuota 设置 Google API 用量统计，多个 MapsService 共用同一个统计以共享预算
+func (s *MapsService) SetQuota(quota *QuotaTracker) {
+	s.quota = quota
+	if provider, ok := s.provider.(quotaSetter); ok {
+		provider.SetQuota(quota)
 	}
+}
 
-	httpClient := &http.Client{
-		Transport: transport,
+// StreetViewImage 请求数据源的街景图片，数据源不支持图片时返回 models.ErrNoStreetView 分类的错误
+func (s *MapsService) StreetViewImage(ctx context.Context, req StreetViewImageRequest, maxBytes int64) (*StreetViewImage, error) {
+	source, ok := s.provider.(StreetViewImageSource)
+	if !ok {
+		return nil, models.Classify(models.ErrNoStreetView, errors.New("街景数据源不支持图片"))
 	}
-
-	return httpClient, true
+	return source.StreetViewImage(ctx, req, maxBytes)
 }
 
-// getHTTPClient 获取配置好的HTTP客户端
-func (s *MapsService) getHTTPClient() *http.Client {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	if s.httpClient != nil {
-		return s.httpClient
-	}
-	return &http.Client{}
+// StreetViewExhausted 判断街景元数据预算是否已用完，用完后不再搜索街景，由调用方降级
+func (s *MapsService) StreetViewExhausted(ctx context.Context) bool {
+	return s.quota.Exhausted(ctx, APIStreetViewMetadata)
 }
 
-// 检查坐标是否有街景可用，并返回街景坐标
-// 使用兜底措施确保总是能找到可用的街景
-func (s *MapsService) HasStreetView(ctx context.Context, latitude, longitude float64, hasInterest bool) (bool, float64, float64, string) {
+// streetViewProbeWave 每一轮并发探测的半径数量
+const streetViewProbeWave = 3
+
+// FindStreetView 查找坐标附近可用的街景，返回全景 ID、街景坐标、拍摄日期和版权信息
+// 逐步扩大搜索半径直到不限半径，全部失败时返回 nil，由调用方使用 FallbackPanorama
+func (s *MapsService) FindStreetView(ctx context.Context, latitude, longitude float64, hasInterest bool) *Panorama {
 	// 定义搜索半径序列，包含兜底措施
 	var searchRadii []int
 	if hasInterest {
@@ -131,229 +94,140 @@ func (s *MapsService) HasStreetView(ctx context.Context, latitude, longitude flo
 	} else {
 		searchRadii = []int{10000, 50000, 200000, 1000000, 5000000} // 10km, 50km, 200km, 1000km, 5000km
 	}
+	// 最后的大半径作为兜底；如果所有半径都失败了，最后去除半径限制再试一次
+	searchRadii = append(searchRadii, 0)
 
-	// 逐步增加搜索半径，最后的大半径作为兜底
-	for _, radius := range searchRadii {
-		streetViewURL := fmt.Sprintf(
-			"https://maps.googleapis.com/maps/api/streetview/metadata"+
-				"?location=%.6f,%.6f"+
-				"&source=outdoor"+ // 只搜索户外街景
-				"&radius=%d"+ // 搜索半径（单位：米）
-				"&key=%s", // 添加 API Key
-			latitude, longitude,
-			radius,
-			s.apiKey,
-		)
-
-		// 创建请求
-		req, err := http.NewRequestWithContext(ctx, "GET", streetViewURL, nil)
-		if err != nil {
-			continue
-		}
-
-		// 使用预配置的HTTP客户端
-		client := s.getHTTPClient()
-
-		// 发送请求
-		resp, err := client.Do(req)
-		if err != nil {
-			continue
-		}
-		defer resp.Body.Close()
+	// 元数据预算用完时不再探测，直接由调用方使用兜底全景
+	if s.StreetViewExhausted(ctx) {
+		utils.MapsLogger().Info("streetview_quota_degraded", "Street View metadata budget exhausted, skipping search", map[string]interface{}{
+			"latitude":  latitude,
+			"longitude": longitude,
+		})
+		return nil
+	}
 
-		// 读取完整的响应体
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			continue
+	// 按轮并发探测，每轮中半径最小的成功结果胜出，后面的轮次只在前一轮全部失败时才发出
+	for start := 0; start < len(searchRadii); start += s.probeWave {
+		// 请求已取消或超时，不再继续消耗配额
+		if ctx.Err() != nil {
+			return nil
 		}
 
-		// 解析响应
-		var result struct {
-			Status   string `json:"status"`
-			Location struct {
-				Lat float64 `json:"lat"`
-				Lng float64 `json:"lng"`
-			} `json:"location"`
-			Copyright string `json:"copyright"`
-			Date      string `json:"date"`
-			PanoId    string `json:"pano_id"`
+		end := start + s.probeWave
+		if end > len(searchRadii) {
+			end = len(searchRadii)
 		}
-		if err := json.Unmarshal(body, &result); err != nil {
-			continue
-		}
-
-		if result.Status == "OK" {
-			return true, result.Location.Lat, result.Location.Lng, result.PanoId
+		if pano := s.probeRadii(ctx, latitude, longitude, searchRadii[start:end]); pano != nil {
+			return pano
 		}
 	}
 
-	// 如果所有半径都失败了，尝试最后的兜底策略：去除坐标限制
-	fallbackURL := fmt.Sprintf(
-		"https://maps.googleapis.com/maps/api/streetview/metadata"+
-			"?location=%.6f,%.6f"+
-			"&source=outdoor"+
-			"&key=%s", // 不设置半径限制
-		latitude, longitude,
-		s.apiKey,
-	)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", fallbackURL, nil)
-	if err == nil {
-		client := s.getHTTPClient()
-
-		resp, err := client.Do(req)
-		if err == nil {
-			defer resp.Body.Close()
-			body, err := io.ReadAll(resp.Body)
-			if err == nil {
-				var result struct {
-					Status   string `json:"status"`
-					Location struct {
-						Lat float64 `json:"lat"`
-						Lng float64 `json:"lng"`
-					} `json:"location"`
-					PanoId string `json:"pano_id"`
-				}
-				if json.Unmarshal(body, &result) == nil && result.Status == "OK" {
-					return true, result.Location.Lat, result.Location.Lng, result.PanoId
-				}
-			}
-		}
+	if ctx.Err() != nil {
+		return nil
 	}
 
-	// 如果真的都失败了，记录严重错误但返回一个默认位置（这种情况极少发生）
-	logger := utils.MapsLogger()
-	logger.Error("streetview_complete_failure", "All street view searches failed, using default location", nil, map[string]interface{}{
+	// 如果真的都失败了，记录严重错误（这种情况极少发生，通常是 Google 不可用）
+	utils.MapsLogger().Error("streetview_complete_failure", "All street view searches failed", nil, map[string]interface{}{
 		"coords": fmt.Sprintf("(%.6f,%.6f)", latitude, longitude),
 	})
-	// 返回纽约时代广场作为默认位置（有街景保证）
-	return true, 40.758896, -73.985130, "default-location"
+	return nil
 }
 
-func (s *MapsService) GetLocationInfo(ctx context.Context, latitude, longitude float64, language string) (map[string]string, error) {
-	// 创建 Geocoding 请求
-	req := &maps.GeocodingRequest{
-		LatLng: &maps.LatLng{
-			Lat: latitude,
-			Lng: longitude,
-		},
-	}
+// probeResult 一次半径探测的结果
+type probeResult struct {
+	index int
+	pano  *Panorama
+}
 
-	// Set language if provided, otherwise Google will use its default or infer
-	if language != "" {
-		req.Language = language
+// probeRadii 并发探测一组从小到大排列的半径，返回半径最小的成功结果，全部失败时返回 nil
+// 一旦某个半径成功且比它小的半径都已失败，就取消其余仍在进行的探测
+func (s *MapsService) probeRadii(ctx context.Context, latitude, longitude float64, radii []int) *Panorama {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 带缓冲，被取消的探测不会阻塞
+	results := make(chan probeResult, len(radii))
+	for i, radius := range radii {
+		go func(i, radius int) {
+			results <- probeResult{index: i, pano: s.probe(ctx, latitude, longitude, radius)}
+		}(i, radius)
+	}
+
+	panos := make([]*Panorama, len(radii))
+	finished := make([]bool, len(radii))
+	for range radii {
+		result := <-results
+		panos[result.index], finished[result.index] = result.pano, true
+
+		// 从最小的半径开始，遇到还没完成的探测就继续等待
+		for i := range radii {
+			if !finished[i] {
+				break
+			}
+			if panos[i] != nil {
+				return panos[i]
+			}
+		}
 	}
+	return nil
+}
 
-	// 发送请求
-	resp, err := s.client.ReverseGeocode(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("Geocoding API 请求失败: %w", err)
-	}
+// probe 探测一个半径并记录耗时，失败时返回 nil
+func (s *MapsService) probe(ctx context.Context, latitude, longitude float64, radius int) *Panorama {
+	startTime := time.Now()
+	pano, err := s.provider.NearestPanorama(ctx, latitude, longitude, radius)
+
+	fields := map[string]interface{}{
+		"coords":   fmt.Sprintf("(%.6f,%.6f)", latitude, longitude),
+		"radius":   radius,
+		"duration": time.Since(startTime).String(),
+	}
+	switch {
+	case err == nil:
+		fields["pano_id"] = pano.PanoID
+		utils.MapsLogger().Info("streetview_probe", "Street view probe found a panorama", fields)
+	case ctx.Err() != nil:
+		utils.MapsLogger().Info("streetview_probe_cancelled", "Street view probe cancelled", fields)
+	case errors.Is(err, models.ErrNoStreetView):
+		utils.MapsLogger().Info("streetview_probe", "Street view probe found no panorama", fields)
+	default:
+		utils.MapsLogger().Error("streetview_probe_failed", "Street view probe failed", err, fields)
+	}
+	return pano
+}
 
-	// 如果没有结果，返回错误
-	if len(resp) == 0 {
-		return nil, fmt.Errorf("未找到位置信息")
+// GetLocationInfo 通过数据源逆地理编码坐标，设置了缓存时优先使用缓存的结果
+func (s *MapsService) GetLocationInfo(ctx context.Context, latitude, longitude float64, language string) (*models.GeocodeResult, error) {
+	if s.geocodes == nil {
+		return s.provider.ReverseGeocode(ctx, latitude, longitude, language)
 	}
+	return s.geocodes.Lookup(ctx, latitude, longitude, language, func(ctx context.Context) (*models.GeocodeResult, error) {
+		return s.provider.ReverseGeocode(ctx, latitude, longitude, language)
+	})
+}
 
-	// 提取位置信息
-	result := make(map[string]string)
-	result["formatted_address"] = resp[0].FormattedAddress
+// SetGeocodeCache 设置逆地理编码缓存，多个 MapsService 可以共用同一个缓存
+func (s *MapsService) SetGeocodeCache(cache *GeocodeCache) {
+	s.geocodes = cache
+}
 
-	// 提取详细的地址组件信息
-	for _, component := range resp[0].AddressComponents {
-		for _, t := range component.Types {
-			switch t {
-			case "street_number":
-				result["street_number"] = component.LongName
-			case "route":
-				result["route"] = component.LongName
-			case "intersection":
-				result["intersection"] = component.LongName
-			case "political":
-				result["political"] = component.LongName
-			case "country":
-				result["country"] = component.LongName
-				result["country_code"] = component.ShortName
-			case "administrative_area_level_1":
-				result["state_province"] = component.LongName
-				result["state_province_code"] = component.ShortName
-			case "administrative_area_level_2":
-				result["county_district"] = component.LongName
-			case "administrative_area_level_3":
-				result["subdistrict"] = component.LongName
-			case "administrative_area_level_4":
-				result["neighborhood"] = component.LongName
-			case "administrative_area_level_5":
-				result["subneighborhood"] = component.LongName
-			case "locality":
-				result["city"] = component.LongName
-			case "sublocality":
-				result["sublocality"] = component.LongName
-			case "sublocality_level_1":
-				result["sublocality_level_1"] = component.LongName
-			case "sublocality_level_2":
-				result["sublocality_level_2"] = component.LongName
-			case "sublocality_level_3":
-				result["sublocality_level_3"] = component.LongName
-			case "colloquial_area":
-				result["colloquial_area"] = component.LongName
-			case "floor":
-				result["floor"] = component.LongName
-			case "room":
-				result["room"] = component.LongName
-			case "postal_code":
-				result["postal_code"] = component.LongName
-			case "postal_code_suffix":
-				result["postal_code_suffix"] = component.LongName
-			case "postal_town":
-				result["postal_town"] = component.LongName
-			case "premise":
-				result["premise"] = component.LongName
-			case "subpremise":
-				result["subpremise"] = component.LongName
-			case "plus_code":
-				result["plus_code"] = component.LongName
-			case "establishment":
-				result["establishment"] = component.LongName
-			case "point_of_interest":
-				result["point_of_interest"] = component.LongName
-			case "park":
-				result["park"] = component.LongName
-			case "natural_feature":
-				result["natural_feature"] = component.LongName
-			case "airport":
-				result["airport"] = component.LongName
-			case "university":
-				result["university"] = component.LongName
-			case "school":
-				result["school"] = component.LongName
-			case "hospital":
-				result["hospital"] = component.LongName
-			case "pharmacy":
-				result["pharmacy"] = component.LongName
-			case "church":
-				result["church"] = component.LongName
-			case "finance":
-				result["finance"] = component.LongName
-			case "post_box":
-				result["post_box"] = component.LongName
-			case "bus_station":
-				result["bus_station"] = component.LongName
-			case "train_station":
-				result["train_station"] = component.LongName
-			case "transit_station":
-				result["transit_station"] = component.LongName
-			}
-		}
+// ResolveLocationInfo 获取坐标的位置信息，Google Geocoding 失败时回退到基于 Natural Earth 数据的离线地理编码
+// 离线结果只包含国家和州/省；离线也无法解析时返回 Google 的错误
+func (s *MapsService) ResolveLocationInfo(ctx context.Context, latitude, longitude float64, language string) (*models.GeocodeResult, error) {
+	info, err := s.GetLocationInfo(ctx, latitude, longitude, language)
+	if err == nil || ctx.Err() != nil {
+		return info, err
 	}
 
-	// 如果有Plus Code信息，也提取出来
-	if resp[0].PlusCode.GlobalCode != "" {
-		result["plus_code_global"] = resp[0].PlusCode.GlobalCode
+	offline, ok := utils.ReverseGeocodeOffline(latitude, longitude, language)
+	if !ok {
+		return nil, err
 	}
-	if resp[0].PlusCode.CompoundCode != "" {
-		result["plus_code_compound"] = resp[0].PlusCode.CompoundCode
-	}
-
-	return result, nil
+	utils.MapsLogger().Error("geocode_offline_fallback", "Google geocoding failed, using offline geocoder", err, map[string]interface{}{
+		"latitude":  latitude,
+		"longitude": longitude,
+		"language":  language,
+		"country":   offline.Address().Country,
+	})
+	return offline, nil
 }
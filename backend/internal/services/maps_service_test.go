@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+// metadataRadii 返回模拟服务器收到的所有 radius 参数，按数值排序，不限半径排在最后
+func metadataRadii(f *fakeGoogle) []string {
+	var radii []string
+	for _, query := range f.metadataCalls() {
+		radii = append(radii, query.Get("radius"))
+	}
+	sort.Slice(radii, func(i, j int) bool {
+		if radii[i] == "" || radii[j] == "" {
+			return radii[j] == ""
+		}
+		return len(radii[i]) < len(radii[j]) || len(radii[i]) == len(radii[j]) && radii[i] < radii[j]
+	})
+	return radii
+}
+
+func TestFindStreetViewSmallestRadiusWins(t *testing.T) {
+	fake := newFakeGoogle(t)
+	fake.setMetadataByRadius(map[string]fakeResponse{
+		"100":   {status: "ZERO_RESULTS"},
+		"5000":  {status: "OK", delay: 50 * time.Millisecond},
+		"50000": {status: "OK"},
+	})
+	maps := NewMapsServiceWithProvider(newFakeProvider(t, fake))
+
+	// 50km 的探测先返回，但 5km 的结果胜出
+	pano := maps.FindStreetView(context.Background(), 10, 20, true)
+	if pano == nil || pano.PanoID != "fake_pano_5000" || pano.Latitude != 10 || pano.Longitude != 20 {
+		t.Fatalf("应该使用 5km 的结果，实际为 %+v", pano)
+	}
+	if pano.Date != "2023-05" || pano.Copyright != "© Google" {
+		t.Errorf("应该带有拍摄日期和版权信息，实际为 %+v", pano)
+	}
+
+	// 第一轮有结果，不发出第二轮
+	radii := metadataRadii(fake)
+	if len(radii) != 3 || radii[0] != "100" || radii[1] != "5000" || radii[2] != "50000" {
+		t.Errorf("只应该探测第一轮的半径，实际为 %v", radii)
+	}
+}
+
+func TestFindStreetViewCancelsLargerRadii(t *testing.T) {
+	fake := newFakeGoogle(t)
+	fake.setMetadataByRadius(map[string]fakeResponse{
+		"100":   {status: "OK"},
+		"5000":  {status: "OK", delay: 5 * time.Second},
+		"50000": {status: "OK", delay: 5 * time.Second},
+	})
+	maps := NewMapsServiceWithProvider(newFakeProvider(t, fake))
+
+	startTime := time.Now()
+	pano := maps.FindStreetView(context.Background(), 10, 20, true)
+	if pano == nil || pano.PanoID != "fake_pano_100" {
+		t.Fatalf("应该使用最小半径的结果，实际为 %+v", pano)
+	}
+	if elapsed := time.Since(startTime); elapsed > time.Second {
+		t.Errorf("最小半径成功后应该取消其余探测，实际耗时 %v", elapsed)
+	}
+}
+
+func TestFindStreetViewProbesInWaves(t *testing.T) {
+	fake := newFakeGoogle(t)
+	delay := 100 * time.Millisecond
+	fake.setMetadataByRadius(map[string]fakeResponse{
+		"10000":   {status: "ZERO_RESULTS", delay: delay},
+		"50000":   {status: "ZERO_RESULTS", delay: delay},
+		"200000":  {status: "ZERO_RESULTS", delay: delay},
+		"1000000": {status: "ZERO_RESULTS", delay: delay},
+		"5000000": {status: "ZERO_RESULTS", delay: delay},
+		"":        {status: "OK", delay: delay},
+	})
+	maps := NewMapsServiceWithProvider(newFakeProvider(t, fake))
+
+	startTime := time.Now()
+	pano := maps.FindStreetView(context.Background(), 10, 20, false)
+	elapsed := time.Since(startTime)
+	if pano == nil || pano.PanoID != "fake_pano_unlimited" {
+		t.Fatalf("应该在不限半径时找到全景，实际为 %+v", pano)
+	}
+
+	radii := metadataRadii(fake)
+	if len(radii) != 6 || radii[5] != "" {
+		t.Errorf("应该探测全部半径并最后不限半径，实际为 %v", radii)
+	}
+	// 两轮并发探测约 2 个 delay，逐个探测需要 6 个 delay
+	if elapsed > 4*delay {
+		t.Errorf("探测应该并发进行，实际耗时 %v", elapsed)
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// syntheticPanoPrefix 合成全景 ID 的前缀，用于和 Google 的全景 ID 区分
+const syntheticPanoPrefix = "offline_"
+
+// streetViewFinder 查找坐标附近可用的街景，找不到时返回 nil
+type streetViewFinder interface {
+	FindStreetView(ctx context.Context, latitude, longitude float64, hasInterest bool) *Panorama
+}
+
+// OfflineStreetView 离线模式的街景查找，不访问 Google，直接把坐标当作街景位置并返回合成的全景 ID
+// 坐标来自 utils.GenerateRandomCoordinate，已经保证在陆地上
+type OfflineStreetView struct{}
+
+// FindStreetView 返回坐标本身和由坐标确定的合成全景 ID，合成全景没有拍摄日期和版权信息
+func (OfflineStreetView) FindStreetView(ctx context.Context, latitude, longitude float64, hasInterest bool) *Panorama {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return &Panorama{PanoID: SyntheticPanoID(latitude, longitude), Latitude: latitude, Longitude: longitude}
+}
+
+// SyntheticPanoID 根据坐标生成确定的全景 ID，同一坐标（精确到 6 位小数）总是得到同一个 ID
+func SyntheticPanoID(latitude, longitude float64) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%.6f,%.6f", latitude, longitude)))
+	return syntheticPanoPrefix + hex.EncodeToString(sum[:10])
+}
+
+// isSyntheticPanoID 判断全景 ID 是否为离线模式生成的合成 ID
+func isSyntheticPanoID(panoID string) bool {
+	return strings.HasPrefix(panoID, syntheticPanoPrefix)
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/repositories"
+)
+
+func TestOfflineStreetView(t *testing.T) {
+	var finder streetViewFinder = OfflineStreetView{}
+
+	pano := finder.FindStreetView(context.Background(), 35.6595, 139.7006, false)
+	if pano == nil {
+		t.Fatal("离线模式应该总是返回全景")
+	}
+	if pano.Latitude != 35.6595 || pano.Longitude != 139.7006 || pano.Date != "" {
+		t.Errorf("合成全景应该位于请求的坐标且没有拍摄日期: %+v", pano)
+	}
+	if !isSyntheticPanoID(pano.PanoID) || pano.PanoID != SyntheticPanoID(35.6595, 139.7006) {
+		t.Errorf("全景 ID 应为由坐标确定的合成 ID，实际为 %q", pano.PanoID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if pano := finder.FindStreetView(ctx, 35.6595, 139.7006, false); pano != nil {
+		t.Errorf("context 已取消时应该返回 nil，实际为 %+v", pano)
+	}
+}
+
+func TestSyntheticPanoID(t *testing.T) {
+	id := SyntheticPanoID(35.6595, 139.7006)
+	if SyntheticPanoID(35.65950004, 139.70059996) != id {
+		t.Error("精确到 6 位小数相同的坐标应该得到同一个 ID")
+	}
+	if SyntheticPanoID(35.6596, 139.7006) == id {
+		t.Error("不同坐标应该得到不同的 ID")
+	}
+
+	tests := []struct {
+		panoID string
+		want   bool
+	}{
+		{id, true},
+		{"CAoSLEFGMVFpcE1", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isSyntheticPanoID(tt.panoID); got != tt.want {
+			t.Errorf("isSyntheticPanoID(%q) = %v，期望 %v", tt.panoID, got, tt.want)
+		}
+	}
+}
+
+func TestStreetViewImageSkipsSyntheticPano(t *testing.T) {
+	fake := newFakeGoogle(t)
+	images := NewStreetViewImageService(newFakeProvider(t, fake), repositories.NewMemoryRepository(), time.Hour, 1024)
+	req := StreetViewImageRequest{PanoID: SyntheticPanoID(1, 2), FOV: 90, Width: 640, Height: 400}
+
+	if _, err := images.Get(context.Background(), req); !errors.Is(err, models.ErrNoStreetView) {
+		t.Errorf("合成全景的错误应为 ErrNoStreetView，实际为 %v", err)
+	}
+	if got := len(fake.imageCalls()); got != 0 {
+		t.Errorf("合成全景不应请求 Google，实际请求 %d 次", got)
+	}
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/repositories"
+	"github.com/my-streetview-project/backend/internal/utils"
+)
+
+// 计费的 Google API
+const (
+	APIStreetViewMetadata = "streetview_metadata"
+	APIGeocode            = "geocode"
+	APIStreetViewImage    = "streetview_image" // Street View Static API 图片
+)
+
+// quotaAPIs 用量报告中的接口顺序
+var quotaAPIs = []string{APIStreetViewMetadata, APIGeocode, APIStreetViewImage}
+
+const (
+	// 统计窗口的计数在窗口结束后再保留一段时间，超过后由仓库删除
+	quotaDayTTL   = 48 * time.Hour
+	quotaMonthTTL = 62 * 24 * time.Hour
+)
+
+// QuotaBudget 一个接口的每日和每月请求预算，0 表示不限制
+type QuotaBudget struct {
+	Daily   int64 `json:"daily"`
+	Monthly int64 `json:"monthly"`
+}
+
+// APIUsage 一个接口在当前窗口内的用量
+type APIUsage struct {
+	API       string      `json:"api"`
+	Day       string      `json:"day"`   // 统计日，UTC，例如 2024-05-01
+	Month     string      `json:"month"` // 统计月，UTC，例如 2024-05
+	Daily     int64       `json:"daily"`
+	Monthly   int64       `json:"monthly"`
+	Budget    QuotaBudget `json:"budget"`
+	Exhausted bool        `json:"exhausted"` // 每日或每月预算已用完，处于降级模式
+}
+
+// QuotaTracker 按 UTC 日和月统计 Google API 请求次数，计数保存在仓库中，多个实例共用同一个预算
+// 预算用完后拒绝新的请求，由调用方降级到位置池、兜底全景、缓存或离线地理编码
+type QuotaTracker struct {
+	repo    repositories.Repository
+	budgets map[string]QuotaBudget
+	now     func() time.Time
+
+	mu        sync.Mutex
+	exhausted map[string]bool // 已记录过预算用完日志的窗口
+}
+
+// NewQuotaTracker 创建用量统计，budgets 中没有的接口不限制预算
+func NewQuotaTracker(repo repositories.Repository, budgets map[string]QuotaBudget) *QuotaTracker {
+	return &QuotaTracker{
+		repo:      repo,
+		budgets:   budgets,
+		now:       time.Now,
+		exhausted: make(map[string]bool),
+	}
+}
+
+// quotaWindows 返回某一时刻所在的统计日和统计月
+func quotaWindows(t time.Time) (day, month string) {
+	t = t.UTC()
+	return t.Format("2006-01-02"), t.Format("2006-01")
+}
+
+func quotaDayKey(api, day string) string {
+	return fmt.Sprintf("%s:day:%s", api, day)
+}
+
+func quotaMonthKey(api, month string) string {
+	return fmt.Sprintf("%s:month:%s", api, month)
+}
+
+// Acquire 在发出一次请求前调用：先计数加一，新的计数超出预算时撤销这次计数并返回 models.ErrQuotaExhausted 分类的错误
+// 计数加一是原子操作，并发的请求不会一起越过预算；仓库不可用时不阻止请求；tracker 为 nil 时不统计
+func (q *QuotaTracker) Acquire(ctx context.Context, api string) error {
+	if q == nil {
+		return nil
+	}
+	logger := utils.MapsLogger()
+
+	day, month := quotaWindows(q.now())
+	usage := APIUsage{API: api, Day: day, Month: month, Budget: q.budgets[api]}
+	dayKey, monthKey := quotaDayKey(api, day), quotaMonthKey(api, month)
+
+	dayCounted, monthCounted := true, true
+	var err error
+	if usage.Daily, err = q.repo.IncrementUsage(ctx, dayKey, quotaDayTTL); err != nil {
+		dayCounted = false
+		logger.Error("quota_increment_failed", "Failed to count Google API usage", err, map[string]interface{}{
+			"api": api,
+		})
+	}
+	if usage.Monthly, err = q.repo.IncrementUsage(ctx, monthKey, quotaMonthTTL); err != nil {
+		monthCounted = false
+		logger.Error("quota_increment_failed", "Failed to count Google API usage", err, map[string]interface{}{
+			"api": api,
+		})
+	}
+
+	if (usage.Budget.Daily <= 0 || usage.Daily <= usage.Budget.Daily) &&
+		(usage.Budget.Monthly <= 0 || usage.Monthly <= usage.Budget.Monthly) {
+		return nil
+	}
+
+	// 超出预算的请求不会发出，撤销这次计数，用量报告中的计数不超过预算
+	if dayCounted {
+		q.rollback(ctx, dayKey)
+		usage.Daily--
+	}
+	if monthCounted {
+		q.rollback(ctx, monthKey)
+		usage.Monthly--
+	}
+	usage.Exhausted = true
+	q.logExhausted(usage)
+	return models.Classify(models.ErrQuotaExhausted, fmt.Errorf("%s 的 Google API 预算已用完 (今日 %d/%d，本月 %d/%d)",
+		api, usage.Daily, usage.Budget.Daily, usage.Monthly, usage.Budget.Monthly))
+}
+
+// rollback 撤销一次计数，失败时只记录日志，计数最多多算一次
+func (q *QuotaTracker) rollback(ctx context.Context, key string) {
+	if err := q.repo.DecrementUsage(ctx, key); err != nil {
+		utils.MapsLogger().Error("quota_rollback_failed", "Failed to roll back Google API usage", err, map[string]interface{}{
+			"key": key,
+		})
+	}
+}
+
+// Exhausted 判断接口的预算是否已用完，tracker 为 nil 时始终返回 false
+func (q *QuotaTracker) Exhausted(ctx context.Context, api string) bool {
+	if q == nil {
+		return false
+	}
+	return q.usage(ctx, api).Exhausted
+}
+
+// Usage 返回所有计费接口在当前窗口内的用量，tracker 为 nil 时返回 nil
+func (q *QuotaTracker) Usage(ctx context.Context) []APIUsage {
+	if q == nil {
+		return nil
+	}
+	usages := make([]APIUsage, 0, len(quotaAPIs))
+	for _, api := range quotaAPIs {
+		usages = append(usages, q.usage(ctx, api))
+	}
+	return usages
+}
+
+// usage 读取接口在当前窗口内的计数，读取失败时按 0 处理
+func (q *QuotaTracker) usage(ctx context.Context, api string) APIUsage {
+	day, month := quotaWindows(q.now())
+	usage := APIUsage{API: api, Day: day, Month: month, Budget: q.budgets[api]}
+
+	var err error
+	if usage.Daily, err = q.repo.GetUsage(ctx, quotaDayKey(api, day)); err != nil {
+		utils.MapsLogger().Error("quota_read_failed", "Failed to read Google API usage", err, map[string]interface{}{
+			"api": api,
+		})
+	}
+	if usage.Monthly, err = q.repo.GetUsage(ctx, quotaMonthKey(api, month)); err != nil {
+		utils.MapsLogger().Error("quota_read_failed", "Failed to read Google API usage", err, map[string]interface{}{
+			"api": api,
+		})
+	}
+
+	usage.Exhausted = (usage.Budget.Daily > 0 && usage.Daily >= usage.Budget.Daily) ||
+		(usage.Budget.Monthly > 0 && usage.Monthly >= usage.Budget.Monthly)
+	return usage
+}
+
+// logExhausted 每个接口在每个统计日只记录一次预算用完的日志
+func (q *QuotaTracker) logExhausted(usage APIUsage) {
+	key := quotaDayKey(usage.API, usage.Day)
+	q.mu.Lock()
+	logged := q.exhausted[key]
+	q.exhausted[key] = true
+	q.mu.Unlock()
+	if logged {
+		return
+	}
+
+	utils.MapsLogger().Error("google_quota_exhausted", "Google API budget exhausted, degrading", nil, map[string]interface{}{
+		"api":            usage.API,
+		"daily":          usage.Daily,
+		"daily_budget":   usage.Budget.Daily,
+		"monthly":        usage.Monthly,
+		"monthly_budget": usage.Budget.Monthly,
+	})
+}
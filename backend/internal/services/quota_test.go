@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/repositories"
+)
+
+func TestQuotaTrackerBudgets(t *testing.T) {
+	quota := NewQuotaTracker(repositories.NewMemoryRepository(), map[string]QuotaBudget{
+		APIStreetViewMetadata: {Daily: 2},
+		APIGeocode:            {Monthly: 1},
+	})
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	quota.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := quota.Acquire(ctx, APIStreetViewMetadata); err != nil {
+			t.Fatalf("预算内的请求不应被拒绝: %v", err)
+		}
+	}
+	if err := quota.Acquire(ctx, APIStreetViewMetadata); !errors.Is(err, models.ErrQuotaExhausted) {
+		t.Errorf("超出每日预算时错误应为 ErrQuotaExhausted，实际为 %v", err)
+	}
+	if err := quota.Acquire(ctx, APIGeocode); err != nil {
+		t.Fatalf("不同接口的预算分别计算: %v", err)
+	}
+
+	usage := quota.Usage(ctx)
+	if len(usage) != 3 || usage[0].API != APIStreetViewMetadata || usage[0].Daily != 2 || usage[0].Monthly != 2 || !usage[0].Exhausted {
+		t.Errorf("元数据用量不正确: %+v", usage)
+	}
+	if usage[0].Day != "2024-05-15" || usage[0].Month != "2024-05" {
+		t.Errorf("统计窗口为 %s / %s，期望 2024-05-15 / 2024-05", usage[0].Day, usage[0].Month)
+	}
+
+	// 第二天每日预算恢复，每月预算在同一个月内仍然用完
+	now = now.Add(24 * time.Hour)
+	if err := quota.Acquire(ctx, APIStreetViewMetadata); err != nil {
+		t.Errorf("新的一天应恢复每日预算: %v", err)
+	}
+	if !quota.Exhausted(ctx, APIGeocode) {
+		t.Error("同一个月内每月预算应保持用完")
+	}
+	now = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	if quota.Exhausted(ctx, APIGeocode) {
+		t.Error("新的一个月应恢复每月预算")
+	}
+
+	var disabled *QuotaTracker
+	if err := disabled.Acquire(ctx, APIGeocode); err != nil || disabled.Exhausted(ctx, APIGeocode) || disabled.Usage(ctx) != nil {
+		t.Error("未设置用量统计时不应限制请求")
+	}
+}
+
+func TestQuotaExhaustedStopsGoogleRequests(t *testing.T) {
+	fake := newFakeGoogle(t)
+	maps, _ := newCachedMapsService(t, fake)
+	maps.SetQuota(NewQuotaTracker(repositories.NewMemoryRepository(), map[string]QuotaBudget{
+		APIStreetViewMetadata: {Daily: 1},
+		APIGeocode:            {Daily: 1},
+	}))
+	ctx := context.Background()
+
+	// 用完元数据预算后不再探测，由调用方使用兜底全景
+	if pano := maps.FindStreetView(ctx, 10, 20, false); pano == nil {
+		t.Fatal("预算内应该找到全景")
+	}
+	calls := len(fake.metadataCalls())
+	if pano := maps.FindStreetView(ctx, 10, 20, false); pano != nil {
+		t.Errorf("预算用完后不应返回全景，实际为 %+v", pano)
+	}
+	if got := len(fake.metadataCalls()); got != calls {
+		t.Errorf("预算用完后不应请求元数据，多请求了 %d 次", got-calls)
+	}
+
+	// 用完 Geocoding 预算后，已缓存的坐标仍可使用，其余坐标不再请求 Google
+	if _, err := maps.GetLocationInfo(ctx, 35.6595, 139.7006, "en"); err != nil {
+		t.Fatalf("预算内的逆地理编码失败: %v", err)
+	}
+	if _, err := maps.GetLocationInfo(ctx, 35.6595, 139.7006, "en"); err != nil {
+		t.Errorf("预算用完后应该仍能命中缓存: %v", err)
+	}
+	if _, err := maps.GetLocationInfo(ctx, 48.8584, 2.2945, "en"); !errors.Is(err, models.ErrQuotaExhausted) {
+		t.Errorf("错误应为 ErrQuotaExhausted，实际为 %v", err)
+	}
+	if got := len(fake.geocodeCalls()); got != 1 {
+		t.Errorf("应该只请求 1 次 Geocoding，实际为 %d 次", got)
+	}
+}
+
+func TestQuotaTrackerConcurrentAcquire(t *testing.T) {
+	quota := NewQuotaTracker(repositories.NewMemoryRepository(), map[string]QuotaBudget{
+		APIStreetViewMetadata: {Daily: 5},
+	})
+	ctx := context.Background()
+
+	// 并发的请求一起越过预算时，只有预算内的请求成功，超出的计数被撤销
+	var wg sync.WaitGroup
+	var acquired atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if quota.Acquire(ctx, APIStreetViewMetadata) == nil {
+				acquired.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := acquired.Load(); got != 5 {
+		t.Errorf("应该有 5 个请求成功，实际为 %d", got)
+	}
+	if usage := quota.Usage(ctx)[0]; usage.Daily != 5 || usage.Monthly != 5 || !usage.Exhausted {
+		t.Errorf("超出预算的计数应该被撤销: %+v", usage)
+	}
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/utils"
+)
+
+// defaultFallbackData 内置的兜底全景列表，可以通过 STREETVIEW_FALLBACK_FILE 替换
+//
+//go:embed fallback_panoramas.json
+var defaultFallbackData []byte
+
+const (
+	// fallbackFileVersion 当前支持的兜底列表文件格式版本
+	fallbackFileVersion = 1
+	// fallbackResolveRadius 兜底条目没有 pano_id 时查找全景的半径（米）
+	fallbackResolveRadius = 50
+	// fallbackMaxResolves 每次兜底最多查找几个没有 pano_id 的条目，避免 Google 不可用时消耗过多配额
+	fallbackMaxResolves = 3
+)
+
+// FallbackPanorama 兜底列表中的一个已知有街景的位置
+// 指定 PanoID 的条目直接使用，不请求上游；PanoID 为空时在首次使用时通过街景元数据查找并缓存，拍摄日期和版权信息也来自查找结果
+type FallbackPanorama struct {
+	Label     string  `json:"label"`
+	PanoID    string  `json:"pano_id,omitempty"`
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lng"`
+	Date      string  `json:"date,omitempty"` // 指定 pano_id 时的拍摄年月，例如 2023-05
+	Copyright string  `json:"copyright,omitempty"`
+}
+
+// fallbackFile 兜底列表文件格式
+type fallbackFile struct {
+	Version   int                `json:"version"`
+	Panoramas []FallbackPanorama `json:"panoramas"`
+}
+
+// FallbackStats 兜底全景的使用统计
+type FallbackStats struct {
+	Version     int   `json:"version"`
+	Panoramas   int   `json:"panoramas"`
+	Used        int64 `json:"used"`        // 使用兜底全景的次数
+	Unavailable int64 `json:"unavailable"` // 兜底列表中也没有可用全景的次数
+}
+
+// FallbackSet 所有半径都找不到街景时使用的兜底全景列表
+type FallbackSet struct {
+	version   int
+	panoramas []FallbackPanorama
+
+	mu       sync.Mutex
+	resolved map[int]*Panorama // 条目下标到查找到的全景
+
+	used        atomic.Int64
+	unavailable atomic.Int64
+}
+
+// ParseFallbackSet 解析 JSON 格式的兜底列表
+func ParseFallbackSet(data []byte) (*FallbackSet, error) {
+	var file fallbackFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析兜底全景列表失败: %w", err)
+	}
+	if file.Version != fallbackFileVersion {
+		return nil, fmt.Errorf("不支持的兜底全景列表版本: %d", file.Version)
+	}
+	if len(file.Panoramas) == 0 {
+		return nil, fmt.Errorf("兜底全景列表为空")
+	}
+	for i, pano := range file.Panoramas {
+		if pano.Latitude < -90 || pano.Latitude > 90 || pano.Longitude < -180 || pano.Longitude > 180 {
+			return nil, fmt.Errorf("兜底全景 %d (%s) 的坐标无效", i, pano.Label)
+		}
+	}
+	return &FallbackSet{
+		version:   file.Version,
+		panoramas: file.Panoramas,
+		resolved:  make(map[int]*Panorama),
+	}, nil
+}
+
+// LoadFallbackSet 从 JSON 文件加载兜底列表，path 为空时使用内置列表
+func LoadFallbackSet(path string) (*FallbackSet, error) {
+	if path == "" {
+		return ParseFallbackSet(defaultFallbackData)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取兜底全景列表失败: %w", err)
+	}
+	return ParseFallbackSet(data)
+}
+
+// mustDefaultFallbackSet 内置列表随程序一起编译，格式错误时直接 panic
+func mustDefaultFallbackSet() *FallbackSet {
+	set, err := LoadFallbackSet("")
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// Stats 返回兜底列表的版本、条目数和使用次数
+func (f *FallbackSet) Stats() FallbackStats {
+	return FallbackStats{
+		Version:     f.version,
+		Panoramas:   len(f.panoramas),
+		Used:        f.used.Load(),
+		Unavailable: f.unavailable.Load(),
+	}
+}
+
+// candidates 返回位于偏好区域内的条目下标，没有区域或区域内没有条目时返回全部条目，顺序随机
+func (f *FallbackSet) candidates(regions []models.Region) ([]int, bool) {
+	var scoped []int
+	for i, pano := range f.panoramas {
+		for _, region := range regions {
+			if regionContains(region, pano.Latitude, pano.Longitude) {
+				scoped = append(scoped, i)
+				break
+			}
+		}
+	}
+
+	if len(scoped) == 0 {
+		return rand.Perm(len(f.panoramas)), false
+	}
+	rand.Shuffle(len(scoped), func(i, j int) { scoped[i], scoped[j] = scoped[j], scoped[i] })
+	return scoped, true
+}
+
+// regionContains 判断坐标是否在区域的边界框内，West 大于 East 时表示跨越 180 度经线
+func regionContains(region models.Region, latitude, longitude float64) bool {
+	c := region.Coordinates
+	if latitude < c.South || latitude > c.North {
+		return false
+	}
+	if c.West <= c.East {
+		return longitude >= c.West && longitude <= c.East
+	}
+	return longitude >= c.West || longitude <= c.East
+}
+
+// pick 随机选择一个拍摄日期在范围内的兜底全景
+// 先在已知全景 ID 的条目（文件中指定 pano_id 或之前查找过）中选择，不请求上游；
+// 都不可用时才通过 resolve 查找没有 pano_id 的条目，resolve 为 nil 时只使用已知全景 ID 的条目
+func (f *FallbackSet) pick(ctx context.Context, regions []models.Region, dates models.CaptureDateRange, resolve func(ctx context.Context, pano FallbackPanorama) (*Panorama, error)) (*Panorama, FallbackPanorama, bool, error) {
+	indexes, scoped := f.candidates(regions)
+
+	var unresolved []int
+	for _, i := range indexes {
+		pano := f.known(i)
+		if pano == nil {
+			unresolved = append(unresolved, i)
+			continue
+		}
+		if dates.Contains(pano.Date) {
+			return pano, f.panoramas[i], scoped, nil
+		}
+	}
+
+	var lastErr error
+	if resolve == nil {
+		unresolved = nil
+	}
+	resolves := 0
+	for _, i := range unresolved {
+		if resolves >= fallbackMaxResolves || ctx.Err() != nil {
+			break
+		}
+		resolves++
+		entry := f.panoramas[i]
+		pano, err := resolve(ctx, entry)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		f.mu.Lock()
+		f.resolved[i] = pano
+		f.mu.Unlock()
+		if !dates.Contains(pano.Date) {
+			continue
+		}
+		return pano, entry, scoped, nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("没有可用的兜底全景")
+	}
+	return nil, FallbackPanorama{}, scoped, lastErr
+}
+
+// known 返回条目已知的全景：文件中指定了 pano_id 或之前已经查找过，否则返回 nil
+func (f *FallbackSet) known(i int) *Panorama {
+	if entry := f.panoramas[i]; entry.PanoID != "" {
+		return &Panorama{
+			PanoID:    entry.PanoID,
+			Latitude:  entry.Latitude,
+			Longitude: entry.Longitude,
+			Date:      entry.Date,
+			Copyright: entry.Copyright,
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.resolved[i]
+}
+
+// Pin 通过街景元数据查找所有没有 pano_id 的条目，把全景 ID、全景坐标、拍摄日期和版权信息写入条目，返回写入的条目数
+// 用于生成随程序发布的兜底列表，发布后使用这些条目不再请求上游；查找失败的条目保持不变，并返回最后一个错误
+func (f *FallbackSet) Pin(ctx context.Context, provider StreetViewProvider) (int, error) {
+	pinned := 0
+	var lastErr error
+	for i, entry := range f.panoramas {
+		if entry.PanoID != "" {
+			continue
+		}
+		pano, err := provider.NearestPanorama(ctx, entry.Latitude, entry.Longitude, fallbackResolveRadius)
+		if err != nil {
+			lastErr = fmt.Errorf("查找兜底全景 %s 失败: %w", entry.Label, err)
+			continue
+		}
+		entry.PanoID = pano.PanoID
+		entry.Latitude = pano.Latitude
+		entry.Longitude = pano.Longitude
+		entry.Date = pano.Date
+		entry.Copyright = pano.Copyright
+		f.panoramas[i] = entry
+		pinned++
+	}
+	return pinned, lastErr
+}
+
+// Encode 按兜底列表文件格式编码，每个条目占一行
+func (f *FallbackSet) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "{\n  \"version\": %d,\n  \"panoramas\": [\n", f.version)
+	for i, entry := range f.panoramas {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("编码兜底全景失败: %w", err)
+		}
+		buf.WriteString("    ")
+		buf.Write(line)
+		if i < len(f.panoramas)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("  ]\n}\n")
+	return buf.Bytes(), nil
+}
+
+// FallbackPanorama 所有半径都找不到街景时，从兜底列表中随机选择一个已知有街景且拍摄日期在范围内的位置
+// 优先选择位于偏好区域内的条目；没有可用条目时返回 ErrNoStreetView，不会返回无效的全景 ID
+func (s *MapsService) FallbackPanorama(ctx context.Context, regions []models.Region, dates models.CaptureDateRange) (*Panorama, error) {
+	logger := utils.MapsLogger()
+
+	// 元数据预算用完时不查找没有 pano_id 的条目
+	resolve := func(ctx context.Context, entry FallbackPanorama) (*Panorama, error) {
+		return s.provider.NearestPanorama(ctx, entry.Latitude, entry.Longitude, fallbackResolveRadius)
+	}
+	if s.StreetViewExhausted(ctx) {
+		resolve = nil
+	}
+
+	pano, entry, scoped, err := s.fallbacks.pick(ctx, regions, dates, resolve)
+	if err != nil {
+		s.fallbacks.unavailable.Add(1)
+		logger.Error("streetview_fallback_unavailable", "No fallback panorama available", err, map[string]interface{}{
+			"version": s.fallbacks.version,
+			"scoped":  scoped,
+		})
+		return nil, models.Classify(models.ErrNoStreetView, fmt.Errorf("兜底全景不可用: %w", err))
+	}
+
+	s.fallbacks.used.Add(1)
+	logger.Info("streetview_fallback_used", "Using fallback panorama", map[string]interface{}{
+		"pano_id": pano.PanoID,
+		"label":   entry.Label,
+		"version": s.fallbacks.version,
+		"scoped":  scoped,
+		"total":   s.fallbacks.used.Load(),
+	})
+	return pano, nil
+}
+
+// SetFallbacks 替换兜底全景列表
+func (s *MapsService) SetFallbacks(fallbacks *FallbackSet) {
+	s.fallbacks = fallbacks
+}
+
+// FallbackStats 返回兜底全景的使用统计
+func (s *MapsService) FallbackStats() FallbackStats {
+	return s.fallbacks.Stats()
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/my-streetview-project/backend/internal/models"
+)
+
+const testFallbackData = `{
+  "version": 1,
+  "panoramas": [
+    {"label": "Pinned", "pano_id": "pinned_pano", "lat": 10, "lng": 20},
+    {"label": "Tokyo", "lat": 35.659487, "lng": 139.700553},
+    {"label": "Auckland", "lat": -36.8485, "lng": 174.7649}
+  ]
+}`
+
+func TestParseFallbackSet(t *testing.T) {
+	if _, err := LoadFallbackSet(""); err != nil {
+		t.Fatalf("内置兜底列表应该有效: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"格式错误", `{"version": 1, "panoramas": [`},
+		{"不支持的版本", `{"version": 2, "panoramas": [{"lat": 1, "lng": 2}]}`},
+		{"列表为空", `{"version": 1, "panoramas": []}`},
+		{"坐标无效", `{"version": 1, "panoramas": [{"lat": 91, "lng": 2}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseFallbackSet([]byte(tt.data)); err == nil {
+				t.Error("应该返回错误")
+			}
+		})
+	}
+}
+
+func testRegion(north, south, east, west float64) models.Region {
+	var region models.Region
+	region.Coordinates.North, region.Coordinates.South = north, south
+	region.Coordinates.East, region.Coordinates.West = east, west
+	return region
+}
+
+func TestFallbackPanoramaScopedToRegions(t *testing.T) {
+	fake := newFakeGoogle(t)
+	maps := NewMapsServiceWithProvider(newFakeProvider(t, fake))
+	fallbacks, err := ParseFallbackSet([]byte(testFallbackData))
+	if err != nil {
+		t.Fatalf("解析兜底列表失败: %v", err)
+	}
+	maps.SetFallbacks(fallbacks)
+
+	// 偏好区域内只有东京，没有 pano_id 的条目通过街景元数据查找
+	regions := []models.Region{testRegion(40, 30, 145, 135)}
+	for i := 0; i < 3; i++ {
+		pano, err := maps.FallbackPanorama(context.Background(), regions, models.CaptureDateRange{})
+		if err != nil {
+			t.Fatalf("应该使用兜底全景: %v", err)
+		}
+		if pano.PanoID != fakePanoID("50") || pano.Latitude != 35.659487 {
+			t.Errorf("应该使用区域内的东京，实际为 %+v", pano)
+		}
+	}
+	// 查找结果被缓存
+	if calls := fake.metadataCalls(); len(calls) != 1 || calls[0].Get("radius") != "50" {
+		t.Errorf("只应该查找一次，实际请求为 %v", calls)
+	}
+
+	// 跨越 180 度经线的区域
+	pano, err := maps.FallbackPanorama(context.Background(), []models.Region{testRegion(-30, -40, -170, 170)}, models.CaptureDateRange{})
+	if err != nil || pano.Latitude != -36.8485 {
+		t.Errorf("应该使用区域内的奥克兰，实际为 %+v %v", pano, err)
+	}
+
+	if stats := maps.FallbackStats(); stats.Used != 4 || stats.Unavailable != 0 || stats.Version != 1 || stats.Panoramas != 3 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+}
+
+func TestFallbackPanoramaUnavailable(t *testing.T) {
+	fake := newFakeGoogle(t)
+	fake.setMetadata(fakeResponse{status: "ZERO_RESULTS"})
+	maps := NewMapsServiceWithProvider(newFakeProvider(t, fake))
+
+	// 所有半径都没有街景时不再返回假的全景 ID
+	if pano := maps.FindStreetView(context.Background(), 10, 20, false); pano != nil {
+		t.Fatalf("所有半径都失败时应该返回 nil，实际全景为 %+v", pano)
+	}
+
+	// 内置列表没有 pano_id，查找都失败时返回 ErrNoStreetView，且限制查找次数
+	before := len(fake.metadataCalls())
+	_, err := maps.FallbackPanorama(context.Background(), nil, models.CaptureDateRange{})
+	if !errors.Is(err, models.ErrNoStreetView) {
+		t.Errorf("错误应为 ErrNoStreetView，实际为 %v", err)
+	}
+	if calls := len(fake.metadataCalls()) - before; calls != fallbackMaxResolves {
+		t.Errorf("应该最多查找 %d 个条目，实际为 %d", fallbackMaxResolves, calls)
+	}
+	if stats := maps.FallbackStats(); stats.Used != 0 || stats.Unavailable != 1 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+}
+
+// failingProvider 所有请求都失败的数据源，记录请求次数；MapsService 会并发探测多个半径，计数需要原子操作
+type failingProvider struct {
+	calls atomic.Int64
+}
+
+func (p *failingProvider) NearestPanorama(ctx context.Context, latitude, longitude float64, radius int) (*Panorama, error) {
+	p.calls.Add(1)
+	return nil, models.Classify(models.ErrUpstreamUnavailable, errors.New("google unavailable"))
+}
+
+func (p *failingProvider) ReverseGeocode(ctx context.Context, latitude, longitude float64, language string) (*models.GeocodeResult, error) {
+	p.calls.Add(1)
+	return nil, models.Classify(models.ErrUpstreamUnavailable, errors.New("google unavailable"))
+}
+
+func TestFallbackPanoramaWithoutUpstream(t *testing.T) {
+	provider := &failingProvider{}
+	maps := NewMapsServiceWithProvider(provider)
+	fallbacks, err := ParseFallbackSet([]byte(testFallbackData))
+	if err != nil {
+		t.Fatalf("解析兜底列表失败: %v", err)
+	}
+	maps.SetFallbacks(fallbacks)
+
+	// 上游一直失败时，指定了 pano_id 的条目仍然可用，且不请求上游
+	for i := 0; i < 10; i++ {
+		pano, err := maps.FallbackPanorama(context.Background(), nil, models.CaptureDateRange{})
+		if err != nil {
+			t.Fatalf("应该使用指定了 pano_id 的兜底全景: %v", err)
+		}
+		if pano.PanoID != "pinned_pano" {
+			t.Errorf("兜底全景为 %+v，期望 pinned_pano", pano)
+		}
+	}
+	if calls := provider.calls.Load(); calls != 0 {
+		t.Errorf("有已知全景时不应请求上游，实际请求 %d 次", calls)
+	}
+}
+
+func TestFallbackSetPin(t *testing.T) {
+	fake := newFakeGoogle(t)
+	fallbacks, err := ParseFallbackSet([]byte(testFallbackData))
+	if err != nil {
+		t.Fatalf("解析兜底列表失败: %v", err)
+	}
+
+	pinned, err := fallbacks.Pin(context.Background(), newFakeProvider(t, fake))
+	if err != nil || pinned != 2 {
+		t.Fatalf("应该写入 2 个条目，实际为 %d: %v", pinned, err)
+	}
+	if got := len(fake.metadataCalls()); got != 2 {
+		t.Errorf("已有 pano_id 的条目不应查找，实际请求 %d 次", got)
+	}
+
+	// 编码后重新解析，所有条目都有全景 ID 和拍摄日期，使用时不再请求上游
+	data, err := fallbacks.Encode()
+	if err != nil {
+		t.Fatalf("编码兜底列表失败: %v", err)
+	}
+	reloaded, err := ParseFallbackSet(data)
+	if err != nil {
+		t.Fatalf("重新解析兜底列表失败: %v: %s", err, data)
+	}
+	for _, entry := range reloaded.panoramas {
+		if entry.PanoID == "" || entry.Label == "" {
+			t.Errorf("条目应该带有全景 ID 和名称: %+v", entry)
+		}
+	}
+	if tokyo := reloaded.panoramas[1]; tokyo.PanoID != fakePanoID("50") || tokyo.Date != "2023-05" {
+		t.Errorf("东京条目应该写入查找到的全景: %+v", tokyo)
+	}
+}
+
+func TestDefaultFallbackSetPin(t *testing.T) {
+	fake := newFakeGoogle(t)
+	fallbacks := mustDefaultFallbackSet()
+
+	// cmd/fallbacks 对内置列表的输出重新加载后，每个条目都有全景 ID，使用时不再请求上游
+	if _, err := fallbacks.Pin(context.Background(), newFakeProvider(t, fake)); err != nil {
+		t.Fatalf("写入全景 ID 失败: %v", err)
+	}
+	data, err := fallbacks.Encode()
+	if err != nil {
+		t.Fatalf("编码兜底列表失败: %v", err)
+	}
+	reloaded, err := ParseFallbackSet(data)
+	if err != nil {
+		t.Fatalf("重新解析兜底列表失败: %v", err)
+	}
+	if len(reloaded.panoramas) != len(mustDefaultFallbackSet().panoramas) {
+		t.Errorf("条目数量为 %d，期望 %d", len(reloaded.panoramas), len(mustDefaultFallbackSet().panoramas))
+	}
+	for i := range reloaded.panoramas {
+		if reloaded.known(i) == nil {
+			t.Errorf("条目应该已写入全景 ID: %+v", reloaded.panoramas[i])
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/repositories"
+	"github.com/my-streetview-project/backend/internal/utils"
+	"golang.org/x/sync/singleflight"
+)
+
+// 街景图片的尺寸和视角
+// 图片接口是公开的，每个不同的视角和尺寸都是一次 Street View Static API 请求和一条缓存，因此角度按 15 度取整，尺寸只允许几种
+const (
+	defaultStreetViewImageWidth  = 640
+	defaultStreetViewImageHeight = 400
+	defaultStreetViewImageFOV    = 90
+	minStreetViewImageFOV        = 10
+	maxStreetViewImageFOV        = 120
+	streetViewImageFetchTimeout  = 30 * time.Second    // 合并后的上游请求不随单个调用方取消，用该超时限制最长时间
+	streetViewImageAngleStep     = 15                  // 朝向、俯仰角和视野取整的步长（度）
+	streetViewImageETagGrace     = 30 * 24 * time.Hour // 图片缓存过期后 ETag 继续保留的时间，期间客户端重新验证不请求上游
+)
+
+// StreetViewImageSizes 允许的图片尺寸，默认 640x400
+var StreetViewImageSizes = []string{"640x400", "640x640", "320x200", "320x320"}
+
+// StreetViewImageRequest 一张街景图片的全景图ID、视角和尺寸
+type StreetViewImageRequest struct {
+	PanoID  string
+	Heading float64 // 朝向，0 到 360 度，0 为正北
+	Pitch   float64 // 俯仰角，-90 到 90 度
+	FOV     float64 // 水平视野，10 到 120 度
+	Width   int
+	Height  int
+}
+
+// ParseStreetViewImageRequest 解析图片的查询参数，为空的参数使用默认值（朝向 0、俯仰 0、视野 90、尺寸 640x400）
+// 角度按 15 度取整；参数格式错误、超出范围或尺寸不在 StreetViewImageSizes 中时返回 models.ErrInvalidInput 分类的错误
+func ParseStreetViewImageRequest(panoID, heading, pitch, fov, size string) (StreetViewImageRequest, error) {
+	req := StreetViewImageRequest{
+		PanoID: panoID,
+		FOV:    defaultStreetViewImageFOV,
+		Width:  defaultStreetViewImageWidth,
+		Height: defaultStreetViewImageHeight,
+	}
+	invalidView := models.NewError(models.ErrInvalidInput, "INVALID_IMAGE_VIEW", "图片视角参数无效")
+
+	angles := []struct {
+		value    string
+		dst      *float64
+		min, max float64
+	}{
+		{heading, &req.Heading, -360, 360},
+		{pitch, &req.Pitch, -90, 90},
+		{fov, &req.FOV, minStreetViewImageFOV, maxStreetViewImageFOV},
+	}
+	for _, angle := range angles {
+		if angle.value == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(angle.value, 64)
+		if err != nil || math.IsNaN(v) || v < angle.min || v > angle.max {
+			return req, invalidView
+		}
+		*angle.dst = math.Round(v/streetViewImageAngleStep) * streetViewImageAngleStep
+	}
+	// 负数朝向换算到 0-360 度
+	if req.Heading = math.Mod(req.Heading, 360); req.Heading < 0 {
+		req.Heading += 360
+	}
+
+	if size != "" {
+		size = strings.ToLower(size)
+		if !slices.Contains(StreetViewImageSizes, size) {
+			return req, models.NewError(models.ErrInvalidInput, "INVALID_IMAGE_SIZE", "图片尺寸无效")
+		}
+		width, height, _ := strings.Cut(size, "x")
+		req.Width, _ = strconv.Atoi(width)
+		req.Height, _ = strconv.Atoi(height)
+	}
+
+	return req, nil
+}
+
+// cacheKey 返回图片的缓存键，例如 CAoSLEFG:h90:p0:f90:640x400
+func (r StreetViewImageRequest) cacheKey() string {
+	return fmt.Sprintf("%s:h%g:p%g:f%g:%dx%d", r.PanoID, r.Heading, r.Pitch, r.FOV, r.Width, r.Height)
+}
+
+// StreetViewImageSource 街景图片的数据源
+type StreetViewImageSource interface {
+	// StreetViewImage 返回全景图片，超过 maxBytes 时返回错误
+	StreetViewImage(ctx context.Context, req StreetViewImageRequest, maxBytes int64) (*StreetViewImage, error)
+}
+
+// StreetViewImageService 在服务端请求街景图片并缓存在仓库中，客户端无需持有 Google Maps API Key
+// 同一张图片的并发请求只向上游发出一次请求，其余调用方等待并共享结果
+type StreetViewImageService struct {
+	source   StreetViewImageSource
+	repo     repositories.Repository
+	ttl      time.Duration
+	maxBytes int64
+	group    singleflight.Group
+}
+
+// NewStreetViewImageService 创建街景图片服务，ttl <= 0 时不缓存，maxBytes 为单张图片的最大字节数
+func NewStreetViewImageService(source StreetViewImageSource, repo repositories.Repository, ttl time.Duration, maxBytes int64) *StreetViewImageService {
+	return &StreetViewImageService{source: source, repo: repo, ttl: ttl, maxBytes: maxBytes}
+}
+
+// CachedETag 返回已缓存图片的 ETag 和客户端可以继续使用该图片的截止时间，不请求数据源
+// 图片缓存已过期但 ETag 仍保留时，截止时间从现在起顺延一个缓存周期；没有记录或不缓存时返回空字符串
+func (s *StreetViewImageService) CachedETag(ctx context.Context, req StreetViewImageRequest) (string, time.Time) {
+	if s.ttl <= 0 || isSyntheticPanoID(req.PanoID) {
+		return "", time.Time{}
+	}
+
+	logger := utils.MapsLogger()
+	key := req.cacheKey()
+
+	entry, err := s.repo.GetStreetViewImage(ctx, key)
+	if err != nil {
+		logger.Error("streetview_image_cache_read_failed", "Failed to read Street View image cache", err, map[string]interface{}{
+			"key": key,
+		})
+	}
+	if entry != nil {
+		return entry.ETag, entry.ExpiresAt
+	}
+
+	etag, err := s.repo.GetStreetViewImageETag(ctx, key)
+	if err != nil {
+		logger.Error("streetview_image_etag_read_failed", "Failed to read Street View image ETag", err, map[string]interface{}{
+			"key": key,
+		})
+		return "", time.Time{}
+	}
+	if etag == "" {
+		return "", time.Time{}
+	}
+	return etag, time.Now().Add(s.ttl)
+}
+
+// Get 返回街景图片和它的 ETag，没有缓存时请求数据源并缓存
+// 离线模式的合成全景没有图片，直接返回 models.ErrNoStreetView 分类的错误，不请求数据源也不占用图片配额
+func (s *StreetViewImageService) Get(ctx context.Context, req StreetViewImageRequest) (*models.StreetViewImageCacheEntry, error) {
+	if isSyntheticPanoID(req.PanoID) {
+		return nil, models.Classify(models.ErrNoStreetView, fmt.Errorf("合成全景没有街景图片: %s", req.PanoID))
+	}
+
+	logger := utils.MapsLogger()
+	key := req.cacheKey()
+
+	if s.ttl > 0 {
+		entry, err := s.repo.GetStreetViewImage(ctx, key)
+		if err != nil {
+			// 缓存不可用时直接请求上游
+			logger.Error("streetview_image_cache_read_failed", "Failed to read Street View image cache", err, map[string]interface{}{
+				"key": key,
+			})
+		}
+		if entry != nil {
+			return entry, nil
+		}
+	}
+
+	results := s.group.DoChan(key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), streetViewImageFetchTimeout)
+		defer cancel()
+
+		image, err := s.source.StreetViewImage(fetchCtx, req, s.maxBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		entry := &models.StreetViewImageCacheEntry{
+			Key:         key,
+			ContentType: image.ContentType,
+			Data:        image.Data,
+			ETag:        imageETag(image.Data),
+			CachedAt:    now,
+			ExpiresAt:   now.Add(s.ttl),
+		}
+		if s.ttl > 0 {
+			if err := s.repo.SaveStreetViewImage(fetchCtx, *entry); err != nil {
+				logger.Error("streetview_image_cache_write_failed", "Failed to write Street View image cache", err, map[string]interface{}{
+					"key": key,
+				})
+			}
+			if err := s.repo.SaveStreetViewImageETag(fetchCtx, key, entry.ETag, entry.ExpiresAt.Add(streetViewImageETagGrace)); err != nil {
+				logger.Error("streetview_image_etag_write_failed", "Failed to write Street View image ETag", err, map[string]interface{}{
+					"key": key,
+				})
+			}
+		}
+		return entry, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		// 并发的调用方共享同一个条目，图片内容只读，复制结构体即可
+		entry := *result.Val.(*models.StreetViewImageCacheEntry)
+		return &entry, nil
+	}
+}
+
+// imageETag 由图片内容的 SHA-256 摘要生成强 ETag，内容相同的图片 ETag 相同
+func imageETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
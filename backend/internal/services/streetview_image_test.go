@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/my-streetview-project/backend/internal/repositories"
+)
+
+func TestParseStreetViewImageRequest(t *testing.T) {
+	tests := []struct {
+		name                string
+		heading, pitch, fov string
+		size                string
+		want                StreetViewImageRequest
+		valid               bool
+	}{
+		{"默认值", "", "", "", "", StreetViewImageRequest{PanoID: "pano", FOV: 90, Width: 640, Height: 400}, true},
+		{"指定视角和尺寸", "90.04", "-10", "60", "320x200", StreetViewImageRequest{PanoID: "pano", Heading: 90, Pitch: -15, FOV: 60, Width: 320, Height: 200}, true},
+		{"角度按 15 度取整", "97", "8", "10", "", StreetViewImageRequest{PanoID: "pano", Heading: 90, Pitch: 15, FOV: 15, Width: 640, Height: 400}, true},
+		{"朝向取整到 360 度", "355", "", "", "", StreetViewImageRequest{PanoID: "pano", FOV: 90, Width: 640, Height: 400}, true},
+		{"负数朝向", "-90", "", "", "", StreetViewImageRequest{PanoID: "pano", Heading: 270, FOV: 90, Width: 640, Height: 400}, true},
+		{"朝向不是数字", "north", "", "", "", StreetViewImageRequest{}, false},
+		{"俯仰角超出范围", "", "91", "", "", StreetViewImageRequest{}, false},
+		{"视野过小", "", "", "5", "", StreetViewImageRequest{}, false},
+		{"尺寸超过上限", "", "", "", "641x400", StreetViewImageRequest{}, false},
+		{"尺寸格式错误", "", "", "", "640", StreetViewImageRequest{}, false},
+		{"尺寸不在允许列表中", "", "", "", "320x240", StreetViewImageRequest{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := ParseStreetViewImageRequest("pano", tt.heading, tt.pitch, tt.fov, tt.size)
+			if !tt.valid {
+				if !errors.Is(err, models.ErrInvalidInput) {
+					t.Errorf("错误应为 ErrInvalidInput，实际为 %v", err)
+				}
+				return
+			}
+			if err != nil || req != tt.want {
+				t.Errorf("解析结果为 %+v, %v，期望 %+v", req, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreetViewImageService(t *testing.T) {
+	fake := newFakeGoogle(t)
+	images := NewStreetViewImageService(newFakeProvider(t, fake), repositories.NewMemoryRepository(), time.Hour, 1024)
+	ctx := context.Background()
+	req := StreetViewImageRequest{PanoID: "pano", Heading: 90, FOV: 90, Width: 640, Height: 400}
+
+	first, err := images.Get(ctx, req)
+	if err != nil {
+		t.Fatalf("获取图片失败: %v", err)
+	}
+	if !bytes.Equal(first.Data, fakeImage("pano", "640x400")) || first.ContentType != "image/jpeg" || first.ETag == "" {
+		t.Errorf("图片不正确: %+v", first)
+	}
+	query := fake.imageCalls()[0]
+	if query.Get("pano") != "pano" || query.Get("heading") != "90" || query.Get("fov") != "90" ||
+		query.Get("return_error_code") != "true" || query.Get("key") != fakeGoogleAPIKey {
+		t.Errorf("请求参数不正确: %v", query)
+	}
+
+	// 第二次命中缓存，ETag 不变
+	second, err := images.Get(ctx, req)
+	if err != nil || second.ETag != first.ETag {
+		t.Errorf("缓存的图片不正确: %+v, %v", second, err)
+	}
+	if got := len(fake.imageCalls()); got != 1 {
+		t.Errorf("应该只请求 1 次图片，实际为 %d 次", got)
+	}
+
+	// 不同视角使用不同的缓存
+	other := req
+	other.Heading = 180
+	if _, err := images.Get(ctx, other); err != nil {
+		t.Fatalf("获取图片失败: %v", err)
+	}
+	if got := len(fake.imageCalls()); got != 2 {
+		t.Errorf("不同视角应该分别请求，实际请求 %d 次", got)
+	}
+}
+
+func TestStreetViewImageServiceErrors(t *testing.T) {
+	fake := newFakeGoogle(t)
+	provider := newFakeProvider(t, fake)
+	ctx := context.Background()
+	req := StreetViewImageRequest{PanoID: "pano", FOV: 90, Width: 640, Height: 400}
+
+	// 超过大小限制的图片不返回也不缓存
+	small := NewStreetViewImageService(provider, repositories.NewMemoryRepository(), time.Hour, 8)
+	if _, err := small.Get(ctx, req); !errors.Is(err, models.ErrUpstreamUnavailable) {
+		t.Errorf("错误应为 ErrUpstreamUnavailable，实际为 %v", err)
+	} else if code, _ := models.Detail(err); code != "STREETVIEW_IMAGE_TOO_LARGE" {
+		t.Errorf("错误码为 %q，期望 STREETVIEW_IMAGE_TOO_LARGE", code)
+	}
+
+	fake.setImage(fakeResponse{status: "ZERO_RESULTS"})
+	images := NewStreetViewImageService(provider, repositories.NewMemoryRepository(), time.Hour, 1024)
+	if _, err := images.Get(ctx, req); !errors.Is(err, models.ErrNoStreetView) {
+		t.Errorf("全景不存在时错误应为 ErrNoStreetView，实际为 %v", err)
+	}
+}
+
+func TestStreetViewImageServiceCoalescing(t *testing.T) {
+	fake := newFakeGoogle(t)
+	fake.setImage(fakeResponse{status: "OK", delay: 50 * time.Millisecond})
+	images := NewStreetViewImageService(newFakeProvider(t, fake), repositories.NewMemoryRepository(), time.Hour, 1024)
+	req := StreetViewImageRequest{PanoID: "pano", FOV: 90, Width: 640, Height: 400}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := images.Get(context.Background(), req); err != nil {
+				t.Errorf("获取图片失败: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(fake.imageCalls()); got != 1 {
+		t.Errorf("并发请求同一张图片应该只请求 1 次，实际为 %d 次", got)
+	}
+}
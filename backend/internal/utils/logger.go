@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"log"
 	"time"
 )
@@ -46,7 +47,8 @@ func (l *Logger) log(level LogLevel, action, message string, fields map[string]i
 	}
 
 	// Always use readable format for development
-	log.Printf("[%s] %s:%s %s %v", level, l.service, action, message, fields)
+	// 字段和消息中可能包含请求 URL，输出前去掉 API Key 和 URL 签名
+	log.Print(RedactSecrets(fmt.Sprintf("[%s] %s:%s %s %v", level, l.service, action, message, fields)))
 }
 
 func (l *Logger) Info(action, message string, fields ...map[string]interface{}) {
@@ -69,7 +71,7 @@ func (l *Logger) Error(action, message string, err error, fields ...map[string]i
 func (l *Logger) LogRequest(action string, duration time.Duration, fields map[string]interface{}) {
 	durationStr := duration.String()
 	// Always use readable format for development
-	log.Printf("[%s] %s:%s (%s) %v", INFO, l.service, action, durationStr, fields)
+	log.Print(RedactSecrets(fmt.Sprintf("[%s] %s:%s (%s) %v", INFO, l.service, action, durationStr, fields)))
 }
 
 // Global logger instances
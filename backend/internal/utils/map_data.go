@@ -18,12 +18,15 @@ const (
 	WorldMapURL = "https://raw.githubusercontent.com/nvkelso/natural-earth-vector/master/geojson/ne_10m_admin_0_countries.geojson"
 	// 小型岛屿数据URL - 使用Natural Earth 1:10m小型岛屿数据
 	MinorIslandsURL = "https://raw.githubusercontent.com/martynafford/natural-earth-geojson/master/10m/physical/ne_10m_minor_islands.json"
+	// 一级行政区（州/省）数据URL - 文件较大（约40MB），不自动下载，需要手动放到 MapDataDir 下
+	Admin1URL = "https://raw.githubusercontent.com/nvkelso/natural-earth-vector/master/geojson/ne_10m_admin_1_states_provinces.geojson"
 	// 本地存储路径
 	MapDataDir          = "data/maps"
 	WorldMapFile        = "world.geojson"
 	WorldMapMD5File     = "world.geojson.md5"
 	MinorIslandsFile    = "minor_islands.json"
 	MinorIslandsMD5File = "minor_islands.json.md5"
+	Admin1File          = "admin1.geojson"
 	// 数据更新检查间隔（7天）
 	UpdateCheckInterval = 7 * 24 * time.Hour
 )
@@ -372,3 +375,29 @@ func (m *MapDataManager) getRemoteMinorIslandsMD5() (string, error) {
 
 	return fmt.Sprintf("%x", md5.Sum(data)), nil
 }
+
+// HasAdmin1Data 判断本地是否有一级行政区数据
+func (m *MapDataManager) HasAdmin1Data() bool {
+	return m.fileExists(filepath.Join(m.dataDir, Admin1File))
+}
+
+// LoadAdmin1Data 加载本地一级行政区数据
+func (m *MapDataManager) LoadAdmin1Data() (*geojson.FeatureCollection, error) {
+	admin1Path := filepath.Join(m.dataDir, Admin1File)
+
+	if !m.fileExists(admin1Path) {
+		return nil, fmt.Errorf("一级行政区数据文件不存在: %s", admin1Path)
+	}
+
+	data, err := os.ReadFile(admin1Path)
+	if err != nil {
+		return nil, fmt.Errorf("读取一级行政区数据失败: %w", err)
+	}
+
+	var fc geojson.FeatureCollection
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("解析一级行政区数据失败: %w", err)
+	}
+
+	return &fc, nil
+}
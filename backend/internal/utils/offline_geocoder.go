@@ -0,0 +1,286 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// 点不在任何多边形内时，向外搜索最近边界的范围
+// 10m 数据的海岸线会把码头、防波堤和近岸小岛上的街景点划到海里
+const (
+	offlineCoastToleranceDeg = 0.1
+	offlineCoastToleranceKm  = 10.0
+)
+
+// OfflineGeocoder 基于 Natural Earth 国家和一级行政区多边形的离线逆地理编码
+// 只能解析到国家和州/省，返回的结果结构与 MapsService.GetLocationInfo 相同
+type OfflineGeocoder struct {
+	countries []geoArea
+	provinces []geoArea
+}
+
+// geoArea 一个国家或行政区的多边形和属性
+type geoArea struct {
+	bound      orb.Bound
+	polygons   []orb.Polygon
+	bounds     []orb.Bound
+	properties geojson.Properties
+}
+
+// NewOfflineGeocoder 使用国家数据和可选的一级行政区数据（可以为 nil）创建离线地理编码器
+func NewOfflineGeocoder(countries, provinces *geojson.FeatureCollection) *OfflineGeocoder {
+	return &OfflineGeocoder{
+		countries: extractGeoAreas(countries),
+		provinces: extractGeoAreas(provinces),
+	}
+}
+
+// HasProvinces 判断是否加载了一级行政区数据
+func (g *OfflineGeocoder) HasProvinces() bool {
+	return len(g.provinces) > 0
+}
+
+// ReverseGeocode 返回坐标所在的国家和州/省，language 为描述语言代码，数据中有对应语言的名称时使用该名称
+// 结果只有一个地点，类型为最具体的一级（有州/省时为 administrative_area_level_1，否则为 country）
+// 坐标不在任何国家或行政区内时 ok 为 false
+func (g *OfflineGeocoder) ReverseGeocode(lat, lng float64, language string) (*models.GeocodeResult, bool) {
+	country := findGeoArea(g.countries, lat, lng)
+	province := findGeoArea(g.provinces, lat, lng)
+	if country == nil && province == nil {
+		return nil, false
+	}
+
+	var address models.AddressHierarchy
+	if country != nil {
+		address.Country = localizedName(country.properties, language)
+		address.CountryCode = countryCode(country.properties)
+	} else {
+		// 一级行政区数据自带所属国家
+		address.Country = propertyString(province.properties, "admin")
+		address.CountryCode = propertyString(province.properties, "iso_a2")
+	}
+
+	placeType := "country"
+	if province != nil {
+		address.StateProvince = localizedName(province.properties, language)
+		address.StateProvinceCode = provinceCode(province.properties)
+		placeType = "administrative_area_level_1"
+	}
+
+	var parts []string
+	for _, part := range []string{address.StateProvince, address.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return &models.GeocodeResult{
+		Source:   models.GeocodeSourceOffline,
+		Language: language,
+		Results: []models.GeocodePlace{{
+			FormattedAddress: strings.Join(parts, ", "),
+			Types:            []string{placeType, "political"},
+			Address:          address,
+		}},
+	}, true
+}
+
+// extractGeoAreas 从 GeoJSON 中提取多边形要素
+func extractGeoAreas(fc *geojson.FeatureCollection) []geoArea {
+	if fc == nil {
+		return nil
+	}
+
+	var areas []geoArea
+	for _, feature := range fc.Features {
+		if feature.Geometry == nil {
+			continue
+		}
+
+		var polygons []orb.Polygon
+		switch geom := feature.Geometry.(type) {
+		case orb.Polygon:
+			polygons = []orb.Polygon{geom}
+		case orb.MultiPolygon:
+			polygons = geom
+		default:
+			continue
+		}
+
+		area := geoArea{
+			bound:      feature.Geometry.Bound(),
+			polygons:   polygons,
+			bounds:     make([]orb.Bound, len(polygons)),
+			properties: feature.Properties,
+		}
+		for i, polygon := range polygons {
+			area.bounds[i] = polygon.Bound()
+		}
+		areas = append(areas, area)
+	}
+	return areas
+}
+
+// findGeoArea 返回包含坐标的要素；没有时返回海岸线容差范围内最近的要素
+func findGeoArea(areas []geoArea, lat, lng float64) *geoArea {
+	point := orb.Point{lng, lat}
+	for i := range areas {
+		if !areas[i].bound.Contains(point) {
+			continue
+		}
+		for j, polygon := range areas[i].polygons {
+			if areas[i].bounds[j].Contains(point) && pointInPolygon(lat, lng, polygon) {
+				return &areas[i]
+			}
+		}
+	}
+
+	var nearest *geoArea
+	nearestDistance := offlineCoastToleranceKm
+	for i := range areas {
+		if !areas[i].bound.Pad(offlineCoastToleranceDeg).Contains(point) {
+			continue
+		}
+		for j, polygon := range areas[i].polygons {
+			if !areas[i].bounds[j].Pad(offlineCoastToleranceDeg).Contains(point) {
+				continue
+			}
+			if d := distanceToRing(lat, lng, polygon[0]); d <= nearestDistance {
+				nearest, nearestDistance = &areas[i], d
+			}
+		}
+	}
+	return nearest
+}
+
+// distanceToRing 计算点到环边界的最短距离（单位：公里）
+// 容差只有十公里左右，按点所在纬度做等距投影后在平面上计算点到线段的距离
+func distanceToRing(lat, lng float64, ring orb.Ring) float64 {
+	const kmPerDegree = 111.32
+	scale := math.Cos(lat * math.Pi / 180)
+
+	minDistance := math.Inf(1)
+	for i := 1; i < len(ring); i++ {
+		ax, ay := (ring[i-1][0]-lng)*scale, ring[i-1][1]-lat
+		bx, by := (ring[i][0]-lng)*scale, ring[i][1]-lat
+		dx, dy := bx-ax, by-ay
+
+		// 原点在线段上的投影位置，限制在线段范围内
+		t := 0.0
+		if length := dx*dx + dy*dy; length > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+		}
+		minDistance = math.Min(minDistance, math.Hypot(ax+t*dx, ay+t*dy))
+	}
+	return minDistance * kmPerDegree
+}
+
+// localizedName 返回要素在指定语言下的名称，例如 NAME_ZH、name_ja，没有时返回默认名称
+func localizedName(properties geojson.Properties, language string) string {
+	if suffix := nameSuffix(language); suffix != "" {
+		if name := propertyString(properties, "name_"+suffix); name != "" {
+			return name
+		}
+	}
+	return propertyString(properties, "name")
+}
+
+// nameSuffix 把语言代码转换为 Natural Earth 名称字段的后缀，繁体中文使用 zht
+func nameSuffix(language string) string {
+	language = strings.ToLower(strings.ReplaceAll(language, "_", "-"))
+	switch language {
+	case "zh-tw", "zh-hk", "zh-mo", "zh-hant":
+		return "zht"
+	}
+	base, _, _ := strings.Cut(language, "-")
+	return base
+}
+
+// countryCode 返回 ISO 3166-1 二位代码，ISO_A2 为 -99 的国家（例如法国、挪威）使用 ISO_A2_EH
+func countryCode(properties geojson.Properties) string {
+	if code := propertyString(properties, "iso_a2"); code != "" {
+		return code
+	}
+	return propertyString(properties, "iso_a2_eh")
+}
+
+// provinceCode 返回州/省的简称，与 Google 的 short_name 一致优先使用邮政简称（例如 CA），否则使用 ISO 3166-2 的后半部分
+func provinceCode(properties geojson.Properties) string {
+	if code := propertyString(properties, "postal"); code != "" {
+		return code
+	}
+	code := propertyString(properties, "iso_3166_2")
+	if _, subdivision, found := strings.Cut(code, "-"); found {
+		return subdivision
+	}
+	return code
+}
+
+// propertyString 读取字符串属性，国家数据的字段为大写、行政区数据为小写，Natural Earth 用 -99 表示缺失
+func propertyString(properties geojson.Properties, key string) string {
+	for _, k := range []string{key, strings.ToUpper(key), strings.ToLower(key)} {
+		if value, ok := properties[k].(string); ok {
+			value = strings.TrimSpace(value)
+			if value == "-99" {
+				return ""
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+// 全局离线地理编码器，首次使用时从地图数据管理器加载
+var (
+	offlineGeocoder     *OfflineGeocoder
+	offlineGeocoderOnce sync.Once
+)
+
+// GetOfflineGeocoder 获取全局离线地理编码器，世界地图数据不可用时返回 nil
+func GetOfflineGeocoder() *OfflineGeocoder {
+	offlineGeocoderOnce.Do(func() {
+		logger := SystemLogger()
+
+		mapManager := GetGlobalMapManager()
+		if mapManager == nil {
+			logger.Error("offline_geocoder_init_failed", "Map data manager is not initialized", nil)
+			return
+		}
+
+		countries, err := mapManager.LoadWorldMapData()
+		if err != nil {
+			logger.Error("offline_geocoder_init_failed", "Failed to load world map data for offline geocoding", err)
+			return
+		}
+
+		// 一级行政区数据是可选的，没有时只解析到国家
+		var provinces *geojson.FeatureCollection
+		if mapManager.HasAdmin1Data() {
+			provinces, err = mapManager.LoadAdmin1Data()
+			if err != nil {
+				logger.Error("admin1_load_failed", "Failed to load admin-1 data, offline geocoding resolves countries only", err)
+			}
+		}
+
+		offlineGeocoder = NewOfflineGeocoder(countries, provinces)
+		logger.Info("offline_geocoder_ready", "Offline geocoder initialized", map[string]interface{}{
+			"countries": len(offlineGeocoder.countries),
+			"provinces": len(offlineGeocoder.provinces),
+		})
+	})
+	return offlineGeocoder
+}
+
+// ReverseGeocodeOffline 使用全局离线地理编码器解析坐标，数据不可用或没有结果时 ok 为 false
+func ReverseGeocodeOffline(lat, lng float64, language string) (*models.GeocodeResult, bool) {
+	geocoder := GetOfflineGeocoder()
+	if geocoder == nil {
+		return nil, false
+	}
+	return geocoder.ReverseGeocode(lat, lng, language)
+}
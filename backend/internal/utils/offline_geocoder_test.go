@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/my-streetview-project/backend/internal/models"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func squarePolygon(west, south, east, north float64) orb.Polygon {
+	return orb.Polygon{{{west, south}, {east, south}, {east, north}, {west, north}, {west, south}}}
+}
+
+func testOfflineGeocoder(withProvinces bool) *OfflineGeocoder {
+	countries := geojson.NewFeatureCollection()
+	france := geojson.NewFeature(orb.MultiPolygon{squarePolygon(0, 40, 10, 50), squarePolygon(20, 40, 21, 41)})
+	france.Properties = geojson.Properties{"NAME": "France", "NAME_ZH": "法国", "ISO_A2": "-99", "ISO_A2_EH": "FR"}
+	countries.Append(france)
+	japan := geojson.NewFeature(squarePolygon(130, 30, 140, 40))
+	japan.Properties = geojson.Properties{"NAME": "Japan", "NAME_JA": "日本", "ISO_A2": "JP"}
+	countries.Append(japan)
+
+	if !withProvinces {
+		return NewOfflineGeocoder(countries, nil)
+	}
+	provinces := geojson.NewFeatureCollection()
+	tokyo := geojson.NewFeature(squarePolygon(135, 35, 140, 40))
+	tokyo.Properties = geojson.Properties{"name": "Tokyo", "name_ja": "東京都", "iso_3166_2": "JP-13", "postal": "-99", "admin": "Japan", "iso_a2": "JP"}
+	provinces.Append(tokyo)
+	return NewOfflineGeocoder(countries, provinces)
+}
+
+func TestOfflineReverseGeocode(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		language string
+		provs    bool
+		want     models.AddressHierarchy
+		address  string
+	}{
+		{
+			name: "国家，ISO_A2 缺失时使用 ISO_A2_EH",
+			lat:  45, lng: 5, language: "en",
+			want: models.AddressHierarchy{Country: "France", CountryCode: "FR"}, address: "France",
+		},
+		{
+			name: "多边形的第二部分",
+			lat:  40.5, lng: 20.5, language: "zh",
+			want: models.AddressHierarchy{Country: "法国", CountryCode: "FR"}, address: "法国",
+		},
+		{
+			name: "没有行政区数据时只返回国家",
+			lat:  36, lng: 138, language: "ja",
+			want: models.AddressHierarchy{Country: "日本", CountryCode: "JP"}, address: "日本",
+		},
+		{
+			name: "国家和行政区",
+			lat:  36, lng: 138, language: "ja", provs: true,
+			want: models.AddressHierarchy{
+				Country: "日本", CountryCode: "JP",
+				StateProvince: "東京都", StateProvinceCode: "13",
+			},
+			address: "東京都, 日本",
+		},
+		{
+			name: "没有对应语言的名称时使用默认名称",
+			lat:  36, lng: 138, language: "ko", provs: true,
+			want: models.AddressHierarchy{
+				Country: "Japan", CountryCode: "JP",
+				StateProvince: "Tokyo", StateProvinceCode: "13",
+			},
+			address: "Tokyo, Japan",
+		},
+		{
+			name: "海岸线外容差范围内使用最近的国家",
+			lat:  45, lng: 10.05, language: "en",
+			want: models.AddressHierarchy{Country: "France", CountryCode: "FR"}, address: "France",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := testOfflineGeocoder(tt.provs).ReverseGeocode(tt.lat, tt.lng, tt.language)
+			if !ok {
+				t.Fatal("应该解析出位置信息")
+			}
+			if got.Source != models.GeocodeSourceOffline || got.Language != tt.language {
+				t.Errorf("来源和语言为 %s/%s，期望 offline/%s", got.Source, got.Language, tt.language)
+			}
+			if len(got.Results) != 1 {
+				t.Fatalf("应该只有一个结果，实际为 %d 个", len(got.Results))
+			}
+			if address := got.Address(); address != tt.want {
+				t.Errorf("地址层级为 %+v，期望 %+v", address, tt.want)
+			}
+			if got.FormattedAddress() != tt.address {
+				t.Errorf("完整地址为 %q，期望 %q", got.FormattedAddress(), tt.address)
+			}
+		})
+	}
+}
+
+func TestOfflineReverseGeocodeOcean(t *testing.T) {
+	if info, ok := testOfflineGeocoder(true).ReverseGeocode(0, -30, "en"); ok {
+		t.Errorf("海洋中的坐标不应有结果，实际为 %v", info)
+	}
+	// 超出海岸线容差
+	if info, ok := testOfflineGeocoder(true).ReverseGeocode(45, 10.5, "en"); ok {
+		t.Errorf("远离海岸线的坐标不应有结果，实际为 %v", info)
+	}
+}
@@ -0,0 +1,12 @@
+package utils
+
+import "regexp"
+
+// secretQueryParam 匹配 URL 中的 key= 和 signature= 参数（包括 URL 编码后出现在其他参数值中的情况）
+var secretQueryParam = regexp.MustCompile(`(?i)(^|[?&;\s"']|%3F|%26)(key|signature)(=|%3D)[^&\s"'<>]*`)
+
+// RedactSecrets 把文本中 key= 和 signature= 参数的值替换为 REDACTED
+// 用于日志和错误上报，避免 Google API Key 和 URL 签名随请求 URL 泄露
+func RedactSecrets(s string) string {
+	return secretQueryParam.ReplaceAllString(s, "${1}${2}${3}REDACTED")
+}
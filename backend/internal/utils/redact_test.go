@@ -0,0 +1,26 @@
+package utils
+
+import "testing"
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{
+			`Get "https://maps.googleapis.com/maps/api/streetview/metadata?key=AIzaSecret&location=1,2&signature=abc-_=": EOF`,
+			`Get "https://maps.googleapis.com/maps/api/streetview/metadata?key=REDACTED&location=1,2&signature=REDACTED": EOF`,
+		},
+		{"map[url:/api/v1/locations?KEY=secret page=2]", "map[url:/api/v1/locations?KEY=REDACTED page=2]"},
+		{"/callback?next=%2Fmetadata%3Fkey%3Dsecret", "/callback?next=%2Fmetadata%3Fkey%3DREDACTED"},
+		// 其他以 key 结尾的参数和普通文本不受影响
+		{"/api/v1/chat?session_key=abc&monkey=1", "/api/v1/chat?session_key=abc&monkey=1"},
+		{"key not found", "key not found"},
+	}
+
+	for _, tt := range tests {
+		if got := RedactSecrets(tt.input); got != tt.want {
+			t.Errorf("RedactSecrets(%q) = %q，期望 %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/my-streetview-project/backend/internal/models"
+)
+
+// RetryPolicy 重试策略：指数退避 + 全抖动
+type RetryPolicy struct {
+	MaxAttempts int           // 最多尝试次数（包含首次请求）
+	BaseDelay   time.Duration // 首次重试前的基础等待时间，之后每次翻倍
+	MaxDelay    time.Duration // 单次等待的上限；服务端要求等待更久时不再重试
+}
+
+// DefaultRetryPolicy AI 和 Google Maps 请求共用的默认重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   300 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// RetryableError 表示可以重试的临时错误，RetryAfter 为服务端通过 Retry-After 要求的等待时间
+type RetryableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable 将错误标记为可重试，retryAfter 为 0 时按退避策略等待
+func Retryable(err error, retryAfter time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err, RetryAfter: retryAfter}
+}
+
+// RetryableStatus 判断 HTTP 状态码是否属于可重试的临时失败
+func RetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// StatusErrorKind 返回上游 HTTP 状态码对应的错误分类，没有对应分类时返回 nil
+func StatusErrorKind(code int) error {
+	switch {
+	case code == http.StatusTooManyRequests, code == http.StatusPaymentRequired:
+		return models.ErrQuotaExhausted
+	case code == http.StatusRequestTimeout, code == http.StatusGatewayTimeout:
+		return models.ErrTimeout
+	case code >= 500:
+		return models.ErrUpstreamUnavailable
+	}
+	return nil
+}
+
+// ParseRetryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期两种格式，无法解析时返回 0
+func ParseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// backoff 计算第 retry 次重试（从 1 开始）前的等待时间：[0, min(MaxDelay, BaseDelay*2^(retry-1))) 内随机
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.BaseDelay << (retry - 1)
+	if ceiling <= 0 || ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// Retry 按策略执行 fn，只有 fn 返回 RetryableError 时才会重试
+// 返回实际重试的次数和最后一次的错误。请求处于 Sentry 事务中时，
+// 会创建 op 为 operation 的子 span 并记录重试次数
+func Retry(ctx context.Context, policy RetryPolicy, logger *Logger, operation string, fn func(ctx context.Context) error) (int, error) {
+	var span *sentry.Span
+	if parent := sentry.SpanFromContext(ctx); parent != nil {
+		span = parent.StartChild(operation)
+		ctx = span.Context()
+	}
+
+	retries := 0
+	finish := func(status sentry.SpanStatus, err error) (int, error) {
+		if span != nil {
+			span.Status = status
+			span.SetData("retries", retries)
+			span.Finish()
+		}
+		if err != nil && retries > 0 {
+			logger.Error("retry_exhausted", "Request failed after retries", err, map[string]interface{}{
+				"operation": operation,
+				"retries":   retries,
+			})
+		}
+		return retries, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return finish(sentry.SpanStatusOK, nil)
+		}
+
+		var retryable *RetryableError
+		if !errors.As(err, &retryable) || attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			return finish(sentry.SpanStatusInternalError, err)
+		}
+
+		delay := policy.backoff(attempt)
+		if retryable.RetryAfter > 0 {
+			if retryable.RetryAfter > policy.MaxDelay {
+				return finish(sentry.SpanStatusResourceExhausted, fmt.Errorf("服务端要求 %v 后重试，超过等待上限: %w", retryable.RetryAfter, err))
+			}
+			delay = retryable.RetryAfter
+		}
+
+		// 等待时间超过请求剩余时间时直接放弃
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return finish(sentry.SpanStatusDeadlineExceeded, err)
+		}
+
+		retries++
+		logger.Info("retry_scheduled", "Transient failure, retrying", map[string]interface{}{
+			"operation": operation,
+			"attempt":   attempt + 1,
+			"delay":     delay.String(),
+			"error":     err.Error(),
+		})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return finish(sentry.SpanStatusCanceled, err)
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    20 * time.Millisecond,
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	attempts := 0
+	retries, err := Retry(context.Background(), testRetryPolicy, SystemLogger(), "test", func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return Retryable(errors.New("503"), 0)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("第三次尝试应该成功: %v", err)
+	}
+	if attempts != 3 || retries != 2 {
+		t.Errorf("应该尝试 3 次、重试 2 次，实际为 %d 次、%d 次", attempts, retries)
+	}
+}
+
+func TestRetryStopsOnPermanentFailure(t *testing.T) {
+	attempts := 0
+	permanent := errors.New("400")
+	retries, err := Retry(context.Background(), testRetryPolicy, SystemLogger(), "test", func(ctx context.Context) error {
+		attempts++
+		return permanent
+	})
+	if !errors.Is(err, permanent) || attempts != 1 || retries != 0 {
+		t.Errorf("不可重试的错误不应该重试: err=%v attempts=%d retries=%d", err, attempts, retries)
+	}
+}
+
+func TestRetryGivesUpWhenRetryAfterTooLong(t *testing.T) {
+	attempts := 0
+	_, err := Retry(context.Background(), testRetryPolicy, SystemLogger(), "test", func(ctx context.Context) error {
+		attempts++
+		return Retryable(errors.New("429"), time.Minute)
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("Retry-After 超过等待上限时应该直接放弃: err=%v attempts=%d", err, attempts)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := ParseRetryAfter("3"); d != 3*time.Second {
+		t.Errorf("秒数格式解析错误: %v", d)
+	}
+	future := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if d := ParseRetryAfter(future); d <= 0 || d > 10*time.Second {
+		t.Errorf("HTTP 日期格式解析错误: %v", d)
+	}
+	if d := ParseRetryAfter("soon"); d != 0 {
+		t.Errorf("无法解析时应该返回 0: %v", d)
+	}
+}
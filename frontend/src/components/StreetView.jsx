@@ -70,7 +70,7 @@ const styles = {
     }
 };
 
-export default function StreetView({ latitude, longitude, onPovChanged }) {
+export default function StreetView({ latitude, longitude, isMock, onPovChanged }) {
     const panoramaRef = useRef(null);
     const panoramaInstanceRef = useRef(null); // 存储街景实例的引用
     const autoRotateRef = useRef(null); // 存储自动旋转定时器的引用
@@ -342,7 +342,8 @@ export default function StreetView({ latitude, longitude, onPovChanged }) {
             }
         };
 
-        if (latitude && longitude) {
+        // 离线模式的合成全景没有街景图像，不加载 Google Maps
+        if (latitude && longitude && !isMock) {
             // 延迟执行以避免与其他地图组件的竞态条件
             timeoutId = setTimeout(() => {
                 if (isMounted) {
@@ -371,7 +372,7 @@ export default function StreetView({ latitude, longitude, onPovChanged }) {
                 cleanup();
             }
         };
-    }, [latitude, longitude, onPovChanged, t]);
+    }, [latitude, longitude, isMock, onPovChanged, t]);
 
     return (
         <div style={styles.container}>
@@ -384,7 +385,17 @@ export default function StreetView({ latitude, longitude, onPovChanged }) {
                 </div>
             )}
             
-            {error && (
+            {isMock && (
+                <div style={styles.errorContainer}>
+                    <div style={styles.errorIcon}>🗺️</div>
+                    <div style={styles.errorText}>{t('streetview.offlinePlaceholder')}</div>
+                    <div style={styles.errorSubText}>
+                        {Number(latitude).toFixed(6)}, {Number(longitude).toFixed(6)}
+                    </div>
+                </div>
+            )}
+
+            {error && !isMock && (
                 <div style={styles.errorContainer}>
                     <div style={styles.errorIcon}>
                         {isNetworkError ? '🌐' : '⚠️'}
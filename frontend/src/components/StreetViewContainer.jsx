@@ -1,12 +1,13 @@
 import React from 'react';
 import StreetView from './StreetView';
 
-export default function StreetViewContainer({ latitude, longitude, onPovChanged }) {
+export default function StreetViewContainer({ latitude, longitude, isMock, onPovChanged }) {
     return (
         <div className="street-view-container">
             <StreetView 
                 latitude={latitude} 
                 longitude={longitude} 
+                isMock={isMock}
                 onPovChanged={onPovChanged}
             />
         </div>
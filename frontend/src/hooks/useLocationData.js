@@ -60,7 +60,11 @@ export default function useLocationData() {
                     pano_id: resp.data.pano_id,
                     formatted_address: resp.data.formatted_address,
                     country: resp.data.country,
-                    city: resp.data.city
+                    city: resp.data.city,
+                    capture_date: resp.data.capture_date,
+                    copyright: resp.data.copyright,
+                    geocode: resp.data.geocode,
+                    is_mock: resp.data.is_mock
                 };
                 
                 setLocation(locationData);
@@ -154,6 +154,7 @@ export default function HomePage() {
                     <StreetViewContainer 
                         latitude={location?.latitude} 
                         longitude={location?.longitude} 
+                        isMock={location?.is_mock}
                         onPovChanged={setHeading}
                     />
                 </div>
@@ -12,6 +12,11 @@ function getCurrentLanguage() {
     return i18n.language || 'en';
 }
 
+// 取出错误说明，后端的错误响应为 { success: false, error: { code, message } }
+function errorMessage(data, fallback) {
+    return data?.error?.message || fallback;
+}
+
 // 带超时的 fetch
 async function fetchWithTimeout(url, options, timeout = DEFAULT_TIMEOUT) {
     // If an external signal is provided in options and it's already aborted, throw immediately.
@@ -82,7 +87,7 @@ export async function getRandomLocation(language = null) {
             success: false,
             data: null,
             message: null,
-            error: data.error || '获取位置失败',
+            error: errorMessage(data, '获取位置失败'),
         };
     } catch (err) {
         return {
@@ -143,7 +148,7 @@ export async function getLocationDescription(panoId, language = null, signal = n
             data: null,
             language: null,
             message: null,
-            error: data.error || '获取描述失败',
+            error: errorMessage(data, '获取描述失败'),
         };
     } catch (err) {
         return {
@@ -174,7 +179,7 @@ export async function setExplorationPreference(interest, language = null) {
         
         return {
             success: data.success,
-            error: data.error,
+            error: errorMessage(data, null),
             message: data.message || '探索偏好设置成功',
         };
     } catch (err) {
@@ -203,7 +208,7 @@ export async function deleteExplorationPreference(language = null) {
         const data = await response.json();
         return {
             success: data.success,
-            error: data.error || data.detail,
+            error: errorMessage(data, data.detail),
             message: data.message || '探索偏好已删除',
         };
     } catch (err) {
@@ -265,7 +270,7 @@ export async function getLocationDetailedDescription(panoId, language = null, si
             data: null,
             language: null,
             message: null,
-            error: data.error || '获取详细介绍失败',
+            error: errorMessage(data, '获取详细介绍失败'),
         };
     } catch (err) {
         return {